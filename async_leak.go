@@ -0,0 +1,116 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"sort"
+	"time"
+)
+
+// PendingInfo describes an asynchronous transition that has been started but
+// has neither completed nor been canceled, as returned by PendingAsync.
+type PendingInfo struct {
+	// ID is the ID of the event that started the transition, see Event.ID.
+	ID uint64
+
+	// Event is the event name.
+	Event string
+
+	// Src is the state before the transition.
+	Src string
+
+	// Dst is the state after the transition.
+	Dst string
+
+	// StartedAt is the time the transition became asynchronous.
+	StartedAt time.Time
+}
+
+// pendingAsync is an asynchronous transition tracked for PendingAsync.
+type pendingAsync struct {
+	info  PendingInfo
+	timer Timer
+	// ttl expires the transition because of WithAsyncTTL.
+	ttl Timer
+}
+
+// WithAsyncLeakDetection calls warn from its own goroutine for every
+// asynchronous transition that is still pending threshold after it was
+// started, to find code paths that forget to call Transition.
+func WithAsyncLeakDetection(threshold time.Duration, warn func(PendingInfo)) Option {
+	return func(f *FSM) {
+		f.leakThreshold = threshold
+		f.leakWarn = warn
+	}
+}
+
+// PendingAsync returns the asynchronous transitions that have been started
+// but have neither completed nor been canceled, in the order they were
+// started.
+func (f *FSM) PendingAsync() []PendingInfo {
+	if !f.initialized() {
+		return nil
+	}
+	f.pendingMu.Lock()
+	defer f.pendingMu.Unlock()
+	pending := make([]PendingInfo, 0, len(f.pendingAsync))
+	for _, p := range f.pendingAsync {
+		pending = append(pending, p.info)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ID < pending[j].ID
+	})
+	return pending
+}
+
+// trackAsync keeps track of the asynchronous transition of e that reached
+// phase.
+func (f *FSM) trackAsync(e *Event, phase asyncPhase) {
+	f.pendingMu.Lock()
+	defer f.pendingMu.Unlock()
+	if phase != asyncStarted {
+		if p, ok := f.pendingAsync[e.ID]; ok {
+			if p.timer != nil {
+				p.timer.Stop()
+			}
+			if p.ttl != nil {
+				p.ttl.Stop()
+			}
+			delete(f.pendingAsync, e.ID)
+		}
+		return
+	}
+
+	if f.pendingAsync == nil {
+		f.pendingAsync = make(map[uint64]*pendingAsync)
+	}
+	p := &pendingAsync{info: PendingInfo{e.ID, e.Event, e.Src, e.Dst, f.clock.Now()}}
+	if f.leakWarn != nil && f.leakThreshold > 0 {
+		p.timer = f.clock.AfterFunc(f.leakThreshold, func() {
+			f.pendingMu.Lock()
+			_, ok := f.pendingAsync[p.info.ID]
+			f.pendingMu.Unlock()
+			if ok {
+				f.leakWarn(p.info)
+			}
+		})
+	}
+	if f.asyncTTL > 0 {
+		p.ttl = f.clock.AfterFunc(f.asyncTTL, func() {
+			f.expireAsync(e)
+		})
+	}
+	f.pendingAsync[e.ID] = p
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPendingAsync(t *testing.T) {
+	warned := make(chan PendingInfo, 1)
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+		WithAsyncLeakDetection(10*time.Millisecond, func(info PendingInfo) {
+			warned <- info
+		}),
+	)
+
+	if len(fsm.PendingAsync()) != 0 {
+		t.Error("expected no pending transitions")
+	}
+	if _, ok := fsm.Event(context.Background(), "open").(AsyncError); !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	pending := fsm.PendingAsync()
+	if len(pending) != 1 || pending[0].Event != "open" || pending[0].Src != "closed" || pending[0].Dst != "open" {
+		t.Fatalf("expected the open transition to be pending, got %+v", pending)
+	}
+
+	select {
+	case info := <-warned:
+		if info.ID != pending[0].ID {
+			t.Errorf("expected warning for %d, got %d", pending[0].ID, info.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a warning for the pending transition")
+	}
+
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(fsm.PendingAsync()) != 0 {
+		t.Error("expected no pending transitions after Transition")
+	}
+}
+
+func TestPendingAsyncCanceled(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+		WithAsyncLeakDetection(10*time.Millisecond, func(info PendingInfo) {
+			t.Errorf("expected no warning, got %+v", info)
+		}),
+	)
+
+	asyncErr, ok := fsm.Event(context.Background(), "open").(AsyncError)
+	if !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	asyncErr.CancelTransition()
+	if len(fsm.PendingAsync()) != 0 {
+		t.Error("expected no pending transitions after cancel")
+	}
+	time.Sleep(20 * time.Millisecond)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// AsyncObserver is an Observer that is also notified of the lifecycle of
+// asynchronous transitions, for example to track the ones that are
+// outstanding and alert on those that never complete. Observers added with
+// AddObserver that implement AsyncObserver are notified automatically.
+type AsyncObserver interface {
+	Observer
+
+	// OnAsyncStarted is called when a leave callback made the transition
+	// asynchronous, before Event returns the AsyncError.
+	OnAsyncStarted(ctx context.Context, info TransitionInfo)
+
+	// OnAsyncCompleted is called when Transition completed the asynchronous
+	// transition, after the after callbacks. info.Err is set if the
+	// transition failed, for example because of a side effect.
+	OnAsyncCompleted(ctx context.Context, info TransitionInfo)
+
+	// OnAsyncCanceled is called when the asynchronous transition is canceled
+	// with AsyncError.CancelTransition before it completed.
+	OnAsyncCanceled(ctx context.Context, info TransitionInfo)
+}
+
+// asyncPhase is a phase of an asynchronous transition that is reported to
+// AsyncObservers.
+type asyncPhase int
+
+const (
+	asyncStarted asyncPhase = iota
+	asyncCompleted
+	asyncCanceled
+)
+
+// asyncCancelFunc wraps the function canceling the asynchronous transition of
+// e, to notify AsyncObservers when it is canceled.
+func (f *FSM) asyncCancelFunc(ctx context.Context, e *Event, cancel context.CancelFunc) context.CancelFunc {
+	return func() {
+		cancel()
+		f.notifyAsync(ctx, e, asyncCanceled)
+	}
+}
+
+// notifyAsync tracks the asynchronous transition of e and notifies the
+// AsyncObservers that it reached phase. Only the first of asyncCompleted and asyncCanceled is
+// reported.
+func (f *FSM) notifyAsync(ctx context.Context, e *Event, phase asyncPhase) {
+	if phase != asyncStarted && !atomic.CompareAndSwapInt32(&e.asyncDone, 0, 1) {
+		return
+	}
+	f.trackAsync(e, phase)
+	observers := f.observersFor()
+	if len(observers) == 0 {
+		return
+	}
+	info := TransitionInfo{
+		ID:       e.ID,
+		Event:    e.Event,
+		Src:      e.Src,
+		Dst:      e.Dst,
+		Args:     e.Args,
+		Err:      e.Err,
+		Duration: f.since(e.StartedAt),
+		Replay:   e.Replay,
+		Tags:     e.Tags,
+
+		SrcDuration: e.SrcDuration,
+	}
+	for _, o := range observers {
+		ao, ok := o.(AsyncObserver)
+		if !ok {
+			continue
+		}
+		switch phase {
+		case asyncStarted:
+			ao.OnAsyncStarted(ctx, info)
+		case asyncCompleted:
+			ao.OnAsyncCompleted(ctx, info)
+		case asyncCanceled:
+			ao.OnAsyncCanceled(ctx, info)
+		}
+	}
+}
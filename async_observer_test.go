@@ -0,0 +1,117 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type asyncRecorder struct {
+	mu     sync.Mutex
+	phases []string
+}
+
+func (r *asyncRecorder) record(phase string, info TransitionInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phases = append(r.phases, phase+" "+info.Event+" "+info.Src+">"+info.Dst)
+}
+
+func (r *asyncRecorder) OnTransition(_ context.Context, info TransitionInfo) {
+	r.record("transition", info)
+}
+
+func (r *asyncRecorder) OnAsyncStarted(_ context.Context, info TransitionInfo) {
+	r.record("started", info)
+}
+
+func (r *asyncRecorder) OnAsyncCompleted(_ context.Context, info TransitionInfo) {
+	r.record("completed", info)
+}
+
+func (r *asyncRecorder) OnAsyncCanceled(_ context.Context, info TransitionInfo) {
+	r.record("canceled", info)
+}
+
+func TestAsyncObserverCompleted(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	r := &asyncRecorder{}
+	fsm.AddObserver(r)
+	asyncErr, ok := fsm.Event(context.Background(), "open").(AsyncError)
+	if !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	asyncErr.CancelTransition()
+
+	expected := []string{
+		"started open closed>open",
+		"transition open closed>open",
+		"completed open closed>open",
+	}
+	if !reflect.DeepEqual(r.phases, expected) {
+		t.Errorf("expected %v, got %v", expected, r.phases)
+	}
+}
+
+func TestAsyncObserverCanceled(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	r := &asyncRecorder{}
+	fsm.AddObserver(r)
+	asyncErr, ok := fsm.Event(context.Background(), "open").(AsyncError)
+	if !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	asyncErr.CancelTransition()
+	asyncErr.CancelTransition()
+	_ = fsm.Transition()
+
+	expected := []string{
+		"started open closed>open",
+		"transition open closed>open",
+		"canceled open closed>open",
+	}
+	if !reflect.DeepEqual(r.phases, expected) {
+		t.Errorf("expected %v, got %v", expected, r.phases)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// WithStrictAsync makes Event.Async panic with an AsyncPhaseError when it is
+// called outside of a leave_<STATE> or leave_state callback, instead of
+// failing the callback. This surfaces the misuse during development.
+func WithStrictAsync() Option {
+	return func(f *FSM) {
+		f.strictAsync = true
+	}
+}
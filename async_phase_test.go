@@ -0,0 +1,125 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAsyncInBeforeCallback(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_open": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	err := fsm.Event(context.Background(), "open")
+	var phaseErr AsyncPhaseError
+	if _, ok := err.(CanceledError); !ok || !errors.As(err, &phaseErr) {
+		t.Fatalf("expected 'CanceledError' with 'AsyncPhaseError', got %v", err)
+	}
+	if phaseErr.Callback != "before_open" {
+		t.Errorf("expected callback before_open, got %s", phaseErr.Callback)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+}
+
+func TestAsyncInEnterCallback(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"enter_state": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	err := fsm.Event(context.Background(), "open")
+	if e, ok := err.(AsyncPhaseError); !ok || e.Callback != "enter_state" {
+		t.Fatalf("expected 'AsyncPhaseError' for enter_state, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+	if err := fsm.Transition(); err == nil {
+		t.Error("expected no transition to be in progress")
+	}
+}
+
+func TestAsyncInLeaveCallback(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+		WithStrictAsync(),
+	)
+	if _, ok := fsm.Event(context.Background(), "open").(AsyncError); !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestAsyncOutsideCallback(t *testing.T) {
+	e := &Event{}
+	e.Async()
+	if _, ok := e.Err.(AsyncPhaseError); !ok {
+		t.Errorf("expected 'AsyncPhaseError', got %v", e.Err)
+	}
+}
+
+func TestStrictAsync(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"after_open": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+		WithStrictAsync(),
+	)
+	defer func() {
+		r := recover()
+		if e, ok := r.(AsyncPhaseError); !ok || e.Callback != "after_open" {
+			t.Errorf("expected panic with 'AsyncPhaseError', got %v", r)
+		}
+	}()
+	_ = fsm.Event(context.Background(), "open")
+	t.Error("expected panic")
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"time"
+)
+
+// AsyncTTLAction is what happens to an asynchronous transition that expires,
+// see WithAsyncTTL.
+type AsyncTTLAction int
+
+const (
+	// AsyncTTLCancel cancels the expired transition like ForceRelease,
+	// leaving the state unchanged.
+	AsyncTTLCancel AsyncTTLAction = iota
+
+	// AsyncTTLComplete completes the expired transition like Transition.
+	AsyncTTLComplete
+)
+
+// WithAsyncTTL limits how long an asynchronous transition can stay pending.
+// An asynchronous transition that has neither completed nor been canceled ttl
+// after it was started, on the clock of the FSM, is canceled or completed as
+// decided by action, so that a forgotten call to Transition does not make
+// every further event fail with an InTransitionError.
+//
+// The expiry waits for the event being processed, if any. A late call to
+// Transition returns a NotInTransitionError.
+func WithAsyncTTL(ttl time.Duration, action AsyncTTLAction) Option {
+	return func(f *FSM) {
+		f.asyncTTL = ttl
+		f.asyncTTLAction = action
+	}
+}
+
+// ForceRelease cancels the pending asynchronous transition, if any, and
+// releases the FSM so that new events can be processed. The context of the
+// transition is canceled and the AsyncObservers are notified as with
+// AsyncError.CancelTransition, and the state is left unchanged. It returns
+// false if no asynchronous transition is pending.
+//
+// ForceRelease waits for the event being processed, if any, so it must not
+// be called from a callback.
+func (f *FSM) ForceRelease() bool {
+	if !f.initialized() {
+		return false
+	}
+	f.eventMu.Lock()
+	e := f.releaseAsync(nil)
+	f.eventMu.Unlock()
+	if e == nil {
+		return false
+	}
+	e.cancelFunc()
+	return true
+}
+
+// releaseAsync clears the pending asynchronous transition if it is the one of
+// e, or any if e is nil, and returns its event. It returns nil if there was
+// none. Callers must hold eventMu.
+func (f *FSM) releaseAsync(e *Event) *Event {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	pending := f.asyncEvent
+	if pending == nil || (e != nil && pending != e) {
+		return nil
+	}
+	f.transition = nil
+	f.asyncEvent = nil
+	f.storeView()
+	return pending
+}
+
+// expireAsync cancels or completes the asynchronous transition of e if it is
+// still pending once its TTL has expired.
+func (f *FSM) expireAsync(e *Event) {
+	f.eventMu.Lock()
+	if f.asyncTTLAction == AsyncTTLComplete {
+		defer f.eventMu.Unlock()
+		f.stateMu.RLock()
+		pending := f.asyncEvent == e
+		f.stateMu.RUnlock()
+		if pending {
+			f.countAsyncCompleted(f.doTransition())
+		}
+		return
+	}
+	released := f.releaseAsync(e)
+	f.eventMu.Unlock()
+	if released != nil {
+		released.cancelFunc()
+	}
+}
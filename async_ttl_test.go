@@ -0,0 +1,205 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestForceRelease(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "lock", Src: []string{"closed"}, Dst: "locked"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				if e.Event == "open" {
+					e.Async()
+				}
+			},
+		},
+	)
+	r := &asyncRecorder{}
+	fsm.AddObserver(r)
+	if fsm.ForceRelease() {
+		t.Error("expected nothing to release")
+	}
+	asyncErr, ok := fsm.Event(context.Background(), "open").(AsyncError)
+	if !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	if _, ok := fsm.Event(context.Background(), "lock").(InTransitionError); !ok {
+		t.Fatal("expected 'InTransitionError'")
+	}
+
+	if !fsm.ForceRelease() {
+		t.Fatal("expected pending transition to be released")
+	}
+	if asyncErr.Ctx.Err() == nil {
+		t.Error("expected context of transition to be canceled")
+	}
+	if _, ok := fsm.Transition().(NotInTransitionError); !ok {
+		t.Error("expected 'NotInTransitionError'")
+	}
+	if err := fsm.Event(context.Background(), "lock"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{
+		"started open closed>open",
+		"transition open closed>open",
+		"transition lock closed>",
+		"canceled open closed>open",
+		"transition lock closed>locked",
+	}
+	if !reflect.DeepEqual(r.phases, expected) {
+		t.Errorf("expected phases %v, got %v", expected, r.phases)
+	}
+}
+
+func TestCanceledAsyncTransitionReleased(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "lock", Src: []string{"closed"}, Dst: "locked"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				if e.Event == "open" {
+					e.Async()
+				}
+			},
+		},
+	)
+	asyncErr, ok := fsm.Event(context.Background(), "open").(AsyncError)
+	if !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	asyncErr.CancelTransition()
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fsm.Event(context.Background(), "lock"); err != nil {
+		t.Errorf("expected canceled transition to be released, got %v", err)
+	}
+}
+
+func TestAsyncTTLCancel(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "lock", Src: []string{"closed"}, Dst: "locked"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				if e.Event == "open" {
+					e.Async()
+				}
+			},
+		},
+		WithClock(clock),
+		WithAsyncTTL(time.Minute, AsyncTTLCancel),
+	)
+	r := &asyncRecorder{}
+	fsm.AddObserver(r)
+	if _, ok := fsm.Event(context.Background(), "open").(AsyncError); !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	clock.Advance(time.Minute)
+	if len(fsm.PendingAsync()) != 0 {
+		t.Error("expected no pending transition")
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+	if r.phases[len(r.phases)-1] != "canceled open closed>open" {
+		t.Errorf("expected transition to be canceled, got %v", r.phases)
+	}
+	if err := fsm.Event(context.Background(), "lock"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestAsyncTTLComplete(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "lock", Src: []string{"closed"}, Dst: "locked"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				if e.Event == "open" {
+					e.Async()
+				}
+			},
+		},
+		WithClock(clock),
+		WithAsyncTTL(time.Minute, AsyncTTLComplete),
+	)
+	r := &asyncRecorder{}
+	fsm.AddObserver(r)
+	if _, ok := fsm.Event(context.Background(), "open").(AsyncError); !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	clock.Advance(time.Minute)
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+	if r.phases[len(r.phases)-1] != "completed open closed>open" {
+		t.Errorf("expected transition to be completed, got %v", r.phases)
+	}
+}
+
+func TestAsyncTTLNotExpired(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "lock", Src: []string{"closed"}, Dst: "locked"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				if e.Event == "open" {
+					e.Async()
+				}
+			},
+		},
+		WithClock(clock),
+		WithAsyncTTL(time.Minute, AsyncTTLCancel),
+	)
+	if _, ok := fsm.Event(context.Background(), "open").(AsyncError); !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(clock.timers) != 0 {
+		t.Errorf("expected TTL timer to be stopped, got %d timers", len(clock.timers))
+	}
+	clock.Advance(time.Minute)
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// EventRequest is an event with its arguments, as applied by EventBatch.
+type EventRequest struct {
+	Event string
+	Args  []interface{}
+}
+
+// EventBatch applies the events of requests one after the other as a unit. If
+// any of them fails, the state and metadata of the FSM are restored to what
+// they were before the batch, including the metadata set by callbacks and the
+// data bound with BindData, and a BatchError with the error of the failed
+// event is returned. The remaining events are not applied.
+//
+// An event that returns a NoTransitionError without an error, for example a
+// self transition, does not fail the batch. Any other error does, including
+// an AsyncError, as the batch can not wait for an asynchronous transition. The
+// asynchronous transition is canceled when the batch is rolled back.
+//
+// Like WithinTx, side effects of callbacks are not rolled back and EventBatch
+// should not be used concurrently with other events on the same FSM.
+func (f *FSM) EventBatch(ctx context.Context, requests []EventRequest) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	snapshot := f.takeSnapshot()
+	for i, r := range requests {
+		err := f.Event(ctx, r.Event, r.Args...)
+		if e, ok := err.(NoTransitionError); ok && e.Err == nil {
+			continue
+		}
+		if err != nil {
+			f.restoreSnapshot(snapshot)
+			return BatchError{i, r.Event, err}
+		}
+	}
+	return nil
+}
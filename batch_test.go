@@ -0,0 +1,130 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEventBatch(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "checkout", Src: []string{"cart"}, Dst: "pending"},
+			{Name: "touch", Src: []string{"pending"}, Dst: "pending"},
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{
+			"enter_pending": func(_ context.Context, e *Event) {
+				e.FSM.SetMetadata("order", 1)
+			},
+			"before_pay": func(_ context.Context, e *Event) {
+				if len(e.Args) > 0 {
+					e.Cancel(e.Args[0].(error))
+				}
+			},
+		},
+	)
+	err := fsm.EventBatch(context.Background(), []EventRequest{
+		{Event: "checkout"},
+		{Event: "touch"},
+		{Event: "pay"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+	if _, ok := fsm.Metadata("order"); !ok {
+		t.Error("expected metadata to be kept")
+	}
+}
+
+func TestEventBatchRollback(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "checkout", Src: []string{"cart"}, Dst: "pending"},
+			{Name: "touch", Src: []string{"pending"}, Dst: "pending"},
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{
+			"enter_pending": func(_ context.Context, e *Event) {
+				e.FSM.SetMetadata("order", 1)
+			},
+			"before_pay": func(_ context.Context, e *Event) {
+				if len(e.Args) > 0 {
+					e.Cancel(e.Args[0].(error))
+				}
+			},
+		},
+	)
+	declined := errors.New("card declined")
+	err := fsm.EventBatch(context.Background(), []EventRequest{
+		{Event: "checkout"},
+		{Event: "pay", Args: []interface{}{declined}},
+		{Event: "pay"},
+	})
+	var batchErr BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected 'BatchError', got %v", err)
+	}
+	if batchErr.Index != 1 || batchErr.Event != "pay" {
+		t.Errorf("expected event 1 (pay) to fail, got %d (%s)", batchErr.Index, batchErr.Event)
+	}
+	if !errors.Is(err, declined) {
+		t.Errorf("expected error to wrap the cancel error, got %v", err)
+	}
+	if fsm.Current() != "cart" {
+		t.Errorf("expected state to be rolled back to 'cart', got %s", fsm.Current())
+	}
+	if _, ok := fsm.Metadata("order"); ok {
+		t.Error("expected metadata to be rolled back")
+	}
+}
+
+func TestEventBatchRollbackAsync(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "checkout", Src: []string{"cart"}, Dst: "pending"},
+		},
+		Callbacks{
+			"leave_cart": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	err := fsm.EventBatch(context.Background(), []EventRequest{{Event: "checkout"}})
+	var batchErr BatchError
+	if !errors.As(err, &batchErr) || !errors.As(err, &AsyncError{}) {
+		t.Fatalf("expected 'BatchError' wrapping 'AsyncError', got %v", err)
+	}
+	if pending := fsm.PendingAsync(); len(pending) != 0 {
+		t.Errorf("expected no pending asynchronous transitions, got %v", pending)
+	}
+	if s := fsm.Stats(); s.AsyncStarted != 0 || s.Canceled != 1 {
+		t.Errorf("expected the asynchronous transition to be counted as canceled, got %+v", s)
+	}
+	if _, ok := fsm.Transition().(NotInTransitionError); !ok {
+		t.Error("expected 'NotInTransitionError'")
+	}
+	if fsm.Current() != "cart" || !fsm.Can("checkout") {
+		t.Errorf("expected state to be 'cart', got %s", fsm.Current())
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// callbackContext hides the context keys that only configure how an event is
+// processed, like the expected source state of EventIf, from the callbacks.
+// Otherwise an event sent from a callback with its context would be processed
+// like the event of the callback.
+type callbackContext struct {
+	context.Context
+}
+
+func (c callbackContext) Value(key interface{}) interface{} {
+	switch key.(type) {
+	case expectedSrcKey, lockModeKey, retryKey, redeliveryKey, rateLimitKey:
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+// withoutEventKeys returns ctx without the keys hidden by callbackContext. ctx
+// is returned as is if it has none of them, so that events sent without them
+// do not allocate.
+func withoutEventKeys(ctx context.Context) context.Context {
+	if ctx.Value(expectedSrcKey{}) == nil && ctx.Value(lockModeKey{}) == nil && ctx.Value(retryKey{}) == nil &&
+		ctx.Value(redeliveryKey{}) == nil && ctx.Value(rateLimitKey{}) == nil {
+		return ctx
+	}
+	return callbackContext{ctx}
+}
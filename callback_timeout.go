@@ -0,0 +1,111 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// CallbackTimeouts are the maximum durations of the callbacks of each kind.
+// A zero duration means no timeout.
+type CallbackTimeouts struct {
+	Before time.Duration
+	Leave  time.Duration
+	Enter  time.Duration
+	After  time.Duration
+}
+
+// WithCallbackTimeout limits the duration of every callback, see
+// WithCallbackTimeouts.
+func WithCallbackTimeout(timeout time.Duration) Option {
+	return WithCallbackTimeouts(CallbackTimeouts{timeout, timeout, timeout, timeout})
+}
+
+// WithCallbackTimeouts limits the duration of the callbacks of each kind, to
+// protect the FSM from a callback that hangs.
+//
+// When a callback runs longer than its timeout its context is canceled and
+// the callback fails with a CallbackTimeoutError: a before_ or leave_ callback
+// cancels the transition and Event returns a CanceledError wrapping it, an
+// enter_ or after_ callback makes Event return it after the state has changed.
+//
+// The callback is not waited for after the timeout, so it must stop using the
+// Event once its context is done. A deterministic FSM waits for it instead,
+// see WithDeterministic.
+func WithCallbackTimeouts(timeouts CallbackTimeouts) Option {
+	return func(f *FSM) {
+		f.callbackTimeouts = timeouts
+	}
+}
+
+// forType returns the timeout of a callback type.
+func (t CallbackTimeouts) forType(callbackType int) time.Duration {
+	switch callbackType {
+	case callbackBeforeEvent:
+		return t.Before
+	case callbackLeaveState:
+		return t.Leave
+	case callbackEnterState:
+		return t.Enter
+	case callbackAfterEvent:
+		return t.After
+	}
+	return 0
+}
+
+// withCallbackTimeout wraps the callback fn bound to key so that it fails with
+// a CallbackTimeoutError if it runs longer than timeout. A panic in fn is
+// passed on to the caller.
+func withCallbackTimeout(key cKey, fn Callback, timeout time.Duration) Callback {
+	return func(ctx context.Context, e *Event) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		done := make(chan interface{}, 1)
+		go callTimed(ctx, e, fn, done)
+
+		select {
+		case r := <-done:
+			if r != nil {
+				panic(r)
+			}
+		case <-ctx.Done():
+			if ctx.Err() != context.DeadlineExceeded {
+				// The caller canceled the context, so it is up to the
+				// callback to return.
+				if r := <-done; r != nil {
+					panic(r)
+				}
+				return
+			}
+			callbackFailed(e, key.callbackType, CallbackTimeoutError{key.String(), timeout})
+		}
+	}
+}
+
+// callTimed calls the callback fn of withCallbackTimeout on its own goroutine,
+// and sends the value of its panic, or nil, to done.
+func callTimed(ctx context.Context, e *Event, fn Callback, done chan<- interface{}) {
+	panicked := true
+	defer func() {
+		if panicked {
+			done <- recover()
+		}
+	}()
+	fn(ctx, e)
+	panicked = false
+	done <- nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallbackTimeoutLeave(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(ctx context.Context, e *Event) {
+				select {
+				case <-ctx.Done():
+				case <-release:
+				}
+			},
+		},
+		WithCallbackTimeouts(CallbackTimeouts{Leave: 10 * time.Millisecond}),
+	)
+
+	err := fsm.Event(context.Background(), "open")
+	var timeoutErr CallbackTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected CallbackTimeoutError, got %v", err)
+	}
+	if _, ok := err.(CanceledError); !ok {
+		t.Errorf("expected CanceledError, got %T", err)
+	}
+	if timeoutErr.Callback != "leave_closed" || timeoutErr.Timeout != 10*time.Millisecond {
+		t.Errorf("unexpected timeout error %+v", timeoutErr)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+}
+
+func TestCallbackTimeoutEnter(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(ctx context.Context, e *Event) {
+				<-ctx.Done()
+			},
+		},
+		WithCallbackTimeout(10*time.Millisecond),
+	)
+
+	err := fsm.Event(context.Background(), "open")
+	if _, ok := err.(CallbackTimeoutError); !ok {
+		t.Fatalf("expected CallbackTimeoutError, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+	if err := fsm.Event(context.Background(), "close"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestCallbackTimeoutNotReached(t *testing.T) {
+	called := false
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_open": func(ctx context.Context, e *Event) {
+				called = true
+			},
+		},
+		WithCallbackTimeout(time.Second),
+	)
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !called {
+		t.Error("expected callback to be called")
+	}
+}
+
+func TestCallbackTimeoutPanic(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_open": func(ctx context.Context, e *Event) {
+				panic("boom")
+			},
+		},
+		WithCallbackTimeout(time.Second),
+		WithRecoverCallbacks(),
+	)
+
+	err := fsm.Event(context.Background(), "open")
+	var panicErr CallbackPanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Errorf("expected CallbackPanicError, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// CallbackWithErr is a callback that can return an error. Event is the current
+// event info as the callback happens.
+//
+// An error returned from a before_ or leave_ callback cancels the transition,
+// like calling Event.Cancel with the error, and Event returns a CanceledError
+// wrapping it. An error returned from an enter_ or after_ callback can not stop
+// the transition anymore; it is stored in Event.Err and returned by Event.
+type CallbackWithErr func(context.Context, *Event) error
+
+// CallbacksWithErr is a shorthand for defining error returning callbacks with
+// WithErrCallbacks.
+type CallbacksWithErr map[string]CallbackWithErr
+
+// NewFSMWithErrCallbacks constructs a FSM like NewFSM, with errCallbacks as
+// additional callbacks that return errors, see CallbackWithErr for how their
+// errors are handled. The keys of errCallbacks are parsed in the same way as
+// those of callbacks. If the same key is used in both maps the error returning
+// callback is used.
+func NewFSMWithErrCallbacks(initial string, events []EventDesc, callbacks map[string]Callback, errCallbacks map[string]CallbackWithErr, opts ...Option) *FSM {
+	return NewFSM(initial, events, callbacks, append([]Option{WithErrCallbacks(errCallbacks)}, opts...)...)
+}
+
+// WithErrCallbacks adds callbacks that return errors. The keys are parsed in
+// the same way as the callbacks passed to NewFSM. If the same key is used for
+// both kinds of callbacks the error returning callback is used.
+func WithErrCallbacks(callbacks CallbacksWithErr) Option {
+	return func(f *FSM) {
+		if f.errCallbacks == nil {
+			f.errCallbacks = make(CallbacksWithErr)
+		}
+		for name, fn := range callbacks {
+			f.errCallbacks[name] = fn
+		}
+	}
+}
+
+// callback converts fn into a Callback for the given callback type.
+func (fn CallbackWithErr) callback(callbackType int) Callback {
+	return func(ctx context.Context, e *Event) {
+		if err := fn(ctx, e); err != nil {
+			callbackFailed(e, callbackType, err)
+		}
+	}
+}
+
+// callbackFailed handles the error of a callback of the given type. Before and
+// leave callbacks cancel the transition, enter and after callbacks store the
+// error in e.Err.
+func callbackFailed(e *Event, callbackType int, err error) {
+	switch callbackType {
+	case callbackBeforeEvent, callbackLeaveState:
+		e.Cancel(err)
+	default:
+		e.Err = err
+	}
+}
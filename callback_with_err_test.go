@@ -0,0 +1,138 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestErrCallbackCancels(t *testing.T) {
+	for _, key := range []string{"before_run", "before_event", "leave_start", "leave_state"} {
+		cbErr := errors.New("not allowed")
+		fsm := NewFSM(
+			"start",
+			Events{
+				{Name: "run", Src: []string{"start"}, Dst: "end"},
+			},
+			Callbacks{},
+			WithErrCallbacks(CallbacksWithErr{
+				key: func(_ context.Context, e *Event) error {
+					return cbErr
+				},
+			}),
+		)
+		err := fsm.Event(context.Background(), "run")
+		if e, ok := err.(CanceledError); !ok || e.Err != cbErr {
+			t.Errorf("%s: expected 'CanceledError' with callback error, got %v", key, err)
+		}
+		if fsm.Current() != "start" {
+			t.Errorf("%s: expected state to be 'start', was '%s'", key, fsm.Current())
+		}
+	}
+}
+
+func TestErrCallbackAfterTransition(t *testing.T) {
+	for _, key := range []string{"enter_end", "enter_state", "after_run", "after_event", "end", "run"} {
+		cbErr := errors.New("notification failed")
+		fsm := NewFSM(
+			"start",
+			Events{
+				{Name: "run", Src: []string{"start"}, Dst: "end"},
+			},
+			Callbacks{},
+			WithErrCallbacks(CallbacksWithErr{
+				key: func(_ context.Context, e *Event) error {
+					return cbErr
+				},
+			}),
+		)
+		err := fsm.Event(context.Background(), "run")
+		if err != cbErr {
+			t.Errorf("%s: expected callback error, got %v", key, err)
+		}
+		if fsm.Current() != "end" {
+			t.Errorf("%s: expected state to be 'end', was '%s'", key, fsm.Current())
+		}
+	}
+}
+
+func TestErrCallbackNoError(t *testing.T) {
+	var called, plainCalled bool
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{
+			"leave_state": func(_ context.Context, e *Event) {
+				plainCalled = true
+			},
+		},
+		WithErrCallbacks(CallbacksWithErr{
+			"before_run": func(_ context.Context, e *Event) error {
+				called = true
+				return nil
+			},
+		}),
+	)
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if !(called && plainCalled) {
+		t.Error("expected both kinds of callbacks to be called")
+	}
+}
+
+func TestNewFSMWithErrCallbacks(t *testing.T) {
+	var plainCalled bool
+	deny := true
+	notifyErr := errors.New("notification failed")
+	fsm := NewFSMWithErrCallbacks(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{
+			"enter_state": func(_ context.Context, e *Event) {
+				plainCalled = true
+			},
+		},
+		CallbacksWithErr{
+			"leave_start": func(_ context.Context, e *Event) error {
+				if deny {
+					return errors.New("not allowed")
+				}
+				return nil
+			},
+			"enter_end": func(_ context.Context, e *Event) error {
+				return notifyErr
+			},
+		},
+		WithFinalStates("end"),
+	)
+
+	if _, ok := fsm.Event(context.Background(), "run").(CanceledError); !ok || fsm.Current() != "start" {
+		t.Errorf("expected 'CanceledError' in state 'start', got state %s", fsm.Current())
+	}
+	deny = false
+	if err := fsm.Event(context.Background(), "run"); err != notifyErr {
+		t.Errorf("expected the error of enter_end, got %v", err)
+	}
+	if !fsm.IsCompleted() || !plainCalled {
+		t.Error("expected the transition to complete and call the plain callbacks")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"sort"
+	"strings"
+)
+
+// MergeCallbacks merges several callback maps into a single map that can be
+// passed to NewFSM. This is useful when a machine is assembled from callbacks
+// defined by different modules or features.
+//
+// The maps are merged in the given order, and the keys of each map in sorted
+// order. If a key is present in more than one map, or a key and its short form
+// are both present, like "enter_open" and "open", a DuplicateCallbackError is
+// returned for the first conflicting key, as only one callback can be bound to
+// each key in Callbacks. As MergeCallbacks does not know whether "open" is a
+// state or an event, it conflicts with both "enter_open" and "after_open". Use
+// WithCallbacks to bind several callbacks to the same key.
+func MergeCallbacks(maps ...Callbacks) (Callbacks, error) {
+	merged := make(Callbacks)
+	for _, m := range maps {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, alias := range callbackAliases(key) {
+				if _, ok := merged[alias]; ok {
+					return nil, DuplicateCallbackError{key}
+				}
+			}
+			merged[key] = m[key]
+		}
+	}
+	return merged, nil
+}
+
+// callbackAliases returns key and the other keys that may bind a callback to
+// the same target: the short form "open" binds enter_open if open is a state
+// and after_open if it is an event. The long forms of the states named "state"
+// and the events named "event" are the general callbacks instead.
+func callbackAliases(key string) []string {
+	for _, prefix := range []string{"before_", "leave_", "enter_", "after_"} {
+		target := strings.TrimPrefix(key, prefix)
+		if target == key {
+			continue
+		}
+		if (prefix == "enter_" && target != "state") || (prefix == "after_" && target != "event") {
+			return []string{key, target}
+		}
+		return []string{key}
+	}
+	aliases := []string{key}
+	if key != "state" {
+		aliases = append(aliases, "enter_"+key)
+	}
+	if key != "event" {
+		aliases = append(aliases, "after_"+key)
+	}
+	return aliases
+}
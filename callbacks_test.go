@@ -0,0 +1,117 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMergeCallbacks(t *testing.T) {
+	var enterState, afterRun bool
+	callbacks, err := MergeCallbacks(
+		Callbacks{
+			"enter_state": func(_ context.Context, e *Event) {
+				enterState = true
+			},
+		},
+		Callbacks{
+			"after_run": func(_ context.Context, e *Event) {
+				afterRun = true
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(callbacks) != 2 {
+		t.Errorf("expected 2 callbacks, got %d", len(callbacks))
+	}
+
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		callbacks,
+	)
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if !(enterState && afterRun) {
+		t.Error("expected all merged callbacks to be called")
+	}
+}
+
+func TestMergeCallbacksConflict(t *testing.T) {
+	noop := func(_ context.Context, e *Event) {}
+	_, err := MergeCallbacks(
+		Callbacks{"enter_state": noop},
+		Callbacks{"leave_state": noop},
+		Callbacks{"enter_state": noop},
+	)
+	if e, ok := err.(DuplicateCallbackError); !ok || e.Key != "enter_state" {
+		t.Errorf("expected 'DuplicateCallbackError' for enter_state, got %v", err)
+	}
+}
+
+func TestMergeCallbacksEmpty(t *testing.T) {
+	callbacks, err := MergeCallbacks()
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if callbacks == nil || len(callbacks) != 0 {
+		t.Error("expected an empty callbacks map")
+	}
+}
+
+func TestMergeCallbacksAlias(t *testing.T) {
+	noop := func(_ context.Context, e *Event) {}
+	tests := []struct {
+		maps []Callbacks
+		key  string
+	}{
+		{[]Callbacks{{"enter_open": noop}, {"open": noop}}, "open"},
+		{[]Callbacks{{"open": noop}, {"enter_open": noop}}, "enter_open"},
+		{[]Callbacks{{"after_run": noop}, {"run": noop}}, "run"},
+		{[]Callbacks{{"open": noop, "enter_open": noop}}, "open"},
+		{[]Callbacks{{"leave_open": noop, "before_open": noop}, {"enter_state": noop, "state": noop, "after_event": noop, "event": noop}}, ""},
+	}
+	for _, tt := range tests {
+		_, err := MergeCallbacks(tt.maps...)
+		if tt.key == "" {
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			continue
+		}
+		if e, ok := err.(DuplicateCallbackError); !ok || e.Key != tt.key {
+			t.Errorf("expected 'DuplicateCallbackError' for %s, got %v", tt.key, err)
+		}
+	}
+}
+
+func TestMergeCallbacksDeterministic(t *testing.T) {
+	noop := func(_ context.Context, e *Event) {}
+	for i := 0; i < 20; i++ {
+		_, err := MergeCallbacks(
+			Callbacks{"enter_a": noop, "enter_b": noop, "enter_c": noop},
+			Callbacks{"enter_c": noop, "enter_b": noop, "enter_a": noop},
+		)
+		if e, ok := err.(DuplicateCallbackError); !ok || e.Key != "enter_a" {
+			t.Fatalf("expected 'DuplicateCallbackError' for enter_a, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// ChainPolicy is how a chain of events, where callbacks trigger further
+// events with the context they were given, handles the cancellation of the
+// context of the event that started it.
+type ChainPolicy int
+
+const (
+	// AbortChain cancels the event being processed, as with any canceled
+	// context, and aborts the remaining events of the chain.
+	AbortChain ChainPolicy = iota + 1
+	// CompleteHop completes the event being processed but aborts the
+	// remaining events of the chain.
+	CompleteHop
+	// ContinueChain completes the chain as if the context had not been
+	// canceled.
+	ContinueChain
+)
+
+// ChainHop is an event of a chain.
+type ChainHop struct {
+	Event string
+	Err   error
+	// Aborted is true if the event was not processed because the chain
+	// was canceled.
+	Aborted bool
+}
+
+// ChainResult is what happened to a chain of events started with
+// EventChain.
+type ChainResult struct {
+	// Hops are the events of the chain in the order they were triggered,
+	// starting with the event passed to EventChain.
+	Hops []ChainHop
+	// Canceled is true if the context passed to EventChain was canceled
+	// before the chain completed.
+	Canceled bool
+}
+
+// chainKey is the context key for the chain of an event.
+type chainKey struct{}
+
+// chain tracks the events of a chain.
+type chain struct {
+	// ctx is the context of the event that started the chain.
+	ctx    context.Context
+	policy ChainPolicy
+
+	mu   sync.Mutex
+	hops []ChainHop
+}
+
+// WithChainPolicy sets how the chains of events handle the cancellation of
+// the context of the event that started them. By default the events of a
+// chain are not tracked and each of them handles the canceled context on its
+// own, which usually means that they fail when changing the state.
+func WithChainPolicy(policy ChainPolicy) Option {
+	return func(f *FSM) {
+		f.chainPolicy = policy
+	}
+}
+
+// EventChain initiates a state transition with the named event like Event,
+// and returns what happened to the chain of events triggered by its
+// callbacks, with the policy set by WithChainPolicy or AbortChain. Events
+// triggered on other FSMs with the context of the callbacks are part of the
+// chain too.
+func (f *FSM) EventChain(ctx context.Context, event string, args ...interface{}) (ChainResult, error) {
+	if !f.initialized() {
+		return ChainResult{}, NotInitializedError{}
+	}
+	policy := f.chainPolicy
+	if policy == 0 {
+		policy = AbortChain
+	}
+	return f.eventChain(ctx, policy, event, args)
+}
+
+// eventChain starts a chain with the event.
+func (f *FSM) eventChain(ctx context.Context, policy ChainPolicy, event string, args []interface{}) (ChainResult, error) {
+	c := &chain{ctx: ctx, policy: policy}
+	hopCtx := ctx
+	if policy != AbortChain {
+		var cancel context.CancelFunc
+		hopCtx, cancel = uncancelContext(ctx)
+		defer cancel()
+	}
+	err := c.event(context.WithValue(hopCtx, chainKey{}, c), f, event, args)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := ChainResult{
+		Hops:     make([]ChainHop, len(c.hops)),
+		Canceled: ctx.Err() != nil,
+	}
+	copy(result.Hops, c.hops)
+	return result, err
+}
+
+// event processes an event of the chain, unless the chain has been canceled.
+func (c *chain) event(ctx context.Context, f *FSM, event string, args []interface{}) error {
+	c.mu.Lock()
+	i := len(c.hops)
+	c.hops = append(c.hops, ChainHop{Event: event})
+	if i > 0 && c.policy != ContinueChain && c.ctx.Err() != nil {
+		c.hops[i].Err, c.hops[i].Aborted = c.ctx.Err(), true
+		c.mu.Unlock()
+		return c.ctx.Err()
+	}
+	c.mu.Unlock()
+
+	err := f.processEvent(ctx, event, args)
+
+	c.mu.Lock()
+	c.hops[i].Err = err
+	c.mu.Unlock()
+	return err
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestEventChain(t *testing.T) {
+	tests := []struct {
+		policy   ChainPolicy
+		state    string
+		expected []ChainHop
+	}{
+		{
+			AbortChain,
+			"b",
+			[]ChainHop{{Event: "go1"}, {Event: "go2", Err: context.Canceled}},
+		},
+		{
+			CompleteHop,
+			"c",
+			[]ChainHop{{Event: "go1"}, {Event: "go2"}, {Event: "go3", Err: context.Canceled, Aborted: true}},
+		},
+		{
+			ContinueChain,
+			"d",
+			[]ChainHop{{Event: "go1"}, {Event: "go2"}, {Event: "go3"}},
+		},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		var fsm *FSM
+		fsm = NewFSM(
+			"a",
+			Events{
+				{Name: "go1", Src: []string{"a"}, Dst: "b"},
+				{Name: "go2", Src: []string{"b"}, Dst: "c"},
+				{Name: "go3", Src: []string{"c"}, Dst: "d"},
+			},
+			Callbacks{
+				"enter_b": func(ctx context.Context, e *Event) {
+					_ = fsm.Event(ctx, "go2")
+				},
+				"before_go2": func(ctx context.Context, e *Event) {
+					cancel()
+				},
+				"enter_c": func(ctx context.Context, e *Event) {
+					_ = fsm.Event(ctx, "go3")
+				},
+			},
+			WithChainPolicy(test.policy),
+		)
+
+		result, err := fsm.EventChain(ctx, "go1")
+		if err != nil {
+			t.Errorf("expected no error for the first event, got %v", err)
+		}
+		if fsm.Current() != test.state {
+			t.Errorf("expected state %s with policy %d, got %s", test.state, test.policy, fsm.Current())
+		}
+		if !result.Canceled {
+			t.Error("expected chain to be canceled")
+		}
+		if !reflect.DeepEqual(result.Hops, test.expected) {
+			t.Errorf("expected hops %+v with policy %d, got %+v", test.expected, test.policy, result.Hops)
+		}
+	}
+}
+
+func TestEventChainPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var fsm *FSM
+	fsm = NewFSM(
+		"a",
+		Events{
+			{Name: "go1", Src: []string{"a"}, Dst: "b"},
+			{Name: "go2", Src: []string{"b"}, Dst: "c"},
+			{Name: "go3", Src: []string{"c"}, Dst: "d"},
+		},
+		Callbacks{
+			"enter_b": func(ctx context.Context, e *Event) {
+				_ = fsm.Event(ctx, "go2")
+			},
+			"before_go2": func(ctx context.Context, e *Event) {
+				cancel()
+			},
+			"enter_c": func(ctx context.Context, e *Event) {
+				_ = fsm.Event(ctx, "go3")
+			},
+		},
+		WithChainPolicy(ContinueChain),
+	)
+	if err := fsm.Event(ctx, "go1"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "d" {
+		t.Errorf("expected chain to continue, got %s", fsm.Current())
+	}
+}
+
+func TestEventChainDefault(t *testing.T) {
+	var fsm *FSM
+	fsm = NewFSM(
+		"a",
+		Events{
+			{Name: "go1", Src: []string{"a"}, Dst: "b"},
+			{Name: "go2", Src: []string{"b"}, Dst: "c"},
+			{Name: "go3", Src: []string{"c"}, Dst: "d"},
+		},
+		Callbacks{
+			"enter_b": func(ctx context.Context, e *Event) {
+				_ = fsm.Event(ctx, "go2")
+			},
+			"enter_c": func(ctx context.Context, e *Event) {
+				_ = fsm.Event(ctx, "go3")
+			},
+		},
+	)
+	result, err := fsm.EventChain(context.Background(), "go1")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(result.Hops) != 3 || result.Canceled || fsm.Current() != "d" {
+		t.Errorf("expected complete chain, got %+v in state %s", result, fsm.Current())
+	}
+}
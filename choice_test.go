@@ -0,0 +1,91 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChoiceDefaultDestination(t *testing.T) {
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{Name: "submit", Src: []string{"draft"}, Dst: "approved", Choice: func(_ context.Context, e *Event) string {
+				if len(e.Args) > 0 && e.Args[0].(int) > 100 {
+					return "needs_review"
+				}
+				return ""
+			}},
+			{Name: "approve", Src: []string{"needs_review"}, Dst: "approved"},
+		},
+		Callbacks{},
+	)
+	if err := fsm.Event(context.Background(), "submit", 10); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "approved" {
+		t.Errorf("expected state to be 'approved', was '%s'", fsm.Current())
+	}
+}
+
+func TestChoiceBranch(t *testing.T) {
+	var dsts []string
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{Name: "submit", Src: []string{"draft"}, Dst: "approved", Choice: func(_ context.Context, e *Event) string {
+				if len(e.Args) > 0 && e.Args[0].(int) > 100 {
+					return "needs_review"
+				}
+				return ""
+			}},
+			{Name: "approve", Src: []string{"needs_review"}, Dst: "approved"},
+		},
+		Callbacks{
+			"before_submit": func(_ context.Context, e *Event) {
+				dsts = append(dsts, e.Dst)
+			},
+			"enter_needs_review": func(_ context.Context, e *Event) {
+				dsts = append(dsts, e.Dst)
+			},
+		},
+	)
+	if err := fsm.Event(context.Background(), "submit", 1000); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "needs_review" {
+		t.Errorf("expected state to be 'needs_review', was '%s'", fsm.Current())
+	}
+	if len(dsts) != 2 || dsts[0] != "needs_review" || dsts[1] != "needs_review" {
+		t.Errorf("expected callbacks to see the chosen destination, got %v", dsts)
+	}
+}
+
+func TestChoiceSameState(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end", Choice: func(_ context.Context, e *Event) string {
+				return "start"
+			}},
+		},
+		Callbacks{},
+	)
+	err := fsm.Event(context.Background(), "run")
+	if _, ok := err.(NoTransitionError); !ok {
+		t.Errorf("expected 'NoTransitionError', got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"time"
+)
+
+// Clock tells the time and runs the timers of the time-based features of a
+// FSM, like state timeouts, delayed and periodic events and the durations
+// reported to observers, so that they can be controlled in tests. See
+// fsmtest.FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for d to elapse and then sends the current time on the
+	// returned channel, like time.After.
+	After(d time.Duration) <-chan time.Time
+
+	// NewTimer creates a Timer that sends the current time on its channel
+	// after d, like time.NewTimer.
+	NewTimer(d time.Duration) Timer
+
+	// AfterFunc calls fn in its own goroutine once d has elapsed, like
+	// time.AfterFunc. The channel of the returned Timer is nil.
+	AfterFunc(d time.Duration, fn func()) Timer
+}
+
+// Timer is a timer started by a Clock, like time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false if the timer
+	// has already fired or been stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after d. It returns true if the timer
+	// had been active.
+	Reset(d time.Duration) bool
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+// Now returns time.Now().
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// After returns time.After(d).
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewTimer returns time.NewTimer(d).
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// AfterFunc returns time.AfterFunc(d, fn).
+func (realClock) AfterFunc(d time.Duration, fn func()) Timer {
+	return realTimer{time.AfterFunc(d, fn)}
+}
+
+// realTimer is the Timer of the time package.
+type realTimer struct {
+	*time.Timer
+}
+
+// C returns the channel of the timer.
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// WithClock sets the clock used by the time-based features of the FSM. By
+// default the clock of the time package is used. Callback timeouts are
+// context deadlines and always use the real time.
+func WithClock(clock Clock) Option {
+	return func(f *FSM) {
+		f.clock = clock
+	}
+}
+
+// since returns the time elapsed since t on the clock of the FSM.
+func (f *FSM) since(t time.Time) time.Duration {
+	return f.clock.Now().Sub(t)
+}
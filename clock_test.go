@@ -0,0 +1,167 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock whose timers only fire when it is advanced, like
+// fsmtest.FakeClock which can not be used by the tests of this package.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	clock    *manualClock
+	deadline time.Time
+	fn       func()
+	c        chan time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *manualClock) NewTimer(d time.Duration) Timer {
+	return c.add(d, nil, make(chan time.Time, 1))
+}
+
+func (c *manualClock) AfterFunc(d time.Duration, fn func()) Timer {
+	return c.add(d, fn, nil)
+}
+
+func (c *manualClock) add(d time.Duration, fn func(), ch chan time.Time) *manualTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{c, c.now.Add(d), fn, ch}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the time forward by d and fires the timers that are due, in
+// the order of their deadlines.
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		next := -1
+		for i, t := range c.timers {
+			if !t.deadline.After(target) && (next < 0 || t.deadline.Before(c.timers[next].deadline)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		t := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		c.now = t.deadline
+		c.mu.Unlock()
+		if t.fn != nil {
+			t.fn()
+		} else {
+			t.c <- t.deadline
+		}
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.deadline = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	return active
+}
+
+func TestRealClock(t *testing.T) {
+	var clock Clock = realClock{}
+	if clock.Now().IsZero() {
+		t.Error("expected current time")
+	}
+	timer := clock.NewTimer(time.Hour)
+	if !timer.Stop() {
+		t.Error("expected timer to be active")
+	}
+	if timer.Reset(time.Millisecond) {
+		t.Error("expected stopped timer to be inactive")
+	}
+	<-timer.C()
+	<-clock.After(time.Millisecond)
+	if clock.AfterFunc(time.Hour, func() {}).C() != nil {
+		t.Error("expected no channel for AfterFunc timers")
+	}
+}
+
+func TestClockDurations(t *testing.T) {
+	clock := &manualClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(context.Context, *Event) {
+				clock.Advance(time.Second)
+			},
+		},
+		WithClock(clock),
+	)
+
+	var info TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, i TransitionInfo) {
+		info = i
+	}))
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Duration != time.Second {
+		t.Errorf("expected duration of 1s on the clock, got %v", info.Duration)
+	}
+	if !fsm.State().EnteredAt.Equal(clock.Now()) {
+		t.Errorf("expected state to be entered at %v, got %v", clock.Now(), fsm.State().EnteredAt)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// WithCompensations sets compensating events, keyed by the event they undo.
+// When a callback calls Event.Cancel in an enter_ or after_ callback of an
+// event with a compensating event, the compensating event is triggered with
+// the same arguments once the transition is done, for example "refund" for
+// "pay".
+//
+// Event returns a CanceledError wrapping the error passed to Cancel if the
+// compensating event succeeded, or the error of the compensating event if it
+// failed. Without a compensating event Event returns a LateCancelError.
+func WithCompensations(compensations map[string]string) Option {
+	return func(f *FSM) {
+		f.compensations = compensations
+	}
+}
+
+// compensate triggers the compensating event of e after it was canceled late,
+// and returns the error that Event should return instead of err.
+func (f *FSM) compensate(ctx context.Context, e *Event, err error) error {
+	event, ok := f.compensations[e.Event]
+	if !ok {
+		return err
+	}
+	if err := f.Event(ctx, event, e.Args...); err != nil {
+		return err
+	}
+	return CanceledError{e.lateCancel.Err}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestLateCancel(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "refund", Src: []string{"paid"}, Dst: "pending"},
+		},
+		Callbacks{
+			"enter_paid": func(_ context.Context, e *Event) {
+				calls = append(calls, "enter_paid")
+				if len(e.Args) > 0 {
+					e.Cancel(e.Args[0].(error))
+				}
+			},
+			"after_pay": func(_ context.Context, e *Event) {
+				calls = append(calls, "after_pay")
+			},
+			"after_refund": func(_ context.Context, e *Event) {
+				calls = append(calls, "after_refund")
+			},
+		},
+	)
+	shipped := errors.New("already shipped")
+	err := fsm.Event(context.Background(), "pay", shipped)
+	if e, ok := err.(LateCancelError); !ok || e.Callback != "enter_paid" || e.Err != shipped {
+		t.Errorf("expected 'LateCancelError' from enter_paid, got %v", err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+	if len(calls) != 2 {
+		t.Errorf("expected the remaining callbacks to be called, got %v", calls)
+	}
+}
+
+func TestLateCancelCompensation(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "refund", Src: []string{"paid"}, Dst: "pending"},
+		},
+		Callbacks{
+			"enter_paid": func(_ context.Context, e *Event) {
+				calls = append(calls, "enter_paid")
+				if len(e.Args) > 0 {
+					e.Cancel(e.Args[0].(error))
+				}
+			},
+			"after_pay": func(_ context.Context, e *Event) {
+				calls = append(calls, "after_pay")
+			},
+			"after_refund": func(_ context.Context, e *Event) {
+				calls = append(calls, "after_refund")
+			},
+		},
+		WithCompensations(map[string]string{"pay": "refund"}),
+	)
+	shipped := errors.New("already shipped")
+	err := fsm.Event(context.Background(), "pay", shipped)
+	if e, ok := err.(CanceledError); !ok || e.Err != shipped {
+		t.Errorf("expected 'CanceledError', got %v", err)
+	}
+	if fsm.Current() != "pending" {
+		t.Errorf("expected state to be 'pending', got %s", fsm.Current())
+	}
+	expected := "[enter_paid after_pay after_refund]"
+	if got := fmt.Sprint(calls); got != expected {
+		t.Errorf("expected calls %s, got %s", expected, got)
+	}
+
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+}
+
+func TestLateCancelCompensationFailed(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "refund", Src: []string{"paid"}, Dst: "pending"},
+		},
+		Callbacks{
+			"enter_paid": func(_ context.Context, e *Event) {
+				calls = append(calls, "enter_paid")
+				if len(e.Args) > 0 {
+					e.Cancel(e.Args[0].(error))
+				}
+			},
+			"after_pay": func(_ context.Context, e *Event) {
+				calls = append(calls, "after_pay")
+			},
+			"after_refund": func(_ context.Context, e *Event) {
+				calls = append(calls, "after_refund")
+			},
+		},
+		WithCompensations(map[string]string{"pay": "void"}),
+	)
+	err := fsm.Event(context.Background(), "pay", errors.New("already shipped"))
+	if _, ok := err.(UnknownEventError); !ok {
+		t.Errorf("expected 'UnknownEventError', got %v", err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Compose merges event fragments into a single transition map that can be
+// passed to NewFSM. This is useful when a large machine is assembled from
+// fragments maintained by different modules or teams, like MergeCallbacks for
+// callbacks.
+//
+// The fragments are merged in the given order. If two fragments both define
+// an unconditional transition (without Guard or Unless) for the same event and
+// source state with the same Priority, only one of them could ever be taken,
+// so a ConflictingEventError is returned for the first such conflict. Use
+// PrefixStates to keep the states of a fragment apart from the others.
+func Compose(fragments ...Events) (Events, error) {
+	type owner struct {
+		fragment int
+		priority int
+	}
+	owners := make(map[eKey][]owner)
+	var composed Events
+	for i, fragment := range fragments {
+		for _, e := range fragment {
+			if e.Guard == nil && len(e.Unless) == 0 {
+				for _, src := range e.Src {
+					key := eKey{e.Name, src}
+					for _, o := range owners[key] {
+						if o.fragment != i && o.priority == e.Priority {
+							return nil, ConflictingEventError{e.Name, src}
+						}
+					}
+					owners[key] = append(owners[key], owner{i, e.Priority})
+				}
+			}
+			composed = append(composed, e)
+		}
+	}
+	return composed, nil
+}
+
+// PrefixStates returns a copy of events with prefix added to the source and
+// destination states, except for AnyState and the given shared states which
+// connect the fragment to the rest of the machine.
+func PrefixStates(prefix string, events Events, shared ...string) Events {
+	keep := map[string]bool{AnyState: true}
+	for _, state := range shared {
+		keep[state] = true
+	}
+	rename := func(state string) string {
+		if state == "" || keep[state] {
+			return state
+		}
+		return prefix + state
+	}
+
+	prefixed := make(Events, len(events))
+	for i, e := range events {
+		src := make([]string, len(e.Src))
+		for j, state := range e.Src {
+			src[j] = rename(state)
+		}
+		e.Src = src
+		e.Dst = rename(e.Dst)
+		prefixed[i] = e
+	}
+	return prefixed
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	checkout := Events{
+		{Name: "checkout", Src: []string{"cart"}, Dst: "payment"},
+		{Name: "cancel", Src: []string{"cart"}, Dst: "canceled"},
+	}
+	payment := PrefixStates("payment_", Events{
+		{Name: "pay", Src: []string{"pending"}, Dst: "done"},
+		{Name: "cancel", Src: []string{"pending"}, Dst: "canceled"},
+		{Name: "reset", Src: []string{AnyState}, Dst: "cart"},
+	}, "canceled", "cart")
+	payment = append(payment, EventDesc{Name: "start", Src: []string{"payment"}, Dst: "payment_pending"})
+
+	events, err := Compose(checkout, payment)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("expected 6 events, got %d", len(events))
+	}
+
+	fsm := NewFSM("cart", events, Callbacks{})
+	for _, event := range []string{"checkout", "start", "pay"} {
+		if err := fsm.Event(context.Background(), event); err != nil {
+			t.Fatalf("expected no error for %s, got %v", event, err)
+		}
+	}
+	if fsm.Current() != "payment_done" {
+		t.Errorf("expected state to be 'payment_done', got %s", fsm.Current())
+	}
+	if err := fsm.Event(context.Background(), "reset"); err != nil || fsm.Current() != "cart" {
+		t.Errorf("expected shared state to be kept, got %s %v", fsm.Current(), err)
+	}
+}
+
+func TestComposeConflict(t *testing.T) {
+	_, err := Compose(
+		Events{{Name: "cancel", Src: []string{"cart", "payment"}, Dst: "canceled"}},
+		Events{{Name: "cancel", Src: []string{"payment"}, Dst: "refunded"}},
+	)
+	if e, ok := err.(ConflictingEventError); !ok || e.Event != "cancel" || e.State != "payment" {
+		t.Errorf("expected 'ConflictingEventError', got %v", err)
+	}
+
+	_, err = Compose(
+		Events{{Name: "cancel", Src: []string{"payment"}, Dst: "canceled"}},
+		Events{{
+			Name: "cancel", Src: []string{"payment"}, Dst: "refunded",
+			Guard: func(context.Context, GuardContext) bool { return true },
+		}},
+		Events{{Name: "cancel", Src: []string{"payment"}, Dst: "failed", Priority: 1}},
+	)
+	if err != nil {
+		t.Errorf("expected guarded or prioritized transitions not to conflict, got %v", err)
+	}
+}
+
+func TestPrefixStates(t *testing.T) {
+	events := Events{
+		{Name: "pay", Src: []string{"pending", "retry"}, Dst: "done"},
+	}
+	prefixed := PrefixStates("payment_", events, "done")
+	if !reflect.DeepEqual(prefixed[0].Src, []string{"payment_pending", "payment_retry"}) || prefixed[0].Dst != "done" {
+		t.Errorf("unexpected prefixed event: %+v", prefixed[0])
+	}
+	if events[0].Src[0] != "pending" {
+		t.Error("expected original events to be unchanged")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// BindData binds a user defined struct to the FSM as structured alternative to
+// the metadata map. ptr must be a non-nil pointer to a struct, otherwise an
+// InvalidDataError is returned. Callbacks can access the struct with DataAs,
+// which checks its type, or with Data.
+//
+// The FSM is not generic over the type of the struct, because the module
+// supports Go versions without type parameters; DataAs provides the type
+// safety instead.
+//
+// The exported fields of the struct are serialized as JSON by MarshalData and
+// UnmarshalData. The struct is restored together with the state and metadata
+// when WithinTx rolls back.
+func (f *FSM) BindData(ptr interface{}) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return InvalidDataError{reflect.TypeOf(ptr)}
+	}
+	f.metadataMu.Lock()
+	defer f.metadataMu.Unlock()
+	f.data = ptr
+	f.metadataVersion++
+	return nil
+}
+
+// Data returns the struct bound with BindData, or nil if no struct is bound.
+//
+//	order := e.FSM.Data().(*OrderData)
+func (f *FSM) Data() interface{} {
+	if !f.initialized() {
+		return nil
+	}
+	f.metadataMu.RLock()
+	defer f.metadataMu.RUnlock()
+	return f.data
+}
+
+// DataAs stores the struct bound with BindData in the variable that ptr points
+// to, which must be of the type passed to BindData:
+//
+//	var order *OrderData
+//	if err := e.FSM.DataAs(&order); err != nil {
+//		e.Cancel(err)
+//		return
+//	}
+//
+// It returns an InvalidDataError if no struct is bound, and a DataTypeError if
+// ptr is not a non-nil pointer to a variable that the struct can be assigned
+// to.
+func (f *FSM) DataAs(ptr interface{}) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	data := f.Data()
+	if data == nil {
+		return InvalidDataError{}
+	}
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || !reflect.TypeOf(data).AssignableTo(v.Elem().Type()) {
+		return DataTypeError{reflect.TypeOf(data), reflect.TypeOf(ptr)}
+	}
+	v.Elem().Set(reflect.ValueOf(data))
+	return nil
+}
+
+// MarshalData serializes the bound struct as JSON. It returns "null" if no
+// struct is bound.
+func (f *FSM) MarshalData() ([]byte, error) {
+	if !f.initialized() {
+		return nil, NotInitializedError{}
+	}
+	f.metadataMu.RLock()
+	defer f.metadataMu.RUnlock()
+	return json.Marshal(f.data)
+}
+
+// UnmarshalData deserializes JSON into the bound struct. Fields that do not
+// exist in the struct are rejected, so that data of another schema is not
+// silently dropped.
+func (f *FSM) UnmarshalData(data []byte) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	f.metadataMu.Lock()
+	defer f.metadataMu.Unlock()
+	if f.data == nil {
+		return InvalidDataError{}
+	}
+	f.metadataVersion++
+	return unmarshalStrict(data, f.data)
+}
+
+// unmarshalStrict unmarshals JSON into v, rejecting unknown fields.
+func unmarshalStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
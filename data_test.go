@@ -0,0 +1,155 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type orderData struct {
+	Items int    `json:"items"`
+	Note  string `json:"note"`
+}
+
+func TestBindData(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "add", Src: []string{"cart"}, Kind: KindInternal},
+		},
+		Callbacks{
+			"after_add": func(_ context.Context, e *Event) {
+				e.FSM.Data().(*orderData).Items++
+			},
+		},
+	)
+	if fsm.Data() != nil {
+		t.Error("expected no data to be bound")
+	}
+	order := &orderData{}
+	if err := fsm.BindData(order); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = fsm.Event(context.Background(), "add")
+	_ = fsm.Event(context.Background(), "add")
+	if order.Items != 2 {
+		t.Errorf("expected 2 items, got %d", order.Items)
+	}
+}
+
+func TestBindDataInvalid(t *testing.T) {
+	fsm := NewFSM("start", Events{}, Callbacks{})
+	for _, v := range []interface{}{nil, orderData{}, (*orderData)(nil), new(int)} {
+		if _, ok := fsm.BindData(v).(InvalidDataError); !ok {
+			t.Errorf("expected 'InvalidDataError' for %#v", v)
+		}
+	}
+	if _, ok := fsm.UnmarshalData([]byte(`{}`)).(InvalidDataError); !ok {
+		t.Error("expected 'InvalidDataError' when no data is bound")
+	}
+}
+
+func TestDataAs(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "add", Src: []string{"cart"}, Kind: KindInternal},
+		},
+		Callbacks{
+			"after_add": func(_ context.Context, e *Event) {
+				var order *orderData
+				if err := e.FSM.DataAs(&order); err != nil {
+					e.Cancel(err)
+					return
+				}
+				order.Items++
+			},
+		},
+	)
+	var order *orderData
+	if _, ok := fsm.DataAs(&order).(InvalidDataError); !ok {
+		t.Error("expected 'InvalidDataError' when no data is bound")
+	}
+	bound := &orderData{}
+	if err := fsm.BindData(bound); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fsm.Event(context.Background(), "add"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fsm.DataAs(&order); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if order != bound || order.Items != 1 {
+		t.Errorf("expected the bound data with 1 item, got %#v", order)
+	}
+	var value interface{}
+	if err := fsm.DataAs(&value); err != nil || value != bound {
+		t.Errorf("expected the bound data in an interface, got %#v, %v", value, err)
+	}
+	var wrong *paymentData
+	for _, ptr := range []interface{}{nil, order, (**orderData)(nil), &wrong} {
+		if _, ok := fsm.DataAs(ptr).(DataTypeError); !ok {
+			t.Errorf("expected 'DataTypeError' for %#v", ptr)
+		}
+	}
+}
+
+func TestMarshalData(t *testing.T) {
+	fsm := NewFSM("start", Events{}, Callbacks{})
+	_ = fsm.BindData(&orderData{Items: 3, Note: "gift"})
+	b, err := fsm.MarshalData()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(b) != `{"items":3,"note":"gift"}` {
+		t.Errorf("unexpected JSON %s", b)
+	}
+
+	restored := NewFSM("start", Events{}, Callbacks{})
+	order := &orderData{}
+	_ = restored.BindData(order)
+	if err := restored.UnmarshalData(b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if *order != (orderData{Items: 3, Note: "gift"}) {
+		t.Errorf("unexpected data %+v", *order)
+	}
+	if err := restored.UnmarshalData([]byte(`{"items":1,"discount":5}`)); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestBindDataWithinTx(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	order := &orderData{Items: 1}
+	_ = fsm.BindData(order)
+	_ = fsm.WithinTx(context.Background(), &fakeTx{}, func(ctx context.Context) error {
+		order.Items = 5
+		order.Note = "changed"
+		return errors.New("failed")
+	})
+	if *order != (orderData{Items: 1}) {
+		t.Errorf("expected data to be restored, got %+v", *order)
+	}
+}
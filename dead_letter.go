@@ -0,0 +1,187 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DeadLetter is an event that could not be processed, with the context needed
+// to process it later.
+type DeadLetter struct {
+	// Event is the event name.
+	Event string
+
+	// Args are the arguments passed to the event.
+	Args []interface{}
+
+	// State is the state of the FSM when the event was received.
+	State string
+
+	// Err is the reason why the event could not be processed.
+	Err error
+
+	// At is the time the event was passed to the sink.
+	At time.Time
+}
+
+// DeadLetterSink receives the events that could not be processed.
+type DeadLetterSink interface {
+	// Put stores letter. It is called with the context of the event.
+	Put(ctx context.Context, letter DeadLetter)
+}
+
+// DeadLetterQueue is a DeadLetterSink that the stored events can be taken
+// back from, to be redelivered with FSM.RedeliverDeadLetters.
+type DeadLetterQueue interface {
+	DeadLetterSink
+
+	// Take removes and returns the stored events, oldest first.
+	Take() []DeadLetter
+}
+
+// DeadLetterFunc is an adapter to use an ordinary function as a
+// DeadLetterSink.
+type DeadLetterFunc func(ctx context.Context, letter DeadLetter)
+
+// Put calls fn(ctx, letter).
+func (fn DeadLetterFunc) Put(ctx context.Context, letter DeadLetter) {
+	fn(ctx, letter)
+}
+
+// DeadLetterBuffer is an in-memory DeadLetterQueue. When it is full the
+// oldest events are dropped to make room for new ones.
+type DeadLetterBuffer struct {
+	size    int
+	letters []DeadLetter
+	mu      sync.Mutex
+}
+
+// NewDeadLetterBuffer returns a DeadLetterBuffer holding at most size events,
+// or any number of events if size is not positive.
+func NewDeadLetterBuffer(size int) *DeadLetterBuffer {
+	return &DeadLetterBuffer{size: size}
+}
+
+// Put stores letter, dropping the oldest event if the buffer is full.
+func (b *DeadLetterBuffer) Put(_ context.Context, letter DeadLetter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.size > 0 && len(b.letters) >= b.size {
+		b.letters = b.letters[1:]
+	}
+	b.letters = append(b.letters, letter)
+}
+
+// Take removes and returns the stored events, oldest first.
+func (b *DeadLetterBuffer) Take() []DeadLetter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	letters := b.letters
+	b.letters = nil
+	return letters
+}
+
+// Letters returns the stored events, oldest first, without removing them.
+func (b *DeadLetterBuffer) Letters() []DeadLetter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]DeadLetter(nil), b.letters...)
+}
+
+// Len returns the number of stored events.
+func (b *DeadLetterBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.letters)
+}
+
+// redeliveryKey is the context key that marks the redelivery of dead letters.
+type redeliveryKey struct{}
+
+// WithDeadLetters sets the sink of the events that could not be processed:
+// events that are unknown or inappropriate in the current state, rejected by
+// a guard or a validator, that expired before they could be processed, or
+// that were received while the FSM was unavailable with DeadLetterUnavailable.
+// Event still returns the error of such events, except for
+// DeadLetterUnavailable. Events that are deferred because of
+// WithDeferredEvents are not dead letters unless they are dropped.
+//
+// Use a DeadLetterQueue, like a DeadLetterBuffer, to be able to redeliver
+// the events with RedeliverDeadLetters.
+func WithDeadLetters(sink DeadLetterSink) Option {
+	return func(f *FSM) {
+		f.deadLetters = sink
+	}
+}
+
+// RedeliverDeadLetters takes the events from the dead letter queue and sends
+// them again, oldest first, with ctx. The events that fail again are put back
+// in the queue with their new error. It returns the number of events that
+// were processed, and a DeadLetterQueueError if the sink set with
+// WithDeadLetters is not a DeadLetterQueue.
+//
+// If ctx is done before all events were sent, the remaining events are put
+// back in the queue and the error of ctx is returned.
+func (f *FSM) RedeliverDeadLetters(ctx context.Context) (int, error) {
+	if !f.initialized() {
+		return 0, NotInitializedError{}
+	}
+	queue, ok := f.deadLetters.(DeadLetterQueue)
+	if !ok {
+		return 0, DeadLetterQueueError{}
+	}
+	ctx = context.WithValue(ctx, redeliveryKey{}, true)
+	delivered := 0
+	letters := queue.Take()
+	for i, letter := range letters {
+		if ctx.Err() != nil {
+			for _, l := range letters[i:] {
+				queue.Put(ctx, l)
+			}
+			return delivered, ctx.Err()
+		}
+		err := f.Event(ctx, letter.Event, letter.Args...)
+		if nerr, ok := err.(NoTransitionError); err != nil && (!ok || nerr.Err != nil) {
+			letter.Err = err
+			queue.Put(ctx, letter)
+			continue
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// isDeadLetter returns true if an event that failed with err should be passed
+// to the dead letter sink.
+func isDeadLetter(err error) bool {
+	switch err.(type) {
+	case InvalidEventError, UnknownEventError, GuardFailedError, ValidationError:
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// putDeadLetter passes event to the dead letter sink, if any. Events that are
+// redelivered or deferred are not passed, they are handled by the caller.
+func (f *FSM) putDeadLetter(ctx context.Context, event string, args []interface{}, state string, err error) {
+	if f.deadLetters == nil || ctx.Value(redeliveryKey{}) != nil || ctx.Value(retryKey{}) != nil {
+		return
+	}
+	f.deadLetters.Put(ctx, DeadLetter{event, args, state, err, f.clock.Now()})
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func deadLetterEvents(letters []DeadLetter) []string {
+	events := make([]string, len(letters))
+	for i, letter := range letters {
+		events[i] = letter.Event
+	}
+	return events
+}
+
+func TestDeadLetters(t *testing.T) {
+	buffer := NewDeadLetterBuffer(0)
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+		},
+		Callbacks{},
+		WithDeadLetters(buffer),
+	)
+	if err := fsm.AddTransition(EventDesc{
+		Name: "refund", Src: []string{"pending"}, Dst: "refunded",
+		Guard: func(context.Context, GuardContext) bool { return false },
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, ok := fsm.Event(context.Background(), "ship", "parcel").(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError'")
+	}
+	if _, ok := fsm.Event(context.Background(), "jump").(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError'")
+	}
+	if _, ok := fsm.Event(context.Background(), "refund").(GuardFailedError); !ok {
+		t.Error("expected 'GuardFailedError'")
+	}
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if buffer.Len() != 3 {
+		t.Fatalf("expected 3 dead letters, got %d", buffer.Len())
+	}
+	letters := buffer.Letters()
+	if events := deadLetterEvents(letters); !reflect.DeepEqual(events, []string{"ship", "jump", "refund"}) {
+		t.Errorf("expected dead letters [ship jump refund], got %v", events)
+	}
+	letter := letters[0]
+	if letter.State != "pending" || !reflect.DeepEqual(letter.Args, []interface{}{"parcel"}) || letter.At.IsZero() {
+		t.Errorf("unexpected dead letter: %+v", letter)
+	}
+	if _, ok := letter.Err.(InvalidEventError); !ok {
+		t.Errorf("expected 'InvalidEventError', got %v", letter.Err)
+	}
+	if buffer.Len() != 3 {
+		t.Error("expected Letters not to remove dead letters")
+	}
+}
+
+func TestDeadLetterExpired(t *testing.T) {
+	buffer := NewDeadLetterBuffer(0)
+	var fsm *FSM
+	var err error
+	fsm = NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+		},
+		Callbacks{
+			"before_pay": func(_ context.Context, e *Event) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				defer cancel()
+				err = fsm.EventWait(ctx, "ship")
+			},
+		},
+		WithDeadLetters(buffer),
+	)
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline to be exceeded, got %v", err)
+	}
+	letters := buffer.Letters()
+	if events := deadLetterEvents(letters); !reflect.DeepEqual(events, []string{"ship"}) {
+		t.Fatalf("expected dead letters [ship], got %v", events)
+	}
+	if letters[0].Err != context.DeadlineExceeded {
+		t.Errorf("expected deadline to be exceeded, got %v", letters[0].Err)
+	}
+}
+
+func TestDeadLetterBufferSize(t *testing.T) {
+	buffer := NewDeadLetterBuffer(2)
+	for _, event := range []string{"a", "b", "c"} {
+		buffer.Put(context.Background(), DeadLetter{Event: event})
+	}
+	if events := deadLetterEvents(buffer.Take()); !reflect.DeepEqual(events, []string{"b", "c"}) {
+		t.Errorf("expected oldest dead letter to be dropped, got %v", events)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected Take to remove dead letters, got %d", buffer.Len())
+	}
+}
+
+func TestRedeliverDeadLetters(t *testing.T) {
+	buffer := NewDeadLetterBuffer(0)
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+		},
+		Callbacks{},
+		WithDeadLetters(buffer),
+	)
+	_ = fsm.Event(context.Background(), "ship")
+	_ = fsm.Event(context.Background(), "jump")
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	n, err := fsm.RedeliverDeadLetters(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 redelivered event, got %d", n)
+	}
+	if fsm.Current() != "shipped" {
+		t.Errorf("expected state to be 'shipped', got %s", fsm.Current())
+	}
+	letters := buffer.Letters()
+	if events := deadLetterEvents(letters); !reflect.DeepEqual(events, []string{"jump"}) {
+		t.Fatalf("expected failed event to be put back, got %v", events)
+	}
+	if _, ok := letters[0].Err.(UnknownEventError); !ok {
+		t.Errorf("expected 'UnknownEventError', got %v", letters[0].Err)
+	}
+}
+
+func TestRedeliverDeadLettersCanceled(t *testing.T) {
+	buffer := NewDeadLetterBuffer(0)
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+		},
+		Callbacks{},
+		WithDeadLetters(buffer),
+	)
+	_ = fsm.Event(context.Background(), "ship")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, err := fsm.RedeliverDeadLetters(ctx)
+	if err != context.Canceled || n != 0 {
+		t.Errorf("expected no redelivery with context canceled, got %d %v", n, err)
+	}
+	if buffer.Len() != 1 {
+		t.Errorf("expected dead letter to be put back, got %d", buffer.Len())
+	}
+}
+
+func TestRedeliverDeadLettersUnavailable(t *testing.T) {
+	buffer := NewDeadLetterBuffer(0)
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+		},
+		Callbacks{},
+		WithDeadLetters(buffer),
+	)
+	fsm.unavailableStrategies = map[Unavailability]UnavailableStrategy{
+		UnavailablePaused: DeadLetterUnavailable,
+	}
+	fsm.Pause()
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	n, _ := fsm.RedeliverDeadLetters(context.Background())
+	if n != 0 || buffer.Len() != 1 {
+		t.Errorf("expected dead letter to stay while paused, got %d %d", n, buffer.Len())
+	}
+	fsm.Resume()
+	n, _ = fsm.RedeliverDeadLetters(context.Background())
+	if n != 1 || fsm.Current() != "paid" {
+		t.Errorf("expected dead letter to be redelivered, got %d %s", n, fsm.Current())
+	}
+}
+
+func TestRedeliverDeadLettersWithoutQueue(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+		},
+		Callbacks{},
+		WithDeadLetters(DeadLetterFunc(func(context.Context, DeadLetter) {})),
+	)
+	if _, err := fsm.RedeliverDeadLetters(context.Background()); err != (DeadLetterQueueError{}) {
+		t.Errorf("expected 'DeadLetterQueueError', got %v", err)
+	}
+}
+
+func TestDeadLetterDroppedDeferred(t *testing.T) {
+	buffer := NewDeadLetterBuffer(0)
+	var shipped []interface{}
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+			{Name: "deliver", Src: []string{"shipped"}, Dst: "delivered"},
+		},
+		Callbacks{
+			"after_ship": func(_ context.Context, e *Event) {
+				shipped = append(shipped, e.Args...)
+			},
+		},
+		WithDeferredEvents(1, DeferDropOldest),
+	)
+	fsm.deadLetters = buffer
+	_ = fsm.Event(context.Background(), "ship", "first")
+	_ = fsm.Event(context.Background(), "ship", "second")
+	letters := buffer.Letters()
+	if len(letters) != 1 || !reflect.DeepEqual(letters[0].Args, []interface{}{"first"}) {
+		t.Fatalf("expected dropped deferred event to be a dead letter, got %+v", letters)
+	}
+	if _, ok := letters[0].Err.(InvalidEventError); !ok {
+		t.Errorf("expected 'InvalidEventError', got %v", letters[0].Err)
+	}
+}
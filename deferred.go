@@ -0,0 +1,166 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// DeferPolicy decides what happens when an event is deferred while the queue
+// of deferred events is full.
+type DeferPolicy int
+
+const (
+	// DeferDropNewest rejects the new event with the InvalidEventError it
+	// would have gotten without deferral.
+	DeferDropNewest DeferPolicy = iota
+
+	// DeferDropOldest drops the oldest deferred event to make room for the
+	// new one.
+	DeferDropOldest
+)
+
+// deferredEvent is an event that was deferred because it was inappropriate
+// in the state it was sent in.
+type deferredEvent struct {
+	ctx   context.Context
+	event string
+	args  []interface{}
+	err   InvalidEventError
+}
+
+// retryKey is the context key that marks the retries of deferred events.
+type retryKey struct{}
+
+// WithDeferredEvents defers events that are inappropriate in the current
+// state instead of rejecting them, like deferrable events in UML. Event
+// returns a DeferredError for such events and queues them. After every
+// successful event the queued events are retried in the order they were sent,
+// with the context values but not the cancellation of their original context.
+// An event that is still inappropriate stays queued, an event that fails for
+// another reason is dropped.
+//
+// Events dropped from the queue are passed to the sink set with
+// WithDeadLetters, if any.
+//
+// At most size events are queued; policy decides what happens to further
+// events. Only events that are defined for some state are deferred.
+func WithDeferredEvents(size int, policy DeferPolicy) Option {
+	return func(f *FSM) {
+		f.deferSize = size
+		f.deferPolicy = policy
+	}
+}
+
+// DeferredEvents returns the names of the deferred events in the order they
+// will be retried.
+func (f *FSM) DeferredEvents() []string {
+	if !f.initialized() {
+		return nil
+	}
+	f.deferredMu.Lock()
+	defer f.deferredMu.Unlock()
+	events := make([]string, len(f.deferred))
+	for i, d := range f.deferred {
+		events[i] = d.event
+	}
+	return events
+}
+
+// deferEvent queues an event that failed with err, if it can be deferred, and
+// returns the error to return from Event.
+func (f *FSM) deferEvent(ctx context.Context, event string, args []interface{}, err error) error {
+	invalid, ok := err.(InvalidEventError)
+	if !ok || f.deferSize <= 0 || ctx.Value(retryKey{}) != nil {
+		return err
+	}
+
+	f.deferredMu.Lock()
+	var dropped []deferredEvent
+	if len(f.deferred) >= f.deferSize {
+		if f.deferPolicy != DeferDropOldest {
+			f.deferredMu.Unlock()
+			return err
+		}
+		dropped = f.deferred[:1]
+		f.deferred = f.deferred[1:]
+	}
+	f.deferred = append(f.deferred, deferredEvent{&uncancel{ctx}, event, args, invalid})
+	f.deferredMu.Unlock()
+	f.dropDeferred(dropped)
+	return DeferredError{invalid.Event, invalid.State}
+}
+
+// dropDeferred passes deferred events that were dropped to the dead letter
+// sink, if any.
+func (f *FSM) dropDeferred(dropped []deferredEvent) {
+	for _, d := range dropped {
+		f.putDeadLetter(d.ctx, d.event, d.args, d.err.State, d.err)
+	}
+}
+
+// retryDeferred retries the deferred events until none of them can be
+// processed anymore. Only one goroutine retries at a time; other callers
+// make it do another pass.
+func (f *FSM) retryDeferred() {
+	f.deferredMu.Lock()
+	if len(f.deferred) == 0 {
+		f.deferredMu.Unlock()
+		return
+	}
+	if f.retryingDeferred {
+		f.deferredDirty = true
+		f.deferredMu.Unlock()
+		return
+	}
+	f.retryingDeferred = true
+	f.deferredMu.Unlock()
+
+	for {
+		f.deferredMu.Lock()
+		queue := f.deferred
+		f.deferred = nil
+		f.deferredDirty = false
+		f.deferredMu.Unlock()
+
+		progress := false
+		var remaining []deferredEvent
+		for _, d := range queue {
+			err := f.Event(context.WithValue(d.ctx, retryKey{}, true), d.event, d.args...)
+			if _, ok := err.(InvalidEventError); ok {
+				remaining = append(remaining, d)
+				continue
+			}
+			progress = true
+		}
+
+		f.deferredMu.Lock()
+		f.deferred = append(remaining, f.deferred...)
+		var dropped []deferredEvent
+		if over := len(f.deferred) - f.deferSize; over > 0 {
+			dropped = f.deferred[:over]
+			f.deferred = f.deferred[over:]
+		}
+		done := (!progress && !f.deferredDirty) || len(f.deferred) == 0
+		if done {
+			f.retryingDeferred = false
+		}
+		f.deferredMu.Unlock()
+		f.dropDeferred(dropped)
+		if done {
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDeferredEvents(t *testing.T) {
+	var shipped []interface{}
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+			{Name: "deliver", Src: []string{"shipped"}, Dst: "delivered"},
+		},
+		Callbacks{
+			"after_ship": func(_ context.Context, e *Event) {
+				shipped = append(shipped, e.Args...)
+			},
+		},
+		WithDeferredEvents(10, DeferDropNewest),
+	)
+
+	err := fsm.Event(context.Background(), "deliver")
+	if derr, ok := err.(DeferredError); !ok || derr.Event != "deliver" || derr.State != "pending" {
+		t.Fatalf("expected 'DeferredError', got %v", err)
+	}
+	if _, ok := fsm.Event(context.Background(), "ship", "parcel").(DeferredError); !ok {
+		t.Fatal("expected 'DeferredError'")
+	}
+	if _, ok := fsm.Event(context.Background(), "jump").(UnknownEventError); !ok {
+		t.Error("expected unknown events not to be deferred")
+	}
+	if events := fsm.DeferredEvents(); !reflect.DeepEqual(events, []string{"deliver", "ship"}) {
+		t.Errorf("expected deferred events [deliver ship], got %v", events)
+	}
+
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "delivered" {
+		t.Errorf("expected state to be 'delivered', got %s", fsm.Current())
+	}
+	if !reflect.DeepEqual(shipped, []interface{}{"parcel"}) {
+		t.Errorf("expected deferred event to keep its args, got %v", shipped)
+	}
+	if events := fsm.DeferredEvents(); len(events) != 0 {
+		t.Errorf("expected no deferred events, got %v", events)
+	}
+}
+
+func TestDeferredEventsKeepContext(t *testing.T) {
+	type key struct{}
+	var value interface{}
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+		},
+		Callbacks{
+			"before_ship": func(ctx context.Context, e *Event) {
+				value = ctx.Value(key{})
+			},
+		},
+		WithDeferredEvents(1, DeferDropNewest),
+	)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	if _, ok := fsm.Event(ctx, "ship").(DeferredError); !ok {
+		t.Fatal("expected 'DeferredError'")
+	}
+	cancel()
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "shipped" || value != "value" {
+		t.Errorf("expected deferred event with context value, got state %s and value %v", fsm.Current(), value)
+	}
+}
+
+func TestDeferredEventsFull(t *testing.T) {
+	var shipped []interface{}
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+			{Name: "deliver", Src: []string{"shipped"}, Dst: "delivered"},
+		},
+		Callbacks{
+			"after_ship": func(_ context.Context, e *Event) {
+				shipped = append(shipped, e.Args...)
+			},
+		},
+		WithDeferredEvents(2, DeferDropNewest),
+	)
+	_ = fsm.Event(context.Background(), "ship", 1)
+	_ = fsm.Event(context.Background(), "ship", 2)
+	if _, ok := fsm.Event(context.Background(), "ship", 3).(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError' when the queue is full")
+	}
+
+	fsm = NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+			{Name: "ship", Src: []string{"paid"}, Dst: "shipped"},
+			{Name: "deliver", Src: []string{"shipped"}, Dst: "delivered"},
+		},
+		Callbacks{
+			"after_ship": func(_ context.Context, e *Event) {
+				shipped = append(shipped, e.Args...)
+			},
+		},
+		WithDeferredEvents(2, DeferDropOldest),
+	)
+	_ = fsm.Event(context.Background(), "deliver")
+	_ = fsm.Event(context.Background(), "ship", 1)
+	if _, ok := fsm.Event(context.Background(), "ship", 2).(DeferredError); !ok {
+		t.Error("expected 'DeferredError' when dropping the oldest event")
+	}
+	if events := fsm.DeferredEvents(); !reflect.DeepEqual(events, []string{"ship", "ship"}) {
+		t.Errorf("expected oldest event to be dropped, got %v", events)
+	}
+
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// The second ship is inappropriate once shipped and stays deferred.
+	if !reflect.DeepEqual(shipped, []interface{}{1}) {
+		t.Errorf("expected first deferred ship to be processed, got %v", shipped)
+	}
+	if events := fsm.DeferredEvents(); !reflect.DeepEqual(events, []string{"ship"}) {
+		t.Errorf("expected second ship to stay deferred, got %v", events)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Definition is a reusable description of a FSM, from which any number of
+// independent FSMs can be created, for example to embed a common fragment
+// like a retryable call as the submachine of several composite states.
+//
+// The callbacks and options are shared by all the FSMs created from the
+// definition, so callbacks should use Event.FSM rather than a particular FSM.
+type Definition struct {
+	Initial   string
+	Events    Events
+	Callbacks Callbacks
+	Options   []Option
+}
+
+// New creates a FSM from the definition, with opts applied after the options
+// of the definition.
+func (d Definition) New(opts ...Option) *FSM {
+	options := make([]Option, 0, len(d.Options)+len(opts))
+	options = append(options, d.Options...)
+	options = append(options, opts...)
+	return NewFSM(d.Initial, d.Events, d.Callbacks, options...)
+}
+
+// WithSubmachineDefinition makes state a composite state like WithSubmachine,
+// with a child FSM created from def. Every FSM using the definition gets its
+// own child.
+func WithSubmachineDefinition(state string, def Definition, exit SubmachineExit) Option {
+	return func(f *FSM) {
+		WithSubmachine(state, def.New(), exit)(f)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDefinition(t *testing.T) {
+	attempts := map[*FSM]int{}
+	call := Definition{
+		Initial: "calling",
+		Events: Events{
+			{Name: "fail", Src: []string{"calling"}, Dst: "waiting"},
+			{Name: "retry", Src: []string{"waiting"}, Dst: "calling"},
+			{Name: "succeed", Src: []string{"calling"}, Dst: "succeeded"},
+		},
+		Callbacks: Callbacks{
+			"enter_calling": func(_ context.Context, e *Event) {
+				attempts[e.FSM]++
+			},
+		},
+	}
+	ctx := context.Background()
+
+	newParent := func() *FSM {
+		return NewFSM(
+			"idle",
+			Events{
+				{Name: "fetch", Src: []string{"idle"}, Dst: "fetching"},
+			},
+			Callbacks{},
+			WithSubmachineDefinition("fetching", call, ResetSubmachine),
+		)
+	}
+	first, second := newParent(), newParent()
+	if first.Submachine("fetching") == second.Submachine("fetching") {
+		t.Fatal("expected every parent to get its own child")
+	}
+
+	_ = first.Event(ctx, "fetch")
+	_ = second.Event(ctx, "fetch")
+	for _, event := range []string{"fail", "retry", "succeed"} {
+		if err := first.Event(ctx, event); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if states := first.ActiveStates(); !reflect.DeepEqual(states, []string{"fetching", "succeeded"}) {
+		t.Errorf("expected first child to succeed, got %v", states)
+	}
+	if states := second.ActiveStates(); !reflect.DeepEqual(states, []string{"fetching", "calling"}) {
+		t.Errorf("expected second child to be unchanged, got %v", states)
+	}
+	if n := attempts[first.Submachine("fetching")]; n != 2 {
+		t.Errorf("expected the first call and one retry of the first child, got %d", n)
+	}
+	if n := attempts[second.Submachine("fetching")]; n != 1 {
+		t.Errorf("expected the first call of the second child, got %d", n)
+	}
+}
+
+func TestDefinitionOptions(t *testing.T) {
+	def := Definition{
+		Initial: "closed",
+		Events: Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Options: []Option{WithStateDescriptions(map[string]string{"open": "definition"})},
+	}
+	fsm := def.New(WithStateDescriptions(map[string]string{"open": "instance"}))
+	if fsm.Current() != "closed" {
+		t.Errorf("expected initial state closed, got %s", fsm.Current())
+	}
+	if d := fsm.StateDescription("open"); d != "instance" {
+		t.Errorf("expected options of New to be applied last, got %s", d)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// WithDeps attaches a dependency container to the FSM, like a struct holding
+// the services that the callbacks need. Callbacks get it with Event.Deps and
+// guards with GuardContext.Deps, instead of closing over globals or storing
+// services in the metadata.
+func WithDeps(deps interface{}) Option {
+	return func(f *FSM) {
+		f.deps = deps
+	}
+}
+
+// Deps returns the dependency container set with WithDeps, or nil.
+func (f *FSM) Deps() interface{} {
+	if f == nil {
+		return nil
+	}
+	return f.deps
+}
+
+// Deps returns the dependency container of the FSM, see WithDeps. Callbacks
+// usually assert it to the type they passed to WithDeps.
+func (e *Event) Deps() interface{} {
+	return e.FSM.Deps()
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+type mailer struct {
+	sent []string
+}
+
+type services struct {
+	mailer *mailer
+	open   bool
+}
+
+func TestDeps(t *testing.T) {
+	deps := &services{mailer: &mailer{}, open: true}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Guard: func(_ context.Context, g GuardContext) bool {
+				return g.Deps().(*services).open
+			}},
+		},
+		Callbacks{
+			"enter_open": func(_ context.Context, e *Event) {
+				m := e.Deps().(*services).mailer
+				m.sent = append(m.sent, e.Dst)
+			},
+		},
+		WithDeps(deps),
+	)
+
+	if fsm.Deps() != deps {
+		t.Error("expected Deps to return the container")
+	}
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(deps.mailer.sent) != 1 || deps.mailer.sent[0] != "open" {
+		t.Errorf("expected callback to use the mailer, got %v", deps.mailer.sent)
+	}
+}
+
+func TestNoDeps(t *testing.T) {
+	fsm := NewFSM("closed", Events{}, Callbacks{})
+	if fsm.Deps() != nil {
+		t.Error("expected no dependencies")
+	}
+	if (&Event{}).Deps() != nil {
+		t.Error("expected no dependencies for an event without FSM")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// WithStateDescriptions adds human-readable descriptions of states, shown in
+// visualizations. It can be given more than once.
+func WithStateDescriptions(descriptions map[string]string) Option {
+	return func(f *FSM) {
+		if f.stateDescriptions == nil {
+			f.stateDescriptions = make(map[string]string)
+		}
+		for state, description := range descriptions {
+			f.stateDescriptions[state] = description
+		}
+	}
+}
+
+// WithEventDescriptions adds human-readable descriptions of events, shown in
+// visualizations for the transitions without a description of their own. It
+// can be given more than once.
+func WithEventDescriptions(descriptions map[string]string) Option {
+	return func(f *FSM) {
+		if f.eventDescriptions == nil {
+			f.eventDescriptions = make(map[string]string)
+		}
+		for event, description := range descriptions {
+			f.eventDescriptions[event] = description
+		}
+	}
+}
+
+// StateDescription returns the description of a state, or an empty string if
+// it has none.
+func (f *FSM) StateDescription(state string) string {
+	if !f.initialized() {
+		return ""
+	}
+	return f.stateDescriptions[state]
+}
+
+// EventDescription returns the description of an event, or an empty string if
+// it has none.
+func (f *FSM) EventDescription(event string) string {
+	if !f.initialized() {
+		return ""
+	}
+	return f.eventDescriptions[event]
+}
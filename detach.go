@@ -0,0 +1,122 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// DetachedTransition is a transition that goes on in the background after
+// Event returned a DetachedError.
+type DetachedTransition struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	panicked interface{}
+	detached bool
+	mu       sync.Mutex
+}
+
+// Done returns a channel that is closed when the transition has finished.
+func (d *DetachedTransition) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the error that Event would have returned for the transition
+// once Done is closed. It returns nil before.
+func (d *DetachedTransition) Err() error {
+	select {
+	case <-d.done:
+		return d.err
+	default:
+		return nil
+	}
+}
+
+// Cancel cancels the context of the callbacks of the transition. Like for an
+// asynchronous transition, it is up to the callbacks to stop.
+func (d *DetachedTransition) Cancel() {
+	d.cancel()
+}
+
+// WithDetachOnDeadline makes Event return instead of blocking past the
+// deadline of its context.
+//
+// When Event is called with a context that has a deadline, the event is
+// processed in a goroutine under a context that keeps the values of the
+// original one but ignores its cancellation, like the context of an
+// asynchronous transition (see AsyncError). If the deadline is exceeded
+// before the event has been processed, Event returns a DetachedError while
+// the transition goes on in the background. The callbacks therefore never
+// see the deadline of the caller; use WithTransitionTimeout to limit them.
+//
+// If the context is canceled instead, the cancellation is passed on to the
+// callbacks and Event waits for them as usual.
+func WithDetachOnDeadline() Option {
+	return func(f *FSM) {
+		f.detachOnDeadline = true
+	}
+}
+
+// detachEvent processes the event in a goroutine, and returns a DetachedError
+// if the deadline of ctx is exceeded before it is done.
+func (f *FSM) detachEvent(ctx context.Context, event string, args []interface{}) error {
+	bg, cancel := uncancelContext(ctx)
+	d := &DetachedTransition{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer cancel()
+		var err error
+		defer func() {
+			r := recover()
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if r != nil && d.detached {
+				panic(r)
+			}
+			d.err, d.panicked = err, r
+			close(d.done)
+		}()
+		err = f.dispatchEvent(bg, event, args)
+	}()
+
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded && d.detach() {
+			return DetachedError{event, ctx.Err(), d}
+		}
+		cancel()
+		<-d.done
+	}
+	if d.panicked != nil {
+		panic(d.panicked)
+	}
+	return d.err
+}
+
+// detach marks the transition as detached from the caller of Event. It
+// returns false if the transition has already finished.
+func (d *DetachedTransition) detach() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.done:
+		return false
+	default:
+		d.detached = true
+		return true
+	}
+}
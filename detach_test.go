@@ -0,0 +1,169 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDetachOnDeadline(t *testing.T) {
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(ctx context.Context, e *Event) {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					e.Cancel(ctx.Err())
+				}
+			},
+		},
+		WithDetachOnDeadline(),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := fsm.Event(ctx, "open")
+	var derr DetachedError
+	if !errors.As(err, &derr) || derr.Event != "open" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected 'DetachedError', got %v", err)
+	}
+	if derr.Transition.Err() != nil {
+		t.Error("expected no error before the transition is done")
+	}
+	close(release)
+	<-derr.Transition.Done()
+	if err := derr.Transition.Err(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestDetachOnDeadlineCancel(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(ctx context.Context, e *Event) {
+				<-ctx.Done()
+				e.Cancel(ctx.Err())
+			},
+		},
+		WithDetachOnDeadline(),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var derr DetachedError
+	if err := fsm.Event(ctx, "open"); !errors.As(err, &derr) {
+		t.Fatalf("expected 'DetachedError', got %v", err)
+	}
+	derr.Transition.Cancel()
+	<-derr.Transition.Done()
+	if cerr, ok := derr.Transition.Err().(CanceledError); !ok || cerr.Err != context.Canceled {
+		t.Fatalf("expected 'CanceledError', got %v", derr.Transition.Err())
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+}
+
+func TestDetachOnDeadlineCanceled(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(ctx context.Context, e *Event) {
+				<-ctx.Done()
+				e.Cancel(ctx.Err())
+			},
+		},
+		WithDetachOnDeadline(),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := fsm.Event(ctx, "open")
+	if cerr, ok := err.(CanceledError); !ok || cerr.Err != context.Canceled {
+		t.Fatalf("expected cancellation to reach the callbacks, got %v", err)
+	}
+}
+
+func TestDetachOnDeadlineFast(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(ctx context.Context, e *Event) {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					e.Cancel(ctx.Err())
+				}
+			},
+		},
+		WithDetachOnDeadline(),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := fsm.Event(ctx, "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestDetachOnDeadlinePanic(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(context.Context, *Event) {
+				panic("boom")
+			},
+		},
+		WithDetachOnDeadline(),
+	)
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected panic to reach the caller, got %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_ = fsm.Event(ctx, "open")
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// WithDeterministic makes the FSM deterministic, for use in simulators,
+// workflow engines and other runtimes that replay the same code and expect
+// the same results. Given the same events and a clock that is only advanced
+// by the runtime, like fsmtest.FakeClock, the FSM produces the same
+// transitions, IDs, times and durations on every run.
+//
+// The FSM then never starts goroutines of its own:
+//
+// - All timeouts, including WithCallbackTimeouts and WithTransitionTimeout,
+// use clock instead of the real time. Callbacks run in the goroutine of the
+// caller and fail after they return if they exceeded their timeout.
+//
+// - The events sent with Send are queued and processed in order by the
+// goroutine of the first caller of Send that finds the queue empty, and Run
+// returns right away.
+//
+// - EventAsync processes the event synchronously, so the returned future is
+// already complete.
+//
+// - Retries are always scheduled as with RetryPolicy.Schedule, and
+// WithDetachOnDeadline is ignored.
+//
+// - The IDs of the events are counted per FSM instead of per process.
+func WithDeterministic(clock Clock) Option {
+	return func(f *FSM) {
+		f.clock = clock
+		f.deterministic = true
+	}
+}
+
+// transitionID returns the ID of a new Event.
+func (f *FSM) transitionID() uint64 {
+	if f.deterministic {
+		return atomic.AddUint64(&f.lastTransitionID, 1)
+	}
+	return nextTransitionID()
+}
+
+// clockContext is a context canceled when a deadline of the Clock of a
+// deterministic FSM is exceeded.
+type clockContext struct {
+	context.Context
+	deadline time.Time
+	// expired is set to 1 when the deadline is exceeded.
+	expired int32
+}
+
+// withClockTimeout is like context.WithTimeout with the clock of f.
+func (f *FSM) withClockTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &clockContext{Context: ctx, deadline: f.clock.Now().Add(timeout)}
+	timer := f.clock.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&c.expired, 1)
+		cancel()
+	})
+	return c, func() {
+		timer.Stop()
+		cancel()
+	}
+}
+
+// Deadline returns the deadline of the clock.
+func (c *clockContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+// Err returns context.DeadlineExceeded once the deadline is exceeded.
+func (c *clockContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && atomic.LoadInt32(&c.expired) == 1 {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// withClockCallbackTimeout wraps the callback fn bound to key so that it
+// fails with a CallbackTimeoutError if the clock of f shows that it ran longer
+// than timeout, once it has returned.
+func (f *FSM) withClockCallbackTimeout(key cKey, fn Callback, timeout time.Duration) Callback {
+	return func(ctx context.Context, e *Event) {
+		ctx, cancel := f.withClockTimeout(ctx, timeout)
+		defer cancel()
+		fn(ctx, e)
+		if ctx.Err() == context.DeadlineExceeded {
+			callbackFailed(e, key.callbackType, CallbackTimeoutError{key.String(), timeout})
+		}
+	}
+}
+
+// sendDeterministic queues the event sent with Send, and processes the queue
+// unless another call is already processing it.
+func (f *FSM) sendDeterministic(msg mailboxMessage) {
+	f.queueMu.Lock()
+	f.queue = append(f.queue, msg)
+	if f.draining {
+		f.queueMu.Unlock()
+		return
+	}
+	f.draining = true
+	for len(f.queue) > 0 {
+		msg := f.queue[0]
+		f.queue = f.queue[1:]
+		f.queueMu.Unlock()
+		f.processMessage(msg)
+		f.queueMu.Lock()
+	}
+	f.draining = false
+	f.queueMu.Unlock()
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// runDeterministic runs a workflow on a deterministic FSM and returns the
+// transitions seen by its observer.
+func runDeterministic(t *testing.T) []TransitionInfo {
+	clock := &manualClock{}
+	var trace []TransitionInfo
+	var fsm *FSM
+	fsm = NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "working"},
+			{Name: "done", Src: []string{"working"}, Dst: "idle"},
+			{Name: "expire", Src: []string{"working"}, Dst: "expired"},
+		},
+		Callbacks{
+			"enter_working": func(ctx context.Context, e *Event) {
+				clock.Advance(time.Second)
+				_ = fsm.Send(context.Background(), "done")
+			},
+		},
+		WithDeterministic(clock),
+		WithStateTimeout("idle", time.Minute, "start"),
+	)
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		trace = append(trace, info)
+	}))
+	ctx := context.Background()
+
+	if err := <-fsm.Send(ctx, "start"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(5 * time.Second)
+	future, err := fsm.EventAsync(ctx, "start")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	select {
+	case <-future.Done():
+	default:
+		t.Fatal("expected future to be complete")
+	}
+	clock.Advance(time.Minute)
+	return trace
+}
+
+func TestDeterministicTrace(t *testing.T) {
+	first := runDeterministic(t)
+	second := runDeterministic(t)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected identical traces, got %+v and %+v", first, second)
+	}
+
+	var events []string
+	seen := make(map[uint64]bool)
+	for _, info := range first {
+		seen[info.ID] = true
+		events = append(events, info.Event)
+	}
+	for id := uint64(1); id <= uint64(len(first)); id++ {
+		if !seen[id] {
+			t.Errorf("expected IDs counted per FSM, got no %d", id)
+		}
+	}
+	// Observers are notified after the enter callbacks, which process the
+	// done sent by EventAsync and by the timeout of idle right away.
+	expected := []string{"start", "done", "done", "start", "done", "start"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %v, got %v", expected, events)
+	}
+	if first[1].SrcDuration != time.Second {
+		t.Errorf("expected durations from the clock, got %v", first[1].SrcDuration)
+	}
+}
+
+func TestDeterministicTimeouts(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "slow", Src: []string{"idle"}, Dst: "done"},
+			{Name: "stuck", Src: []string{"idle"}, Dst: "done"},
+		},
+		Callbacks{
+			"before_slow": func(ctx context.Context, e *Event) {
+				clock.Advance(2 * time.Second)
+			},
+			"leave_idle": func(ctx context.Context, e *Event) {
+				if e.Event == "stuck" {
+					clock.Advance(10 * time.Second)
+				}
+			},
+		},
+		WithDeterministic(clock),
+		WithCallbackTimeouts(CallbackTimeouts{Before: time.Second}),
+		WithTransitionTimeout(5*time.Second),
+	)
+	ctx := context.Background()
+
+	err := fsm.Event(ctx, "slow")
+	var timeout CallbackTimeoutError
+	if !errors.As(err, &timeout) || timeout.Callback != "before_slow" {
+		t.Errorf("expected 'CallbackTimeoutError', got %v", err)
+	}
+	if _, ok := fsm.Event(ctx, "stuck").(TransitionTimeoutError); !ok {
+		t.Errorf("expected 'TransitionTimeoutError', got %v", err)
+	}
+	if fsm.Current() != "idle" {
+		t.Errorf("expected state to be unchanged, got %s", fsm.Current())
+	}
+}
+
+func TestDeterministicRun(t *testing.T) {
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "working"},
+		},
+		Callbacks{},
+		WithDeterministic(&manualClock{}),
+	)
+	if err := fsm.Run(context.Background()); err != nil {
+		t.Errorf("expected Run to return right away, got %v", err)
+	}
+	if err := <-fsm.Send(context.Background(), "start"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// AddTransition adds the transitions described by e to the FSM, for example
+// when the rules change at runtime. It is safe to call concurrently with other
+// methods, but not from within callbacks or guards.
+//
+// The source states must already be known to the FSM, or be AnyState, so that
+// new states can only be connected to the existing graph as destinations.
+// Otherwise a DisconnectedStateError is returned and nothing is added, like
+// the ReservedEventError for DoneEvent if the FSM has no composite states.
+//
+// Callbacks passed to NewFSM are bound when the FSM is constructed, so
+// callbacks for states or events that are new to the FSM have to be added with
+// On after the transition has been added.
+func (f *FSM) AddTransition(e EventDesc) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	if e.Name == DoneEvent && f.submachines == nil {
+		return ReservedEventError{DoneEvent}
+	}
+	states := f.knownStates()
+	for _, src := range e.Src {
+		if src != AnyState && !states[src] {
+			return DisconnectedStateError{src}
+		}
+	}
+	for _, src := range e.Src {
+		f.addTransitionRule(eKey{e.Name, src}, newTransitionRule(e))
+	}
+	f.storeVerdicts()
+	return nil
+}
+
+// RemoveTransition removes all transitions for event from the source state src,
+// which can also be AnyState. It is safe to call concurrently with other
+// methods, but not from within callbacks or guards.
+//
+// An InvalidEventError is returned if there is no such transition.
+func (f *FSM) RemoveTransition(event, src string) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	key := eKey{event, src}
+	if _, ok := f.transitions[key]; !ok {
+		return InvalidEventError{event, src}
+	}
+	delete(f.transitions, key)
+	f.storeVerdicts()
+	return nil
+}
+
+// knownStates returns the set of states used in the transitions and the
+// current state. Callers must hold stateMu.
+func (f *FSM) knownStates() map[string]bool {
+	states := map[string]bool{f.current: true}
+	for key, rules := range f.transitions {
+		if key.src != AnyState {
+			states[key.src] = true
+		}
+		for _, rule := range rules {
+			if rule.kind != KindInternal {
+				states[rule.dst] = true
+			}
+		}
+	}
+	return states
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestAddTransition(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+	fsm.SetMetadata("tenant", "acme")
+
+	err := fsm.AddTransition(EventDesc{Name: "lock", Src: []string{"closed"}, Dst: "locked"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err = fsm.AddTransition(EventDesc{Name: "unlock", Src: []string{"locked"}, Dst: "closed"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := fsm.Event(context.Background(), "lock"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "locked" {
+		t.Errorf("expected state to be 'locked', was '%s'", fsm.Current())
+	}
+	if err := fsm.Event(context.Background(), "unlock"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if v, _ := fsm.Metadata("tenant"); v != "acme" {
+		t.Error("expected metadata to be kept")
+	}
+}
+
+func TestAddTransitionDisconnected(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+	)
+	err := fsm.AddTransition(EventDesc{Name: "fly", Src: []string{"open", "island"}, Dst: "sky"})
+	if e, ok := err.(DisconnectedStateError); !ok || e.State != "island" {
+		t.Errorf("expected 'DisconnectedStateError' for 'island', got %v", err)
+	}
+	fsm.SetState("open")
+	if _, ok := fsm.Event(context.Background(), "fly").(UnknownEventError); !ok {
+		t.Error("expected nothing to be added for a disconnected state")
+	}
+	if err := fsm.AddTransition(EventDesc{Name: "reset", Src: []string{AnyState}, Dst: "closed"}); err != nil {
+		t.Errorf("expected no error for AnyState, got %v", err)
+	}
+}
+
+func TestRemoveTransition(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+	if err := fsm.RemoveTransition("open", "closed"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Can("open") {
+		t.Error("expected 'open' to be removed")
+	}
+	if _, ok := fsm.Event(context.Background(), "open").(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError'")
+	}
+	err := fsm.RemoveTransition("close", "closed")
+	if _, ok := err.(InvalidEventError); !ok {
+		t.Errorf("expected 'InvalidEventError', got %v", err)
+	}
+}
+
+func TestAddTransitionConcurrently(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = fsm.AddTransition(EventDesc{Name: "kick", Src: []string{"closed"}, Dst: "broken"})
+			_ = fsm.RemoveTransition("kick", "closed")
+		}()
+		go func() {
+			defer wg.Done()
+			_ = fsm.Event(context.Background(), "open")
+			_ = fsm.Event(context.Background(), "close")
+			_ = Visualize(fsm)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// EffectHandler performs a named side effect of a transition, like sending an
+// email or charging a card. Event is the event info of the transition.
+type EffectHandler func(context.Context, *Event) error
+
+// EffectRegistry maps the names of side effects to their handlers.
+type EffectRegistry map[string]EffectHandler
+
+// WithEffects registers the handlers for the side effects that transitions
+// declare in EventDesc.Effects. It can be given more than once; later handlers
+// replace earlier ones with the same name.
+//
+// The effects of a transition are performed in the declared order after the
+// leave callbacks and before the state is changed. If an effect fails, or has
+// no registered handler, the remaining effects are skipped, the state is left
+// unchanged and Event returns an EffectError. For internal transitions the
+// effects are performed before the after callbacks. Effects are not performed
+// for replayed events, see SetReplay.
+func WithEffects(registry EffectRegistry) Option {
+	return func(f *FSM) {
+		if f.effects == nil {
+			f.effects = make(EffectRegistry)
+		}
+		for name, handler := range registry {
+			f.effects[name] = handler
+		}
+	}
+}
+
+// performEffects performs the named side effects of the transition of e.
+func (f *FSM) performEffects(ctx context.Context, e *Event, effects []string) error {
+	if e.Replay {
+		return nil
+	}
+	for _, name := range effects {
+		handler, ok := f.effects[name]
+		if !ok {
+			return EffectError{name, UnknownEffectError{name}}
+		}
+		if err := handler(ctx, e); err != nil {
+			return EffectError{name, err}
+		}
+	}
+	return nil
+}
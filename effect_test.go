@@ -0,0 +1,150 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEffects(t *testing.T) {
+	var order []string
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card", "send_receipt"}},
+		},
+		Callbacks{
+			"leave_pending": func(_ context.Context, e *Event) {
+				order = append(order, "leave")
+			},
+			"enter_paid": func(_ context.Context, e *Event) {
+				order = append(order, "enter")
+			},
+		},
+		WithEffects(EffectRegistry{
+			"charge_card": func(_ context.Context, e *Event) error {
+				order = append(order, "charge_card")
+				return nil
+			},
+			"send_receipt": func(_ context.Context, e *Event) error {
+				order = append(order, "send_receipt:"+e.FSM.Current())
+				return nil
+			},
+		}),
+	)
+
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+	expected := []string{"leave", "charge_card", "send_receipt:pending", "enter"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected order %v, got %v", expected, order)
+	}
+}
+
+func TestEffectFailure(t *testing.T) {
+	declined := errors.New("card declined")
+	receiptSent := false
+	entered := false
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card", "send_receipt"}},
+		},
+		Callbacks{
+			"enter_paid": func(_ context.Context, e *Event) {
+				entered = true
+			},
+		},
+		WithEffects(EffectRegistry{
+			"charge_card": func(_ context.Context, e *Event) error {
+				return declined
+			},
+			"send_receipt": func(_ context.Context, e *Event) error {
+				receiptSent = true
+				return nil
+			},
+		}),
+	)
+
+	err := fsm.Event(context.Background(), "pay")
+	var effectErr EffectError
+	if !errors.As(err, &effectErr) || effectErr.Effect != "charge_card" {
+		t.Fatalf("expected EffectError for charge_card, got %v", err)
+	}
+	if !errors.Is(err, declined) {
+		t.Error("expected error to wrap the effect error")
+	}
+	if fsm.Current() != "pending" {
+		t.Errorf("expected state to be 'pending', got %s", fsm.Current())
+	}
+	if receiptSent || entered {
+		t.Error("expected remaining effects and enter callbacks to be skipped")
+	}
+
+	// The FSM must not be stuck in a transition.
+	if err := fsm.Event(context.Background(), "pay"); !errors.As(err, &effectErr) {
+		t.Errorf("expected EffectError again, got %v", err)
+	}
+}
+
+func TestUnknownEffect(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card"}},
+		},
+		Callbacks{},
+	)
+
+	err := fsm.Event(context.Background(), "pay")
+	var unknownErr UnknownEffectError
+	if !errors.As(err, &unknownErr) || unknownErr.Effect != "charge_card" {
+		t.Errorf("expected UnknownEffectError, got %v", err)
+	}
+	if fsm.Current() != "pending" {
+		t.Errorf("expected state to be 'pending', got %s", fsm.Current())
+	}
+}
+
+func TestInternalTransitionEffects(t *testing.T) {
+	performed := false
+	fsm := NewFSM(
+		"active",
+		Events{
+			{Name: "ping", Src: []string{"active"}, Kind: KindInternal, Effects: []string{"pong"}},
+		},
+		Callbacks{},
+		WithEffects(EffectRegistry{
+			"pong": func(_ context.Context, e *Event) error {
+				performed = true
+				return nil
+			},
+		}),
+	)
+
+	if err := fsm.Event(context.Background(), "ping"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !performed {
+		t.Error("expected effect to be performed")
+	}
+}
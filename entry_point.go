@@ -0,0 +1,96 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// WithEntryPoint adds the entry point name to the composite state, so that a
+// transition with EventDesc.Entry set to name enters state with its child at
+// states[0] instead of its initial state. For a state with regions, states
+// are the states of the regions in order; the regions without a state are
+// entered as usual. Such an entry point is a fork of the regions, which can be
+// joined again with WithJoinStates.
+func WithEntryPoint(state, name string, states ...string) Option {
+	return func(f *FSM) {
+		if f.entryPoints == nil {
+			f.entryPoints = make(map[string]map[string][]string)
+		}
+		if f.entryPoints[state] == nil {
+			f.entryPoints[state] = make(map[string][]string)
+		}
+		f.entryPoints[state][name] = states
+	}
+}
+
+// WithExitPoint adds the exit point name to the composite state: when an
+// event handled by its child, or by one of its regions, leaves it in one of
+// states, the FSM is sent the event name with Event, which usually leaves the
+// composite state. If that event fails, the event handled by the child
+// returns an ExitEventError.
+func WithExitPoint(state, name string, states ...string) Option {
+	return func(f *FSM) {
+		if f.exitPoints == nil {
+			f.exitPoints = make(map[string]map[string]string)
+		}
+		if f.exitPoints[state] == nil {
+			f.exitPoints[state] = make(map[string]string)
+		}
+		for _, s := range states {
+			f.exitPoints[state][s] = name
+		}
+	}
+}
+
+// exit sends the event of the exit point reached by a child of state, if any,
+// then the event of the first join point whose states are reached by the
+// regions, and otherwise joins the children if they are complete.
+func (f *FSM) exit(ctx context.Context, state string) error {
+	if points := f.exitPoints[state]; points != nil {
+		for _, s := range f.submachines[state] {
+			if event, ok := points[s.child.liveState()]; ok {
+				return f.exitEvent(ctx, event, true)
+			}
+		}
+	}
+	for _, j := range f.joinPoints[state] {
+		if j.reached(f.submachines[state]) {
+			return f.exitEvent(ctx, j.event, true)
+		}
+	}
+	return f.join(ctx, state)
+}
+
+// exitEvent sends event to the FSM with Event, so that it goes through the
+// middleware and is observed like any other event. Unless required, it is
+// ignored if the FSM cannot handle it. A failure is returned as an
+// ExitEventError, as the transitions of the children are not undone.
+func (f *FSM) exitEvent(ctx context.Context, event string, required bool) error {
+	err := f.Event(withoutEventKeys(ctx), event)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case NoTransitionError:
+		if e.Err == nil {
+			return nil
+		}
+	case UnknownEventError, InvalidEventError:
+		if !required {
+			return nil
+		}
+	}
+	return ExitEventError{event, err}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEntryPoint(t *testing.T) {
+	child := NewFSM(
+		"loading",
+		Events{
+			{Name: "loaded", Src: []string{"loading"}, Dst: "ready"},
+			{Name: "fail", Src: []string{"loading", "ready"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: "resume", Src: []string{"idle"}, Dst: "running", Entry: "warm"},
+			{Name: "crash", Src: []string{"running"}, Dst: "crashed"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, ResetSubmachine),
+		WithEntryPoint("running", "warm", "ready"),
+		WithExitPoint("running", "crash", "failed"),
+	)
+	ctx := context.Background()
+
+	if err := fsm.Event(ctx, "resume"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"running", "ready"}) {
+		t.Errorf("expected child to be entered at the entry point, got %v", states)
+	}
+
+	fsm.SetState("idle")
+	if err := fsm.Event(ctx, "start"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"running", "loading"}) {
+		t.Errorf("expected child to be entered at its initial state, got %v", states)
+	}
+}
+
+func TestExitPoint(t *testing.T) {
+	child := NewFSM(
+		"loading",
+		Events{
+			{Name: "loaded", Src: []string{"loading"}, Dst: "ready"},
+			{Name: "fail", Src: []string{"loading", "ready"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: "resume", Src: []string{"idle"}, Dst: "running", Entry: "warm"},
+			{Name: "crash", Src: []string{"running"}, Dst: "crashed"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, ResetSubmachine),
+		WithEntryPoint("running", "warm", "ready"),
+		WithExitPoint("running", "crash", "failed"),
+	)
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "start")
+
+	if err := fsm.Event(ctx, "fail"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"crashed"}) {
+		t.Errorf("expected exit point to leave the composite state, got %v", states)
+	}
+}
+
+func TestExitPointEvent(t *testing.T) {
+	child := NewFSM(
+		"loading",
+		Events{
+			{Name: "fail", Src: []string{"loading"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	canceled := errors.New("not now")
+	fsm := NewFSM(
+		"running",
+		Events{
+			{Name: "crash", Src: []string{"running"}, Dst: "crashed"},
+		},
+		Callbacks{
+			"before_crash": func(_ context.Context, e *Event) {
+				e.Cancel(canceled)
+			},
+		},
+		WithSubmachine("running", child, ResetSubmachine),
+		WithExitPoint("running", "crash", "failed"),
+	)
+	var events []string
+	fsm.Use(func(next EventHandler) EventHandler {
+		return func(ctx context.Context, event string, args ...interface{}) error {
+			events = append(events, event)
+			return next(ctx, event, args...)
+		}
+	})
+
+	err := fsm.Event(context.Background(), "fail")
+	var exitErr ExitEventError
+	if !errors.As(err, &exitErr) || exitErr.Event != "crash" || !errors.Is(err, canceled) {
+		t.Fatalf("expected 'ExitEventError' for crash, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"running", "failed"}) {
+		t.Errorf("expected the transition of the child to stay, got %v", states)
+	}
+	if !reflect.DeepEqual(events, []string{"fail", "crash"}) {
+		t.Errorf("expected the middleware to see [fail crash], got %v", events)
+	}
+}
+
+func TestEntryPointRegions(t *testing.T) {
+	newRegion := func(initial, dst string) *FSM {
+		return NewFSM(
+			initial,
+			Events{
+				{Name: "advance", Src: []string{initial}, Dst: dst},
+			},
+			Callbacks{},
+		)
+	}
+	payment, shipping := newRegion("unpaid", "paid"), newRegion("packing", "shipped")
+	fsm := NewFSM(
+		"new",
+		Events{
+			{Name: "reship", Src: []string{"new"}, Dst: "processing", Entry: "paid"},
+		},
+		Callbacks{},
+		WithRegions("processing", ResetSubmachine, Region{FSM: payment}, Region{FSM: shipping}),
+		WithEntryPoint("processing", "paid", "paid"),
+	)
+
+	if err := fsm.Event(context.Background(), "reship"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"processing", "paid", "packing"}) {
+		t.Errorf("expected only the first region to be entered at the entry point, got %v", states)
+	}
+}
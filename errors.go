@@ -16,6 +16,10 @@ package fsm
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
 )
 
 // InvalidEventError is returned by FSM.Event() when the event cannot be called
@@ -29,6 +33,86 @@ func (e InvalidEventError) Error() string {
 	return "event " + e.Event + " inappropriate in current state " + e.State
 }
 
+// StateChangedError is returned by FSM.EventIf() when the current state is not
+// the expected source state.
+type StateChangedError struct {
+	Event    string
+	Expected string
+	State    string
+}
+
+func (e StateChangedError) Error() string {
+	return "event " + e.Event + " expected state " + e.Expected + " but current state is " + e.State
+}
+
+// UnavailableError is returned by FSM.Event() when the FSM is unavailable,
+// for example because it is paused, see WithUnavailableStrategies.
+type UnavailableError struct {
+	Event  string
+	State  string
+	Reason Unavailability
+}
+
+func (e UnavailableError) Error() string {
+	return "event " + e.Event + " inappropriate because fsm is " + e.Reason.String() + " in state " + e.State
+}
+
+// SetStateRejectedError is returned by FSM.SetStateWithReason() when the call
+// is not allowed by the policy set with WithSetStatePolicy.
+type SetStateRejectedError struct {
+	State  string
+	Reason string
+	Caller string
+}
+
+func (e SetStateRejectedError) Error() string {
+	msg := "set state " + e.State + " rejected for caller " + e.Caller
+	if e.Reason != "" {
+		return msg + " with reason " + e.Reason
+	}
+	return msg
+}
+
+// MachineCompletedError is returned by FSM.Event() when the FSM is in a final
+// state, see WithFinalStates.
+type MachineCompletedError struct {
+	Event string
+	State string
+}
+
+func (e MachineCompletedError) Error() string {
+	return "event " + e.Event + " inappropriate because fsm completed in final state " + e.State
+}
+
+// ExitEventError is returned by FSM.Event() when a submachine handled the
+// event, but the event that the FSM was sent for the exit point, join or
+// completion that the submachine reached failed, see WithExitPoint. The
+// transition of the submachine is not undone.
+type ExitEventError struct {
+	Event string
+	Err   error
+}
+
+func (e ExitEventError) Error() string {
+	return "exit event " + e.Event + " failed: " + e.Err.Error()
+}
+
+func (e ExitEventError) Unwrap() error {
+	return e.Err
+}
+
+// ReservedEventError is the panic of NewFSM(), and is returned by
+// FSM.AddTransition(), when a FSM without composite states defines a
+// transition for DoneEvent, which is reserved for the completion of
+// submachines.
+type ReservedEventError struct {
+	Event string
+}
+
+func (e ReservedEventError) Error() string {
+	return "event " + e.Event + " is reserved for the completion of submachines"
+}
+
 // UnknownEventError is returned by FSM.Event() when the event is not defined.
 type UnknownEventError struct {
 	Event string
@@ -82,6 +166,54 @@ func (e CanceledError) Error() string {
 	return "transition canceled"
 }
 
+func (e CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// LateCancelError is returned by FSM.Event() when a callback called
+// Event.Cancel after the state had already changed, in an enter_ or after_
+// callback.
+type LateCancelError struct {
+	// Callback is the name of the callback that called Cancel.
+	Callback string
+	// Err is the optional error passed to Cancel.
+	Err error
+}
+
+func (e LateCancelError) Error() string {
+	msg := "transition canceled too late in callback " + e.Callback
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e LateCancelError) Unwrap() error {
+	return e.Err
+}
+
+// RetryScheduledError is returned by FSM.Event() when the transition was
+// canceled with a retryable error and the next attempt has been scheduled,
+// because of WithRetry with RetryPolicy.Schedule. The result of the next
+// attempt is reported by Retry, and is itself a RetryScheduledError if yet
+// another attempt has been scheduled.
+type RetryScheduledError struct {
+	Event string
+	// Attempt is the number of the scheduled attempt.
+	Attempt int
+	// Err is the error of the failed attempt.
+	Err   error
+	Retry *ScheduledEvent
+}
+
+func (e RetryScheduledError) Error() string {
+	return "event " + e.Event + " attempt " + strconv.Itoa(e.Attempt) + " scheduled after error: " + e.Err.Error()
+}
+
+func (e RetryScheduledError) Unwrap() error {
+	return e.Err
+}
+
 // AsyncError is returned by FSM.Event() when a callback have initiated an
 // asynchronous state transition.
 type AsyncError struct {
@@ -98,6 +230,48 @@ func (e AsyncError) Error() string {
 	return "async started"
 }
 
+// DetachedError is returned by FSM.Event() when the deadline of its context
+// was exceeded while the transition was still running, because of
+// WithDetachOnDeadline. The transition goes on in the background; use
+// Transition to wait for its result or to cancel it.
+type DetachedError struct {
+	Event string
+	// Err is the error of the context passed to Event.
+	Err        error
+	Transition *DetachedTransition
+}
+
+func (e DetachedError) Error() string {
+	return "event " + e.Event + " detached: " + e.Err.Error()
+}
+
+func (e DetachedError) Unwrap() error {
+	return e.Err
+}
+
+// AsyncPhaseError is returned by FSM.Event() when Event.Async was called
+// outside of a leave_<STATE> or leave_state callback.
+type AsyncPhaseError struct {
+	// Callback is the name of the callback that called Async, or empty if it
+	// was not called from a callback.
+	Callback string
+}
+
+func (e AsyncPhaseError) Error() string {
+	if e.Callback == "" {
+		return "async transition started outside of a callback, only leave callbacks can start it"
+	}
+	return "async transition started in callback " + e.Callback + ", only leave callbacks can start it"
+}
+
+// NotInitializedError is returned by the methods of a FSM when the FSM is nil
+// or was not created with NewFSM.
+type NotInitializedError struct{}
+
+func (e NotInitializedError) Error() string {
+	return "fsm is not initialized, use NewFSM"
+}
+
 // InternalError is returned by FSM.Event() and should never occur. It is a
 // probably because of a bug.
 type InternalError struct{}
@@ -105,3 +279,280 @@ type InternalError struct{}
 func (e InternalError) Error() string {
 	return "internal error on state transition"
 }
+
+// DuplicateCallbackError is returned by MergeCallbacks() when the same callback
+// key is defined in more than one of the merged maps.
+type DuplicateCallbackError struct {
+	Key string
+}
+
+func (e DuplicateCallbackError) Error() string {
+	return "callback " + e.Key + " defined more than once"
+}
+
+// ConflictingEventError is returned by Compose() when more than one fragment
+// defines an unconditional transition for the same event and source state.
+type ConflictingEventError struct {
+	Event string
+	State string
+}
+
+func (e ConflictingEventError) Error() string {
+	return "event " + e.Event + " from state " + e.State + " defined by more than one fragment"
+}
+
+// GuardFailedError is returned by FSM.Event() when the guard of the transition
+// did not allow the event in the current state.
+type GuardFailedError struct {
+	Event string
+	State string
+}
+
+func (e GuardFailedError) Error() string {
+	return "event " + e.Event + " rejected by guard in current state " + e.State
+}
+
+// GuardMutationError is returned by FSM.Event() when a guard, unless condition
+// or validator wrote the metadata, see WithPureGuards.
+type GuardMutationError struct {
+	Event string
+	State string
+}
+
+func (e GuardMutationError) Error() string {
+	return "event " + e.Event + " rejected because a guard modified the metadata in current state " + e.State
+}
+
+// LoopDetectedError is returned by FSM.Event() when the transition would enter
+// a state more times than allowed by WithLoopDetection.
+type LoopDetectedError struct {
+	Event string
+	State string
+	Count int
+}
+
+func (e LoopDetectedError) Error() string {
+	return "event " + e.Event + " would enter state " + e.State + " " + strconv.Itoa(e.Count) + " times"
+}
+
+// DisconnectedStateError is returned by FSM.AddTransition() when a source state
+// is not connected to the existing states of the FSM.
+type DisconnectedStateError struct {
+	State string
+}
+
+func (e DisconnectedStateError) Error() string {
+	return "state " + e.State + " is not connected to the existing states"
+}
+
+// UnknownCallbackError is returned by FSM.On() when the name of the callback
+// does not refer to a known event or state.
+type UnknownCallbackError struct {
+	Name string
+}
+
+func (e UnknownCallbackError) Error() string {
+	return "callback " + e.Name + " does not refer to a known event or state"
+}
+
+// InvalidDataError is returned by FSM.BindData() when the data is not a pointer
+// to a struct, and by FSM.UnmarshalData() and FSM.DataAs() when no data is
+// bound.
+type InvalidDataError struct {
+	Type reflect.Type
+}
+
+func (e InvalidDataError) Error() string {
+	if e.Type == nil {
+		return "no data bound"
+	}
+	return "data of type " + e.Type.String() + " is not a pointer to a struct"
+}
+
+// DataTypeError is returned by FSM.DataAs() when the bound data can not be
+// stored where the given pointer points to.
+type DataTypeError struct {
+	Data   reflect.Type
+	Target reflect.Type
+}
+
+func (e DataTypeError) Error() string {
+	return fmt.Sprintf("data of type %v can not be stored in %v", e.Data, e.Target)
+}
+
+// EffectError is returned by FSM.Event() when a side effect of the transition
+// failed.
+type EffectError struct {
+	Effect string
+	Err    error
+}
+
+func (e EffectError) Error() string {
+	return "effect " + e.Effect + " failed: " + e.Err.Error()
+}
+
+func (e EffectError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownEffectError is wrapped in an EffectError when no handler has been
+// registered for a side effect.
+type UnknownEffectError struct {
+	Effect string
+}
+
+func (e UnknownEffectError) Error() string {
+	return "no handler for effect " + e.Effect
+}
+
+// CallbackPanicError is returned by FSM.Event() when a callback panicked and
+// the panic was recovered because of WithRecoverCallbacks.
+type CallbackPanicError struct {
+	// Callback is the name of the callback, like "enter_open".
+	Callback string
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e CallbackPanicError) Error() string {
+	return "callback " + e.Callback + " panicked: " + fmt.Sprint(e.Value)
+}
+
+// CallbackTimeoutError is returned by FSM.Event() when a callback ran longer
+// than allowed by WithCallbackTimeouts.
+type CallbackTimeoutError struct {
+	Callback string
+	Timeout  time.Duration
+}
+
+func (e CallbackTimeoutError) Error() string {
+	return "callback " + e.Callback + " timed out after " + e.Timeout.String()
+}
+
+// TransitionTimeoutError is returned by FSM.Event() when the callbacks of a
+// transition ran longer than allowed by WithTransitionTimeout.
+type TransitionTimeoutError struct {
+	Event   string
+	Timeout time.Duration
+}
+
+func (e TransitionTimeoutError) Error() string {
+	return "event " + e.Event + " timed out after " + e.Timeout.String()
+}
+
+// ValidationError is returned by FSM.Event() when the validator of the
+// transition rejected the event arguments.
+type ValidationError struct {
+	Event string
+	Err   error
+}
+
+func (e ValidationError) Error() string {
+	return "event " + e.Event + " rejected by validator: " + e.Err.Error()
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// InvariantViolationError is returned by FSM.Event() when an invariant set
+// with WithInvariant does not hold after the transition. The state has
+// already changed.
+type InvariantViolationError struct {
+	Invariant string
+	State     string
+	Err       error
+}
+
+func (e InvariantViolationError) Error() string {
+	return "invariant " + e.Invariant + " violated in state " + e.State + ": " + e.Err.Error()
+}
+
+func (e InvariantViolationError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned by FSM.EventBatch() when one of the events failed.
+type BatchError struct {
+	// Index is the position of the failed event in the batch.
+	Index int
+	Event string
+	Err   error
+}
+
+func (e BatchError) Error() string {
+	return "batch event " + strconv.Itoa(e.Index) + " (" + e.Event + ") failed: " + e.Err.Error()
+}
+
+func (e BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ClosedError is returned by FSM.Send() when the FSM has been closed.
+type ClosedError struct{}
+
+func (e ClosedError) Error() string {
+	return "fsm is closed"
+}
+
+// StoppedError is returned by FSM.Send() when the FSM has been stopped, and
+// for the queued events that were not processed before Stop gave up.
+type StoppedError struct{}
+
+func (e StoppedError) Error() string {
+	return "fsm is stopped"
+}
+
+// DeferredError is returned by FSM.Event() when the event was inappropriate in
+// the current state and has been deferred because of WithDeferredEvents.
+type DeferredError struct {
+	Event string
+	State string
+}
+
+func (e DeferredError) Error() string {
+	return "event " + e.Event + " deferred in current state " + e.State
+}
+
+// DeadLetterQueueError is returned by FSM.RedeliverDeadLetters() when the sink
+// set with WithDeadLetters is not a DeadLetterQueue.
+type DeadLetterQueueError struct{}
+
+func (e DeadLetterQueueError) Error() string {
+	return "no dead letter queue to redeliver from"
+}
+
+// DebouncedError is returned by FSM.Event() when the event has been debounced
+// because of WithDebounce. It will be processed once no more calls are made
+// for Wait.
+type DebouncedError struct {
+	Event string
+	Wait  time.Duration
+}
+
+func (e DebouncedError) Error() string {
+	return "event " + e.Event + " debounced for " + e.Wait.String()
+}
+
+// ThrottledError is returned by FSM.Event() when the event has been dropped
+// because of WithThrottle.
+type ThrottledError struct {
+	Event    string
+	Interval time.Duration
+}
+
+func (e ThrottledError) Error() string {
+	return "event " + e.Event + " throttled to once every " + e.Interval.String()
+}
+
+// WouldBlockError is returned by FSM.TryEvent() when another event is being
+// processed.
+type WouldBlockError struct {
+	Event string
+}
+
+func (e WouldBlockError) Error() string {
+	return "event " + e.Event + " would block because another event is being processed"
+}
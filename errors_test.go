@@ -15,8 +15,11 @@
 package fsm
 
 import (
+	"context"
 	"errors"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestInvalidEventError(t *testing.T) {
@@ -28,6 +31,20 @@ func TestInvalidEventError(t *testing.T) {
 	}
 }
 
+func TestStateChangedError(t *testing.T) {
+	e := StateChangedError{Event: "open", Expected: "closed", State: "open"}
+	if e.Error() != "event open expected state closed but current state is open" {
+		t.Error("StateChangedError string mismatch")
+	}
+}
+
+func TestUnavailableError(t *testing.T) {
+	e := UnavailableError{Event: "open", State: "closed", Reason: UnavailablePaused}
+	if e.Error() != "event open inappropriate because fsm is paused in state closed" {
+		t.Error("UnavailableError string mismatch")
+	}
+}
+
 func TestUnknownEventError(t *testing.T) {
 	event := "invalid event"
 	e := UnknownEventError{Event: event}
@@ -73,6 +90,31 @@ func TestCanceledError(t *testing.T) {
 	}
 }
 
+func TestLateCancelError(t *testing.T) {
+	e := LateCancelError{Callback: "enter_open"}
+	if e.Error() != "transition canceled too late in callback enter_open" {
+		t.Error("LateCancelError string mismatch")
+	}
+	err := errors.New("boom")
+	e.Err = err
+	if e.Error() != "transition canceled too late in callback enter_open: boom" {
+		t.Error("LateCancelError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("expected LateCancelError to unwrap to the cancel error")
+	}
+}
+
+func TestRetryScheduledError(t *testing.T) {
+	e := RetryScheduledError{Event: "pay", Attempt: 2, Err: CanceledError{}}
+	if e.Error() != "event pay attempt 2 scheduled after error: transition canceled" {
+		t.Error("RetryScheduledError string mismatch")
+	}
+	if e.Unwrap() != (CanceledError{}) {
+		t.Error("RetryScheduledError unwrap mismatch")
+	}
+}
+
 func TestAsyncError(t *testing.T) {
 	e := AsyncError{}
 	if e.Error() != "async started" {
@@ -84,9 +126,239 @@ func TestAsyncError(t *testing.T) {
 	}
 }
 
+func TestDetachedError(t *testing.T) {
+	e := DetachedError{Event: "pay", Err: context.DeadlineExceeded}
+	if e.Error() != "event pay detached: context deadline exceeded" {
+		t.Error("DetachedError string mismatch")
+	}
+	if e.Unwrap() != context.DeadlineExceeded {
+		t.Error("DetachedError unwrap mismatch")
+	}
+}
+
+func TestAsyncPhaseError(t *testing.T) {
+	e := AsyncPhaseError{Callback: "enter_open"}
+	if e.Error() != "async transition started in callback enter_open, only leave callbacks can start it" {
+		t.Error("AsyncPhaseError string mismatch")
+	}
+	e.Callback = ""
+	if e.Error() != "async transition started outside of a callback, only leave callbacks can start it" {
+		t.Error("AsyncPhaseError string mismatch")
+	}
+}
+
+func TestNotInitializedError(t *testing.T) {
+	e := NotInitializedError{}
+	if e.Error() != "fsm is not initialized, use NewFSM" {
+		t.Error("NotInitializedError string mismatch")
+	}
+}
+
 func TestInternalError(t *testing.T) {
 	e := InternalError{}
 	if e.Error() != "internal error on state transition" {
 		t.Error("InternalError string mismatch")
 	}
 }
+
+func TestDuplicateCallbackError(t *testing.T) {
+	key := "enter_state"
+	e := DuplicateCallbackError{Key: key}
+	if e.Error() != "callback "+e.Key+" defined more than once" {
+		t.Error("DuplicateCallbackError string mismatch")
+	}
+}
+
+func TestConflictingEventError(t *testing.T) {
+	e := ConflictingEventError{Event: "open", State: "closed"}
+	if e.Error() != "event open from state closed defined by more than one fragment" {
+		t.Error("ConflictingEventError string mismatch")
+	}
+}
+
+func TestGuardFailedError(t *testing.T) {
+	event := "guarded event"
+	state := "state"
+	e := GuardFailedError{Event: event, State: state}
+	if e.Error() != "event "+e.Event+" rejected by guard in current state "+e.State {
+		t.Error("GuardFailedError string mismatch")
+	}
+}
+
+func TestGuardMutationError(t *testing.T) {
+	e := GuardMutationError{Event: "pay", State: "cart"}
+	if e.Error() != "event pay rejected because a guard modified the metadata in current state cart" {
+		t.Error("GuardMutationError string mismatch")
+	}
+}
+
+func TestLoopDetectedError(t *testing.T) {
+	e := LoopDetectedError{Event: "retry", State: "retrying", Count: 4}
+	if e.Error() != "event retry would enter state retrying 4 times" {
+		t.Error("LoopDetectedError string mismatch")
+	}
+}
+
+func TestDisconnectedStateError(t *testing.T) {
+	e := DisconnectedStateError{State: "island"}
+	if e.Error() != "state "+e.State+" is not connected to the existing states" {
+		t.Error("DisconnectedStateError string mismatch")
+	}
+}
+
+func TestUnknownCallbackError(t *testing.T) {
+	e := UnknownCallbackError{Name: "enter_nowhere"}
+	if e.Error() != "callback "+e.Name+" does not refer to a known event or state" {
+		t.Error("UnknownCallbackError string mismatch")
+	}
+}
+
+func TestInvalidDataError(t *testing.T) {
+	e := InvalidDataError{}
+	if e.Error() != "no data bound" {
+		t.Error("InvalidDataError string mismatch")
+	}
+	e.Type = reflect.TypeOf(1)
+	if e.Error() != "data of type int is not a pointer to a struct" {
+		t.Error("InvalidDataError string mismatch")
+	}
+}
+
+func TestEffectError(t *testing.T) {
+	err := errors.New("card declined")
+	e := EffectError{Effect: "charge_card", Err: err}
+	if e.Error() != "effect charge_card failed: card declined" {
+		t.Error("EffectError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("EffectError should unwrap to the effect error")
+	}
+}
+
+func TestUnknownEffectError(t *testing.T) {
+	e := UnknownEffectError{Effect: "charge_card"}
+	if e.Error() != "no handler for effect charge_card" {
+		t.Error("UnknownEffectError string mismatch")
+	}
+}
+
+func TestCallbackPanicError(t *testing.T) {
+	e := CallbackPanicError{Callback: "enter_open", Value: "boom"}
+	if e.Error() != "callback enter_open panicked: boom" {
+		t.Error("CallbackPanicError string mismatch")
+	}
+}
+
+func TestCallbackTimeoutError(t *testing.T) {
+	e := CallbackTimeoutError{Callback: "enter_open", Timeout: time.Second}
+	if e.Error() != "callback enter_open timed out after 1s" {
+		t.Error("CallbackTimeoutError string mismatch")
+	}
+}
+
+func TestTransitionTimeoutError(t *testing.T) {
+	e := TransitionTimeoutError{Event: "open", Timeout: time.Second}
+	if e.Error() != "event open timed out after 1s" {
+		t.Error("TransitionTimeoutError string mismatch")
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := errors.New("amount must be positive")
+	e := ValidationError{Event: "pay", Err: err}
+	if e.Error() != "event pay rejected by validator: amount must be positive" {
+		t.Error("ValidationError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("ValidationError should unwrap to the validator error")
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	err := errors.New("boom")
+	e := BatchError{Index: 2, Event: "pay", Err: err}
+	if e.Error() != "batch event 2 (pay) failed: boom" {
+		t.Error("BatchError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("expected BatchError to unwrap to the event error")
+	}
+}
+
+func TestClosedError(t *testing.T) {
+	e := ClosedError{}
+	if e.Error() != "fsm is closed" {
+		t.Error("ClosedError string mismatch")
+	}
+}
+
+func TestDeferredError(t *testing.T) {
+	e := DeferredError{Event: "ship", State: "pending"}
+	if e.Error() != "event ship deferred in current state pending" {
+		t.Error("DeferredError string mismatch")
+	}
+}
+
+func TestDebouncedError(t *testing.T) {
+	e := DebouncedError{Event: "update", Wait: time.Second}
+	if e.Error() != "event update debounced for 1s" {
+		t.Error("DebouncedError string mismatch")
+	}
+}
+
+func TestThrottledError(t *testing.T) {
+	e := ThrottledError{Event: "update", Interval: time.Second}
+	if e.Error() != "event update throttled to once every 1s" {
+		t.Error("ThrottledError string mismatch")
+	}
+}
+
+func TestWouldBlockError(t *testing.T) {
+	e := WouldBlockError{Event: "open"}
+	if e.Error() != "event open would block because another event is being processed" {
+		t.Error("WouldBlockError string mismatch")
+	}
+}
+
+func TestStoppedError(t *testing.T) {
+	e := StoppedError{}
+	if e.Error() != "fsm is stopped" {
+		t.Error("StoppedError string mismatch")
+	}
+}
+
+func TestDeadLetterQueueError(t *testing.T) {
+	e := DeadLetterQueueError{}
+	if e.Error() != "no dead letter queue to redeliver from" {
+		t.Error("DeadLetterQueueError string mismatch")
+	}
+}
+
+func TestSetStateRejectedError(t *testing.T) {
+	e := SetStateRejectedError{State: "open", Caller: "main.main"}
+	if e.Error() != "set state open rejected for caller main.main" {
+		t.Error("SetStateRejectedError string mismatch")
+	}
+	e.Reason = "repair"
+	if e.Error() != "set state open rejected for caller main.main with reason repair" {
+		t.Error("SetStateRejectedError string mismatch")
+	}
+}
+
+func TestMachineCompletedError(t *testing.T) {
+	e := MachineCompletedError{Event: "open", State: "done"}
+	if e.Error() != "event open inappropriate because fsm completed in final state done" {
+		t.Error("MachineCompletedError string mismatch")
+	}
+}
+
+func TestInvariantViolationError(t *testing.T) {
+	err := errors.New("negative")
+	e := InvariantViolationError{Invariant: "balance", State: "open", Err: err}
+	if e.Error() != "invariant balance violated in state open: negative" {
+		t.Error("InvariantViolationError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("InvariantViolationError should unwrap to its error")
+	}
+}
@@ -14,6 +14,11 @@
 
 package fsm
 
+import (
+	"sync/atomic"
+	"time"
+)
+
 // Event is the info that get passed as a reference in the callbacks.
 type Event struct {
 	// FSM is an reference to the current FSM.
@@ -34,12 +39,60 @@ type Event struct {
 	// Args is an optional list of arguments passed to the callback.
 	Args []interface{}
 
+	// ID uniquely identifies the call to Event within the process, to
+	// correlate logs, metrics and asynchronous completions.
+	ID uint64
+
+	// StartedAt is the time Event was called.
+	StartedAt time.Time
+
+	// SrcDuration is the time the FSM had spent in Src when Event was
+	// called, see FSM.DurationInState.
+	SrcDuration time.Duration
+
+	// Duration is the time the transition took since StartedAt. It is set
+	// before the after callbacks are called and updated when Event returns,
+	// unless the transition is asynchronous.
+	Duration time.Duration
+
+	// Replay is true if the event is replayed to re-derive the state, see
+	// SetReplay. Callbacks should skip their side effects then.
+	Replay bool
+
+	// Tags are the tags of the transition, see EventDesc.Tags.
+	Tags []string
+
 	// canceled is an internal flag set if the transition is canceled.
 	canceled bool
 
+	// completed is an internal flag set once the transition is performed,
+	// even if it did not change the state.
+	completed bool
+
 	// async is an internal flag set if the transition should be asynchronous
 	async bool
 
+	// stopped is an internal flag set if the remaining callbacks of the
+	// current kind should be skipped.
+	stopped bool
+
+	// asyncDone is set atomically when an asynchronous transition completed
+	// or was canceled.
+	asyncDone int32
+
+	// record is the record of the state entered by the transition. State
+	// reads it by reference, so that publishing it does not allocate.
+	record StateRecord
+
+	// lateCancel is set if Cancel was called in an enter_ or after_ callback.
+	lateCancel *LateCancelError
+
+	// callback is the key of the callback being called, if any.
+	callback cKey
+
+	// progress is the last Progress reported with ReportProgress.
+	progress atomic.Value
+
 	// cancelFunc is called in case the event is canceled.
 	cancelFunc func()
 }
@@ -47,9 +100,28 @@ type Event struct {
 // Cancel can be called in before_<EVENT> or leave_<STATE> to cancel the
 // current transition before it happens. It takes an optional error, which will
 // overwrite e.Err if set before.
+//
+// In enter_ and after_ callbacks the state has already changed and the
+// transition can not be canceled anymore. Cancel sets e.Err to a
+// LateCancelError wrapping the optional error then, which is returned by
+// Event, and the remaining callbacks are still called. If a compensating
+// event is set for the event with WithCompensations, it is triggered when the
+// transition is done to undo it.
 func (e *Event) Cancel(err ...error) {
+	if t := e.callback.callbackType; t == callbackEnterState || t == callbackAfterEvent {
+		late := LateCancelError{Callback: e.callback.String()}
+		if len(err) > 0 {
+			late.Err = err[0]
+		}
+		e.Err = late
+		e.lateCancel = &late
+		return
+	}
+
 	e.canceled = true
-	e.cancelFunc()
+	if e.cancelFunc != nil {
+		e.cancelFunc()
+	}
 
 	if len(err) > 0 {
 		e.Err = err[0]
@@ -61,6 +133,31 @@ func (e *Event) Cancel(err ...error) {
 // The current state transition will be on hold in the old state until a final
 // call to Transition is made. This will complete the transition and possibly
 // call the other callbacks.
+//
+// Async can only be called in leave_<STATE> and leave_state callbacks. Calling
+// it anywhere else fails the callback with an AsyncPhaseError, like a callback
+// returning the error: in before_ callbacks the transition is canceled, in
+// enter_ and after_ callbacks the error is returned by Event. With
+// WithStrictAsync it panics instead.
 func (e *Event) Async() {
+	if e.callback.callbackType != callbackLeaveState {
+		err := AsyncPhaseError{}
+		if e.callback.callbackType != callbackNone {
+			err.Callback = e.callback.String()
+		}
+		if e.FSM != nil && e.FSM.strictAsync {
+			panic(err)
+		}
+		callbackFailed(e, e.callback.callbackType, err)
+		return
+	}
 	e.async = true
 }
+
+// StopPropagation can be called in any callback to skip the remaining
+// callbacks of the same kind, for example the other enter_<STATE> and the
+// enter_state callbacks when called in an enter_<STATE> callback. Callbacks of
+// the following kinds are still called.
+func (e *Event) StopPropagation() {
+	e.stopped = true
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	scheduledPending int32 = iota
+	scheduledDelivered
+	scheduledCanceled
+)
+
+// ScheduledEvent is an event scheduled with EventAfter.
+type ScheduledEvent struct {
+	fsm   *FSM
+	ctx   context.Context
+	timer Timer
+	state int32
+	done  chan struct{}
+	err   error
+}
+
+// Done returns a channel that is closed when the event has been processed or
+// canceled.
+func (s *ScheduledEvent) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error returned by Event for the event once Done is closed,
+// context.Canceled if it was canceled or a ClosedError if the FSM was closed
+// before the event was due. It returns nil before.
+func (s *ScheduledEvent) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Cancel prevents the event from being delivered. It returns false if the
+// event has already been delivered or canceled.
+func (s *ScheduledEvent) Cancel() bool {
+	return s.cancel(context.Canceled)
+}
+
+// cancel cancels the event with err if it is still pending.
+func (s *ScheduledEvent) cancel(err error) bool {
+	if !atomic.CompareAndSwapInt32(&s.state, scheduledPending, scheduledCanceled) {
+		return false
+	}
+	s.timer.Stop()
+	s.fsm.unschedule(s)
+	s.err = err
+	close(s.done)
+	return true
+}
+
+// deliver triggers the event if it is still pending.
+func (s *ScheduledEvent) deliver(event string, args []interface{}) {
+	if !atomic.CompareAndSwapInt32(&s.state, scheduledPending, scheduledDelivered) {
+		return
+	}
+	s.fsm.unschedule(s)
+	s.err = s.fsm.Event(s.ctx, event, args...)
+	close(s.done)
+}
+
+// EventAfter triggers the named event with Event once delay has elapsed on
+// the clock of the FSM, for example to retry later or to send a reminder. The
+// event goes through the middleware, callbacks and observers like any other.
+//
+// The returned ScheduledEvent can be used to cancel the event before it is
+// due and to wait for its result. Events that are still scheduled when the FSM
+// is closed are canceled with a ClosedError.
+func (f *FSM) EventAfter(delay time.Duration, event string, args ...interface{}) *ScheduledEvent {
+	return f.eventAfter(context.Background(), delay, event, args)
+}
+
+// eventAfter schedules the event like EventAfter, to be triggered with ctx.
+func (f *FSM) eventAfter(ctx context.Context, delay time.Duration, event string, args []interface{}) *ScheduledEvent {
+	s := &ScheduledEvent{fsm: f, ctx: ctx, done: make(chan struct{})}
+	if !f.initialized() {
+		s.state = scheduledCanceled
+		s.err = NotInitializedError{}
+		close(s.done)
+		return s
+	}
+
+	f.scheduledMu.Lock()
+	defer f.scheduledMu.Unlock()
+	select {
+	case <-f.closed:
+		s.state = scheduledCanceled
+		s.err = ClosedError{}
+		close(s.done)
+		return s
+	default:
+	}
+	if f.scheduled == nil {
+		f.scheduled = make(map[*ScheduledEvent]struct{})
+	}
+	f.scheduled[s] = struct{}{}
+	s.timer = f.clock.AfterFunc(delay, func() {
+		s.deliver(event, args)
+	})
+	return s
+}
+
+// unschedule forgets about s once it is delivered or canceled.
+func (f *FSM) unschedule(s *ScheduledEvent) {
+	f.scheduledMu.Lock()
+	defer f.scheduledMu.Unlock()
+	delete(f.scheduled, s)
+}
+
+// cancelScheduled cancels the events that are still scheduled with err.
+func (f *FSM) cancelScheduled(err error) {
+	f.scheduledMu.Lock()
+	scheduled := make([]*ScheduledEvent, 0, len(f.scheduled))
+	for s := range f.scheduled {
+		scheduled = append(scheduled, s)
+	}
+	f.scheduledMu.Unlock()
+	for _, s := range scheduled {
+		s.cancel(err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventAfter(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"waiting",
+		Events{
+			{Name: "remind", Src: []string{"waiting"}, Dst: "reminded"},
+		},
+		Callbacks{},
+		WithClock(clock),
+	)
+
+	s := fsm.EventAfter(time.Minute, "remind")
+	clock.Advance(59 * time.Second)
+	if fsm.Current() != "waiting" {
+		t.Fatalf("expected state to be 'waiting', got %s", fsm.Current())
+	}
+	clock.Advance(time.Second)
+	<-s.Done()
+	if err := s.Err(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "reminded" {
+		t.Errorf("expected state to be 'reminded', got %s", fsm.Current())
+	}
+	if s.Cancel() {
+		t.Error("expected delivered event not to be canceled")
+	}
+
+	s = fsm.EventAfter(time.Minute, "remind")
+	clock.Advance(time.Minute)
+	<-s.Done()
+	if _, ok := s.Err().(InvalidEventError); !ok {
+		t.Errorf("expected 'InvalidEventError', got %v", s.Err())
+	}
+}
+
+func TestEventAfterCancel(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"waiting",
+		Events{
+			{Name: "remind", Src: []string{"waiting"}, Dst: "reminded"},
+		},
+		Callbacks{},
+		WithClock(clock),
+	)
+
+	s := fsm.EventAfter(time.Minute, "remind")
+	if s.Err() != nil {
+		t.Error("expected no error before the event is due")
+	}
+	if !s.Cancel() {
+		t.Fatal("expected event to be canceled")
+	}
+	if s.Cancel() {
+		t.Error("expected event to be canceled only once")
+	}
+	clock.Advance(time.Hour)
+	<-s.Done()
+	if s.Err() != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", s.Err())
+	}
+	if fsm.Current() != "waiting" {
+		t.Errorf("expected state to be 'waiting', got %s", fsm.Current())
+	}
+}
+
+func TestEventAfterClose(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"waiting",
+		Events{
+			{Name: "remind", Src: []string{"waiting"}, Dst: "reminded"},
+		},
+		Callbacks{},
+		WithClock(clock),
+	)
+
+	s := fsm.EventAfter(time.Minute, "remind")
+	fsm.Close()
+	<-s.Done()
+	if _, ok := s.Err().(ClosedError); !ok {
+		t.Errorf("expected 'ClosedError', got %v", s.Err())
+	}
+	s = fsm.EventAfter(time.Minute, "remind")
+	if _, ok := s.Err().(ClosedError); !ok {
+		t.Errorf("expected 'ClosedError' after close, got %v", s.Err())
+	}
+}
+
+func TestEventAfterRealClock(t *testing.T) {
+	fsm := NewFSM(
+		"waiting",
+		Events{
+			{Name: "remind", Src: []string{"waiting"}, Dst: "reminded"},
+		},
+		Callbacks{},
+	)
+	s := fsm.EventAfter(time.Millisecond, "remind")
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected event to be delivered")
+	}
+	if fsm.Current() != "reminded" {
+		t.Errorf("expected state to be 'reminded', got %s", fsm.Current())
+	}
+}
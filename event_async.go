@@ -0,0 +1,97 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// TransitionFuture is the result of an event sent with EventAsync.
+type TransitionFuture struct {
+	done chan struct{}
+	err  error
+}
+
+// Done returns a channel that is closed when the event has been processed,
+// including its enter and after callbacks.
+func (t *TransitionFuture) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the error returned by Event for the event, once Done is closed.
+// It returns nil before.
+func (t *TransitionFuture) Err() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// acceptKey is the context key of the function that is called when an event
+// sent with EventAsync has been accepted.
+type acceptKey struct{}
+
+// EventAsync initiates a state transition with the named event like Event,
+// but returns as soon as the state has changed, without waiting for the enter
+// and after callbacks. The returned future completes when they have been
+// called. Until the enter callbacks have been called, new events already see
+// the new state, while Current and the other readers still see the previous
+// state, see State.
+//
+// If the event fails before the state has changed, for example because it is
+// inappropriate in the current state or canceled by a callback, EventAsync
+// returns the error of Event and no future.
+func (f *FSM) EventAsync(ctx context.Context, event string, args ...interface{}) (*TransitionFuture, error) {
+	if !f.initialized() {
+		return nil, NotInitializedError{}
+	}
+	future := &TransitionFuture{done: make(chan struct{})}
+	accepted := make(chan struct{})
+	var once sync.Once
+	ctx = context.WithValue(ctx, acceptKey{}, func() {
+		once.Do(func() { close(accepted) })
+	})
+
+	process := func() {
+		future.err = f.Event(ctx, event, args...)
+		close(future.done)
+	}
+	if f.deterministic {
+		process()
+	} else {
+		go process()
+	}
+
+	select {
+	case <-accepted:
+	case <-future.done:
+		select {
+		case <-accepted:
+		default:
+			return nil, future.err
+		}
+	}
+	return future, nil
+}
+
+// acceptEvent notifies EventAsync that the event of ctx has been accepted.
+func acceptEvent(ctx context.Context) {
+	if accept, ok := ctx.Value(acceptKey{}).(func()); ok {
+		accept()
+	}
+}
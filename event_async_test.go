@@ -0,0 +1,116 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventAsync(t *testing.T) {
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"enter_open": func(context.Context, *Event) {
+				<-release
+			},
+		},
+	)
+
+	future, err := fsm.EventAsync(context.Background(), "open")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	select {
+	case <-future.Done():
+		t.Fatal("expected future not to be done before the enter callbacks return")
+	default:
+	}
+	if future.Err() != nil {
+		t.Errorf("expected no error before done, got %v", future.Err())
+	}
+	if _, ok := fsm.Event(context.Background(), "open").(InvalidEventError); !ok {
+		t.Error("expected the state to have changed")
+	}
+	if fsm.Current() != "closed" {
+		t.Error("expected readers to see the previous state until the enter callbacks return")
+	}
+
+	close(release)
+	select {
+	case <-future.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected future to be done")
+	}
+	if future.Err() != nil {
+		t.Errorf("expected no error, got %v", future.Err())
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestEventAsyncRejected(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_open": func(_ context.Context, e *Event) {
+				e.Cancel(errors.New("not now"))
+			},
+		},
+	)
+
+	future, err := fsm.EventAsync(context.Background(), "close")
+	if _, ok := err.(UnknownEventError); !ok || future != nil {
+		t.Errorf("expected 'UnknownEventError' and no future, got %v", err)
+	}
+	future, err = fsm.EventAsync(context.Background(), "open")
+	if _, ok := err.(CanceledError); !ok || future != nil {
+		t.Errorf("expected 'CanceledError' and no future, got %v", err)
+	}
+}
+
+func TestEventAsyncEnterError(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithErrCallbacks(CallbacksWithErr{
+			"enter_open": func(context.Context, *Event) error {
+				return errors.New("failed")
+			},
+		}),
+	)
+
+	future, err := fsm.EventAsync(context.Background(), "open")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-future.Done()
+	if future.Err() == nil || future.Err().Error() != "failed" {
+		t.Errorf("expected enter error from future, got %v", future.Err())
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// expectedSrcKey is the context key of the source state expected by EventIf.
+type expectedSrcKey struct{}
+
+// EventIf initiates a state transition with the named event like Event, but
+// only if the current state is expectedSrc. Otherwise it returns a
+// StateChangedError without calling any callbacks.
+//
+// The state is compared while holding the event lock, so no other event can
+// change the state between the comparison and the transition. This allows
+// goroutines to act on a state they observed earlier without holding a lock of
+// their own, retrying if the state has changed in the meantime.
+func (f *FSM) EventIf(ctx context.Context, expectedSrc, event string, args ...interface{}) error {
+	return f.Event(context.WithValue(ctx, expectedSrcKey{}, expectedSrc), event, args...)
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestEventIf(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "lock", Src: []string{"open", "closed"}, Dst: "locked"},
+		},
+		Callbacks{},
+	)
+
+	err := fsm.EventIf(context.Background(), "open", "lock")
+	if e, ok := err.(StateChangedError); !ok || e.Expected != "open" || e.State != "closed" {
+		t.Errorf("expected 'StateChangedError', got %v", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+
+	if err := fsm.EventIf(context.Background(), "closed", "lock"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "locked" {
+		t.Errorf("expected state to be 'locked', got %s", fsm.Current())
+	}
+}
+
+func TestEventIfConcurrently(t *testing.T) {
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "claim", Src: []string{"idle", "claimed"}, Dst: "claimed"},
+		},
+		Callbacks{},
+	)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claims := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fsm.EventIf(context.Background(), "idle", "claim"); err == nil {
+				mu.Lock()
+				claims++
+				mu.Unlock()
+			} else if _, ok := err.(StateChangedError); !ok {
+				t.Errorf("expected 'StateChangedError', got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if claims != 1 {
+		t.Errorf("expected exactly one claim, got %d", claims)
+	}
+}
+
+func TestEventIfChainedFromCallback(t *testing.T) {
+	send := map[string]func(f *FSM, ctx context.Context) error{
+		"EventIf": func(f *FSM, ctx context.Context) error {
+			return f.EventIf(ctx, "a", "go")
+		},
+		"TryEvent": func(f *FSM, ctx context.Context) error {
+			return f.TryEvent(ctx, "go")
+		},
+		"EventWait": func(f *FSM, ctx context.Context) error {
+			return f.EventWait(ctx, "go")
+		},
+	}
+	for name, fn := range send {
+		t.Run(name, func(t *testing.T) {
+			var chained error
+			fsm := NewFSM(
+				"a",
+				Events{
+					{Name: "go", Src: []string{"a"}, Dst: "b"},
+					{Name: "next", Src: []string{"b"}, Dst: "c"},
+				},
+				Callbacks{
+					"enter_b": func(ctx context.Context, e *Event) {
+						chained = e.FSM.Event(ctx, "next")
+					},
+				},
+			)
+			if err := fn(fsm, context.Background()); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if chained != nil {
+				t.Errorf("expected chained event to succeed, got %v", chained)
+			}
+			if fsm.Current() != "c" {
+				t.Errorf("expected state to be 'c', got %s", fsm.Current())
+			}
+		})
+	}
+}
+
+func TestWithoutEventKeys(t *testing.T) {
+	ctx := context.Background()
+	if withoutEventKeys(ctx) != ctx {
+		t.Error("expected context without keys to be returned as is")
+	}
+
+	type userKey struct{}
+	ctx = context.WithValue(ctx, userKey{}, "user")
+	ctx = context.WithValue(ctx, expectedSrcKey{}, "a")
+	ctx = context.WithValue(ctx, lockModeKey{}, lockTry)
+	ctx = context.WithValue(ctx, retryKey{}, true)
+	ctx = context.WithValue(ctx, redeliveryKey{}, true)
+	ctx = context.WithValue(ctx, rateLimitKey{}, rateLimited{"go", 1})
+	stripped := withoutEventKeys(ctx)
+	for _, key := range []interface{}{expectedSrcKey{}, lockModeKey{}, retryKey{}, redeliveryKey{}, rateLimitKey{}} {
+		if v := stripped.Value(key); v != nil {
+			t.Errorf("expected %T to be hidden, got %v", key, v)
+		}
+	}
+	if stripped.Value(userKey{}) != "user" {
+		t.Error("expected other values to be kept")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// eventLock is a mutex that can also be acquired without blocking or until a
+// context is done. It must be created with a capacity of 1.
+type eventLock chan struct{}
+
+// Lock acquires the lock, blocking until it is available.
+func (l eventLock) Lock() {
+	l <- struct{}{}
+}
+
+// Unlock releases the lock.
+func (l eventLock) Unlock() {
+	<-l
+}
+
+// TryLock acquires the lock if it is available and returns true if it did.
+func (l eventLock) TryLock() bool {
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// LockContext acquires the lock, blocking until it is available or ctx is
+// done. It returns the error of ctx if the lock was not acquired.
+func (l eventLock) LockContext(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lockMode is how an event waits for the event lock.
+type lockMode int
+
+const (
+	// lockBlock waits until the lock is available.
+	lockBlock lockMode = iota
+	// lockTry fails with a WouldBlockError if the lock is not available.
+	lockTry
+	// lockContext waits until the lock is available or the context is done.
+	lockContext
+)
+
+// lockModeKey is the context key of the lockMode of an event.
+type lockModeKey struct{}
+
+// TryEvent initiates a state transition with the named event like Event, but
+// fails fast with a WouldBlockError instead of waiting if another event is
+// being processed.
+func (f *FSM) TryEvent(ctx context.Context, event string, args ...interface{}) error {
+	return f.Event(context.WithValue(ctx, lockModeKey{}, lockTry), event, args...)
+}
+
+// EventWait initiates a state transition with the named event like Event, but
+// only waits for another event that is being processed until ctx is done. It
+// returns the error of ctx then.
+func (f *FSM) EventWait(ctx context.Context, event string, args ...interface{}) error {
+	return f.Event(context.WithValue(ctx, lockModeKey{}, lockContext), event, args...)
+}
+
+// lockEvent acquires the event lock for event in the lock mode of ctx.
+func (f *FSM) lockEvent(ctx context.Context, event string) error {
+	mode, _ := ctx.Value(lockModeKey{}).(lockMode)
+	switch mode {
+	case lockTry:
+		if !f.eventMu.TryLock() {
+			return WouldBlockError{event}
+		}
+	case lockContext:
+		return f.eventMu.LockContext(ctx)
+	default:
+		f.eventMu.Lock()
+	}
+	return nil
+}
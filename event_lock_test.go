@@ -0,0 +1,101 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTryEvent(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"before_open": func(context.Context, *Event) {
+				close(entered)
+				<-release
+			},
+		},
+	)
+
+	done := make(chan error)
+	go func() {
+		done <- fsm.Event(context.Background(), "open")
+	}()
+	<-entered
+
+	if _, ok := fsm.TryEvent(context.Background(), "close").(WouldBlockError); !ok {
+		t.Error("expected 'WouldBlockError'")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fsm.TryEvent(context.Background(), "close"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+}
+
+func TestEventWait(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"before_open": func(context.Context, *Event) {
+				close(entered)
+				<-release
+			},
+		},
+	)
+
+	done := make(chan error)
+	go func() {
+		done <- fsm.Event(context.Background(), "open")
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := fsm.EventWait(ctx, "close"); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fsm.EventWait(context.Background(), "close"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+}
@@ -4,7 +4,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/looplab/fsm"
@@ -22,14 +21,14 @@ func main() {
 
 	fmt.Println(fsm.Current())
 
-	err := fsm.Event(context.Background(), "open")
+	err := fsm.EventNoCtx("open")
 	if err != nil {
 		fmt.Println(err)
 	}
 
 	fmt.Println(fsm.Current())
 
-	err = fsm.Event(context.Background(), "close")
+	err = fsm.EventNoCtx("close")
 	if err != nil {
 		fmt.Println(err)
 	}
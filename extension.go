@@ -0,0 +1,100 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// Extension is a reusable plugin that hooks into the life cycle of a FSM, for
+// example to add metrics, logging or persistence. Extensions are installed with
+// the WithExtensions option.
+//
+// BaseExtension can be embedded to only implement some of the hooks.
+type Extension interface {
+	// Init is called once when the FSM is constructed, after all options have
+	// been applied.
+	Init(f *FSM)
+
+	// BeforeTransition is called when an event has been accepted in the current
+	// state, before any callbacks are called. It must not trigger new events.
+	BeforeTransition(ctx context.Context, e *Event)
+
+	// AfterTransition is called when Event returns for an event that has been
+	// passed to BeforeTransition, with the error returned to the caller.
+	AfterTransition(ctx context.Context, e *Event, err error)
+
+	// Shutdown is called when the FSM is closed with Close.
+	Shutdown()
+}
+
+// BaseExtension implements all hooks of Extension as no-ops. It can be
+// embedded in extensions that only need some of the hooks.
+type BaseExtension struct{}
+
+// Init implements Extension.
+func (BaseExtension) Init(*FSM) {}
+
+// BeforeTransition implements Extension.
+func (BaseExtension) BeforeTransition(context.Context, *Event) {}
+
+// AfterTransition implements Extension.
+func (BaseExtension) AfterTransition(context.Context, *Event, error) {}
+
+// Shutdown implements Extension.
+func (BaseExtension) Shutdown() {}
+
+// WithExtensions installs extensions on the FSM. The hooks of the extensions
+// are called in the order they are given, except Shutdown which is called in
+// reverse order.
+func WithExtensions(extensions ...Extension) Option {
+	return func(f *FSM) {
+		f.extensions = append(f.extensions, extensions...)
+	}
+}
+
+// Close shuts down the FSM, calling Shutdown on all installed extensions and
+// stopping the processing of events sent with Send. Calling Close more than
+// once has no effect.
+func (f *FSM) Close() {
+	if !f.initialized() {
+		return
+	}
+	f.closeOnce.Do(func() {
+		close(f.closed)
+		f.stopStateTimeout()
+		f.stopPeriodicEvents()
+		f.stopWatchdog()
+		f.cancelScheduled(ClosedError{})
+		f.stopDebounced()
+		for i := len(f.extensions) - 1; i >= 0; i-- {
+			f.extensions[i].Shutdown()
+		}
+	})
+}
+
+// beforeTransitionExtensions calls BeforeTransition on all extensions.
+func (f *FSM) beforeTransitionExtensions(ctx context.Context, e *Event) {
+	for _, ext := range f.extensions {
+		ext.BeforeTransition(ctx, e)
+	}
+}
+
+// afterTransitionExtensions calls AfterTransition on all extensions.
+func (f *FSM) afterTransitionExtensions(ctx context.Context, e *Event, err error) {
+	for _, ext := range f.extensions {
+		ext.AfterTransition(ctx, e, err)
+	}
+}
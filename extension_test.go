@@ -0,0 +1,115 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type recordingExtension struct {
+	BaseExtension
+	name  string
+	calls *[]string
+}
+
+func (r recordingExtension) Init(f *FSM) {
+	*r.calls = append(*r.calls, r.name+" init "+f.Current())
+}
+
+func (r recordingExtension) BeforeTransition(_ context.Context, e *Event) {
+	*r.calls = append(*r.calls, r.name+" before "+e.Event)
+}
+
+func (r recordingExtension) AfterTransition(_ context.Context, e *Event, err error) {
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+	*r.calls = append(*r.calls, r.name+" after "+e.Event+" "+result)
+}
+
+func (r recordingExtension) Shutdown() {
+	*r.calls = append(*r.calls, r.name+" shutdown")
+}
+
+func TestExtensions(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{
+			"enter_end": func(_ context.Context, e *Event) {
+				calls = append(calls, "enter_end")
+			},
+		},
+		WithExtensions(
+			recordingExtension{name: "a", calls: &calls},
+			recordingExtension{name: "b", calls: &calls},
+		),
+	)
+
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	_ = fsm.Event(context.Background(), "run")
+	fsm.Close()
+	fsm.Close()
+
+	wanted := []string{
+		"a init start",
+		"b init start",
+		"a before run",
+		"b before run",
+		"enter_end",
+		"a after run ok",
+		"b after run ok",
+		"b shutdown",
+		"a shutdown",
+	}
+	if !reflect.DeepEqual(calls, wanted) {
+		t.Errorf("expected calls %v, got %v", wanted, calls)
+	}
+}
+
+func TestExtensionsCanceledTransition(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{
+			"before_run": func(_ context.Context, e *Event) {
+				e.Cancel()
+			},
+		},
+		WithExtensions(recordingExtension{name: "a", calls: &calls}),
+	)
+
+	_ = fsm.Event(context.Background(), "run")
+
+	wanted := []string{
+		"a init start",
+		"a before run",
+		"a after run transition canceled",
+	}
+	if !reflect.DeepEqual(calls, wanted) {
+		t.Errorf("expected calls %v, got %v", wanted, calls)
+	}
+}
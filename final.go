@@ -0,0 +1,64 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// DoneEvent is the event that is emitted when a FSM reaches one of its final
+// states, see WithFinalStates. Its name is namespaced so that it does not
+// collide with the events of the FSM, and only a FSM with composite states
+// can define transitions for it, to handle the completion of its children.
+const DoneEvent = "fsm.done"
+
+// WithFinalStates marks states as final. Once the FSM reaches one of them it
+// is completed: the observers are notified of a DoneEvent transition from and
+// to the final state, and all further events are rejected with a
+// MachineCompletedError, as reported by Can, CanWith and AvailableTransitions.
+// SetState can still leave a final state.
+//
+// When the FSM is the child of a composite state, see WithSubmachine, and it
+// completes while handling an event passed by its parent, the parent handles
+// DoneEvent, which can be used to leave the composite state. For regions the
+// parent handles it once all of them have completed, unless WithJoin sets
+// another event.
+func WithFinalStates(states ...string) Option {
+	return func(f *FSM) {
+		if f.finalStates == nil {
+			f.finalStates = make(map[string]bool)
+		}
+		for _, state := range states {
+			f.finalStates[state] = true
+		}
+	}
+}
+
+// IsCompleted returns true if the FSM is in one of the states set with
+// WithFinalStates.
+func (f *FSM) IsCompleted() bool {
+	if !f.initialized() {
+		return false
+	}
+	return f.finalStates[f.Current()]
+}
+
+// notifyDone notifies the observers that the FSM completed in state.
+func (f *FSM) notifyDone(ctx context.Context, state string) {
+	if observers := f.observersFor(); len(observers) > 0 {
+		e := &Event{FSM: f, Event: DoneEvent, Src: state, Dst: state}
+		f.notifyObservers(ctx, observers, f.transitionID(), f.clock.Now(), DoneEvent, nil, e, nil)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFinalStates(t *testing.T) {
+	var events []string
+	fsm := NewFSM(
+		"open",
+		Events{
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithFinalStates("closed"),
+	)
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		events = append(events, info.Event+":"+info.Src+">"+info.Dst)
+	}))
+	ctx := context.Background()
+
+	if fsm.IsCompleted() {
+		t.Error("expected FSM not to be completed")
+	}
+	if err := fsm.Event(ctx, "close"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !fsm.IsCompleted() {
+		t.Error("expected FSM to be completed")
+	}
+	expected := []string{"close:open>closed", DoneEvent + ":closed>closed"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected observed events %v, got %v", expected, events)
+	}
+
+	err := fsm.Event(ctx, "open")
+	if e, ok := err.(MachineCompletedError); !ok || e.State != "closed" {
+		t.Errorf("expected 'MachineCompletedError', got %v", err)
+	}
+
+	fsm.SetState("open")
+	if fsm.IsCompleted() {
+		t.Error("expected SetState to leave the final state")
+	}
+	if !strings.Contains(GenerateDoc(fsm, DocOptions{}), "| closed (final) |") {
+		t.Error("expected final state in the generated doc")
+	}
+}
+
+func TestFinalStatesCan(t *testing.T) {
+	fsm := NewFSM(
+		"open",
+		Events{
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "reset", Src: []string{AnyState}, Dst: "open"},
+			{Name: "audit", Src: []string{"closed"}, Dst: "open", Guard: func(context.Context, GuardContext) bool {
+				return true
+			}},
+		},
+		Callbacks{},
+		WithFinalStates("closed"),
+	)
+	ctx := context.Background()
+	if err := fsm.Event(ctx, "close"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, event := range []string{"open", "reset", "audit"} {
+		if fsm.Can(event) || !fsm.Cannot(event) || fsm.CanWith(ctx, event) {
+			t.Errorf("expected %s to be impossible in a final state", event)
+		}
+		if _, ok := fsm.Event(ctx, event).(MachineCompletedError); !ok {
+			t.Errorf("expected 'MachineCompletedError' for %s", event)
+		}
+	}
+	if transitions := fsm.AvailableTransitions(); len(transitions) != 0 {
+		t.Errorf("expected no available transitions, got %v", transitions)
+	}
+
+	fsm.SetState("open")
+	if !fsm.Can("reset") || !fsm.CanWith(ctx, "reset") {
+		t.Error("expected reset to be possible after leaving the final state")
+	}
+}
+
+func TestFinalStatesSubmachine(t *testing.T) {
+	child := NewFSM(
+		"working",
+		Events{
+			{Name: "finish", Src: []string{"working"}, Dst: "finished"},
+		},
+		Callbacks{},
+		WithFinalStates("finished"),
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: DoneEvent, Src: []string{"running"}, Dst: "idle"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, ResetSubmachine),
+	)
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "start")
+
+	if err := fsm.Event(ctx, "finish"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "idle" || child.Current() != "working" {
+		t.Errorf("expected completion of the child to leave the composite state, got %v", fsm.ActiveStates())
+	}
+}
+
+func TestDoneEventReserved(t *testing.T) {
+	events := Events{
+		{Name: DoneEvent, Src: []string{"working"}, Dst: "finished"},
+	}
+	func() {
+		defer func() {
+			if _, ok := recover().(ReservedEventError); !ok {
+				t.Error("expected NewFSM to panic with 'ReservedEventError'")
+			}
+		}()
+		NewFSM("working", events, Callbacks{}, WithFinalStates("finished"))
+	}()
+
+	fsm := NewFSM("working", Events{}, Callbacks{})
+	if _, ok := fsm.AddTransition(events[0]).(ReservedEventError); !ok {
+		t.Error("expected 'ReservedEventError' from AddTransition")
+	}
+	child := NewFSM("working", Events{}, Callbacks{})
+	parent := NewFSM(
+		"running",
+		Events{
+			{Name: DoneEvent, Src: []string{"running"}, Dst: "idle"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, ResetSubmachine),
+	)
+	if !parent.Can(DoneEvent) {
+		t.Error("expected a FSM with composite states to handle DoneEvent")
+	}
+}
+
+func TestFinalStatesRegions(t *testing.T) {
+	newRegion := func() *FSM {
+		return NewFSM(
+			"working",
+			Events{
+				{Name: "finish", Src: []string{"working"}, Dst: "finished"},
+			},
+			Callbacks{},
+			WithFinalStates("finished"),
+		)
+	}
+	first, second := newRegion(), newRegion()
+	fsm := NewFSM(
+		"running",
+		Events{
+			{Name: DoneEvent, Src: []string{"running"}, Dst: "idle"},
+		},
+		Callbacks{},
+		WithRegions("running", ResetSubmachine, Region{FSM: first}, Region{FSM: second}),
+	)
+	ctx := context.Background()
+
+	if err := first.Event(ctx, "finish"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "running" {
+		t.Error("expected parent to wait for all regions")
+	}
+	// The completed region rejects the event, the other one handles it.
+	if err := fsm.Event(ctx, "finish"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "idle" {
+		t.Errorf("expected joint completion to leave the composite state, got %v", fsm.ActiveStates())
+	}
+}
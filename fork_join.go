@@ -0,0 +1,53 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// WithJoinStates adds a join to a state with regions: when an event handled by
+// the regions leaves each of them in its state of states, in order, the FSM
+// handles event to continue, which usually leaves the composite state. An
+// empty state matches any state of its region.
+//
+// Joins are the counterpart of forks, which are entry points of the state
+// with regions, see WithEntryPoint: a transition with EventDesc.Entry set to
+// the name of the entry point activates the regions at its states instead of
+// at their initial states.
+//
+// Unlike WithJoin, which waits for the final states of the regions, several
+// joins can synchronize the regions at different states. They are checked in
+// the order they were added, after the exit points and before WithJoin.
+func WithJoinStates(state, event string, states ...string) Option {
+	return func(f *FSM) {
+		if f.joinPoints == nil {
+			f.joinPoints = make(map[string][]joinPoint)
+		}
+		f.joinPoints[state] = append(f.joinPoints[state], joinPoint{event, states})
+	}
+}
+
+// joinPoint is a join set with WithJoinStates.
+type joinPoint struct {
+	event  string
+	states []string
+}
+
+// reached returns true if each of regions is in its state of the join.
+func (j joinPoint) reached(regions []*submachine) bool {
+	for i, s := range regions {
+		if i < len(j.states) && j.states[i] != "" && j.states[i] != s.child.liveState() {
+			return false
+		}
+	}
+	return true
+}
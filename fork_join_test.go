@@ -0,0 +1,87 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestForkJoin(t *testing.T) {
+	compile := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "compiling"},
+			{Name: "step", Src: []string{"compiling"}, Dst: "compiled"},
+		},
+		Callbacks{},
+	)
+	test := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "testing"},
+			{Name: "pass", Src: []string{"testing"}, Dst: "passed"},
+			{Name: "fail", Src: []string{"testing"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"queued",
+		Events{
+			{Name: "start", Src: []string{"queued"}, Dst: "building", Entry: "parallel"},
+			{Name: "deploy", Src: []string{"building"}, Dst: "deployed"},
+			{Name: "abort", Src: []string{"building"}, Dst: "aborted"},
+		},
+		Callbacks{},
+		WithRegions("building", ResetSubmachine, Region{FSM: compile}, Region{FSM: test}),
+		WithEntryPoint("building", "parallel", "compiling", "testing"),
+		WithJoinStates("building", "deploy", "compiled", "passed"),
+		WithJoinStates("building", "abort", "", "failed"),
+	)
+	ctx := context.Background()
+
+	if err := fsm.Event(ctx, "start"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"building", "compiling", "testing"}) {
+		t.Errorf("expected fork to activate both regions, got %v", states)
+	}
+
+	// Only the test region is done, so the join does not fire yet.
+	if err := fsm.Event(ctx, "pass"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"building", "compiling", "passed"}) {
+		t.Errorf("expected join to wait for both regions, got %v", states)
+	}
+
+	if err := fsm.Event(ctx, "step"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "deployed" {
+		t.Errorf("expected join to fire 'deploy', got %s", fsm.Current())
+	}
+
+	// The join with an empty state fires whatever the compile region does.
+	fsm.SetState("queued")
+	_ = fsm.Event(ctx, "start")
+	if err := fsm.Event(ctx, "fail"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "aborted" {
+		t.Errorf("expected join to fire 'abort', got %s", fsm.Current())
+	}
+}
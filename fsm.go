@@ -25,8 +25,11 @@ package fsm
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // transitioner is an interface for the FSM's transition function.
@@ -37,31 +40,304 @@ type transitioner interface {
 // FSM is the state machine that holds the current state.
 //
 // It has to be created with NewFSM to function properly.
+//
+// No sequence of events, states and arguments passed to the methods of a FSM
+// makes them panic; they return errors instead. This includes a nil FSM or one
+// that was not created with NewFSM: the methods that return an error return a
+// NotInitializedError, the others return zero values and do nothing. Panics
+// can only come from the callbacks, guards and other functions passed to the
+// FSM, see WithRecoverCallbacks, and from WithStrictAsync. Fuzz tests check
+// this contract.
+//
+// All methods of a FSM are safe for concurrent use, except EventBatch and
+// WithinTx: they do not hold any lock while their events are processed, so
+// that callbacks can trigger new events, and rolling them back also undoes the
+// changes of concurrent events. Events are processed one at a time: Event and
+// Transition block while another event is processed, until its enter
+// callbacks are called. The enter and after callbacks are called without
+// holding any locks, so they can trigger new events. The before and leave
+// callbacks can not, as that would deadlock.
+//
+// Current, Is, State, Can, Cannot and AvailableTransitions all report on the
+// same state. Callbacks see the state as seen by the processing of events,
+// which already is the new state while the enter callbacks are called. Other
+// goroutines see the state of the last transition that has completed its
+// enter callbacks. Current, Is and State never block. Can, Cannot,
+// AvailableTransitions, SetState and the other methods that read or modify the
+// transitions only block while a guard is evaluated or another such method
+// runs, never while callbacks are called. Can and Cannot do not lock at all
+// unless the transition has a guard to evaluate.
 type FSM struct {
-	// current is the state that the FSM is currently in.
+	// lastTransitionID is the ID of the last Event of a deterministic FSM.
+	// It comes first to be aligned for atomic operations.
+	lastTransitionID uint64
+
+	// current is the state that the FSM is currently in, as seen by the
+	// processing of events.
 	current string
+	// stateVersion is incremented when current changes, guarded by stateMu.
+	stateVersion uint64
+	// record holds the *StateRecord of the last completed state change, as
+	// seen by readers.
+	record atomic.Value
+	// live holds the *StateRecord of the last state change, as seen by the
+	// processing of events. It differs from record while the enter
+	// callbacks are called.
+	live atomic.Value
+	// recordMu serializes updates of record.
+	recordMu sync.Mutex
 
-	// transitions maps events and source states to destination states.
-	transitions map[eKey]string
+	// transitions maps events and source states to the transition rules,
+	// ordered by the priority in which they are tried.
+	transitions map[eKey][]*transitionRule
+	// wildcards is set once a transition from AnyState is added, so that
+	// events only look up the rules for AnyState if there are any.
+	wildcards bool
+	// inTransition is 1 while transition is set, read by Can without
+	// locking. It is accessed atomically.
+	inTransition int32
+	// verdicts holds the canVerdicts precomputed from transitions. It is
+	// replaced whenever transitions change.
+	verdicts atomic.Value
 
-	// callbacks maps events and targets to callback functions.
-	callbacks map[cKey]Callback
+	// callbacks maps events and targets to callback functions, in the order
+	// they are called. The slices are replaced, never modified, when
+	// callbacks are added or removed.
+	callbacks map[cKey][]callbackEntry
+	// callbacksMu guards access to callbacks.
+	callbacksMu sync.RWMutex
+	// published holds the *callbackSet read by events without locking. It
+	// is replaced whenever callbacks change.
+	published atomic.Value
+	// lastCallbackID is the ID of the last callback added with On.
+	lastCallbackID uint64
+	// multiCallbacks holds the callbacks from WithCallbacks until they are
+	// mapped in NewFSM.
+	multiCallbacks []MultiCallbacks
+	// errCallbacks holds the callbacks from WithErrCallbacks until they are
+	// mapped in NewFSM.
+	errCallbacks CallbacksWithErr
 
 	// transition is the internal transition functions used either directly
 	// or when Transition is called in an asynchronous state transition.
 	transition func()
+	// asyncEvent is the event of the pending asynchronous transition, if
+	// any.
+	asyncEvent *Event
 	// transitionerObj calls the FSM's transition() function.
 	transitionerObj transitioner
+	// enteredAt is the time the current state was entered, or the FSM
+	// was created for the initial state.
+	enteredAt time.Time
+	// durations are the cumulative durations of the states that were
+	// left.
+	durations map[string]time.Duration
+	// stack is the stack of states of KindPush and KindPop transitions.
+	stack []string
 
-	// stateMu guards access to the current state.
+	// stateMu guards access to current, transition, transitions, entries,
+	// enteredAt, durations and stack.
+	// It is never held while callbacks are called.
 	stateMu sync.RWMutex
-	// eventMu guards access to Event() and Transition().
-	eventMu sync.Mutex
+	// eventMu serializes the processing of events by Event() and
+	// Transition(). It is released before the enter callbacks are called.
+	eventMu eventLock
 	// metadata can be used to store and load data that maybe used across events
 	// use methods SetMetadata() and Metadata() to store and load data
 	metadata map[string]interface{}
 
 	metadataMu sync.RWMutex
+	// data is the struct bound with BindData, guarded by metadataMu.
+	data interface{}
+	// metadataVersion is incremented on every write of metadata or data,
+	// guarded by metadataMu. It is used by WithPureGuards.
+	metadataVersion uint64
+
+	// entries counts how many times each state has been entered.
+	entries map[string]int
+	// loopThreshold is the maximum number of entries per state, if positive.
+	loopThreshold int
+	// loopAlert is called instead of failing when loopThreshold is exceeded.
+	loopAlert LoopAlertFunc
+
+	// effects are the side effect handlers registered with WithEffects.
+	effects EffectRegistry
+	// replay is set to 1 by SetReplay, accessed atomically.
+	replay int32
+
+	// hooks are the flags of the instrumentation registered with the FSM,
+	// see hookTraced. It is accessed atomically.
+	hooks int32
+
+	// observers holds the []Observer added with AddObserver. It is
+	// replaced rather than modified, so events can read it without locking.
+	observers atomic.Value
+	// observersMu serializes the changes to observers.
+	observersMu sync.Mutex
+
+	// middleware is the middleware added with Use.
+	middleware []Middleware
+	// handler holds the EventHandler of the middleware chain around
+	// startEvent, if any middleware was added. It is replaced rather than
+	// modified, so events can read it without locking.
+	handler atomic.Value
+	// handlerMu guards access to middleware and serializes the changes to
+	// handler.
+	handlerMu sync.Mutex
+
+	// recoverCallbacks is set by WithRecoverCallbacks.
+	recoverCallbacks bool
+	// strictAsync is set by WithStrictAsync.
+	strictAsync bool
+	// compensations are the compensating events set by WithCompensations.
+	compensations map[string]string
+	// deps is the dependency container set by WithDeps.
+	deps interface{}
+	// transitionTimeout is the timeout set by WithTransitionTimeout.
+	transitionTimeout time.Duration
+	// retryPolicies are the policies set by WithRetry.
+	retryPolicies map[string]RetryPolicy
+	// detachOnDeadline is set by WithDetachOnDeadline.
+	detachOnDeadline bool
+	// rateLimiters are set by WithDebounce and WithThrottle.
+	rateLimiters map[string]*rateLimiter
+	// rateMu guards access to the state of rateLimiters.
+	rateMu sync.Mutex
+	// progress is the channel set by WithProgressChannel.
+	progress chan<- Progress
+
+	// paused is set to 1 by Pause and to 0 by Resume.
+	paused int32
+	// unavailableStrategies are set by WithUnavailableStrategies.
+	unavailableStrategies map[Unavailability]UnavailableStrategy
+	// deadLetters is the sink set by WithDeadLetters.
+	deadLetters DeadLetterSink
+
+	// clock is the clock set by WithClock.
+	clock Clock
+	// deterministic is set by WithDeterministic.
+	deterministic bool
+	// stateTimeouts are the timeouts set by WithStateTimeout.
+	stateTimeouts map[string]stateTimeout
+	// stateTimer is the timer of the timeout of the current state.
+	stateTimer *stateTimer
+	// periodicEvents are the events set by WithPeriodicEvent.
+	periodicEvents map[string][]periodicEvent
+	// periodicTimers are the timers of the periodic events of the current
+	// state.
+	periodicTimers []Timer
+	// periodicGen is incremented when periodicTimers are stopped.
+	periodicGen uint64
+	// watchdogs are the watchdogs set by WithWatchdog.
+	watchdogs map[string]watchdog
+	// watchdogTimer is the timer of the watchdog of the current state.
+	watchdogTimer *stateTimer
+	// timerMu guards access to stateTimer, periodicTimers, periodicGen and
+	// watchdogTimer.
+	timerMu sync.Mutex
+	// scheduled are the events scheduled with EventAfter that are pending.
+	scheduled map[*ScheduledEvent]struct{}
+	// scheduledMu guards access to scheduled.
+	scheduledMu sync.Mutex
+
+	// pendingAsync are the asynchronous transitions that did not complete,
+	// keyed by the ID of their event.
+	pendingAsync map[uint64]*pendingAsync
+	// pendingMu guards access to pendingAsync.
+	pendingMu sync.Mutex
+	// leakThreshold is the threshold set by WithAsyncLeakDetection.
+	leakThreshold time.Duration
+	// leakWarn is the warning hook set by WithAsyncLeakDetection.
+	leakWarn func(PendingInfo)
+	// asyncTTL is the TTL set by WithAsyncTTL.
+	asyncTTL time.Duration
+	// asyncTTLAction is the action set by WithAsyncTTL.
+	asyncTTLAction AsyncTTLAction
+	// callbackTimeouts are the timeouts set by WithCallbackTimeouts.
+	callbackTimeouts CallbackTimeouts
+
+	// extensions are the extensions installed with WithExtensions.
+	extensions []Extension
+	// closeOnce makes sure that Close only shuts down the extensions once.
+	closeOnce sync.Once
+	// closed is closed by Close.
+	closed chan struct{}
+
+	// deferred are the events deferred because of WithDeferredEvents.
+	deferred []deferredEvent
+	// deferSize is the maximum number of deferred events.
+	deferSize int
+	// deferPolicy decides which events are dropped when deferred is full.
+	deferPolicy DeferPolicy
+	// retryingDeferred is set while the deferred events are retried.
+	retryingDeferred bool
+	// deferredDirty is set if the deferred events should be retried again.
+	deferredDirty bool
+	// deferredMu guards access to deferred, retryingDeferred and
+	// deferredDirty.
+	deferredMu sync.Mutex
+
+	// stateDescriptions are set by WithStateDescriptions.
+	stateDescriptions map[string]string
+	// eventDescriptions are set by WithEventDescriptions.
+	eventDescriptions map[string]string
+
+	// invariants are set by WithInvariant.
+	invariants []namedInvariant
+	// invariantAction and invariantState are set by WithInvariantAction.
+	invariantAction InvariantAction
+	invariantState  string
+
+	// finalStates are set by WithFinalStates.
+	finalStates map[string]bool
+
+	// stats are returned by Stats.
+	stats stats
+
+	// pureGuards is set by WithPureGuards.
+	pureGuards bool
+
+	// chainPolicy is set by WithChainPolicy.
+	chainPolicy ChainPolicy
+
+	// setStatePolicy is set by WithSetStatePolicy.
+	setStatePolicy *SetStatePolicy
+
+	// submachines are the child FSMs or regions of the composite states,
+	// set by WithSubmachine and WithRegions.
+	submachines map[string][]*submachine
+	// joins are the events set by WithJoin.
+	joins map[string]string
+	// joinPoints are the joins set by WithJoinStates, by composite state.
+	joinPoints map[string][]joinPoint
+	// entryPoints are the child states of the entry points set by
+	// WithEntryPoint, by composite state and name.
+	entryPoints map[string]map[string][]string
+	// exitPoints are the events of the exit points set by WithExitPoint, by
+	// composite state and child state.
+	exitPoints map[string]map[string]string
+
+	// mailbox queues the events sent with Send.
+	mailbox chan mailboxMessage
+	// mailboxSize is the buffer size of mailbox set by WithMailbox.
+	mailboxSize int
+	// mailboxOnce starts the goroutine processing mailbox once.
+	mailboxOnce sync.Once
+	// mailboxDone is closed when the goroutine processing mailbox exits.
+	mailboxDone chan struct{}
+	// queue holds the events sent with Send to a deterministic FSM.
+	queue []mailboxMessage
+	// draining is true while queue is being processed.
+	draining bool
+	// queueMu guards access to queue and draining.
+	queueMu sync.Mutex
+
+	// stopOnce makes sure that Stop only stops the FSM once.
+	stopOnce sync.Once
+	// stopping is closed by Stop.
+	stopping chan struct{}
+	// stopCtx is the context passed to Stop.
+	stopCtx context.Context
 }
 
 // EventDesc represents an event when initializing the FSM.
@@ -74,18 +350,117 @@ type EventDesc struct {
 	Name string
 
 	// Src is a slice of source states that the FSM must be in to perform a
-	// state transition.
+	// state transition. AnyState can be used to allow the event in all states.
 	Src []string
 
 	// Dst is the destination state that the FSM will be in if the transition
 	// succeeds.
 	Dst string
+
+	// Guard is an optional condition that is evaluated before the transition.
+	// If it returns false the event fails with a GuardFailedError.
+	Guard GuardFunc
+
+	// Unless is an optional list of conditions that block the transition. If
+	// any of them returns true the event fails with a GuardFailedError, just
+	// like when Guard returns false.
+	Unless []GuardFunc
+
+	// Choice optionally decides the destination state when the event occurs,
+	// which makes it possible to branch to different states depending on the
+	// event arguments or metadata. Dst is used if it returns an empty string.
+	// Callbacks are only bound to states that are used in the events, so
+	// states returned by Choice should be declared by other events as well.
+	Choice ChoiceFunc
+
+	// Priority orders the transitions that match the same event and source
+	// state. Transitions with a higher priority are tried first; the first
+	// one whose guard passes is performed. For equal priorities a transition
+	// for a specific source state is tried before one for AnyState, and
+	// otherwise the transitions are tried in the order they are defined.
+	Priority int
+
+	// Kind defines how the transition is performed. With KindInternal the
+	// event is handled within the current state and Dst is ignored. With
+	// KindExternal a transition to the current state leaves and re-enters it.
+	// KindPush and KindPop model call and return flows with a stack of states.
+	Kind TransitionKind
+
+	// Effects names the side effects of the transition, like "send_email".
+	// They are resolved against the handlers registered with WithEffects and
+	// performed after the leave callbacks, before the state is changed.
+	Effects []string
+
+	// Validator is an optional check of the event arguments. It is called
+	// when the transition has been selected, before any callbacks, and
+	// rejects the event with a ValidationError if it returns an error.
+	Validator ValidatorFunc
+
+	// Description is an optional human-readable description of the
+	// transition, shown in visualizations.
+	Description string
+
+	// Tags are optional labels of the transition, like "billing" or
+	// "heartbeat", that observers can be filtered by with ObserveTags and
+	// IgnoreTags.
+	Tags []string
+
+	// Entry is the optional entry point at which the transition enters Dst,
+	// when Dst is a composite state, see WithEntryPoint.
+	Entry string
 }
 
+// TransitionKind defines how a transition is performed.
+type TransitionKind int
+
+const (
+	// KindDefault performs a regular transition to the destination state. If
+	// the destination is the current state only the before and after
+	// callbacks are called and a NoTransitionError is returned.
+	KindDefault TransitionKind = iota
+
+	// KindInternal handles the event within the current state. Only the before
+	// and after callbacks are called, the state is not changed and no
+	// NoTransitionError is returned. This is useful for "update" style events.
+	KindInternal
+
+	// KindExternal performs a regular transition to the destination state, and
+	// also calls all leave and enter callbacks if the destination is the
+	// current state. Such an external self-transition counts as re-entering
+	// the state.
+	KindExternal
+
+	// KindPush performs a regular transition to the destination state and
+	// pushes the source state onto the stack of the FSM, so that a KindPop
+	// transition can return to it.
+	KindPush
+
+	// KindPop returns to the state at the top of the stack of the FSM and
+	// pops it. Dst is the destination state when the stack is empty.
+	KindPop
+)
+
 // Callback is a function type that callbacks should use. Event is the current
 // event info as the callback happens.
 type Callback func(context.Context, *Event)
 
+// lastTransitionID is the ID of the last Event, see Event.ID.
+var lastTransitionID uint64
+
+// nextTransitionID returns a new unique ID for an Event.
+func nextTransitionID() uint64 {
+	return atomic.AddUint64(&lastTransitionID, 1)
+}
+
+// AnyState can be used as a source state in EventDesc to allow the event in
+// every state, for example for a global "abort" event. A transition defined for
+// a specific source state takes precedence over one defined for AnyState with
+// the same priority.
+const AnyState = "*"
+
+// Option configures optional behavior of a FSM in NewFSM.
+type Option func(*FSM)
+
 // Events is a shorthand for defining the transition map in NewFSM.
 type Events []EventDesc
 
@@ -124,129 +499,225 @@ type Callbacks map[string]Callback
 //
 // 2. <EVENT> - called after event named <EVENT>
 //
+// The name of the event or state in the full versions can also be a pattern as
+// supported by path.Match, like "enter_payment_*", to bind the callback to all
+// matching events or states. These callbacks are called after the named and
+// before the general version, ordered by their pattern.
+//
 // If both a shorthand version and a full version is specified it is undefined
 // which version of the callback will end up in the internal map. This is due
 // to the pseudo random nature of Go maps. No checking for multiple keys is
-// currently performed.
-func NewFSM(initial string, events []EventDesc, callbacks map[string]Callback) *FSM {
+// currently performed. Several callbacks can be bound to the same key with
+// WithCallbacks.
+//
+// Optional behavior can be configured with a list of options, which are applied
+// in the given order.
+//
+// NewFSM panics with a ReservedEventError if events define DoneEvent although
+// the FSM has no composite states, see WithSubmachine.
+func NewFSM(initial string, events []EventDesc, callbacks map[string]Callback, opts ...Option) *FSM {
 	f := &FSM{
 		transitionerObj: &transitionerStruct{},
 		current:         initial,
-		transitions:     make(map[eKey]string),
-		callbacks:       make(map[cKey]Callback),
+		transitions:     make(map[eKey][]*transitionRule),
+		callbacks:       make(map[cKey][]callbackEntry),
 		metadata:        make(map[string]interface{}),
+		entries:         make(map[string]int),
+		closed:          make(chan struct{}),
+		eventMu:         make(eventLock, 1),
+		stopping:        make(chan struct{}),
+		clock:           realClock{},
 	}
 
+	record := &StateRecord{State: initial}
+	f.record.Store(record)
+	f.live.Store(record)
+
 	// Build transition map and store sets of all events and states.
 	allEvents := make(map[string]bool)
 	allStates := make(map[string]bool)
 	for _, e := range events {
 		for _, src := range e.Src {
-			f.transitions[eKey{e.Name, src}] = e.Dst
-			allStates[src] = true
-			allStates[e.Dst] = true
+			f.addTransitionRule(eKey{e.Name, src}, newTransitionRule(e))
+			if src != AnyState {
+				allStates[src] = true
+			}
+			if e.Kind != KindInternal {
+				allStates[e.Dst] = true
+			}
 		}
 		allEvents[e.Name] = true
 	}
+	f.storeVerdicts()
+	f.storeView()
+
+	for _, opt := range opts {
+		opt(f)
+	}
+	if allEvents[DoneEvent] && f.submachines == nil {
+		panic(ReservedEventError{DoneEvent})
+	}
+	if f.deterministic || len(f.extensions) > 0 {
+		f.setHook(hookTraced)
+	}
+	f.enteredAt = f.clock.Now()
 
 	// Map all callbacks to events/states.
 	for name, fn := range callbacks {
-		var target string
-		var callbackType int
-
-		switch {
-		case strings.HasPrefix(name, "before_"):
-			target = strings.TrimPrefix(name, "before_")
-			if target == "event" {
-				target = ""
-				callbackType = callbackBeforeEvent
-			} else if _, ok := allEvents[target]; ok {
-				callbackType = callbackBeforeEvent
-			}
-		case strings.HasPrefix(name, "leave_"):
-			target = strings.TrimPrefix(name, "leave_")
-			if target == "state" {
-				target = ""
-				callbackType = callbackLeaveState
-			} else if _, ok := allStates[target]; ok {
-				callbackType = callbackLeaveState
-			}
-		case strings.HasPrefix(name, "enter_"):
-			target = strings.TrimPrefix(name, "enter_")
-			if target == "state" {
-				target = ""
-				callbackType = callbackEnterState
-			} else if _, ok := allStates[target]; ok {
-				callbackType = callbackEnterState
-			}
-		case strings.HasPrefix(name, "after_"):
-			target = strings.TrimPrefix(name, "after_")
-			if target == "event" {
-				target = ""
-				callbackType = callbackAfterEvent
-			} else if _, ok := allEvents[target]; ok {
-				callbackType = callbackAfterEvent
-			}
-		default:
-			target = name
-			if _, ok := allStates[target]; ok {
-				callbackType = callbackEnterState
-			} else if _, ok := allEvents[target]; ok {
-				callbackType = callbackAfterEvent
+		if key, ok := callbackKey(name, allEvents, allStates); ok {
+			f.callbacks[key] = []callbackEntry{{0, fn}}
+		}
+	}
+	for name, fn := range f.errCallbacks {
+		if key, ok := callbackKey(name, allEvents, allStates); ok {
+			f.callbacks[key] = []callbackEntry{{0, fn.callback(key.callbackType)}}
+		}
+	}
+	f.errCallbacks = nil
+	for _, callbacks := range f.multiCallbacks {
+		for name, fns := range callbacks {
+			if key, ok := callbackKey(name, allEvents, allStates); ok {
+				for _, fn := range fns {
+					f.callbacks[key] = append(f.callbacks[key], callbackEntry{0, fn})
+				}
 			}
 		}
+	}
+	f.multiCallbacks = nil
+	f.publishCallbacks()
+	f.enterStateTimeout(initial)
+	f.enterPeriodicEvents(initial)
+	f.enterWatchdog(initial, f.clock.Now())
 
-		if callbackType != callbackNone {
-			f.callbacks[cKey{target, callbackType}] = fn
-		}
+	for _, ext := range f.extensions {
+		ext.Init(f)
 	}
 
 	return f
 }
 
-// Current returns the current state of the FSM.
+// Current returns the current state of the FSM. While the enter callbacks of
+// a transition run, it returns the new state to the callbacks and the previous
+// state to other goroutines, see State.
 func (f *FSM) Current() string {
-	f.stateMu.RLock()
-	defer f.stateMu.RUnlock()
-	return f.current
+	if !f.initialized() {
+		return ""
+	}
+	return f.readState().State
 }
 
-// Is returns true if state is the current state.
+// Is returns true if state is the current state. It also returns true if
+// state is the start of Path, like "connected/authenticating", so that the
+// current states of submachines can be checked from the root FSM. The
+// composite state "connected" alone matches as the current state.
 func (f *FSM) Is(state string) bool {
-	f.stateMu.RLock()
-	defer f.stateMu.RUnlock()
-	return state == f.current
+	return state == f.Current() || f.isPath(state)
 }
 
 // SetState allows the user to move to the given state from current state.
 // The call does not trigger any callbacks, if defined.
+//
+// SetState bypasses the transitions of the FSM, so it can be restricted with
+// WithSetStatePolicy.
 func (f *FSM) SetState(state string) {
+	if !f.initialized() {
+		return
+	}
+	_ = f.setStateWithReason(state, "")
+}
+
+// setStateWithReason checks the SetStatePolicy, if any, and sets the state. It
+// must be called directly by the exported methods for the caller to be known.
+func (f *FSM) setStateWithReason(state, reason string) error {
+	if f.setStatePolicy != nil {
+		if err := f.checkSetState(state, reason); err != nil {
+			return err
+		}
+	}
+	f.moveTo(state)
+	return nil
+}
+
+// moveTo sets the current state without calling callbacks, and switches the
+// submachines if the state changed.
+func (f *FSM) moveTo(state string) {
 	f.stateMu.Lock()
 	defer f.stateMu.Unlock()
-	f.current = state
+	src := f.current
+	f.setState(state)
+	if state != src {
+		f.switchSubmachines(src, state, "")
+	}
 }
 
-// Can returns true if event can occur in the current state.
+// setState sets the current state and enters it without calling callbacks.
+// Callers must hold stateMu for writing.
+func (f *FSM) setState(state string) {
+	var record StateRecord
+	f.changeState(&record, state, f.clock.Now())
+	f.publishState(&record)
+	f.storeView()
+	f.enterStateTimeout(state)
+	f.enterPeriodicEvents(state)
+	f.enterWatchdog(state, record.EnteredAt)
+}
+
+// Can returns true if event can occur in the current state. It returns false
+// in a final state, see WithFinalStates, and while the FSM is paused, see
+// Pause.
+//
+// If the transition has a guard it is evaluated without any event arguments.
 func (f *FSM) Can(event string) bool {
-	f.eventMu.Lock()
-	defer f.eventMu.Unlock()
+	if !f.initialized() {
+		return false
+	}
+	if atomic.LoadInt32(&f.inTransition) == 1 {
+		return false
+	}
+	current := f.readState().State
+	if f.finalStates[current] || f.IsPaused() {
+		return false
+	}
+	switch f.verdicts.Load().(canVerdicts).verdict(event, current) {
+	case canAlways:
+		return true
+	case canNever:
+		return false
+	}
+
 	f.stateMu.RLock()
 	defer f.stateMu.RUnlock()
-	_, ok := f.transitions[eKey{event, f.current}]
-	return ok && (f.transition == nil)
+	_, _, err := f.resolveTransition(context.Background(), event, current, nil)
+	return err == nil && (f.transition == nil)
 }
 
 // AvailableTransitions returns a list of transitions available in the
-// current state.
+// current state, sorted alphabetically. They are the events for which Can
+// returns true: transitions with a guard that does not pass are left out, and
+// none are available while an asynchronous transition is pending, in a final
+// state or while the FSM is paused.
 func (f *FSM) AvailableTransitions() []string {
+	if !f.initialized() {
+		return nil
+	}
+	current := f.readState().State
 	f.stateMu.RLock()
 	defer f.stateMu.RUnlock()
+	if f.transition != nil || f.finalStates[current] || f.IsPaused() {
+		return nil
+	}
 	var transitions []string
+	seen := make(map[string]bool)
 	for key := range f.transitions {
-		if key.src == f.current {
+		if (key.src != current && key.src != AnyState) || seen[key.event] {
+			continue
+		}
+		seen[key.event] = true
+		if _, _, err := f.resolveTransition(context.Background(), key.event, current, nil); err == nil {
 			transitions = append(transitions, key.event)
 		}
 	}
+	sort.Strings(transitions)
 	return transitions
 }
 
@@ -258,6 +729,9 @@ func (f *FSM) Cannot(event string) bool {
 
 // Metadata returns the value stored in metadata
 func (f *FSM) Metadata(key string) (interface{}, bool) {
+	if !f.initialized() {
+		return nil, false
+	}
 	f.metadataMu.RLock()
 	defer f.metadataMu.RUnlock()
 	dataElement, ok := f.metadata[key]
@@ -266,15 +740,23 @@ func (f *FSM) Metadata(key string) (interface{}, bool) {
 
 // SetMetadata stores the dataValue in metadata indexing it with key
 func (f *FSM) SetMetadata(key string, dataValue interface{}) {
+	if !f.initialized() {
+		return
+	}
 	f.metadataMu.Lock()
 	defer f.metadataMu.Unlock()
 	f.metadata[key] = dataValue
+	f.metadataVersion++
 }
 
 // DeleteMetadata deletes the dataValue in metadata by key
 func (f *FSM) DeleteMetadata(key string) {
+	if !f.initialized() {
+		return
+	}
 	f.metadataMu.Lock()
 	delete(f.metadata, key)
+	f.metadataVersion++
 	f.metadataMu.Unlock()
 }
 
@@ -289,6 +771,8 @@ func (f *FSM) DeleteMetadata(key string) {
 //
 // - event X inappropriate in current state Y
 //
+// - event X rejected by guard in current state Y
+//
 // - event X does not exist
 //
 // - internal error on state transition
@@ -296,7 +780,154 @@ func (f *FSM) DeleteMetadata(key string) {
 // The last error should never occur in this situation and is a sign of an
 // internal bug.
 func (f *FSM) Event(ctx context.Context, event string, args ...interface{}) error {
-	f.eventMu.Lock()
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	if f.hooked(hookMiddleware) {
+		if handler := f.handlerFor(); handler != nil {
+			return handler(ctx, event, args...)
+		}
+	}
+	return f.startEvent(ctx, event, args...)
+}
+
+// startEvent is the EventHandler at the end of the middleware chain. It
+// processes the event as part of a chain if needed.
+func (f *FSM) startEvent(ctx context.Context, event string, args ...interface{}) error {
+	if c, ok := ctx.Value(chainKey{}).(*chain); ok {
+		return c.event(ctx, f, event, args)
+	}
+	if f.chainPolicy != 0 {
+		_, err := f.eventChain(ctx, f.chainPolicy, event, args)
+		return err
+	}
+	return f.processEvent(ctx, event, args)
+}
+
+// processEvent passes the event to the active submachine or processes it.
+// If a submachine refused the event, its error is returned unless the FSM can
+// handle the event itself.
+func (f *FSM) processEvent(ctx context.Context, event string, args []interface{}) error {
+	if f.submachines != nil {
+		handled, err := f.submachineEvent(ctx, event, args)
+		if handled {
+			return err
+		}
+		if err != nil {
+			switch ownErr := f.ownEvent(ctx, event, args); ownErr.(type) {
+			case UnknownEventError, InvalidEventError:
+				return err
+			default:
+				return ownErr
+			}
+		}
+	}
+	return f.ownEvent(ctx, event, args)
+}
+
+// ownEvent processes the event in the FSM itself, after its submachines.
+func (f *FSM) ownEvent(ctx context.Context, event string, args []interface{}) error {
+	if f.finalStates != nil {
+		if state := f.liveState(); f.finalStates[state] {
+			return MachineCompletedError{event, state}
+		}
+	}
+	if f.rateLimiters != nil {
+		var err error
+		if ctx, err = f.rateLimit(ctx, event, args); err != nil {
+			return err
+		}
+	}
+	if f.detachOnDeadline && !f.deterministic {
+		if _, ok := ctx.Deadline(); ok {
+			return f.detachEvent(ctx, event, args)
+		}
+	}
+	return f.dispatchEvent(ctx, event, args)
+}
+
+// dispatchEvent handles the event, retrying it if needed.
+func (f *FSM) dispatchEvent(ctx context.Context, event string, args []interface{}) error {
+	if policy, ok := f.retryPolicies[event]; ok {
+		return f.retryEvent(ctx, f.handleEvent, policy, event, args)
+	}
+	return f.handleEvent(ctx, event, args...)
+}
+
+// EventNoCtx initiates a state transition with the named event, like Event
+// with context.Background(). It is a shorthand for callers that do not need
+// cancellation or context values.
+func (f *FSM) EventNoCtx(event string, args ...interface{}) error {
+	return f.Event(context.Background(), event, args...)
+}
+
+// handleEvent performs the event and records its outcome. The event is only
+// given an ID and timed if something that sees it is registered.
+func (f *FSM) handleEvent(ctx context.Context, event string, args ...interface{}) error {
+	hooks := atomic.LoadInt32(&f.hooks)
+	var id uint64
+	var start time.Time
+	if hooks&(hookTraced|hookObservers) != 0 {
+		id, start = f.transitionID(), f.clock.Now()
+	}
+	var observers []Observer
+	if hooks&hookObservers != 0 {
+		observers = f.observersFor()
+	}
+	if hooks&hookUnavailable != 0 {
+		if reason, strategy, ok := f.unavailability(); ok {
+			notified, err := f.handleUnavailable(ctx, event, args, reason, strategy)
+			if len(observers) > 0 {
+				f.notifyObservers(ctx, observers, id, start, event, args, nil, notified)
+			}
+			f.countEvent(nil, err)
+			return err
+		}
+	}
+	e, err := f.event(ctx, id, start, event, args...)
+	if e != nil && err == nil && f.invariants != nil {
+		err = f.checkInvariants(ctx, e)
+	}
+	if e == nil && err != nil {
+		err = f.deferEvent(ctx, event, args, err)
+	}
+	if f.deadLetters != nil && isDeadLetter(err) {
+		state := f.liveState()
+		if e != nil {
+			state = e.Src
+		}
+		f.putDeadLetter(ctx, event, args, state, err)
+	}
+	if e != nil {
+		// the duration is measured again to include the after callbacks,
+		// but only for the extensions and observers that see it
+		if _, ok := err.(AsyncError); !ok && (len(f.extensions) > 0 || len(observers) > 0) {
+			e.Duration = f.since(start)
+		}
+		f.afterTransitionExtensions(ctx, e, err)
+	}
+	if len(observers) > 0 {
+		f.notifyObservers(ctx, observers, id, start, event, args, e, err)
+	}
+	if e != nil && err == nil && f.finalStates[e.Dst] {
+		f.notifyDone(ctx, e.Dst)
+	}
+	if err == nil && f.deferSize > 0 {
+		f.retryDeferred()
+	}
+	if e != nil && e.lateCancel != nil {
+		err = f.compensate(ctx, e, err)
+	}
+	f.countEvent(e, err)
+	return err
+}
+
+// event performs the state transition of Event. The returned Event is nil if
+// the event was rejected before any callbacks were called.
+func (f *FSM) event(ctx context.Context, id uint64, start time.Time, event string, args ...interface{}) (*Event, error) {
+	if err := f.lockEvent(ctx, event); err != nil {
+		return nil, err
+	}
 	// in order to always unlock the event mutex, the defer is added
 	// in case the state transition goes through and enter/after callbacks
 	// are called; because these must be able to trigger new state
@@ -309,53 +940,132 @@ func (f *FSM) Event(ctx context.Context, event string, args ...interface{}) erro
 	}()
 
 	f.stateMu.RLock()
-	defer f.stateMu.RUnlock()
-
 	if f.transition != nil {
-		return InTransitionError{event}
+		f.stateMu.RUnlock()
+		return nil, InTransitionError{event}
+	}
+	current := f.current
+	var inSrc time.Duration
+	if id != 0 {
+		inSrc = start.Sub(f.enteredAt)
+	}
+	if expected, ok := ctx.Value(expectedSrcKey{}).(string); ok && expected != current {
+		f.stateMu.RUnlock()
+		return nil, StateChangedError{event, expected, current}
 	}
+	ctx = withoutEventKeys(ctx)
+	_, rule, err := f.resolveTransition(ctx, event, current, args)
+	if err != nil {
+		f.stateMu.RUnlock()
+		return nil, err
+	}
+	dst := f.targetOf(rule, current)
+	f.stateMu.RUnlock()
 
-	dst, ok := f.transitions[eKey{event, f.current}]
-	if !ok {
-		for ekey := range f.transitions {
-			if ekey.event == event {
-				return InvalidEventError{event, f.current}
-			}
+	if rule.validator != nil {
+		if err := f.validate(ctx, event, current, dst, rule, args); err != nil {
+			return nil, err
 		}
-		return UnknownEventError{event}
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	parent := ctx
+	ctx, cancel := f.transitionContext(ctx)
 	defer cancel()
-	e := &Event{f, event, f.current, dst, nil, args, false, false, cancel}
+	e := &Event{
+		FSM:         f,
+		Event:       event,
+		Src:         current,
+		Dst:         dst,
+		Args:        args,
+		ID:          id,
+		StartedAt:   start,
+		SrcDuration: inSrc,
+		Replay:      f.isReplay(ctx),
+		Tags:        rule.tags,
+		cancelFunc:  cancel,
+	}
+
+	if rule.choice != nil && rule.kind != KindInternal {
+		if d := rule.choice(ctx, e); d != "" {
+			dst = d
+			e.Dst = d
+		}
+	}
+
+	f.beforeTransitionExtensions(ctx, e)
+
+	if e.Src != e.Dst || rule.kind == KindExternal {
+		if err := f.checkLoop(ctx, e); err != nil {
+			return e, err
+		}
+	}
 
-	err := f.beforeEventCallbacks(ctx, e)
+	err = f.beforeEventCallbacks(ctx, e)
 	if err != nil {
-		return err
+		return e, err
 	}
 
-	if f.current == dst {
-		f.stateMu.RUnlock()
-		defer f.stateMu.RLock()
+	if current == dst && rule.kind != KindExternal {
 		f.eventMu.Unlock()
 		unlocked = true
+		acceptEvent(ctx)
+		if rule.kind == KindInternal {
+			if err := f.performEffects(ctx, e, rule.effects); err != nil {
+				return e, err
+			}
+		}
+		e.completed = true
+		if e.ID != 0 {
+			e.Duration = f.since(e.StartedAt)
+		}
 		f.afterEventCallbacks(ctx, e)
-		return NoTransitionError{e.Err}
+		if rule.kind == KindInternal {
+			return e, e.Err
+		}
+		return e, NoTransitionError{e.Err}
 	}
 
 	// Setup the transition, call it later.
 	transitionFunc := func(ctx context.Context, async bool) func() {
 		return func() {
 			if ctx.Err() != nil {
-				if e.Err == nil {
+				if f.transitionTimedOut(parent, ctx, async) {
+					e.Err = TransitionTimeoutError{e.Event, f.transitionTimeout}
+				} else if e.Err == nil {
 					e.Err = ctx.Err()
 				}
+				f.setTransition(nil)
+				return
+			}
+
+			if err := f.performEffects(ctx, e, rule.effects); err != nil {
+				if f.transitionTimedOut(parent, ctx, async) {
+					err = TransitionTimeoutError{e.Event, f.transitionTimeout}
+				}
+				e.Err = err
+				f.setTransition(nil)
+				if async {
+					f.notifyAsync(ctx, e, asyncCompleted)
+				}
 				return
 			}
 
 			f.stateMu.Lock()
-			f.current = dst
+			src := f.current
+			f.changeState(&e.record, dst, f.clock.Now())
+			f.updateStack(rule.kind, src)
+			var entered []enteredState
+			if dst != src {
+				entered = f.switchSubmachines(src, dst, rule.entry)
+			}
+			f.entries[dst]++
+			e.completed = true
 			f.transition = nil // treat the state transition as done
+			f.asyncEvent = nil
+			f.storeView()
+			f.enterStateTimeout(dst)
+			f.enterPeriodicEvents(dst)
+			f.enterWatchdog(dst, e.record.EnteredAt)
 			f.stateMu.Unlock()
 
 			// at this point, we unlock the event mutex in order to allow
@@ -366,46 +1076,67 @@ func (f *FSM) Event(ctx context.Context, event string, args ...interface{}) erro
 				f.eventMu.Unlock()
 				unlocked = true
 			}
+			acceptEvent(ctx)
 			f.enterStateCallbacks(ctx, e)
+			f.enterSubmachineCallbacks(ctx, e, entered)
+			f.publishState(&e.record)
+			if e.ID != 0 {
+				e.Duration = f.since(e.StartedAt)
+			}
 			f.afterEventCallbacks(ctx, e)
+			if async {
+				f.notifyAsync(ctx, e, asyncCompleted)
+			}
 		}
 	}
 
-	f.transition = transitionFunc(ctx, false)
+	f.setTransition(transitionFunc(ctx, false))
 
 	if err = f.leaveStateCallbacks(ctx, e); err != nil {
 		if _, ok := err.(CanceledError); ok {
-			f.transition = nil
+			f.setTransition(nil)
 		} else if asyncError, ok := err.(AsyncError); ok {
 			// setup a new context in order for async state transitions to work correctly
 			// this "uncancels" the original context which ignores its cancelation
 			// but keeps the values of the original context available to callers
 			ctx, cancel := uncancelContext(ctx)
+			cancel = f.asyncCancelFunc(ctx, e, cancel)
 			e.cancelFunc = cancel
 			asyncError.Ctx = ctx
 			asyncError.CancelTransition = cancel
-			f.transition = transitionFunc(ctx, true)
-			return asyncError
+			f.setAsyncTransition(transitionFunc(ctx, true), e)
+			f.notifyAsync(ctx, e, asyncStarted)
+			return e, asyncError
 		}
-		return err
+		return e, err
 	}
 
 	// Perform the rest of the transition, if not asynchronous.
-	f.stateMu.RUnlock()
-	defer f.stateMu.RLock()
 	err = f.doTransition()
 	if err != nil {
-		return InternalError{}
+		return e, InternalError{}
 	}
 
-	return e.Err
+	return e, e.Err
 }
 
 // Transition wraps transitioner.transition.
 func (f *FSM) Transition() error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
 	f.eventMu.Lock()
 	defer f.eventMu.Unlock()
-	return f.doTransition()
+	err := f.doTransition()
+	if _, ok := err.(NotInTransitionError); !ok {
+		f.countAsyncCompleted(err)
+	}
+	return err
+}
+
+// initialized returns true if the FSM was created with NewFSM.
+func (f *FSM) initialized() bool {
+	return f != nil && f.eventMu != nil
 }
 
 // doTransition wraps transitioner.transition.
@@ -422,44 +1153,56 @@ type transitionerStruct struct{}
 // The callback for leave_<STATE> must previously have called Async on its
 // event to have initiated an asynchronous state transition.
 func (t transitionerStruct) transition(f *FSM) error {
-	if f.transition == nil {
+	f.stateMu.RLock()
+	transition := f.transition
+	f.stateMu.RUnlock()
+	if transition == nil {
 		return NotInTransitionError{}
 	}
-	f.transition()
+	transition()
 	return nil
 }
 
+// setTransition sets the pending transition, or clears it if transition is
+// nil.
+func (f *FSM) setTransition(transition func()) {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	f.transition = transition
+	if transition == nil {
+		f.asyncEvent = nil
+	}
+	f.storeView()
+}
+
+// setAsyncTransition sets the pending transition of the asynchronous
+// transition of e.
+func (f *FSM) setAsyncTransition(transition func(), e *Event) {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	f.transition = transition
+	f.asyncEvent = e
+	f.storeView()
+}
+
+// callbacksFor returns the callbacks for key, in the order they are called.
+func (f *FSM) callbacksFor(key cKey) []callbackEntry {
+	return f.published.Load().(*callbackSet).callbacks[key]
+}
+
 // beforeEventCallbacks calls the before_ callbacks, first the named then the
-// general version.
+// matching patterns and then the general version.
 func (f *FSM) beforeEventCallbacks(ctx context.Context, e *Event) error {
-	if fn, ok := f.callbacks[cKey{e.Event, callbackBeforeEvent}]; ok {
-		fn(ctx, e)
-		if e.canceled {
-			return CanceledError{e.Err}
-		}
-	}
-	if fn, ok := f.callbacks[cKey{"", callbackBeforeEvent}]; ok {
-		fn(ctx, e)
-		if e.canceled {
-			return CanceledError{e.Err}
-		}
+	if f.runCallbacks(ctx, e, e.Event, callbackBeforeEvent) && e.canceled {
+		return CanceledError{e.Err}
 	}
 	return nil
 }
 
 // leaveStateCallbacks calls the leave_ callbacks, first the named then the
-// general version.
+// matching patterns and then the general version.
 func (f *FSM) leaveStateCallbacks(ctx context.Context, e *Event) error {
-	if fn, ok := f.callbacks[cKey{f.current, callbackLeaveState}]; ok {
-		fn(ctx, e)
-		if e.canceled {
-			return CanceledError{e.Err}
-		} else if e.async {
-			return AsyncError{Err: e.Err}
-		}
-	}
-	if fn, ok := f.callbacks[cKey{"", callbackLeaveState}]; ok {
-		fn(ctx, e)
+	if f.runCallbacks(ctx, e, e.Src, callbackLeaveState) {
 		if e.canceled {
 			return CanceledError{e.Err}
 		} else if e.async {
@@ -470,25 +1213,50 @@ func (f *FSM) leaveStateCallbacks(ctx context.Context, e *Event) error {
 }
 
 // enterStateCallbacks calls the enter_ callbacks, first the named then the
-// general version.
+// matching patterns and then the general version.
 func (f *FSM) enterStateCallbacks(ctx context.Context, e *Event) {
-	if fn, ok := f.callbacks[cKey{f.current, callbackEnterState}]; ok {
-		fn(ctx, e)
-	}
-	if fn, ok := f.callbacks[cKey{"", callbackEnterState}]; ok {
-		fn(ctx, e)
-	}
+	f.runCallbacks(ctx, e, e.Dst, callbackEnterState)
 }
 
 // afterEventCallbacks calls the after_ callbacks, first the named then the
-// general version.
+// matching patterns and then the general version.
 func (f *FSM) afterEventCallbacks(ctx context.Context, e *Event) {
-	if fn, ok := f.callbacks[cKey{e.Event, callbackAfterEvent}]; ok {
-		fn(ctx, e)
+	f.runCallbacks(ctx, e, e.Event, callbackAfterEvent)
+}
+
+// runCallbacks calls the callbacks of callbackType for target: first the
+// named, then the ones with a matching pattern in sorted order and then the
+// general version. It returns true if a callback canceled the transition,
+// stopped the propagation or, for leave_ callbacks, made the transition
+// asynchronous; the remaining callbacks are skipped then.
+func (f *FSM) runCallbacks(ctx context.Context, e *Event, target string, callbackType int) bool {
+	e.stopped = false
+	run := func(key cKey) bool {
+		for _, cb := range f.callbacksFor(key) {
+			if cb.fn == nil {
+				continue
+			}
+			e.callback = key
+			f.call(ctx, e, key, cb.fn)
+			e.callback = cKey{}
+			if e.canceled || e.stopped || (callbackType == callbackLeaveState && e.async) {
+				return true
+			}
+		}
+		return false
 	}
-	if fn, ok := f.callbacks[cKey{"", callbackAfterEvent}]; ok {
-		fn(ctx, e)
+
+	if run(cKey{target, callbackType}) {
+		return true
 	}
+	for _, key := range f.callbackPatternsFor() {
+		if key.callbackType == callbackType && matchCallbackPattern(key.target, target) {
+			if run(key) {
+				return true
+			}
+		}
+	}
+	return run(cKey{"", callbackType})
 }
 
 const (
@@ -499,6 +1267,65 @@ const (
 	callbackAfterEvent
 )
 
+// callbackKey parses the name of a callback into its key, as described in
+// NewFSM. It returns false if the name does not refer to a known event or state.
+func callbackKey(name string, allEvents, allStates map[string]bool) (cKey, bool) {
+	var target string
+	var callbackType int
+
+	switch {
+	case strings.HasPrefix(name, "before_"):
+		target = strings.TrimPrefix(name, "before_")
+		if target == "event" {
+			target = ""
+			callbackType = callbackBeforeEvent
+		} else if _, ok := allEvents[target]; ok {
+			callbackType = callbackBeforeEvent
+		} else if isCallbackPattern(target) {
+			callbackType = callbackBeforeEvent
+		}
+	case strings.HasPrefix(name, "leave_"):
+		target = strings.TrimPrefix(name, "leave_")
+		if target == "state" {
+			target = ""
+			callbackType = callbackLeaveState
+		} else if _, ok := allStates[target]; ok {
+			callbackType = callbackLeaveState
+		} else if isCallbackPattern(target) {
+			callbackType = callbackLeaveState
+		}
+	case strings.HasPrefix(name, "enter_"):
+		target = strings.TrimPrefix(name, "enter_")
+		if target == "state" {
+			target = ""
+			callbackType = callbackEnterState
+		} else if _, ok := allStates[target]; ok {
+			callbackType = callbackEnterState
+		} else if isCallbackPattern(target) {
+			callbackType = callbackEnterState
+		}
+	case strings.HasPrefix(name, "after_"):
+		target = strings.TrimPrefix(name, "after_")
+		if target == "event" {
+			target = ""
+			callbackType = callbackAfterEvent
+		} else if _, ok := allEvents[target]; ok {
+			callbackType = callbackAfterEvent
+		} else if isCallbackPattern(target) {
+			callbackType = callbackAfterEvent
+		}
+	default:
+		target = name
+		if _, ok := allStates[target]; ok {
+			callbackType = callbackEnterState
+		} else if _, ok := allEvents[target]; ok {
+			callbackType = callbackAfterEvent
+		}
+	}
+
+	return cKey{target, callbackType}, callbackType != callbackNone
+}
+
 // cKey is a struct key used for keeping the callbacks mapped to a target.
 type cKey struct {
 	// target is either the name of a state or an event depending on which
@@ -510,6 +1337,172 @@ type cKey struct {
 	callbackType int
 }
 
+// String returns the name of the callback in the long form, like "enter_open".
+func (k cKey) String() string {
+	var prefix, general string
+	switch k.callbackType {
+	case callbackBeforeEvent:
+		prefix, general = "before_", "event"
+	case callbackLeaveState:
+		prefix, general = "leave_", "state"
+	case callbackEnterState:
+		prefix, general = "enter_", "state"
+	case callbackAfterEvent:
+		prefix, general = "after_", "event"
+	}
+	if k.target == "" {
+		return prefix + general
+	}
+	return prefix + k.target
+}
+
+// transitionRule is a transition from a source state as defined by an
+// EventDesc.
+type transitionRule struct {
+	// dst is the default destination state.
+	dst string
+
+	// guard is the optional condition of the transition.
+	guard GuardFunc
+
+	// unless are the optional conditions that block the transition.
+	unless []GuardFunc
+
+	// choice optionally decides the destination state at event time.
+	choice ChoiceFunc
+
+	// priority orders rules that match the same event and source state.
+	priority int
+
+	// kind defines how the transition is performed.
+	kind TransitionKind
+
+	// effects are the names of the side effects of the transition.
+	effects []string
+
+	// validator checks the event arguments, if set.
+	validator ValidatorFunc
+
+	// description is the human-readable description of the transition.
+	description string
+
+	// tags are the labels of the transition.
+	tags []string
+
+	// entry is the entry point of the destination state.
+	entry string
+}
+
+// newTransitionRule creates the rule for the transitions described by e.
+func newTransitionRule(e EventDesc) *transitionRule {
+	return &transitionRule{e.Dst, e.Guard, e.Unless, e.Choice, e.Priority, e.Kind, e.Effects, e.Validator, e.Description, e.Tags, e.Entry}
+}
+
+// target returns the destination state of the rule when performed in state
+// src, before any choice.
+func (r *transitionRule) target(src string) string {
+	if r.kind == KindInternal {
+		return src
+	}
+	return r.dst
+}
+
+// unconditional returns true if the rule has no guard or unless conditions.
+func (r *transitionRule) unconditional() bool {
+	return r.guard == nil && len(r.unless) == 0
+}
+
+// addTransitionRule adds a rule for key, keeping the rules ordered by
+// priority and then definition order. A rule without conditions replaces an
+// existing rule without conditions of the same priority, so that redefining a
+// transition overrides it like before priorities existed.
+func (f *FSM) addTransitionRule(key eKey, rule *transitionRule) {
+	if rule.choice != nil || len(rule.effects) > 0 {
+		f.setHook(hookTraced)
+	}
+	if key.src == AnyState {
+		f.wildcards = true
+	}
+	rules := f.transitions[key]
+	if rule.unconditional() {
+		for i, r := range rules {
+			if r.unconditional() && r.priority == rule.priority {
+				rules[i] = rule
+				return
+			}
+		}
+	}
+	rules = append(rules, rule)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].priority > rules[j].priority
+	})
+	f.transitions[key] = rules
+}
+
+// resolveTransition finds the transition rule to perform for event in state
+// src. The rules for src and for AnyState are tried in order of priority and
+// the first one whose guard passes is returned, along with the key it matched.
+// Callers must hold stateMu.
+func (f *FSM) resolveTransition(ctx context.Context, event, src string, args []interface{}) (eKey, *transitionRule, error) {
+	var found bool
+	var key eKey
+	var rule *transitionRule
+	var err error
+	f.forEachRule(event, src, func(k eKey, r *transitionRule) bool {
+		found = true
+		var allowed bool
+		if allowed, err = f.guardAllows(ctx, event, src, r, args); err != nil {
+			return false
+		}
+		if allowed {
+			key, rule = k, r
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return eKey{}, nil, err
+	}
+	if rule != nil {
+		return key, rule, nil
+	}
+	if found {
+		return eKey{}, nil, GuardFailedError{event, src}
+	}
+	for ekey := range f.transitions {
+		if ekey.event == event {
+			return eKey{}, nil, InvalidEventError{event, src}
+		}
+	}
+	return eKey{}, nil, UnknownEventError{event}
+}
+
+// forEachRule calls fn for the rules matching event in state src, in the order
+// they are tried, until fn returns false. Rules for src come before rules for
+// AnyState of the same priority.
+func (f *FSM) forEachRule(event, src string, fn func(eKey, *transitionRule) bool) {
+	specificKey, wildcardKey := eKey{event, src}, eKey{event, AnyState}
+	specific := f.transitions[specificKey]
+	var wildcard []*transitionRule
+	if f.wildcards && src != AnyState {
+		wildcard = f.transitions[wildcardKey]
+	}
+	i, j := 0, 0
+	for i < len(specific) || j < len(wildcard) {
+		var cont bool
+		if j >= len(wildcard) || (i < len(specific) && specific[i].priority >= wildcard[j].priority) {
+			cont = fn(specificKey, specific[i])
+			i++
+		} else {
+			cont = fn(wildcardKey, wildcard[j])
+			j++
+		}
+		if !cont {
+			return
+		}
+	}
+}
+
 // eKey is a struct key used for storing the transition map.
 type eKey struct {
 	// event is the name of the event that the keys refers to.
@@ -18,7 +18,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -690,6 +689,93 @@ func TestThreadSafetyRaceCondition(t *testing.T) {
 	wg.Wait()
 }
 
+func TestConcurrentAccessRaceCondition(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"leave_state": func(_ context.Context, e *Event) {
+				if len(e.Args) > 0 {
+					e.Async()
+				}
+			},
+		},
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			event := "open"
+			if i%2 == 1 {
+				event = "close"
+			}
+			if i%5 == 0 {
+				_ = fsm.Event(context.Background(), event, "async")
+			} else {
+				_ = fsm.Event(context.Background(), event)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = fsm.Transition()
+		}()
+		go func() {
+			defer wg.Done()
+			fsm.Can("open")
+			fsm.Cannot("close")
+			fsm.Current()
+			fsm.AvailableTransitions()
+			fsm.EntryCount("open")
+		}()
+	}
+	wg.Wait()
+	_ = fsm.Transition()
+
+	if state := fsm.Current(); state != "open" && state != "closed" {
+		t.Errorf("expected state to be 'open' or 'closed', got %s", state)
+	}
+}
+
+func TestCanInCallbacks(t *testing.T) {
+	var canInBefore, canInLeave, canInEnter bool
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"before_open": func(_ context.Context, e *Event) {
+				canInBefore = e.FSM.Can("open")
+			},
+			"leave_closed": func(_ context.Context, e *Event) {
+				canInLeave = e.FSM.Can("open")
+			},
+			"enter_open": func(_ context.Context, e *Event) {
+				canInEnter = e.FSM.Can("close")
+			},
+		},
+	)
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("transition failed %v", err)
+	}
+	if !canInBefore {
+		t.Error("expected Can to report on the current state in before callbacks")
+	}
+	if canInLeave {
+		t.Error("expected Can to be false while a transition is pending")
+	}
+	if !canInEnter {
+		t.Error("expected Can to report on the new state in enter callbacks")
+	}
+}
+
 func TestDoubleTransition(t *testing.T) {
 	var fsm *FSM
 	var wg sync.WaitGroup
@@ -850,6 +936,172 @@ func TestNoTransitionAfterEventCallbackTransition(t *testing.T) {
 	}
 }
 
+func TestWildcardSource(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "running"},
+			{Name: "abort", Src: []string{AnyState}, Dst: "aborted"},
+		},
+		Callbacks{},
+	)
+	if !fsm.Can("abort") {
+		t.Error("expected 'abort' to be possible from 'start'")
+	}
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if err := fsm.Event(context.Background(), "abort"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "aborted" {
+		t.Errorf("expected state to be 'aborted', was '%s'", fsm.Current())
+	}
+	if _, ok := fsm.Event(context.Background(), "abort").(NoTransitionError); !ok {
+		t.Error("expected 'NoTransitionError' when aborting in 'aborted'")
+	}
+	if _, ok := fsm.Event(context.Background(), "run").(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError' when running in 'aborted'")
+	}
+}
+
+func TestWildcardSourcePrecedence(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "stop", Src: []string{AnyState}, Dst: "stopped"},
+			{Name: "stop", Src: []string{"start"}, Dst: "cancelled"},
+		},
+		Callbacks{},
+	)
+	transitions := fsm.AvailableTransitions()
+	if len(transitions) != 1 || transitions[0] != "stop" {
+		t.Errorf("expected [stop], got %v", transitions)
+	}
+	if err := fsm.Event(context.Background(), "stop"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "cancelled" {
+		t.Errorf("expected state to be 'cancelled', was '%s'", fsm.Current())
+	}
+}
+
+func TestTransitionPriority(t *testing.T) {
+	amount := 0
+	isLarge := func(_ context.Context, g GuardContext) bool {
+		return amount > 100
+	}
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{Name: "submit", Src: []string{"draft"}, Dst: "approved"},
+			{Name: "submit", Src: []string{"draft"}, Dst: "needs_review", Guard: isLarge, Priority: 1},
+			{Name: "reset", Src: []string{"approved", "needs_review"}, Dst: "draft"},
+		},
+		Callbacks{},
+	)
+
+	amount = 1000
+	if err := fsm.Event(context.Background(), "submit"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "needs_review" {
+		t.Errorf("expected state to be 'needs_review', was '%s'", fsm.Current())
+	}
+
+	_ = fsm.Event(context.Background(), "reset")
+	amount = 10
+	if err := fsm.Event(context.Background(), "submit"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "approved" {
+		t.Errorf("expected state to be 'approved', was '%s'", fsm.Current())
+	}
+}
+
+func TestTransitionPriorityDefinitionOrder(t *testing.T) {
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{Name: "submit", Src: []string{"draft"}, Dst: "rejected", Guard: func(_ context.Context, g GuardContext) bool {
+				return len(g.Args) > 0
+			}},
+			{Name: "submit", Src: []string{"draft"}, Dst: "approved"},
+		},
+		Callbacks{},
+	)
+	if err := fsm.Event(context.Background(), "submit", "invalid"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "rejected" {
+		t.Errorf("expected state to be 'rejected', was '%s'", fsm.Current())
+	}
+}
+
+func TestTransitionPriorityOverWildcard(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "stop", Src: []string{"start"}, Dst: "cancelled"},
+			{Name: "stop", Src: []string{AnyState}, Dst: "emergency", Priority: 10, Guard: func(_ context.Context, g GuardContext) bool {
+				v, ok := g.StringArg(0)
+				return ok && v == "emergency"
+			}},
+		},
+		Callbacks{},
+	)
+	if err := fsm.Event(context.Background(), "stop", "emergency"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "emergency" {
+		t.Errorf("expected state to be 'emergency', was '%s'", fsm.Current())
+	}
+
+	fsm.SetState("start")
+	if err := fsm.Event(context.Background(), "stop"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "cancelled" {
+		t.Errorf("expected state to be 'cancelled', was '%s'", fsm.Current())
+	}
+}
+
+func TestTransitionRedefinition(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "one"},
+			{Name: "run", Src: []string{"start"}, Dst: "two"},
+		},
+		Callbacks{},
+	)
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "two" {
+		t.Errorf("expected the last definition to win, state was '%s'", fsm.Current())
+	}
+}
+
+func TestAvailableTransitionsSorted(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "zulu", Src: []string{"start"}, Dst: "end"},
+			{Name: "alpha", Src: []string{"start"}, Dst: "end"},
+			{Name: "mike", Src: []string{AnyState}, Dst: "end"},
+			{Name: "bravo", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{},
+	)
+	for i := 0; i < 10; i++ {
+		transitions := fsm.AvailableTransitions()
+		if fmt.Sprint(transitions) != "[alpha bravo mike zulu]" {
+			t.Fatalf("expected sorted transitions, got %v", transitions)
+		}
+	}
+}
+
 func ExampleNewFSM() {
 	fsm := NewFSM(
 		"green",
@@ -961,10 +1213,7 @@ func ExampleFSM_AvailableTransitions() {
 		},
 		Callbacks{},
 	)
-	// sort the results ordering is consistent for the output checker
-	transitions := fsm.AvailableTransitions()
-	sort.Strings(transitions)
-	fmt.Println(transitions)
+	fmt.Println(fsm.AvailableTransitions())
 	// Output:
 	// [kick open]
 }
@@ -1066,3 +1315,214 @@ func TestEventAndCanInGoroutines(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestInternalTransition(t *testing.T) {
+	var calls []string
+	record := func(name string) Callback {
+		return func(_ context.Context, e *Event) {
+			calls = append(calls, name)
+		}
+	}
+	fsm := NewFSM(
+		"editing",
+		Events{
+			{Name: "update", Src: []string{"editing"}, Kind: KindInternal},
+			{Name: "save", Src: []string{"editing"}, Dst: "saved"},
+		},
+		Callbacks{
+			"before_update": record("before_update"),
+			"leave_state":   record("leave_state"),
+			"enter_state":   record("enter_state"),
+			"after_update":  record("after_update"),
+		},
+	)
+
+	if err := fsm.Event(context.Background(), "update"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "editing" {
+		t.Errorf("expected state to be 'editing', was '%s'", fsm.Current())
+	}
+	if fmt.Sprint(calls) != "[before_update after_update]" {
+		t.Errorf("expected only before and after callbacks, got %v", calls)
+	}
+	if fsm.EntryCount("editing") != 0 {
+		t.Error("expected internal transition not to count as a state entry")
+	}
+	if _, ok := fsm.Event(context.Background(), "update").(NoTransitionError); ok {
+		t.Error("expected no 'NoTransitionError' for an internal transition")
+	}
+}
+
+func TestInternalTransitionAnyState(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+			{Name: "ping", Src: []string{AnyState}, Kind: KindInternal},
+		},
+		Callbacks{},
+	)
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if err := fsm.Event(context.Background(), "ping"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "end" {
+		t.Errorf("expected state to be 'end', was '%s'", fsm.Current())
+	}
+}
+
+func TestExternalSelfTransition(t *testing.T) {
+	var calls []string
+	record := func(name string) Callback {
+		return func(_ context.Context, e *Event) {
+			calls = append(calls, name)
+		}
+	}
+	fsm := NewFSM(
+		"polling",
+		Events{
+			{Name: "restart", Src: []string{"polling"}, Dst: "polling", Kind: KindExternal},
+			{Name: "tick", Src: []string{"polling"}, Dst: "polling"},
+		},
+		Callbacks{
+			"before_event":  record("before_event"),
+			"leave_polling": record("leave_polling"),
+			"enter_polling": record("enter_polling"),
+			"after_event":   record("after_event"),
+		},
+	)
+
+	if err := fsm.Event(context.Background(), "restart"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fmt.Sprint(calls) != "[before_event leave_polling enter_polling after_event]" {
+		t.Errorf("expected leave and enter callbacks for an external self-transition, got %v", calls)
+	}
+	if fsm.EntryCount("polling") != 1 {
+		t.Error("expected external self-transition to count as a state entry")
+	}
+
+	calls = nil
+	if _, ok := fsm.Event(context.Background(), "tick").(NoTransitionError); !ok {
+		t.Error("expected 'NoTransitionError' for a default self-transition")
+	}
+	if fmt.Sprint(calls) != "[before_event after_event]" {
+		t.Errorf("expected only before and after callbacks, got %v", calls)
+	}
+}
+
+func TestTransitionIDAndDuration(t *testing.T) {
+	var enterEvent, afterEvent Event
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_state": func(_ context.Context, e *Event) {
+				enterEvent = *e
+				time.Sleep(time.Millisecond)
+			},
+			"after_event": func(_ context.Context, e *Event) {
+				afterEvent = *e
+			},
+		},
+	)
+
+	var infos []TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+
+	before := time.Now()
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if afterEvent.ID == 0 || afterEvent.ID != enterEvent.ID {
+		t.Errorf("expected the same non-zero ID in all callbacks, got %d and %d", enterEvent.ID, afterEvent.ID)
+	}
+	if afterEvent.StartedAt.Before(before) || afterEvent.StartedAt.After(time.Now()) {
+		t.Errorf("unexpected start time %v", afterEvent.StartedAt)
+	}
+	if enterEvent.Duration != 0 {
+		t.Errorf("expected no duration during enter callbacks, got %v", enterEvent.Duration)
+	}
+	if afterEvent.Duration < time.Millisecond {
+		t.Errorf("expected duration of at least 1ms in after callbacks, got %v", afterEvent.Duration)
+	}
+	if len(infos) != 1 || infos[0].ID != afterEvent.ID {
+		t.Errorf("expected observer to get ID %d, got %+v", afterEvent.ID, infos)
+	}
+
+	if err := fsm.Event(context.Background(), "close"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if afterEvent.ID <= infos[0].ID {
+		t.Errorf("expected increasing IDs, got %d after %d", afterEvent.ID, infos[0].ID)
+	}
+}
+
+func TestEventNoCtx(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_open": func(ctx context.Context, e *Event) {
+				if ctx == nil || ctx.Err() != nil {
+					t.Error("expected a usable context")
+				}
+				if len(e.Args) != 1 || e.Args[0] != "arg" {
+					t.Errorf("expected args to be passed, got %v", e.Args)
+				}
+			},
+		},
+	)
+
+	if err := fsm.EventNoCtx("open", "arg"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+	if _, ok := fsm.EventNoCtx("open").(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError'")
+	}
+}
+
+func TestUninitializedFSM(t *testing.T) {
+	for _, fsm := range []*FSM{nil, {}} {
+		if _, ok := fsm.Event(context.Background(), "open").(NotInitializedError); !ok {
+			t.Error("expected 'NotInitializedError' from Event")
+		}
+		if _, ok := fsm.Transition().(NotInitializedError); !ok {
+			t.Error("expected 'NotInitializedError' from Transition")
+		}
+		if fsm.Current() != "" || fsm.Can("open") {
+			t.Error("expected no state and no possible events")
+		}
+		fsm.Close()
+	}
+}
+
+func TestNilCallbacks(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Unless: []GuardFunc{nil}},
+		},
+		Callbacks{
+			"enter_open": nil,
+		},
+	)
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	e := &Event{}
+	e.Cancel()
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/looplab/fsm"
+)
+
+// FakeClock is a fsm.Clock whose time only moves when Advance is called, to
+// test state timeouts, delayed and periodic events without sleeping:
+//
+//	clock := fsmtest.NewFakeClock(time.Now())
+//	f := fsm.NewFSM(..., fsm.WithClock(clock), fsm.WithStateTimeout("waiting", time.Minute, "expire"))
+//	clock.Advance(time.Minute)
+//	// f is now in the state entered by "expire"
+//
+// It is safe for concurrent use.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer is a timer of a FakeClock.
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	fn       func()
+	c        chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the time of the clock once it has
+// been advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a timer that sends the time of the clock on its channel
+// once the clock has been advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) fsm.Timer {
+	return c.add(d, nil, make(chan time.Time, 1))
+}
+
+// AfterFunc returns a timer that calls fn once the clock has been advanced by
+// d. Unlike time.AfterFunc, fn is called by Advance, so that its effects are
+// visible when Advance returns.
+func (c *FakeClock) AfterFunc(d time.Duration, fn func()) fsm.Timer {
+	return c.add(d, fn, nil)
+}
+
+// Advance moves the clock forward by d and fires the timers that are due, in
+// the order of their deadlines. The time of the clock is set to the deadline
+// of each timer while it fires, so timers started by the functions of other
+// timers fire too if they are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		t := c.next(target)
+		if t == nil {
+			break
+		}
+		c.now = t.deadline
+		c.mu.Unlock()
+		t.fire()
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// Timers returns the number of timers that have not fired or been stopped.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// add starts a timer that fires after d.
+func (c *FakeClock) add(d time.Duration, fn func(), ch chan time.Time) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), fn: fn, c: ch}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// next removes and returns the timer with the earliest deadline that is not
+// after target, or nil if there is none. Callers must hold mu.
+func (c *FakeClock) next(target time.Time) *fakeTimer {
+	next := -1
+	for i, t := range c.timers {
+		if !t.deadline.After(target) && (next < 0 || t.deadline.Before(c.timers[next].deadline)) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return nil
+	}
+	t := c.timers[next]
+	c.timers = append(c.timers[:next], c.timers[next+1:]...)
+	return t
+}
+
+// remove removes t from the timers and returns true if it was there. Callers
+// must hold mu.
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fire calls the function of the timer or sends the deadline on its channel.
+func (t *fakeTimer) fire() {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	select {
+	case t.c <- t.deadline:
+	default:
+	}
+}
+
+// C returns the channel of the timer, which is nil for AfterFunc timers.
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop prevents the timer from firing. It returns false if the timer has
+// already fired or been stopped.
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+// Reset changes the timer to fire once the clock has been advanced by d. It
+// returns true if the timer had been active.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.remove(t)
+	t.deadline = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	return active
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/looplab/fsm"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	var fired []string
+	clock.AfterFunc(2*time.Second, func() {
+		fired = append(fired, "b")
+	})
+	clock.AfterFunc(time.Second, func() {
+		fired = append(fired, "a")
+		clock.AfterFunc(time.Second, func() {
+			fired = append(fired, "c")
+		})
+	})
+	timer := clock.NewTimer(time.Minute)
+	after := clock.After(3 * time.Second)
+
+	clock.Advance(3 * time.Second)
+	if len(fired) != 3 || fired[0] != "a" || fired[1] != "b" || fired[2] != "c" {
+		t.Errorf("expected timers to fire in order, got %v", fired)
+	}
+	select {
+	case now := <-after:
+		if !now.Equal(start.Add(3 * time.Second)) {
+			t.Errorf("expected time of deadline, got %v", now)
+		}
+	default:
+		t.Error("expected After to fire")
+	}
+	if !clock.Now().Equal(start.Add(3 * time.Second)) {
+		t.Errorf("expected clock to be advanced, got %v", clock.Now())
+	}
+	if clock.Timers() != 1 {
+		t.Errorf("expected 1 pending timer, got %d", clock.Timers())
+	}
+
+	if !timer.Reset(time.Second) {
+		t.Error("expected timer to be active")
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Error("expected reset timer to fire")
+	}
+	if timer.Stop() {
+		t.Error("expected fired timer not to be stopped")
+	}
+}
+
+func TestFakeClockStateTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	f := fsm.NewFSM(
+		"waiting",
+		fsm.Events{
+			{Name: "expire", Src: []string{"waiting"}, Dst: "expired"},
+		},
+		fsm.Callbacks{},
+		fsm.WithClock(clock),
+		fsm.WithStateTimeout("waiting", time.Minute, "expire"),
+	)
+	defer f.Close()
+
+	clock.Advance(59 * time.Second)
+	if f.Current() != "waiting" {
+		t.Fatalf("expected state to be 'waiting', got %s", f.Current())
+	}
+	clock.Advance(time.Second)
+	if f.Current() != "expired" {
+		t.Errorf("expected state to be 'expired', got %s", f.Current())
+	}
+	if err := f.Event(context.Background(), "expire"); err == nil {
+		t.Error("expected event to be inappropriate")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/looplab/fsm"
+)
+
+// EffectCall is a recorded invocation of an effect handler.
+type EffectCall struct {
+	// Effect is the name of the effect.
+	Effect string
+
+	// Event is the name of the event that caused the transition.
+	Event string
+
+	// Src is the state before the transition.
+	Src string
+
+	// Dst is the state after the transition.
+	Dst string
+
+	// Args are the arguments passed to the event.
+	Args []interface{}
+}
+
+// EffectRecorder is a test double for the effect handlers of a FSM. It records
+// every invoked effect and checks expectations on them, so that the behavior
+// of a machine can be tested without its real integrations:
+//
+//	effects := fsmtest.NewEffectRecorder()
+//	f := fsm.NewFSM(..., fsm.WithEffects(effects.Registry("charge_card")))
+//	effects.Expect("charge_card").Once()
+//	...
+//	effects.Verify(t)
+//
+// It is safe for concurrent use.
+type EffectRecorder struct {
+	mu           sync.Mutex
+	calls        []EffectCall
+	failures     map[string]error
+	expectations []*EffectExpectation
+}
+
+// NewEffectRecorder returns an empty EffectRecorder.
+func NewEffectRecorder() *EffectRecorder {
+	return &EffectRecorder{
+		failures: make(map[string]error),
+	}
+}
+
+// Registry returns handlers for the named effects that record their
+// invocations, to be passed to fsm.WithEffects.
+func (r *EffectRecorder) Registry(effects ...string) fsm.EffectRegistry {
+	registry := make(fsm.EffectRegistry, len(effects))
+	for _, name := range effects {
+		registry[name] = r.Handler(name)
+	}
+	return registry
+}
+
+// Handler returns a handler for the named effect that records its invocations.
+func (r *EffectRecorder) Handler(effect string) fsm.EffectHandler {
+	return func(_ context.Context, e *fsm.Event) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls = append(r.calls, EffectCall{effect, e.Event, e.Src, e.Dst, e.Args})
+		return r.failures[effect]
+	}
+}
+
+// FailWith makes the handler of the named effect return err, to test how a
+// machine handles failing effects. A nil err makes it succeed again.
+func (r *EffectRecorder) FailWith(effect string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		delete(r.failures, effect)
+		return
+	}
+	r.failures[effect] = err
+}
+
+// Calls returns the recorded invocations of the named effect, in the order
+// they happened. An empty name returns the invocations of all effects.
+func (r *EffectRecorder) Calls(effect string) []EffectCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls []EffectCall
+	for _, c := range r.calls {
+		if effect == "" || c.Effect == effect {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets all recorded invocations and expectations.
+func (r *EffectRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+	r.expectations = nil
+}
+
+// Expect adds an expectation that the named effect is invoked. By default it
+// must be invoked at least once; use the methods of the returned expectation
+// to refine it. Expectations are checked by Verify.
+func (r *EffectRecorder) Expect(effect string) *EffectExpectation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	x := &EffectExpectation{effect: effect, times: -1}
+	r.expectations = append(r.expectations, x)
+	return x
+}
+
+// Verify reports an error on t for every expectation that is not met.
+func (r *EffectRecorder) Verify(t testing.TB) {
+	t.Helper()
+	r.mu.Lock()
+	expectations := r.expectations
+	r.mu.Unlock()
+
+	for _, x := range expectations {
+		n := 0
+		for _, c := range r.Calls(x.effect) {
+			if x.matches(c) {
+				n++
+			}
+		}
+		switch {
+		case x.times < 0 && n == 0:
+			t.Errorf("expected effect %s%s to be invoked, but it was not", x.effect, x.describeArgs())
+		case x.times >= 0 && n != x.times:
+			t.Errorf("expected effect %s%s to be invoked %d times, but it was invoked %d times", x.effect, x.describeArgs(), x.times, n)
+		}
+	}
+}
+
+// EffectExpectation is an expectation on the invocations of an effect,
+// created with EffectRecorder.Expect.
+type EffectExpectation struct {
+	effect  string
+	times   int
+	args    []interface{}
+	hasArgs bool
+}
+
+// Once expects the effect to be invoked exactly once.
+func (x *EffectExpectation) Once() *EffectExpectation {
+	return x.Times(1)
+}
+
+// Times expects the effect to be invoked exactly n times.
+func (x *EffectExpectation) Times(n int) *EffectExpectation {
+	x.times = n
+	return x
+}
+
+// Never expects the effect not to be invoked.
+func (x *EffectExpectation) Never() *EffectExpectation {
+	return x.Times(0)
+}
+
+// WithArgs only counts the invocations for events with the given arguments.
+func (x *EffectExpectation) WithArgs(args ...interface{}) *EffectExpectation {
+	x.args = args
+	x.hasArgs = true
+	return x
+}
+
+func (x *EffectExpectation) matches(c EffectCall) bool {
+	if !x.hasArgs {
+		return true
+	}
+	if len(x.args) == 0 && len(c.Args) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(x.args, c.Args)
+}
+
+func (x *EffectExpectation) describeArgs() string {
+	if !x.hasArgs {
+		return ""
+	}
+	return " with args " + fmt.Sprint(x.args)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/looplab/fsm"
+)
+
+// recordingT records the errors reported by Verify.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestEffectRecorder(t *testing.T) {
+	effects := NewEffectRecorder()
+	f := fsm.NewFSM(
+		"pending",
+		fsm.Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card", "send_receipt"}},
+			{Name: "refund", Src: []string{"paid"}, Dst: "refunded", Effects: []string{"refund_card"}},
+		},
+		fsm.Callbacks{},
+		fsm.WithEffects(effects.Registry("charge_card", "send_receipt", "refund_card")),
+	)
+
+	if err := f.Event(context.Background(), "pay", 42); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	effects.Expect("charge_card").Once().WithArgs(42)
+	effects.Expect("send_receipt")
+	effects.Expect("refund_card").Never()
+	effects.Verify(t)
+
+	calls := effects.Calls("charge_card")
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	wanted := EffectCall{"charge_card", "pay", "pending", "paid", []interface{}{42}}
+	if fmt.Sprint(calls[0]) != fmt.Sprint(wanted) {
+		t.Errorf("expected call %v, got %v", wanted, calls[0])
+	}
+	if len(effects.Calls("")) != 2 {
+		t.Errorf("expected 2 calls in total, got %d", len(effects.Calls("")))
+	}
+}
+
+func TestEffectRecorderUnmetExpectations(t *testing.T) {
+	effects := NewEffectRecorder()
+	f := fsm.NewFSM(
+		"pending",
+		fsm.Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card", "send_receipt"}},
+			{Name: "refund", Src: []string{"paid"}, Dst: "refunded", Effects: []string{"refund_card"}},
+		},
+		fsm.Callbacks{},
+		fsm.WithEffects(effects.Registry("charge_card", "send_receipt", "refund_card")),
+	)
+
+	if err := f.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	effects.Expect("refund_card")
+	effects.Expect("charge_card").Times(2)
+	effects.Expect("send_receipt").WithArgs("x")
+	effects.Expect("send_receipt").Never()
+
+	rt := &recordingT{}
+	effects.Verify(rt)
+	wanted := []string{
+		"expected effect refund_card to be invoked, but it was not",
+		"expected effect charge_card to be invoked 2 times, but it was invoked 1 times",
+		"expected effect send_receipt with args [x] to be invoked, but it was not",
+		"expected effect send_receipt to be invoked 0 times, but it was invoked 1 times",
+	}
+	if fmt.Sprint(rt.errors) != fmt.Sprint(wanted) {
+		t.Errorf("expected errors %q, got %q", wanted, rt.errors)
+	}
+
+	effects.Reset()
+	rt = &recordingT{}
+	effects.Verify(rt)
+	if len(rt.errors) != 0 || len(effects.Calls("")) != 0 {
+		t.Error("expected Reset to forget calls and expectations")
+	}
+}
+
+func TestEffectRecorderFailWith(t *testing.T) {
+	effects := NewEffectRecorder()
+	f := fsm.NewFSM(
+		"pending",
+		fsm.Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card", "send_receipt"}},
+			{Name: "refund", Src: []string{"paid"}, Dst: "refunded", Effects: []string{"refund_card"}},
+		},
+		fsm.Callbacks{},
+		fsm.WithEffects(effects.Registry("charge_card", "send_receipt", "refund_card")),
+	)
+	declined := errors.New("card declined")
+
+	effects.FailWith("charge_card", declined)
+	if err := f.Event(context.Background(), "pay"); !errors.Is(err, declined) {
+		t.Errorf("expected effect error, got %v", err)
+	}
+	if f.Current() != "pending" {
+		t.Errorf("expected state to be 'pending', was '%s'", f.Current())
+	}
+
+	effects.FailWith("charge_card", nil)
+	if err := f.Event(context.Background(), "pay"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	effects.Expect("charge_card").Times(2)
+	effects.Expect("send_receipt").Once()
+	effects.Verify(t)
+}
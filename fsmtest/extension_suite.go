@@ -0,0 +1,274 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsmtest provides utilities for testing code that uses or extends
+// the fsm package.
+package fsmtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/looplab/fsm"
+)
+
+// suiteTimeout is the time a scenario may take before it is considered stuck.
+const suiteTimeout = 5 * time.Second
+
+// RunExtensionSuite runs a behavioral test suite that checks that an extension
+// preserves the core invariants of the FSM: the order of callbacks, the errors
+// returned by Event and that no transition gets stuck.
+//
+// newExtension is called to create a new extension for every scenario.
+func RunExtensionSuite(t *testing.T, newExtension func() fsm.Extension) {
+	t.Helper()
+
+	scenarios := []struct {
+		name string
+		fn   func(*recorder, func() fsm.Extension)
+	}{
+		{"CallbackOrder", testCallbackOrder},
+		{"Errors", testErrors},
+		{"Cancel", testCancel},
+		{"Async", testAsync},
+		{"TransitionInCallback", testTransitionInCallback},
+		{"Concurrency", testConcurrency},
+		{"Close", testClose},
+	}
+	for _, s := range scenarios {
+		s := s
+		t.Run(s.name, func(t *testing.T) {
+			// the scenario reports to the test goroutine, so that t is not
+			// used anymore if it gets stuck and the test returns
+			done := make(chan []string, 1)
+			go func() {
+				r := &recorder{}
+				defer func() {
+					done <- r.messages()
+				}()
+				s.fn(r, newExtension)
+			}()
+			select {
+			case messages := <-done:
+				for _, msg := range messages {
+					t.Error(msg)
+				}
+			case <-time.After(suiteTimeout):
+				t.Fatalf("scenario did not complete within %s", suiteTimeout)
+			}
+		})
+	}
+}
+
+// recorder records the errors of a scenario.
+type recorder struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+// Error records an error formatted like testing.T.Error.
+func (r *recorder) Error(args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+// Errorf records an error formatted like testing.T.Errorf.
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// messages returns the recorded errors.
+func (r *recorder) messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.errors...)
+}
+
+func newDoor(newExtension func() fsm.Extension, callbacks fsm.Callbacks) *fsm.FSM {
+	return fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "stay", Src: []string{"closed"}, Dst: "closed"},
+			{Name: "lock", Src: []string{"closed"}, Dst: "locked", Guard: func(context.Context, fsm.GuardContext) bool {
+				return false
+			}},
+		},
+		callbacks,
+		fsm.WithExtensions(newExtension()),
+	)
+}
+
+func testCallbackOrder(r *recorder, newExtension func() fsm.Extension) {
+	var calls []string
+	record := func(name string) fsm.Callback {
+		return func(context.Context, *fsm.Event) {
+			calls = append(calls, name)
+		}
+	}
+	f := newDoor(newExtension, fsm.Callbacks{
+		"before_open":  record("before_open"),
+		"before_event": record("before_event"),
+		"leave_closed": record("leave_closed"),
+		"leave_state":  record("leave_state"),
+		"enter_open":   record("enter_open"),
+		"enter_state":  record("enter_state"),
+		"after_open":   record("after_open"),
+		"after_event":  record("after_event"),
+	})
+
+	if err := f.Event(context.Background(), "open"); err != nil {
+		r.Errorf("expected no error, got %v", err)
+	}
+	wanted := []string{
+		"before_open", "before_event",
+		"leave_closed", "leave_state",
+		"enter_open", "enter_state",
+		"after_open", "after_event",
+	}
+	if !reflect.DeepEqual(calls, wanted) {
+		r.Errorf("expected callbacks %v, got %v", wanted, calls)
+	}
+	if f.Current() != "open" {
+		r.Errorf("expected state to be 'open', was '%s'", f.Current())
+	}
+}
+
+func testErrors(r *recorder, newExtension func() fsm.Extension) {
+	f := newDoor(newExtension, fsm.Callbacks{})
+
+	if _, ok := f.Event(context.Background(), "close").(fsm.InvalidEventError); !ok {
+		r.Error("expected 'InvalidEventError'")
+	}
+	if _, ok := f.Event(context.Background(), "kick").(fsm.UnknownEventError); !ok {
+		r.Error("expected 'UnknownEventError'")
+	}
+	if _, ok := f.Event(context.Background(), "lock").(fsm.GuardFailedError); !ok {
+		r.Error("expected 'GuardFailedError'")
+	}
+	if _, ok := f.Event(context.Background(), "stay").(fsm.NoTransitionError); !ok {
+		r.Error("expected 'NoTransitionError'")
+	}
+	if f.Current() != "closed" {
+		r.Errorf("expected state to be 'closed', was '%s'", f.Current())
+	}
+}
+
+func testCancel(r *recorder, newExtension func() fsm.Extension) {
+	cancel := true
+	f := newDoor(newExtension, fsm.Callbacks{
+		"leave_closed": func(_ context.Context, e *fsm.Event) {
+			if cancel {
+				e.Cancel()
+			}
+		},
+	})
+
+	if _, ok := f.Event(context.Background(), "open").(fsm.CanceledError); !ok {
+		r.Error("expected 'CanceledError'")
+	}
+	if f.Current() != "closed" {
+		r.Errorf("expected state to be 'closed', was '%s'", f.Current())
+	}
+	cancel = false
+	if err := f.Event(context.Background(), "open"); err != nil {
+		r.Errorf("expected no error after a canceled transition, got %v", err)
+	}
+}
+
+func testAsync(r *recorder, newExtension func() fsm.Extension) {
+	f := newDoor(newExtension, fsm.Callbacks{
+		"leave_closed": func(_ context.Context, e *fsm.Event) {
+			e.Async()
+		},
+	})
+
+	if _, ok := f.Event(context.Background(), "open").(fsm.AsyncError); !ok {
+		r.Error("expected 'AsyncError'")
+	}
+	if _, ok := f.Event(context.Background(), "open").(fsm.InTransitionError); !ok {
+		r.Error("expected 'InTransitionError'")
+	}
+	if err := f.Transition(); err != nil {
+		r.Errorf("expected no error, got %v", err)
+	}
+	if f.Current() != "open" {
+		r.Errorf("expected state to be 'open', was '%s'", f.Current())
+	}
+	if _, ok := f.Transition().(fsm.NotInTransitionError); !ok {
+		r.Error("expected 'NotInTransitionError'")
+	}
+}
+
+func testTransitionInCallback(r *recorder, newExtension func() fsm.Extension) {
+	f := newDoor(newExtension, fsm.Callbacks{
+		"enter_open": func(ctx context.Context, e *fsm.Event) {
+			if err := e.FSM.Event(ctx, "close"); err != nil {
+				r.Errorf("expected no error, got %v", err)
+			}
+		},
+	})
+
+	if err := f.Event(context.Background(), "open"); err != nil {
+		r.Errorf("expected no error, got %v", err)
+	}
+	if f.Current() != "closed" {
+		r.Errorf("expected state to be 'closed', was '%s'", f.Current())
+	}
+}
+
+func testConcurrency(r *recorder, newExtension func() fsm.Extension) {
+	f := newDoor(newExtension, fsm.Callbacks{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(n int) {
+			defer wg.Done()
+			if n%2 == 0 {
+				_ = f.Event(context.Background(), "open")
+			} else {
+				_ = f.Event(context.Background(), "close")
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			f.Can("open")
+			f.Current()
+		}()
+	}
+	wg.Wait()
+
+	if state := f.Current(); state != "open" && state != "closed" {
+		r.Errorf("expected state to be 'open' or 'closed', was '%s'", state)
+	}
+}
+
+func testClose(r *recorder, newExtension func() fsm.Extension) {
+	f := newDoor(newExtension, fsm.Callbacks{})
+	if err := f.Event(context.Background(), "open"); err != nil {
+		r.Errorf("expected no error, got %v", err)
+	}
+	f.Close()
+	f.Close()
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmtest
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/looplab/fsm"
+)
+
+type countingExtension struct {
+	fsm.BaseExtension
+	mu          sync.Mutex
+	transitions int
+}
+
+func (c *countingExtension) AfterTransition(context.Context, *fsm.Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transitions++
+}
+
+func TestRunExtensionSuite(t *testing.T) {
+	RunExtensionSuite(t, func() fsm.Extension {
+		return fsm.BaseExtension{}
+	})
+	RunExtensionSuite(t, func() fsm.Extension {
+		return &countingExtension{}
+	})
+}
+
+type cancelingExtension struct {
+	fsm.BaseExtension
+}
+
+func (cancelingExtension) BeforeTransition(_ context.Context, e *fsm.Event) {
+	e.Cancel()
+}
+
+func TestRunExtensionSuiteReport(t *testing.T) {
+	r := &recorder{}
+	testCancel(r, func() fsm.Extension {
+		return cancelingExtension{}
+	})
+	expected := []string{"expected no error after a canceled transition, got transition canceled"}
+	if messages := r.messages(); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected errors %q, got %q", expected, messages)
+	}
+}
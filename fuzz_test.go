@@ -0,0 +1,238 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var fuzzNames = []string{"open", "close", "reset", "ping", "pick", "slow", "late", "unknown", "", AnyState, "closed", "opened", "picked"}
+
+// FuzzEvent checks that no sequence of operations panics.
+func FuzzEvent(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 1, 1, 1})
+	f.Add([]byte{0, 5, 1, 0, 0, 2, 3, 4})
+	f.Add([]byte{0, 4, 2, 0, 6, 1, 0, 8, 7, 3, 8, 5})
+	f.Add([]byte{4, 9, 0, 0, 5, 0, 1, 2, 0, 3})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		runFuzzOps(data)
+	})
+}
+
+// runFuzzOps performs the operations encoded in data on a new FSM.
+func runFuzzOps(data []byte) {
+	// Use most of the features that can fail, including nil callbacks and
+	// conditions.
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "opened", Guard: func(_ context.Context, g GuardContext) bool {
+				return len(g.Args) == 0 || g.Args[0] != "deny"
+			}},
+			{Name: "close", Src: []string{"opened", "picked"}, Dst: "closed", Unless: []GuardFunc{nil}},
+			{Name: "reset", Src: []string{AnyState}, Dst: "closed"},
+			{Name: "ping", Src: []string{AnyState}, Dst: "opened", Kind: KindInternal},
+			{Name: "pick", Src: []string{"closed", "opened"}, Dst: "picked", Choice: func(_ context.Context, e *Event) string {
+				if len(e.Args) > 0 {
+					s, _ := e.Args[0].(string)
+					return s
+				}
+				return ""
+			}},
+			{Name: "slow", Src: []string{"closed"}, Dst: "opened"},
+			{Name: "late", Src: []string{AnyState}, Dst: "picked"},
+		},
+		Callbacks{
+			"before_open": func(_ context.Context, e *Event) {
+				if len(e.Args) > 0 && e.Args[0] == "cancel" {
+					e.Cancel(errors.New("canceled"))
+				}
+			},
+			"leave_closed": func(_ context.Context, e *Event) {
+				if e.Event == "slow" {
+					e.Async()
+				}
+			},
+			"enter_state": func(_ context.Context, e *Event) {
+				if e.Event == "late" {
+					e.Cancel()
+					e.Async()
+				}
+			},
+			"after_event": nil,
+		},
+		WithCompensations(map[string]string{"late": "reset"}),
+		WithDeferredEvents(2, DeferDropOldest),
+	)
+	defer fsm.Close()
+	ctx := context.Background()
+	var cancels []func()
+
+	next := func() int {
+		if len(data) == 0 {
+			return 0
+		}
+		b := int(data[0])
+		data = data[1:]
+		return b
+	}
+	name := func() string {
+		return fuzzNames[next()%len(fuzzNames)]
+	}
+	args := func() []interface{} {
+		var args []interface{}
+		for i := next() % 3; i > 0; i-- {
+			args = append(args, name())
+		}
+		return args
+	}
+
+	for len(data) > 0 {
+		switch next() % 10 {
+		case 0:
+			err := fsm.Event(ctx, name(), args()...)
+			if asyncErr, ok := err.(AsyncError); ok {
+				cancels = append(cancels, asyncErr.CancelTransition)
+			}
+		case 1:
+			_ = fsm.Transition()
+		case 2:
+			fsm.SetState(name())
+		case 3:
+			fsm.Can(name())
+			fsm.Cannot(name())
+			fsm.AvailableTransitions()
+			fsm.Is(fsm.Current())
+		case 4:
+			_ = fsm.AddTransition(EventDesc{Name: name(), Src: []string{name()}, Dst: name()})
+		case 5:
+			_ = fsm.RemoveTransition(name(), name())
+		case 6:
+			_ = fsm.EventIf(ctx, name(), name(), args()...)
+		case 7:
+			_ = fsm.TryEvent(ctx, name(), args()...)
+		case 8:
+			for _, cancel := range cancels {
+				cancel()
+			}
+			cancels = nil
+		case 9:
+			_ = fsm.EventBatch(ctx, []EventRequest{{name(), args()}, {name(), args()}})
+		}
+	}
+}
+
+// TestUninitializedFSMMethods checks that no method panics on a nil FSM or one that
+// was not created with NewFSM.
+func TestUninitializedFSMMethods(t *testing.T) {
+	for name, fsm := range map[string]*FSM{"nil": nil, "zero": {}} {
+		t.Run(name, func(t *testing.T) {
+			callEveryMethod(t, fsm)
+		})
+	}
+}
+
+// callEveryMethod calls every method of fsm and the functions that take a FSM.
+func callEveryMethod(t *testing.T, fsm *FSM) {
+	ctx := context.Background()
+	notInitialized := func(err error) {
+		t.Helper()
+		if !errors.Is(err, NotInitializedError{}) {
+			t.Errorf("expected NotInitializedError, got %v", err)
+		}
+	}
+
+	notInitialized(fsm.Event(ctx, "open"))
+	notInitialized(fsm.EventNoCtx("open"))
+	notInitialized(fsm.EventIf(ctx, "closed", "open"))
+	notInitialized(fsm.TryEvent(ctx, "open"))
+	notInitialized(fsm.EventWait(ctx, "open"))
+	notInitialized(fsm.Transition())
+	notInitialized(fsm.EventBatch(ctx, []EventRequest{{Event: "open"}}))
+	_, err := fsm.EventChain(ctx, "open")
+	notInitialized(err)
+	_, err = fsm.EventAsync(ctx, "open")
+	notInitialized(err)
+	s := fsm.EventAfter(time.Millisecond, "open")
+	<-s.Done()
+	notInitialized(s.Err())
+	s.Cancel()
+	notInitialized(<-fsm.Send(ctx, "open"))
+	notInitialized(fsm.Run(ctx))
+	notInitialized(fsm.Stop(ctx))
+	notInitialized(fsm.WithinTx(ctx, nil, func(ctx context.Context) error { return nil }))
+	notInitialized(fsm.AddTransition(EventDesc{Name: "open", Src: []string{"closed"}, Dst: "open"}))
+	notInitialized(fsm.RemoveTransition("open", "closed"))
+	notInitialized(fsm.SetStateWithReason("open", "test"))
+	notInitialized(fsm.BindData(&struct{}{}))
+	notInitialized(fsm.UnmarshalData([]byte("{}")))
+	_, err = fsm.MarshalData()
+	notInitialized(err)
+	_, err = fsm.RedeliverDeadLetters(ctx)
+	notInitialized(err)
+	handle, err := fsm.On("enter_state", func(context.Context, *Event) {})
+	notInitialized(err)
+	fsm.Off(handle)
+
+	fsm.SetState("open")
+	fsm.SetMetadata("key", "value")
+	fsm.Metadata("key")
+	fsm.DeleteMetadata("key")
+	fsm.Use(func(next EventHandler) EventHandler { return next })
+	fsm.AddObserver(nil)
+	fsm.Link(nil, "done")
+	fsm.SetReplay(true)
+	fsm.Pause()
+	fsm.Resume()
+	fsm.ResetEntryCounts()
+	fsm.ForceRelease()
+	fsm.Close()
+
+	if fsm.Current() != "" || fsm.Path() != "" || fsm.Leaf() != "" || fsm.Is("open") || fsm.Is("open/closed") || fsm.IsCompleted() || fsm.IsPaused() {
+		t.Error("expected no current state")
+	}
+	if fsm.Can("open") || !fsm.Cannot("open") || fsm.CanWith(ctx, "open") {
+		t.Error("expected no event to be possible")
+	}
+	if fsm.AvailableTransitions() != nil || fsm.ActiveStates() != nil || fsm.Stack() != nil ||
+		fsm.DeferredEvents() != nil || fsm.PendingAsync() != nil || fsm.StateDurations() != nil {
+		t.Error("expected no states or events")
+	}
+	if fsm.Submachine("open") != nil || fsm.Regions("open") != nil || fsm.Data() != nil || fsm.Deps() != nil {
+		t.Error("expected no submachines or data")
+	}
+	fsm.State()
+	fsm.Stats()
+	fsm.MemStats()
+	fsm.EntryCount("open")
+	fsm.DurationInState()
+	fsm.StateDescription("open")
+	fsm.EventDescription("open")
+
+	Visualize(fsm)
+	VisualizeWithOptions(fsm, VisualizeOptions{})
+	VisualizeForPlantUML(fsm)
+	VisualizeForMermaidWithOptions(fsm, MermaidOptions{Guards: true, Callbacks: true})
+	for _, typ := range []VisualizeType{GRAPHVIZ, MERMAID, MermaidStateDiagram, MermaidFlowChart, PLANTUML} {
+		_, _ = VisualizeWithType(fsm, typ)
+	}
+	GenerateDoc(fsm, DocOptions{})
+}
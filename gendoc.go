@@ -0,0 +1,132 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DocOptions configures the document generated by GenerateDoc.
+type DocOptions struct {
+	// Title is the heading of the document, "State machine" if empty.
+	Title string
+
+	// Diagram is the type of the embedded mermaid diagram, StateDiagram if
+	// empty.
+	Diagram MermaidDiagramType
+
+	// NoDiagram leaves the diagram out of the document.
+	NoDiagram bool
+
+	// NoCallbacks leaves the callback inventory out of the document.
+	NoCallbacks bool
+}
+
+// GenerateDoc outputs a markdown document describing the FSM, with an
+// embedded mermaid diagram, the states and their descriptions, the transition
+// table and the inventory of registered callbacks. The output is sorted so
+// that it can be checked in and kept up to date with the code.
+func GenerateDoc(fsm *FSM, opts DocOptions) string {
+	fsm = visualized(fsm)
+	var buf bytes.Buffer
+
+	title := opts.Title
+	if title == "" {
+		title = "State machine"
+	}
+	buf.WriteString("# " + title + "\n")
+
+	if !opts.NoDiagram {
+		diagram, err := VisualizeForMermaidWithGraphType(fsm, opts.Diagram)
+		if err != nil {
+			diagram = visualizeForMermaidAsStateDiagram(fsm, MermaidOptions{})
+		}
+		buf.WriteString("\n## Diagram\n\n```mermaid\n")
+		buf.WriteString(diagram)
+		buf.WriteString("```\n")
+	}
+
+	fsm.stateMu.RLock()
+	edges := getSortedTransitionEdges(fsm)
+	states, _ := getSortedStates(edges)
+	current := fsm.current
+	fsm.stateMu.RUnlock()
+
+	buf.WriteString("\n## States\n\n")
+	buf.WriteString("| State | Description |\n")
+	buf.WriteString("| --- | --- |\n")
+	for _, state := range states {
+		name := docCell(state)
+		if fsm.finalStates[state] {
+			name += " (final)"
+		}
+		if state == current {
+			name += " (current)"
+		}
+		buf.WriteString(fmt.Sprintf("| %s | %s |\n", name, docCell(fsm.StateDescription(state))))
+	}
+
+	buf.WriteString("\n## Transitions\n\n")
+	buf.WriteString("| From | Event | To | Description |\n")
+	buf.WriteString("| --- | --- | --- | --- |\n")
+	for _, edge := range edges {
+		buf.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+			docCell(edge.src), docCell(edge.event), docCell(edge.dst), docCell(edge.description)))
+	}
+
+	if !opts.NoCallbacks {
+		writeDocCallbacks(&buf, fsm)
+	}
+
+	return buf.String()
+}
+
+// writeDocCallbacks writes the callback inventory of the FSM, sorted by name.
+func writeDocCallbacks(buf *bytes.Buffer, fsm *FSM) {
+	fsm.callbacksMu.RLock()
+	counts := make(map[string]int, len(fsm.callbacks))
+	for key, entries := range fsm.callbacks {
+		counts[key.String()] += len(entries)
+	}
+	fsm.callbacksMu.RUnlock()
+
+	names := make([]string, 0, len(counts))
+	for name, count := range counts {
+		if count > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	buf.WriteString("\n## Callbacks\n\n")
+	if len(names) == 0 {
+		buf.WriteString("No callbacks are registered.\n")
+		return
+	}
+	buf.WriteString("| Callback | Handlers |\n")
+	buf.WriteString("| --- | --- |\n")
+	for _, name := range names {
+		buf.WriteString(fmt.Sprintf("| %s | %d |\n", docCell(name), counts[name]))
+	}
+}
+
+// docCell escapes s for use in a markdown table cell.
+func docCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
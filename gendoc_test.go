@@ -0,0 +1,97 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDoc(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Description: "opens | the door"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(_ context.Context, e *Event) {},
+		},
+		WithStateDescriptions(map[string]string{"open": "The door is open"}),
+	)
+	if _, err := fsm.On("enter_open", func(context.Context, *Event) {}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	got := GenerateDoc(fsm, DocOptions{Title: "Door"})
+	wanted := "# Door\n" +
+		"\n## Diagram\n\n```mermaid\n" +
+		visualizeForMermaidAsStateDiagram(fsm, MermaidOptions{}) +
+		"```\n" +
+		`
+## States
+
+| State | Description |
+| --- | --- |
+| closed (current) |  |
+| open | The door is open |
+
+## Transitions
+
+| From | Event | To | Description |
+| --- | --- | --- | --- |
+| closed | open | open | opens \| the door |
+| open | close | closed |  |
+
+## Callbacks
+
+| Callback | Handlers |
+| --- | --- |
+| enter_open | 2 |
+`
+	if got != wanted {
+		t.Errorf("build markdown failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestGenerateDocOptions(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+	)
+
+	got := GenerateDoc(fsm, DocOptions{Diagram: FlowChart, NoCallbacks: true})
+	if !strings.HasPrefix(got, "# State machine\n") {
+		t.Errorf("expected default title, got %q", got)
+	}
+	if !strings.Contains(got, "```mermaid\ngraph LR\n") {
+		t.Errorf("expected flow chart, got %q", got)
+	}
+	if strings.Contains(got, "## Callbacks") {
+		t.Errorf("expected no callback inventory, got %q", got)
+	}
+
+	got = GenerateDoc(fsm, DocOptions{NoDiagram: true})
+	if strings.Contains(got, "```mermaid") {
+		t.Errorf("expected no diagram, got %q", got)
+	}
+	if !strings.Contains(got, "No callbacks are registered.") {
+		t.Errorf("expected empty callback inventory, got %q", got)
+	}
+}
@@ -3,19 +3,62 @@ package fsm
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
+// VisualizeOptions themes the Graphviz output of VisualizeWithOptions. The zero
+// value gives the output of Visualize.
+type VisualizeOptions struct {
+	// RankDir is the direction of the graph, like "LR" or "TB".
+	RankDir string
+
+	// NodeShape is the shape of the states, like "box" or "circle".
+	NodeShape string
+
+	// Shapes are the shapes of individual states, overriding NodeShape.
+	Shapes map[string]string
+
+	// FillColors are the fill colors of individual states, like "#EEEEEE".
+	FillColors map[string]string
+
+	// HighlightColor is the color of the current state, "red" by default.
+	HighlightColor string
+
+	// FontName is the font of the states and transitions.
+	FontName string
+}
+
+// highlightColor returns the color of the current state.
+func (o VisualizeOptions) highlightColor() string {
+	if o.HighlightColor == "" {
+		return "red"
+	}
+	return o.HighlightColor
+}
+
 // Visualize outputs a visualization of a FSM in Graphviz format.
 func Visualize(fsm *FSM) string {
+	return VisualizeWithOptions(fsm, VisualizeOptions{})
+}
+
+// VisualizeWithOptions outputs a visualization of a FSM in Graphviz format,
+// styled with opts.
+func VisualizeWithOptions(fsm *FSM, opts VisualizeOptions) string {
+	fsm = visualized(fsm)
 	var buf bytes.Buffer
 
+	fsm.stateMu.RLock()
+	defer fsm.stateMu.RUnlock()
+
 	// we sort the key alphabetically to have a reproducible graph output
-	sortedEKeys := getSortedTransitionKeys(fsm.transitions)
-	sortedStateKeys, _ := getSortedStates(fsm.transitions)
+	sortedEdges := getSortedTransitionEdges(fsm)
+	sortedStateKeys, statesToIDMap := getSortedStates(sortedEdges)
 
 	writeHeaderLine(&buf)
-	writeTransitions(&buf, sortedEKeys, fsm.transitions)
-	writeStates(&buf, fsm.current, sortedStateKeys)
+	writeGraphAttributes(&buf, opts)
+	writeTransitions(&buf, sortedEdges)
+	writeStates(&buf, fsm.Current(), sortedStateKeys, fsm.stateDescriptions, opts)
+	writeClusters(&buf, fsm, statesToIDMap, "", "    ", true, opts.highlightColor())
 	writeFooter(&buf)
 
 	return buf.String()
@@ -26,20 +69,58 @@ func writeHeaderLine(buf *bytes.Buffer) {
 	buf.WriteString("\n")
 }
 
-func writeTransitions(buf *bytes.Buffer, sortedEKeys []eKey, transitions map[eKey]string) {
-	for _, k := range sortedEKeys {
-		v := transitions[k]
-		buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, k.src, v, k.event))
+func writeGraphAttributes(buf *bytes.Buffer, opts VisualizeOptions) {
+	if opts.RankDir != "" {
+		buf.WriteString(fmt.Sprintf(`    rankdir = %q;`, opts.RankDir))
+		buf.WriteString("\n")
+	}
+	var attrs []string
+	if opts.NodeShape != "" {
+		attrs = append(attrs, fmt.Sprintf(`shape = %q`, opts.NodeShape))
+	}
+	if opts.FontName != "" {
+		attrs = append(attrs, fmt.Sprintf(`fontname = %q`, opts.FontName))
+	}
+	if len(attrs) > 0 {
+		buf.WriteString(fmt.Sprintf(`    node [%s];`, strings.Join(attrs, ", ")))
+		buf.WriteString("\n")
+	}
+	if opts.FontName != "" {
+		buf.WriteString(fmt.Sprintf(`    edge [fontname = %q];`, opts.FontName))
+		buf.WriteString("\n")
+	}
+}
+
+func writeTransitions(buf *bytes.Buffer, sortedEdges []transitionEdge) {
+	for _, edge := range sortedEdges {
+		if edge.description != "" {
+			buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s", tooltip = %q ];`, edge.src, edge.dst, edge.event, edge.description))
+		} else {
+			buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, edge.src, edge.dst, edge.event))
+		}
 		buf.WriteString("\n")
 	}
 
 	buf.WriteString("\n")
 }
 
-func writeStates(buf *bytes.Buffer, current string, sortedStateKeys []string) {
+func writeStates(buf *bytes.Buffer, current string, sortedStateKeys []string, descriptions map[string]string, opts VisualizeOptions) {
 	for _, k := range sortedStateKeys {
+		var attrs []string
 		if k == current {
-			buf.WriteString(fmt.Sprintf(`    "%s" [color = "red"];`, k))
+			attrs = append(attrs, fmt.Sprintf(`color = %q`, opts.highlightColor()))
+		}
+		if shape := opts.Shapes[k]; shape != "" {
+			attrs = append(attrs, fmt.Sprintf(`shape = %q`, shape))
+		}
+		if fill := opts.FillColors[k]; fill != "" {
+			attrs = append(attrs, `style = "filled"`, fmt.Sprintf(`fillcolor = %q`, fill))
+		}
+		if description := descriptions[k]; description != "" {
+			attrs = append(attrs, fmt.Sprintf(`tooltip = %q`, description))
+		}
+		if len(attrs) > 0 {
+			buf.WriteString(fmt.Sprintf(`    "%s" [%s];`, k, strings.Join(attrs, ", ")))
 		} else {
 			buf.WriteString(fmt.Sprintf(`    "%s";`, k))
 		}
@@ -47,6 +128,65 @@ func writeStates(buf *bytes.Buffer, current string, sortedStateKeys []string) {
 	}
 }
 
+// writeClusters writes the composite states of fsm as clusters containing the
+// states and transitions of their children, with a dashed edge from the
+// composite state to the initial state of each child. The states of a child
+// are prefixed with the path of the composite state, like "processing/paid",
+// and those of a region with its index as well. The current states are
+// highlighted with color if active is true.
+func writeClusters(buf *bytes.Buffer, fsm *FSM, statesToIDMap map[string]string, prefix, indent string, active bool, color string) {
+	for _, state := range getSortedCompositeStates(fsm, statesToIDMap) {
+		id := prefix + state
+		subs := fsm.submachines[state]
+		buf.WriteString(fmt.Sprintf(`%ssubgraph "cluster_%s" {`, indent, id))
+		buf.WriteString("\n")
+		buf.WriteString(fmt.Sprintf(`%s    label = "%s";`, indent, state))
+		buf.WriteString("\n")
+		var entries []string
+		for i, s := range subs {
+			childPrefix, inner := id+"/", indent+"    "
+			if len(subs) > 1 {
+				childPrefix = fmt.Sprintf("%s/%d/", id, i)
+				buf.WriteString(fmt.Sprintf(`%ssubgraph "cluster_%s/%d" {`, inner, id, i))
+				buf.WriteString("\n")
+				buf.WriteString(fmt.Sprintf(`%s    style = "dashed";`, inner))
+				buf.WriteString("\n")
+				inner += "    "
+			}
+			writeCluster(buf, s, childPrefix, inner, active && fsm.Current() == state, color)
+			if len(subs) > 1 {
+				buf.WriteString(fmt.Sprintf("%s}\n", indent+"    "))
+			}
+			entries = append(entries, childPrefix+s.initial)
+		}
+		buf.WriteString(fmt.Sprintf("%s}\n", indent))
+		for _, entry := range entries {
+			buf.WriteString(fmt.Sprintf(`%s"%s" -> "%s" [ style = "dashed" ];`, indent, id, entry))
+			buf.WriteString("\n")
+		}
+	}
+}
+
+// writeCluster writes the states and transitions of the child s, prefixed with
+// prefix, and its own composite states.
+func writeCluster(buf *bytes.Buffer, s *submachine, prefix, indent string, active bool, color string) {
+	edges, states, statesToIDMap := getRegionGraph(s)
+	current := s.child.Current()
+	for _, edge := range edges {
+		buf.WriteString(fmt.Sprintf(`%s"%s%s" -> "%s%s" [ label = "%s" ];`, indent, prefix, edge.src, prefix, edge.dst, edge.event))
+		buf.WriteString("\n")
+	}
+	for _, state := range states {
+		if active && state == current {
+			buf.WriteString(fmt.Sprintf(`%s"%s%s" [label = "%s", color = "%s"];`, indent, prefix, state, state, color))
+		} else {
+			buf.WriteString(fmt.Sprintf(`%s"%s%s" [label = "%s"];`, indent, prefix, state, state))
+		}
+		buf.WriteString("\n")
+	}
+	writeClusters(buf, s.child, statesToIDMap, prefix, indent, active, color)
+}
+
 func writeFooter(buf *bytes.Buffer) {
 	buf.WriteString(fmt.Sprintln("}"))
 }
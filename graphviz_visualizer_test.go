@@ -1,6 +1,7 @@
 package fsm
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -36,3 +37,207 @@ digraph fsm {
 		fmt.Println([]byte(normalizedWanted))
 	}
 }
+
+func TestGraphvizOutputWithWildcard(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "break", Src: []string{AnyState}, Dst: "broken"},
+			{Name: "break", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+
+	got := Visualize(fsmUnderTest)
+	wanted := `
+digraph fsm {
+    "broken" -> "broken" [ label = "break" ];
+    "closed" -> "broken" [ label = "break" ];
+    "closed" -> "open" [ label = "open" ];
+    "open" -> "closed" [ label = "break" ];
+
+    "broken";
+    "closed" [color = "red"];
+    "open";
+}`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build graphivz graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestGraphvizOutputWithPriorities(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"draft",
+		Events{
+			{Name: "submit", Src: []string{"draft"}, Dst: "review", Priority: 1, Guard: func(context.Context, GuardContext) bool { return false }},
+			{Name: "submit", Src: []string{"draft"}, Dst: "approved"},
+			{Name: "submit", Src: []string{"draft"}, Dst: "rejected", Priority: -1},
+		},
+		Callbacks{},
+	)
+
+	got := Visualize(fsmUnderTest)
+	wanted := `
+digraph fsm {
+    "draft" -> "approved" [ label = "submit" ];
+    "draft" -> "review" [ label = "submit" ];
+
+    "approved";
+    "draft" [color = "red"];
+    "review";
+}`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build graphivz graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestGraphvizOutputWithInternalTransition(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"editing",
+		Events{
+			{Name: "update", Src: []string{"editing"}, Kind: KindInternal},
+			{Name: "save", Src: []string{"editing"}, Dst: "saved"},
+		},
+		Callbacks{},
+	)
+
+	got := Visualize(fsmUnderTest)
+	wanted := `
+digraph fsm {
+    "editing" -> "saved" [ label = "save" ];
+    "editing" -> "editing" [ label = "update" ];
+
+    "editing" [color = "red"];
+    "saved";
+}`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build graphivz graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestGraphvizOutputWithDescriptions(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Description: "Opens the door"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "part-close", Src: []string{"intermediate"}, Dst: "closed"},
+		},
+		Callbacks{},
+		WithStateDescriptions(map[string]string{
+			"closed": "The door is closed",
+			"open":   `The door is "open"`,
+		}),
+		WithEventDescriptions(map[string]string{
+			"open":  "Ignored for transitions with a description",
+			"close": "Closes the door",
+		}),
+	)
+
+	got := Visualize(fsmUnderTest)
+	wanted := `
+digraph fsm {
+    "closed" -> "open" [ label = "open", tooltip = "Opens the door" ];
+    "intermediate" -> "closed" [ label = "part-close" ];
+    "open" -> "closed" [ label = "close", tooltip = "Closes the door" ];
+
+    "closed" [color = "red", tooltip = "The door is closed"];
+    "intermediate";
+    "open" [tooltip = "The door is \"open\""];
+}`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build graphivz graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+	if fsmUnderTest.StateDescription("open") != `The door is "open"` || fsmUnderTest.EventDescription("close") != "Closes the door" {
+		t.Error("expected descriptions to be returned")
+	}
+	if fsmUnderTest.StateDescription("intermediate") != "" {
+		t.Error("expected no description for undescribed state")
+	}
+}
+
+func TestGraphvizOutputWithSubmachine(t *testing.T) {
+	child := NewFSM(
+		"editing",
+		Events{
+			{Name: "save", Src: []string{"editing"}, Dst: "saved"},
+		},
+		Callbacks{},
+	)
+	fsmUnderTest := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+		WithSubmachine("open", child, ResetSubmachine),
+	)
+
+	got := Visualize(fsmUnderTest)
+	wanted := `
+digraph fsm {
+    "closed" -> "open" [ label = "open" ];
+    "open" -> "closed" [ label = "close" ];
+
+    "closed" [color = "red"];
+    "open";
+    subgraph "cluster_open" {
+        label = "open";
+        "open/editing" -> "open/saved" [ label = "save" ];
+        "open/editing" [label = "editing"];
+        "open/saved" [label = "saved"];
+    }
+    "open" -> "open/editing" [ style = "dashed" ];
+}`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build graphivz graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestGraphvizOutputWithOptions(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+
+	got := VisualizeWithOptions(fsmUnderTest, VisualizeOptions{
+		RankDir:        "LR",
+		NodeShape:      "box",
+		Shapes:         map[string]string{"open": "doublecircle"},
+		FillColors:     map[string]string{"closed": "#EEEEEE"},
+		HighlightColor: "blue",
+		FontName:       "Helvetica",
+	})
+	wanted := `
+digraph fsm {
+    rankdir = "LR";
+    node [shape = "box", fontname = "Helvetica"];
+    edge [fontname = "Helvetica"];
+    "closed" -> "open" [ label = "open" ];
+    "open" -> "closed" [ label = "close" ];
+
+    "closed" [color = "blue", style = "filled", fillcolor = "#EEEEEE"];
+    "open" [shape = "doublecircle"];
+}`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build graphivz graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
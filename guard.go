@@ -0,0 +1,137 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// GuardFunc is a condition that is evaluated before a transition takes place.
+// The transition is only allowed if it returns true. GuardContext describes
+// the pending transition.
+type GuardFunc func(context.Context, GuardContext) bool
+
+// ValidatorFunc checks the arguments of an event before a transition takes
+// place. The event is rejected if it returns an error. GuardContext describes
+// the pending transition.
+type ValidatorFunc func(context.Context, GuardContext) error
+
+// GuardContext is the info that gets passed to guards. It gives access to the
+// pending transition, the event arguments and the metadata of the FSM.
+type GuardContext struct {
+	// Event is the event name.
+	Event string
+
+	// Src is the current state.
+	Src string
+
+	// Dst is the candidate destination state of the transition.
+	Dst string
+
+	// Args is the list of arguments passed to the event.
+	Args []interface{}
+
+	// fsm is used to read the metadata.
+	fsm *FSM
+}
+
+// Arg returns the event argument at index i, if present.
+func (g GuardContext) Arg(i int) (interface{}, bool) {
+	if i < 0 || i >= len(g.Args) {
+		return nil, false
+	}
+	return g.Args[i], true
+}
+
+// StringArg returns the event argument at index i if it is a string.
+func (g GuardContext) StringArg(i int) (string, bool) {
+	arg, _ := g.Arg(i)
+	v, ok := arg.(string)
+	return v, ok
+}
+
+// IntArg returns the event argument at index i if it is an int.
+func (g GuardContext) IntArg(i int) (int, bool) {
+	arg, _ := g.Arg(i)
+	v, ok := arg.(int)
+	return v, ok
+}
+
+// BoolArg returns the event argument at index i if it is a bool.
+func (g GuardContext) BoolArg(i int) (bool, bool) {
+	arg, _ := g.Arg(i)
+	v, ok := arg.(bool)
+	return v, ok
+}
+
+// Metadata returns the value stored in the metadata of the FSM.
+func (g GuardContext) Metadata(key string) (interface{}, bool) {
+	if g.fsm == nil {
+		return nil, false
+	}
+	return g.fsm.Metadata(key)
+}
+
+// Deps returns the dependency container of the FSM, see WithDeps.
+func (g GuardContext) Deps() interface{} {
+	if g.fsm == nil {
+		return nil
+	}
+	return g.fsm.Deps()
+}
+
+// guardAllows evaluates the guard and unless conditions of rule for event in
+// state src, if any. It returns a GuardMutationError if a guard wrote the
+// metadata with WithPureGuards. Callers must hold stateMu.
+func (f *FSM) guardAllows(ctx context.Context, event, src string, rule *transitionRule, args []interface{}) (bool, error) {
+	if rule.unconditional() {
+		return true, nil
+	}
+	g := GuardContext{Event: event, Src: src, Dst: f.targetOf(rule, src), Args: args, fsm: f}
+	version := f.guardVersion()
+	allowed := f.evalGuards(ctx, g, rule)
+	if err := f.checkPure(event, src, version); err != nil {
+		return false, err
+	}
+	return allowed, nil
+}
+
+// evalGuards returns whether the guard of rule passes and none of its unless
+// conditions do.
+func (f *FSM) evalGuards(ctx context.Context, g GuardContext, rule *transitionRule) bool {
+	if rule.guard != nil && !rule.guard(ctx, g) {
+		return false
+	}
+	for _, unless := range rule.unless {
+		if unless != nil && unless(ctx, g) {
+			return false
+		}
+	}
+	return true
+}
+
+// validate calls the validator of rule, wrapping its error in a
+// ValidationError.
+func (f *FSM) validate(ctx context.Context, event, src, dst string, rule *transitionRule, args []interface{}) error {
+	version := f.guardVersion()
+	err := rule.validator(ctx, GuardContext{event, src, dst, args, f})
+	if err := f.checkPure(event, src, version); err != nil {
+		return err
+	}
+	if err != nil {
+		return ValidationError{event, err}
+	}
+	return nil
+}
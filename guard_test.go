@@ -0,0 +1,274 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGuardAllowsTransition(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end", Guard: func(_ context.Context, g GuardContext) bool {
+				v, ok := g.StringArg(0)
+				return ok && v == "go"
+			}},
+		},
+		Callbacks{},
+	)
+
+	err := fsm.Event(context.Background(), "run")
+	if e, ok := err.(GuardFailedError); !ok || e.Event != "run" || e.State != "start" {
+		t.Errorf("expected 'GuardFailedError' with correct state and event, got %v", err)
+	}
+	if fsm.Current() != "start" {
+		t.Error("expected state to be 'start'")
+	}
+
+	err = fsm.Event(context.Background(), "run", "go")
+	if err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "end" {
+		t.Error("expected state to be 'end'")
+	}
+}
+
+func TestGuardRunsBeforeCallbacks(t *testing.T) {
+	beforeEvent := false
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end", Guard: func(_ context.Context, g GuardContext) bool {
+				return false
+			}},
+		},
+		Callbacks{
+			"before_event": func(_ context.Context, e *Event) {
+				beforeEvent = true
+			},
+		},
+	)
+	_ = fsm.Event(context.Background(), "run")
+	if beforeEvent {
+		t.Error("expected before_event not to be called when the guard fails")
+	}
+}
+
+func TestGuardPerSource(t *testing.T) {
+	allowed := false
+	fsm := NewFSM(
+		"one",
+		Events{
+			{Name: "next", Src: []string{"one"}, Dst: "two"},
+			{Name: "next", Src: []string{"two"}, Dst: "three", Guard: func(_ context.Context, g GuardContext) bool {
+				return allowed
+			}},
+		},
+		Callbacks{},
+	)
+	if err := fsm.Event(context.Background(), "next"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if _, ok := fsm.Event(context.Background(), "next").(GuardFailedError); !ok {
+		t.Error("expected 'GuardFailedError'")
+	}
+	allowed = true
+	if err := fsm.Event(context.Background(), "next"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "three" {
+		t.Error("expected state to be 'three'")
+	}
+}
+
+func TestGuardCanAndAvailableTransitions(t *testing.T) {
+	locked := true
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Guard: func(_ context.Context, g GuardContext) bool {
+				return !locked
+			}},
+			{Name: "kick", Src: []string{"closed"}, Dst: "broken"},
+		},
+		Callbacks{},
+	)
+
+	if fsm.Can("open") {
+		t.Error("expected 'open' to be blocked by the guard")
+	}
+	if transitions := fsm.AvailableTransitions(); !reflect.DeepEqual(transitions, []string{"kick"}) {
+		t.Errorf("expected [kick], got %v", transitions)
+	}
+
+	locked = false
+	if !fsm.Can("open") {
+		t.Error("expected 'open' to be allowed by the guard")
+	}
+	if transitions := fsm.AvailableTransitions(); !reflect.DeepEqual(transitions, []string{"kick", "open"}) {
+		t.Errorf("expected [kick open], got %v", transitions)
+	}
+}
+
+func TestUnless(t *testing.T) {
+	paymentPending := true
+	fsm := NewFSM(
+		"ordered",
+		Events{
+			{Name: "ship", Src: []string{"ordered"}, Dst: "shipped", Unless: []GuardFunc{
+				func(_ context.Context, g GuardContext) bool {
+					return paymentPending
+				},
+			}},
+		},
+		Callbacks{},
+	)
+
+	if fsm.Can("ship") {
+		t.Error("expected 'ship' to be blocked while the payment is pending")
+	}
+	err := fsm.Event(context.Background(), "ship")
+	if _, ok := err.(GuardFailedError); !ok {
+		t.Errorf("expected 'GuardFailedError', got %v", err)
+	}
+
+	paymentPending = false
+	if err := fsm.Event(context.Background(), "ship"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if fsm.Current() != "shipped" {
+		t.Error("expected state to be 'shipped'")
+	}
+}
+
+func TestUnlessWithGuard(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"start",
+		Events{
+			{
+				Name: "run", Src: []string{"start"}, Dst: "end",
+				Guard: func(_ context.Context, g GuardContext) bool {
+					calls = append(calls, "guard")
+					return true
+				},
+				Unless: []GuardFunc{
+					func(_ context.Context, g GuardContext) bool {
+						calls = append(calls, "unless 1")
+						return false
+					},
+					func(_ context.Context, g GuardContext) bool {
+						calls = append(calls, "unless 2")
+						return len(g.Args) > 0
+					},
+				},
+			},
+		},
+		Callbacks{},
+	)
+
+	if _, ok := fsm.Event(context.Background(), "run", "blocked").(GuardFailedError); !ok {
+		t.Error("expected 'GuardFailedError'")
+	}
+	if !reflect.DeepEqual(calls, []string{"guard", "unless 1", "unless 2"}) {
+		t.Errorf("expected guard before unless conditions, got %v", calls)
+	}
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+}
+
+func TestGuardContext(t *testing.T) {
+	var got GuardContext
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "checkout", Src: []string{"cart"}, Dst: "paid", Guard: func(_ context.Context, g GuardContext) bool {
+				got = g
+				total, _ := g.IntArg(0)
+				limit, _ := g.Metadata("limit")
+				return total <= limit.(int)
+			}},
+		},
+		Callbacks{},
+	)
+	fsm.SetMetadata("limit", 100)
+
+	if _, ok := fsm.Event(context.Background(), "checkout", 200, "card", true).(GuardFailedError); !ok {
+		t.Error("expected 'GuardFailedError'")
+	}
+	if got.Event != "checkout" || got.Src != "cart" || got.Dst != "paid" {
+		t.Errorf("unexpected guard context %+v", got)
+	}
+	if v, ok := got.StringArg(1); !ok || v != "card" {
+		t.Errorf("expected string argument 'card', got %v", v)
+	}
+	if v, ok := got.BoolArg(2); !ok || !v {
+		t.Errorf("expected bool argument true, got %v", v)
+	}
+	if _, ok := got.IntArg(1); ok {
+		t.Error("expected string argument not to be returned as int")
+	}
+	if _, ok := got.Arg(3); ok {
+		t.Error("expected missing argument not to be returned")
+	}
+
+	if err := fsm.Event(context.Background(), "checkout", 50); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	invalid := errors.New("amount must be positive")
+	called := false
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "pay", Src: []string{"cart"}, Dst: "paid", Validator: func(_ context.Context, g GuardContext) error {
+				if amount, ok := g.IntArg(0); !ok || amount <= 0 {
+					return invalid
+				}
+				return nil
+			}},
+		},
+		Callbacks{
+			"before_event": func(context.Context, *Event) {
+				called = true
+			},
+		},
+	)
+
+	err := fsm.Event(context.Background(), "pay", -5)
+	if verr, ok := err.(ValidationError); !ok || verr.Event != "pay" || verr.Err != invalid {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if called {
+		t.Error("expected callbacks not to be called for invalid arguments")
+	}
+	if fsm.Current() != "cart" {
+		t.Errorf("expected state to be 'cart', got %s", fsm.Current())
+	}
+	if err := fsm.Event(context.Background(), "pay", 5); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+	if !called || fsm.Current() != "paid" {
+		t.Error("expected transition with valid arguments")
+	}
+}
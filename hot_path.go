@@ -0,0 +1,53 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"sync/atomic"
+)
+
+// The hooks are flags of FSM.hooks that tell the hot path of Event which
+// instrumentation is registered, so that it skips the rest with a single load.
+// They are never cleared.
+const (
+	// hookTraced is set if anything that sees an Event is registered:
+	// callbacks, extensions, or the choices and effects of transitions. The
+	// events of deterministic FSMs are always traced.
+	hookTraced int32 = 1 << iota
+
+	// hookObservers is set by AddObserver.
+	hookObservers
+
+	// hookMiddleware is set by Use.
+	hookMiddleware
+
+	// hookUnavailable is set by Pause and WithUnavailableStrategies.
+	hookUnavailable
+)
+
+// setHook sets the flag hook in the hooks of the FSM.
+func (f *FSM) setHook(hook int32) {
+	for {
+		hooks := atomic.LoadInt32(&f.hooks)
+		if hooks&hook != 0 || atomic.CompareAndSwapInt32(&f.hooks, hooks, hooks|hook) {
+			return
+		}
+	}
+}
+
+// hooked returns true if any of the flags in hook is set.
+func (f *FSM) hooked(hook int32) bool {
+	return atomic.LoadInt32(&f.hooks)&hook != 0
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// MetadataView gives read access to the metadata of a FSM.
+type MetadataView interface {
+	Metadata(key string) (interface{}, bool)
+}
+
+// Invariant checks a condition that must hold in every state of a FSM, and
+// returns an error describing the violation if it does not.
+type Invariant func(state string, meta MetadataView) error
+
+// namedInvariant is an Invariant set with WithInvariant.
+type namedInvariant struct {
+	name  string
+	check Invariant
+}
+
+// InvariantAction is what happens when an invariant is violated.
+type InvariantAction int
+
+const (
+	// FailOnViolation makes Event return an InvariantViolationError.
+	FailOnViolation InvariantAction = iota
+	// AlertOnViolation notifies the InvariantObservers, while Event returns
+	// no error.
+	AlertOnViolation
+	// RecoverOnViolation notifies the InvariantObservers and moves the FSM to
+	// the error state set with WithInvariantAction, without calling the
+	// callbacks. Event returns no error.
+	RecoverOnViolation
+)
+
+// InvariantObserver is an Observer that is also notified of the violations of
+// invariants.
+type InvariantObserver interface {
+	Observer
+
+	// OnInvariantViolation is called with the context passed to Event when
+	// an invariant does not hold after a transition.
+	OnInvariantViolation(ctx context.Context, err InvariantViolationError)
+}
+
+// WithInvariant adds an invariant that is checked after every transition, to
+// catch the corruption of the state or metadata by a callback right away.
+// Invariants are checked in the order they were added, until one is violated.
+// Asynchronous transitions are not checked.
+func WithInvariant(name string, check Invariant) Option {
+	return func(f *FSM) {
+		f.invariants = append(f.invariants, namedInvariant{name, check})
+	}
+}
+
+// WithInvariantAction sets what happens when an invariant is violated. The
+// default is FailOnViolation. errorState is the state the FSM is moved to with
+// RecoverOnViolation.
+func WithInvariantAction(action InvariantAction, errorState string) Option {
+	return func(f *FSM) {
+		f.invariantAction = action
+		f.invariantState = errorState
+	}
+}
+
+// checkInvariants checks the invariants after the transition of e, and
+// returns the error to return from Event.
+func (f *FSM) checkInvariants(ctx context.Context, e *Event) error {
+	state := f.liveState()
+	for _, invariant := range f.invariants {
+		err := invariant.check(state, f)
+		if err == nil {
+			continue
+		}
+		violation := InvariantViolationError{invariant.name, state, err}
+		if f.invariantAction == FailOnViolation {
+			return violation
+		}
+		for _, o := range f.observersFor() {
+			if io, ok := o.(InvariantObserver); ok {
+				io.OnInvariantViolation(ctx, violation)
+			}
+		}
+		if f.invariantAction == RecoverOnViolation {
+			f.moveTo(f.invariantState)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type invariantRecorder struct {
+	violations []InvariantViolationError
+}
+
+func (r *invariantRecorder) OnTransition(context.Context, TransitionInfo) {}
+
+func (r *invariantRecorder) OnInvariantViolation(_ context.Context, err InvariantViolationError) {
+	r.violations = append(r.violations, err)
+}
+
+var errNegativeBalance = errors.New("negative balance")
+
+func TestInvariantFail(t *testing.T) {
+	fsm := NewFSM(
+		"open",
+		Events{
+			{Name: "deposit", Src: []string{"open"}, Dst: "open", Kind: KindInternal},
+			{Name: "withdraw", Src: []string{"open"}, Dst: "open", Kind: KindInternal},
+		},
+		Callbacks{
+			"deposit": func(_ context.Context, e *Event) {
+				e.FSM.SetMetadata("balance", 10)
+			},
+			"withdraw": func(_ context.Context, e *Event) {
+				// A buggy callback that overdraws the account.
+				e.FSM.SetMetadata("balance", -5)
+			},
+		},
+		WithInvariant("balance", func(state string, meta MetadataView) error {
+			if balance, ok := meta.Metadata("balance"); ok && balance.(int) < 0 {
+				return errNegativeBalance
+			}
+			return nil
+		}),
+	)
+	fsm.SetMetadata("balance", 0)
+	ctx := context.Background()
+	if err := fsm.Event(ctx, "deposit"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err := fsm.Event(ctx, "withdraw")
+	var violation InvariantViolationError
+	if !errors.As(err, &violation) || violation.Invariant != "balance" || violation.State != "open" {
+		t.Errorf("expected 'InvariantViolationError', got %v", err)
+	}
+	if !errors.Is(err, errNegativeBalance) {
+		t.Error("expected error of the invariant to be wrapped")
+	}
+}
+
+func TestInvariantAlert(t *testing.T) {
+	recorder := &invariantRecorder{}
+	fsm := NewFSM(
+		"open",
+		Events{
+			{Name: "deposit", Src: []string{"open"}, Dst: "open", Kind: KindInternal},
+			{Name: "withdraw", Src: []string{"open"}, Dst: "open", Kind: KindInternal},
+		},
+		Callbacks{
+			"deposit": func(_ context.Context, e *Event) {
+				e.FSM.SetMetadata("balance", 10)
+			},
+			"withdraw": func(_ context.Context, e *Event) {
+				// A buggy callback that overdraws the account.
+				e.FSM.SetMetadata("balance", -5)
+			},
+		},
+		WithInvariantAction(AlertOnViolation, ""),
+		WithInvariant("balance", func(state string, meta MetadataView) error {
+			if balance, ok := meta.Metadata("balance"); ok && balance.(int) < 0 {
+				return errNegativeBalance
+			}
+			return nil
+		}),
+	)
+	fsm.SetMetadata("balance", 0)
+	fsm.AddObserver(recorder)
+	if err := fsm.Event(context.Background(), "withdraw"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(recorder.violations) != 1 || recorder.violations[0].Err != errNegativeBalance {
+		t.Errorf("expected observer to be alerted, got %v", recorder.violations)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be unchanged, got %s", fsm.Current())
+	}
+}
+
+func TestInvariantRecover(t *testing.T) {
+	recorder := &invariantRecorder{}
+	fsm := NewFSM(
+		"open",
+		Events{
+			{Name: "deposit", Src: []string{"open"}, Dst: "open", Kind: KindInternal},
+			{Name: "withdraw", Src: []string{"open"}, Dst: "open", Kind: KindInternal},
+		},
+		Callbacks{
+			"deposit": func(_ context.Context, e *Event) {
+				e.FSM.SetMetadata("balance", 10)
+			},
+			"withdraw": func(_ context.Context, e *Event) {
+				// A buggy callback that overdraws the account.
+				e.FSM.SetMetadata("balance", -5)
+			},
+		},
+		WithInvariantAction(RecoverOnViolation, "frozen"),
+		WithInvariant("balance", func(state string, meta MetadataView) error {
+			if balance, ok := meta.Metadata("balance"); ok && balance.(int) < 0 {
+				return errNegativeBalance
+			}
+			return nil
+		}),
+	)
+	fsm.SetMetadata("balance", 0)
+	fsm.AddObserver(recorder)
+	if err := fsm.Event(context.Background(), "withdraw"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "frozen" {
+		t.Errorf("expected FSM to be moved to the error state, got %s", fsm.Current())
+	}
+	if len(recorder.violations) != 1 {
+		t.Errorf("expected observer to be alerted, got %v", recorder.violations)
+	}
+}
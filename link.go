@@ -0,0 +1,48 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// Link chains f to parent: when f completes in one of its final states, see
+// WithFinalStates, event is sent to parent with the final state as argument.
+// This builds pipelines of machines without glue callbacks.
+//
+// The event is sent with Event, with the context of the event that completed
+// f, once the observers of f added before Link have been notified. The error
+// of parent is not returned to the caller of f; use the observers or the dead
+// letters of parent to handle it.
+func (f *FSM) Link(parent *FSM, event string) {
+	if !f.initialized() {
+		return
+	}
+	f.AddObserver(link{f, parent, event})
+}
+
+// link is the Observer added by Link.
+type link struct {
+	child  *FSM
+	parent *FSM
+	event  string
+}
+
+func (l link) OnTransition(ctx context.Context, info TransitionInfo) {
+	if info.Event != DoneEvent || info.Err != nil || info.Src != info.Dst || !l.child.finalStates[info.Dst] {
+		return
+	}
+	_ = l.parent.Event(ctx, l.event, info.Dst)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	var args []interface{}
+	pipeline := NewFSM(
+		"fetching",
+		Events{
+			{Name: "fetched", Src: []string{"fetching"}, Dst: "parsing"},
+			{Name: "parsed", Src: []string{"parsing"}, Dst: "finished"},
+		},
+		Callbacks{
+			"enter_parsing": func(_ context.Context, e *Event) {
+				args = e.Args
+			},
+		},
+	)
+	fetch := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "downloading"},
+			{Name: "succeed", Src: []string{"downloading"}, Dst: "downloaded"},
+			{Name: "fail", Src: []string{"downloading"}, Dst: "failed"},
+		},
+		Callbacks{},
+		WithFinalStates("downloaded", "failed"),
+	)
+	parse := NewFSM(
+		"idle",
+		Events{
+			{Name: "parse", Src: []string{"idle"}, Dst: "parsed"},
+		},
+		Callbacks{},
+		WithFinalStates("parsed"),
+	)
+	fetch.Link(pipeline, "fetched")
+	parse.Link(pipeline, "parsed")
+
+	if err := fetch.Event(context.Background(), "start"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if pipeline.Current() != "fetching" {
+		t.Errorf("expected state to be 'fetching', got %s", pipeline.Current())
+	}
+	if err := fetch.Event(context.Background(), "succeed"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if pipeline.Current() != "parsing" {
+		t.Errorf("expected state to be 'parsing', got %s", pipeline.Current())
+	}
+	if !reflect.DeepEqual(args, []interface{}{"downloaded"}) {
+		t.Errorf("expected final state as argument, got %v", args)
+	}
+
+	if err := parse.Event(context.Background(), "parse"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if pipeline.Current() != "finished" {
+		t.Errorf("expected state to be 'finished', got %s", pipeline.Current())
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// LoopAlertFunc is called when a state is about to be entered more times than
+// the threshold configured with WithLoopDetection. Count is the number of times
+// the state will have been entered when the transition completes.
+type LoopAlertFunc func(ctx context.Context, state string, count int)
+
+// WithLoopDetection detects pathological loops, like bouncing between a
+// retrying and a failed state forever, by limiting how many times each state
+// may be entered.
+//
+// When a transition would enter a state more than threshold times the event
+// fails with a LoopDetectedError and the state is left unchanged. If alert is
+// not nil it is called instead and the transition is allowed to continue.
+func WithLoopDetection(threshold int, alert LoopAlertFunc) Option {
+	return func(f *FSM) {
+		f.loopThreshold = threshold
+		f.loopAlert = alert
+	}
+}
+
+// EntryCount returns how many times state has been entered by a transition.
+func (f *FSM) EntryCount(state string) int {
+	if !f.initialized() {
+		return 0
+	}
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	return f.entries[state]
+}
+
+// ResetEntryCounts resets the entry counters of all states, for example after
+// the cause of a detected loop has been resolved.
+func (f *FSM) ResetEntryCounts() {
+	if !f.initialized() {
+		return
+	}
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	f.entries = make(map[string]int)
+}
+
+// checkLoop checks if the transition of e would exceed the loop threshold.
+// Callers must not hold stateMu.
+func (f *FSM) checkLoop(ctx context.Context, e *Event) error {
+	if f.loopThreshold <= 0 {
+		return nil
+	}
+	f.stateMu.RLock()
+	count := f.entries[e.Dst] + 1
+	f.stateMu.RUnlock()
+	if count <= f.loopThreshold {
+		return nil
+	}
+	if f.loopAlert != nil {
+		f.loopAlert(ctx, e.Dst, count)
+		return nil
+	}
+	return LoopDetectedError{e.Event, e.Dst, count}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEntryCount(t *testing.T) {
+	fsm := NewFSM(
+		"failed",
+		Events{
+			{Name: "retry", Src: []string{"failed"}, Dst: "retrying"},
+			{Name: "fail", Src: []string{"retrying"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	for i := 0; i < 3; i++ {
+		if err := fsm.Event(context.Background(), "retry"); err != nil {
+			t.Errorf("transition failed %v", err)
+		}
+		if err := fsm.Event(context.Background(), "fail"); err != nil {
+			t.Errorf("transition failed %v", err)
+		}
+	}
+	if n := fsm.EntryCount("retrying"); n != 3 {
+		t.Errorf("expected 'retrying' to be entered 3 times, got %d", n)
+	}
+	if n := fsm.EntryCount("failed"); n != 3 {
+		t.Errorf("expected 'failed' to be entered 3 times, got %d", n)
+	}
+	fsm.ResetEntryCounts()
+	if n := fsm.EntryCount("retrying"); n != 0 {
+		t.Errorf("expected 'retrying' count to be reset, got %d", n)
+	}
+}
+
+func TestLoopDetectionError(t *testing.T) {
+	fsm := NewFSM(
+		"failed",
+		Events{
+			{Name: "retry", Src: []string{"failed"}, Dst: "retrying"},
+			{Name: "fail", Src: []string{"retrying"}, Dst: "failed"},
+		},
+		Callbacks{},
+		WithLoopDetection(2, nil),
+	)
+	for i := 0; i < 2; i++ {
+		_ = fsm.Event(context.Background(), "retry")
+		_ = fsm.Event(context.Background(), "fail")
+	}
+	err := fsm.Event(context.Background(), "retry")
+	if e, ok := err.(LoopDetectedError); !ok || e.State != "retrying" || e.Count != 3 {
+		t.Errorf("expected 'LoopDetectedError' for 'retrying', got %v", err)
+	}
+	if fsm.Current() != "failed" {
+		t.Errorf("expected state to be 'failed', was '%s'", fsm.Current())
+	}
+}
+
+func TestLoopDetectionAlert(t *testing.T) {
+	var alerts []int
+	fsm := NewFSM(
+		"failed",
+		Events{
+			{Name: "retry", Src: []string{"failed"}, Dst: "retrying"},
+			{Name: "fail", Src: []string{"retrying"}, Dst: "failed"},
+		},
+		Callbacks{},
+		WithLoopDetection(1, func(_ context.Context, state string, count int) {
+			if state == "retrying" {
+				alerts = append(alerts, count)
+			}
+		}),
+	)
+	for i := 0; i < 3; i++ {
+		if err := fsm.Event(context.Background(), "retry"); err != nil {
+			t.Errorf("transition failed %v", err)
+		}
+		if err := fsm.Event(context.Background(), "fail"); err != nil {
+			t.Errorf("transition failed %v", err)
+		}
+	}
+	if len(alerts) != 2 || alerts[0] != 2 || alerts[1] != 3 {
+		t.Errorf("expected alerts for count 2 and 3, got %v", alerts)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// mailboxMessage is an event sent with Send.
+type mailboxMessage struct {
+	ctx    context.Context
+	event  string
+	args   []interface{}
+	result chan error
+}
+
+// WithMailbox sets the number of events that can be queued by Send before it
+// blocks. By default Send blocks until the event is picked up.
+func WithMailbox(size int) Option {
+	return func(f *FSM) {
+		f.mailboxSize = size
+	}
+}
+
+// Send queues an event to be processed by a goroutine owned by the FSM, and
+// returns a channel that receives the error returned by Event once the event
+// has been processed. The events sent with Send are processed strictly one
+// after the other in the order they were queued.
+//
+// The goroutine is started by the first call to Send or Run and stopped by
+// Close or Stop. Events that are still queued when the FSM is closed fail with
+// a ClosedError. If ctx is done before the event is processed it fails with the
+// error of ctx.
+//
+// Callbacks should use Event instead of Send to trigger new events, as Send
+// blocks while the mailbox is full and callbacks are called by the goroutine
+// that empties it.
+func (f *FSM) Send(ctx context.Context, event string, args ...interface{}) <-chan error {
+	result := make(chan error, 1)
+	if !f.initialized() {
+		result <- NotInitializedError{}
+		return result
+	}
+	f.startMailbox()
+
+	select {
+	case <-f.closed:
+		result <- ClosedError{}
+		return result
+	case <-f.stopping:
+		result <- StoppedError{}
+		return result
+	default:
+	}
+	if f.deterministic {
+		f.sendDeterministic(mailboxMessage{ctx, event, args, result})
+		return result
+	}
+	select {
+	case f.mailbox <- mailboxMessage{ctx, event, args, result}:
+		select {
+		case <-f.closed:
+			// The mailbox may already have been emptied for the last time.
+			f.drainMailbox(ClosedError{})
+		case <-f.stopping:
+			// The message may have been queued after the mailbox was
+			// emptied for the last time, which is done before exiting.
+			<-f.mailboxDone
+			f.drainMailbox(StoppedError{})
+		default:
+		}
+	case <-ctx.Done():
+		result <- ctx.Err()
+	case <-f.closed:
+		result <- ClosedError{}
+	case <-f.stopping:
+		result <- StoppedError{}
+	}
+	return result
+}
+
+// startMailbox starts the goroutine processing the mailbox once.
+func (f *FSM) startMailbox() {
+	f.mailboxOnce.Do(func() {
+		f.mailbox = make(chan mailboxMessage, f.mailboxSize)
+		f.mailboxDone = make(chan struct{})
+		if f.deterministic {
+			close(f.mailboxDone)
+			return
+		}
+		go f.processMailbox()
+	})
+}
+
+// processMailbox processes the events sent with Send until the FSM is closed
+// or stopped.
+func (f *FSM) processMailbox() {
+	defer close(f.mailboxDone)
+	for {
+		select {
+		case msg := <-f.mailbox:
+			select {
+			case <-f.stopping:
+				f.finishMessage(msg)
+				f.finishMailbox()
+				return
+			default:
+			}
+			f.processMessage(msg)
+		case <-f.closed:
+			f.drainMailbox(ClosedError{})
+			return
+		case <-f.stopping:
+			f.finishMailbox()
+			return
+		}
+	}
+}
+
+// processMessage processes a single event sent with Send.
+func (f *FSM) processMessage(msg mailboxMessage) {
+	select {
+	case <-f.closed:
+		msg.result <- ClosedError{}
+		return
+	default:
+	}
+	if err := msg.ctx.Err(); err != nil {
+		msg.result <- err
+		return
+	}
+	msg.result <- f.Event(msg.ctx, msg.event, msg.args...)
+}
+
+// finishMailbox processes the events that are queued in the mailbox when the
+// FSM is stopped, until the context passed to Stop is done.
+func (f *FSM) finishMailbox() {
+	for {
+		select {
+		case msg := <-f.mailbox:
+			f.finishMessage(msg)
+		default:
+			return
+		}
+	}
+}
+
+// finishMessage processes a single event sent with Send after the FSM has
+// been stopped, unless the context passed to Stop is done.
+func (f *FSM) finishMessage(msg mailboxMessage) {
+	if f.stopCtx.Err() != nil {
+		msg.result <- StoppedError{}
+		return
+	}
+	f.processMessage(msg)
+}
+
+// drainMailbox fails the events that are queued in the mailbox with err.
+func (f *FSM) drainMailbox(err error) {
+	for {
+		select {
+		case msg := <-f.mailbox:
+			msg.result <- err
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	var order []interface{}
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"step": func(_ context.Context, e *Event) {
+				order = append(order, e.Args[0])
+			},
+		},
+		WithMailbox(10),
+	)
+	defer fsm.Close()
+
+	var results []<-chan error
+	for i := 0; i < 10; i++ {
+		results = append(results, fsm.Send(context.Background(), "step", i))
+	}
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}
+	expected := []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected events in order %v, got %v", expected, order)
+	}
+
+	if _, ok := (<-fsm.Send(context.Background(), "jump")).(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError'")
+	}
+}
+
+func TestSendConcurrently(t *testing.T) {
+	count := 0
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"step": func(context.Context, *Event) {
+				count++
+			},
+		},
+	)
+	defer fsm.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := <-fsm.Send(context.Background(), "step"); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 50 {
+		t.Errorf("expected 50 events, got %d", count)
+	}
+}
+
+func TestSendCanceled(t *testing.T) {
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{},
+	)
+	defer fsm.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := <-fsm.Send(ctx, "step"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSendClosed(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	block := make(chan struct{})
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"step": func(context.Context, *Event) {
+				entered <- struct{}{}
+				<-block
+			},
+		},
+		WithMailbox(5),
+	)
+
+	first := fsm.Send(context.Background(), "step")
+	<-entered
+	var queued []<-chan error
+	for i := 0; i < 5; i++ {
+		queued = append(queued, fsm.Send(context.Background(), "step"))
+	}
+	fsm.Close()
+	close(block)
+
+	if err := <-first; err != nil {
+		t.Errorf("expected first event to be processed, got %v", err)
+	}
+	for _, result := range queued {
+		if _, ok := (<-result).(ClosedError); !ok {
+			t.Error("expected 'ClosedError' for queued event")
+		}
+	}
+	if _, ok := (<-fsm.Send(context.Background(), "step")).(ClosedError); !ok {
+		t.Error("expected 'ClosedError' after Close")
+	}
+}
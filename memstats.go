@@ -0,0 +1,143 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// MemStats is an estimate of the memory used by a FSM, in bytes. The estimate
+// counts the sizes of the stored values and strings but not the overhead of
+// the Go maps holding them, so it is a lower bound that is useful to compare
+// machines and spot regressions rather than an exact measurement.
+type MemStats struct {
+	// Definition is the memory used by the transitions.
+	Definition uintptr
+
+	// Callbacks is the memory used by the callback registrations.
+	Callbacks uintptr
+
+	// Metadata is the memory used by the metadata keys and values.
+	Metadata uintptr
+
+	// Data is the memory used by the struct bound with BindData.
+	Data uintptr
+
+	// History is the memory used by the state entry counts.
+	History uintptr
+}
+
+// Total returns the sum of all estimates.
+func (m MemStats) Total() uintptr {
+	return m.Definition + m.Callbacks + m.Metadata + m.Data + m.History
+}
+
+// MemStats returns an estimate of the memory used by the FSM.
+func (f *FSM) MemStats() MemStats {
+	if !f.initialized() {
+		return MemStats{}
+	}
+	var m MemStats
+
+	f.stateMu.RLock()
+	for key, rules := range f.transitions {
+		m.Definition += unsafe.Sizeof(key) + uintptr(len(key.event)+len(key.src))
+		m.Definition += uintptr(cap(rules)) * unsafe.Sizeof(rules[0])
+		for _, rule := range rules {
+			m.Definition += unsafe.Sizeof(*rule) + uintptr(len(rule.dst))
+			m.Definition += uintptr(cap(rule.unless)) * unsafe.Sizeof(GuardFunc(nil))
+			m.Definition += uintptr(cap(rule.effects)) * unsafe.Sizeof("")
+			for _, effect := range rule.effects {
+				m.Definition += uintptr(len(effect))
+			}
+		}
+	}
+	for state := range f.entries {
+		m.History += unsafe.Sizeof(state) + unsafe.Sizeof(0) + uintptr(len(state))
+	}
+	f.stateMu.RUnlock()
+
+	f.callbacksMu.RLock()
+	for key, entries := range f.callbacks {
+		m.Callbacks += unsafe.Sizeof(key) + uintptr(len(key.target))
+		m.Callbacks += uintptr(cap(entries)) * unsafe.Sizeof(callbackEntry{})
+	}
+	f.callbacksMu.RUnlock()
+
+	f.metadataMu.RLock()
+	for key, value := range f.metadata {
+		m.Metadata += unsafe.Sizeof(key) + uintptr(len(key))
+		m.Metadata += sizeOf(reflect.ValueOf(&value).Elem(), make(map[uintptr]bool))
+	}
+	if f.data != nil {
+		m.Data = sizeOf(reflect.ValueOf(f.data), make(map[uintptr]bool))
+	}
+	f.metadataMu.RUnlock()
+
+	return m
+}
+
+// sizeOf estimates the memory used by v and the values it references.
+func sizeOf(v reflect.Value, seen map[uintptr]bool) uintptr {
+	if !v.IsValid() {
+		return 0
+	}
+	return v.Type().Size() + referencedSize(v, seen)
+}
+
+// referencedSize estimates the memory referenced by v, excluding v itself.
+// Values behind pointers are only counted once, using seen.
+func referencedSize(v reflect.Value, seen map[uintptr]bool) uintptr {
+	var size uintptr
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			size += sizeOf(v.Elem(), seen)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() && !seen[v.Pointer()] {
+			seen[v.Pointer()] = true
+			size += sizeOf(v.Elem(), seen)
+		}
+	case reflect.String:
+		size += uintptr(v.Len())
+	case reflect.Slice:
+		if !v.IsNil() && !seen[v.Pointer()] {
+			seen[v.Pointer()] = true
+			size += uintptr(v.Cap()) * v.Type().Elem().Size()
+			for i := 0; i < v.Len(); i++ {
+				size += referencedSize(v.Index(i), seen)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			size += referencedSize(v.Field(i), seen)
+		}
+	case reflect.Map:
+		if !v.IsNil() && !seen[v.Pointer()] {
+			seen[v.Pointer()] = true
+			iter := v.MapRange()
+			for iter.Next() {
+				size += sizeOf(iter.Key(), seen) + sizeOf(iter.Value(), seen)
+			}
+		}
+	}
+	return size
+}
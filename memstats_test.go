@@ -0,0 +1,92 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestMemStats(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Effects: []string{"log"}},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(context.Context, *Event) {},
+		},
+		WithEffects(EffectRegistry{
+			"log": func(context.Context, *Event) error { return nil },
+		}),
+	)
+
+	before := fsm.MemStats()
+	if before.Definition == 0 {
+		t.Error("expected definition to use memory")
+	}
+	if before.Callbacks == 0 {
+		t.Error("expected callbacks to use memory")
+	}
+	if before.Metadata != 0 || before.Data != 0 || before.History != 0 {
+		t.Errorf("expected no metadata, data or history, got %+v", before)
+	}
+
+	fsm.SetMetadata("key", "0123456789")
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	type data struct {
+		Name string
+	}
+	if err := fsm.BindData(&data{Name: "0123456789"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	after := fsm.MemStats()
+	if after.Definition != before.Definition || after.Callbacks != before.Callbacks {
+		t.Errorf("expected definition and callbacks to be unchanged, got %+v", after)
+	}
+	// The key, the interface holding the value, the string header and the
+	// string bytes.
+	wanted := 2*unsafe.Sizeof("") + unsafe.Sizeof(interface{}(nil)) + 3 + 10
+	if after.Metadata != wanted {
+		t.Errorf("expected metadata to use %d bytes, got %d", wanted, after.Metadata)
+	}
+	if after.Data < unsafe.Sizeof(data{})+10 {
+		t.Errorf("expected data to use at least %d bytes, got %d", unsafe.Sizeof(data{})+10, after.Data)
+	}
+	if after.History == 0 {
+		t.Error("expected history to use memory")
+	}
+	if after.Total() != after.Definition+after.Callbacks+after.Metadata+after.Data+after.History {
+		t.Error("expected total to be the sum of all estimates")
+	}
+}
+
+func TestSizeOfCycle(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+	var i interface{} = n
+	if size := sizeOf(reflect.ValueOf(&i).Elem(), make(map[uintptr]bool)); size == 0 {
+		t.Error("expected cyclic value to have a size")
+	}
+}
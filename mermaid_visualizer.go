@@ -3,6 +3,7 @@ package fsm
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 const highlightingColor = "#00AA00"
@@ -23,40 +24,145 @@ func VisualizeForMermaidWithGraphType(fsm *FSM, graphType MermaidDiagramType) (s
 	case FlowChart:
 		return visualizeForMermaidAsFlowChart(fsm), nil
 	case StateDiagram:
-		return visualizeForMermaidAsStateDiagram(fsm), nil
+		return visualizeForMermaidAsStateDiagram(fsm, MermaidOptions{}), nil
 	default:
 		return "", fmt.Errorf("unknown MermaidDiagramType: %s", graphType)
 	}
 }
 
-func visualizeForMermaidAsStateDiagram(fsm *FSM) string {
+// MermaidOptions annotates the Mermaid state diagram of
+// VisualizeForMermaidWithOptions. The zero value gives the output of
+// VisualizeForMermaidWithGraphType with StateDiagram.
+type MermaidOptions struct {
+	// Guards adds the function names of the guard and unless conditions of
+	// the transitions to their labels, like "pay [hasFunds, !isBlocked]".
+	Guards bool
+
+	// Callbacks adds the callbacks registered for the events to the labels of
+	// their transitions, like "pay / before_pay", and those registered for
+	// the states to notes.
+	Callbacks bool
+}
+
+// VisualizeForMermaidWithOptions outputs a visualization of a FSM as a Mermaid
+// state diagram, annotated as set by opts.
+func VisualizeForMermaidWithOptions(fsm *FSM, opts MermaidOptions) string {
+	return visualizeForMermaidAsStateDiagram(fsm, opts)
+}
+
+func visualizeForMermaidAsStateDiagram(fsm *FSM, opts MermaidOptions) string {
+	fsm = visualized(fsm)
 	var buf bytes.Buffer
 
-	sortedTransitionKeys := getSortedTransitionKeys(fsm.transitions)
+	var callbacks map[string]bool
+	if opts.Callbacks {
+		callbacks = registeredCallbacks(fsm)
+	}
 
-	buf.WriteString("stateDiagram-v2\n")
-	buf.WriteString(fmt.Sprintln(`    [*] -->`, fsm.current))
+	fsm.stateMu.RLock()
+	defer fsm.stateMu.RUnlock()
 
-	for _, k := range sortedTransitionKeys {
-		v := fsm.transitions[k]
-		buf.WriteString(fmt.Sprintf(`    %s --> %s: %s`, k.src, v, k.event))
+	sortedEdges := getSortedTransitionEdges(fsm)
+
+	buf.WriteString("stateDiagram-v2\n")
+	buf.WriteString(fmt.Sprintln(`    [*] -->`, fsm.Current()))
+
+	for _, edge := range sortedEdges {
+		label := edge.event
+		if opts.Guards && edge.guards != "" {
+			label += " [" + edge.guards + "]"
+		}
+		if names := callbackNames(callbacks, "before_"+edge.event, "after_"+edge.event); names != "" {
+			label += " / " + names
+		}
+		buf.WriteString(fmt.Sprintf(`    %s --> %s: %s`, edge.src, edge.dst, label))
 		buf.WriteString("\n")
 	}
 
+	sortedStates, statesToIDMap := getSortedStates(sortedEdges)
+	writeStateDiagramComposites(&buf, fsm, statesToIDMap, "    ")
+	for _, state := range sortedStates {
+		description := fsm.stateDescriptions[state]
+		names := callbackNames(callbacks, "enter_"+state, "leave_"+state)
+		switch {
+		case names != "":
+			buf.WriteString(fmt.Sprintf("    note right of %s\n", state))
+			if description != "" {
+				buf.WriteString(fmt.Sprintf("        %s\n", description))
+			}
+			buf.WriteString(fmt.Sprintf("        %s\n", names))
+			buf.WriteString("    end note\n")
+		case description != "":
+			buf.WriteString(fmt.Sprintf(`    note right of %s: %s`, state, description))
+			buf.WriteString("\n")
+		}
+	}
+
 	return buf.String()
 }
 
+// registeredCallbacks returns the names of the callbacks registered on fsm,
+// like "enter_open".
+func registeredCallbacks(fsm *FSM) map[string]bool {
+	fsm.callbacksMu.RLock()
+	defer fsm.callbacksMu.RUnlock()
+	names := make(map[string]bool, len(fsm.callbacks))
+	for key, entries := range fsm.callbacks {
+		if len(entries) > 0 {
+			names[key.String()] = true
+		}
+	}
+	return names
+}
+
+// callbackNames returns the names among names that are in callbacks, separated
+// by commas.
+func callbackNames(callbacks map[string]bool, names ...string) string {
+	var found []string
+	for _, name := range names {
+		if callbacks[name] {
+			found = append(found, name)
+		}
+	}
+	return strings.Join(found, ", ")
+}
+
+// writeStateDiagramComposites writes the composite states of fsm with the
+// transitions of their children, separating regions with "--".
+func writeStateDiagramComposites(buf *bytes.Buffer, fsm *FSM, statesToIDMap map[string]string, indent string) {
+	for _, state := range getSortedCompositeStates(fsm, statesToIDMap) {
+		buf.WriteString(fmt.Sprintf("%sstate %s {\n", indent, state))
+		for i, s := range fsm.submachines[state] {
+			if i > 0 {
+				buf.WriteString(fmt.Sprintf("%s    --\n", indent))
+			}
+			edges, _, childIDs := getRegionGraph(s)
+			buf.WriteString(fmt.Sprintf("%s    [*] --> %s\n", indent, s.initial))
+			for _, edge := range edges {
+				buf.WriteString(fmt.Sprintf("%s    %s --> %s: %s\n", indent, edge.src, edge.dst, edge.event))
+			}
+			writeStateDiagramComposites(buf, s.child, childIDs, indent+"    ")
+		}
+		buf.WriteString(fmt.Sprintf("%s}\n", indent))
+	}
+}
+
 // visualizeForMermaidAsFlowChart outputs a visualization of a FSM in Mermaid format (including highlighting of current state).
 func visualizeForMermaidAsFlowChart(fsm *FSM) string {
+	fsm = visualized(fsm)
 	var buf bytes.Buffer
 
-	sortedTransitionKeys := getSortedTransitionKeys(fsm.transitions)
-	sortedStates, statesToIDMap := getSortedStates(fsm.transitions)
+	fsm.stateMu.RLock()
+	defer fsm.stateMu.RUnlock()
+
+	sortedEdges := getSortedTransitionEdges(fsm)
+	sortedStates, statesToIDMap := getSortedStates(sortedEdges)
 
 	writeFlowChartGraphType(&buf)
 	writeFlowChartStates(&buf, sortedStates, statesToIDMap)
-	writeFlowChartTransitions(&buf, fsm.transitions, sortedTransitionKeys, statesToIDMap)
-	writeFlowChartHighlightCurrent(&buf, fsm.current, statesToIDMap)
+	writeFlowChartTransitions(&buf, sortedEdges, statesToIDMap)
+	writeFlowChartSubgraphs(&buf, fsm, statesToIDMap, "    ", true)
+	writeFlowChartHighlightCurrent(&buf, fsm.Current(), statesToIDMap)
 
 	return buf.String()
 }
@@ -74,15 +180,49 @@ func writeFlowChartStates(buf *bytes.Buffer, sortedStates []string, statesToIDMa
 	buf.WriteString("\n")
 }
 
-func writeFlowChartTransitions(buf *bytes.Buffer, transitions map[eKey]string, sortedTransitionKeys []eKey, statesToIDMap map[string]string) {
-	for _, transition := range sortedTransitionKeys {
-		target := transitions[transition]
-		buf.WriteString(fmt.Sprintf(`    %s --> |%s| %s`, statesToIDMap[transition.src], transition.event, statesToIDMap[target]))
+func writeFlowChartTransitions(buf *bytes.Buffer, sortedEdges []transitionEdge, statesToIDMap map[string]string) {
+	for _, edge := range sortedEdges {
+		buf.WriteString(fmt.Sprintf(`    %s --> |%s| %s`, statesToIDMap[edge.src], edge.event, statesToIDMap[edge.dst]))
 		buf.WriteString("\n")
 	}
 	buf.WriteString("\n")
 }
 
+// writeFlowChartSubgraphs writes the composite states of fsm as subgraphs
+// containing the states and transitions of their children, with a dotted edge
+// from the composite state to the initial state of each child. The current
+// states of the children are highlighted if active is true.
+func writeFlowChartSubgraphs(buf *bytes.Buffer, fsm *FSM, statesToIDMap map[string]string, indent string, active bool) {
+	for _, state := range getSortedCompositeStates(fsm, statesToIDMap) {
+		id := statesToIDMap[state]
+		buf.WriteString(fmt.Sprintf("%ssubgraph %ss [%s]\n", indent, id, state))
+		var entries, highlighted []string
+		for i, s := range fsm.submachines[state] {
+			edges, states, childIDs := getRegionGraph(s)
+			for _, child := range states {
+				childIDs[child] = fmt.Sprintf("%s_%d_%s", id, i, childIDs[child])
+				buf.WriteString(fmt.Sprintf("%s    %s[%s]\n", indent, childIDs[child], child))
+			}
+			for _, edge := range edges {
+				buf.WriteString(fmt.Sprintf("%s    %s --> |%s| %s\n", indent, childIDs[edge.src], edge.event, childIDs[edge.dst]))
+			}
+			childActive := active && fsm.Current() == state
+			writeFlowChartSubgraphs(buf, s.child, childIDs, indent+"    ", childActive)
+			entries = append(entries, childIDs[s.initial])
+			if current, ok := childIDs[s.child.Current()]; ok && childActive {
+				highlighted = append(highlighted, current)
+			}
+		}
+		buf.WriteString(fmt.Sprintf("%send\n", indent))
+		for _, entry := range entries {
+			buf.WriteString(fmt.Sprintf("%s%s -.-> %s\n", indent, id, entry))
+		}
+		for _, h := range highlighted {
+			buf.WriteString(fmt.Sprintf("%sstyle %s fill:%s\n", indent, h, highlightingColor))
+		}
+	}
+}
+
 func writeFlowChartHighlightCurrent(buf *bytes.Buffer, current string, statesToIDMap map[string]string) {
 	buf.WriteString(fmt.Sprintf(`    style %s fill:%s`, statesToIDMap[current], highlightingColor))
 	buf.WriteString("\n")
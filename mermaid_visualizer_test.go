@@ -1,6 +1,7 @@
 package fsm
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -76,3 +77,206 @@ graph LR
 		fmt.Println([]byte(normalizedWanted))
 	}
 }
+
+func TestMermaidOutputWithDescriptions(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+		WithStateDescriptions(map[string]string{
+			"closed": "The door is closed",
+		}),
+	)
+
+	got, err := VisualizeForMermaidWithGraphType(fsmUnderTest, StateDiagram)
+	if err != nil {
+		t.Errorf("got error for visualizing with type MERMAID: %s", err)
+	}
+	wanted := `
+stateDiagram-v2
+    [*] --> closed
+    closed --> open: open
+    open --> closed: close
+    note right of closed: The door is closed
+`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build mermaid graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestMermaidOutputWithRegions(t *testing.T) {
+	payment := NewFSM(
+		"unpaid",
+		Events{
+			{Name: "advance", Src: []string{"unpaid"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	shipping := NewFSM(
+		"packing",
+		Events{
+			{Name: "advance", Src: []string{"packing"}, Dst: "packed"},
+			{Name: "advance", Src: []string{"packed"}, Dst: "shipped"},
+		},
+		Callbacks{},
+	)
+	fsmUnderTest := NewFSM(
+		"new",
+		Events{
+			{Name: "start", Src: []string{"new"}, Dst: "processing"},
+			{Name: "done", Src: []string{"processing"}, Dst: "complete"},
+			{Name: "abort", Src: []string{"processing"}, Dst: "aborted"},
+		},
+		Callbacks{},
+		WithRegions("processing", ResetSubmachine,
+			Region{FSM: payment, Final: []string{"paid"}},
+			Region{FSM: shipping, Final: []string{"shipped"}},
+		),
+		WithJoin("processing", "done"),
+	)
+	_ = fsmUnderTest.Event(context.Background(), "start")
+
+	got, err := VisualizeForMermaidWithGraphType(fsmUnderTest, StateDiagram)
+	if err != nil {
+		t.Errorf("got error for visualizing with type MERMAID: %s", err)
+	}
+	wanted := `
+stateDiagram-v2
+    [*] --> processing
+    new --> processing: start
+    processing --> aborted: abort
+    processing --> complete: done
+    state processing {
+        [*] --> unpaid
+        unpaid --> paid: advance
+        --
+        [*] --> packing
+        packed --> shipped: advance
+        packing --> packed: advance
+    }
+`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build mermaid graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestMermaidFlowChartOutputWithRegions(t *testing.T) {
+	payment := NewFSM(
+		"unpaid",
+		Events{
+			{Name: "advance", Src: []string{"unpaid"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	shipping := NewFSM(
+		"packing",
+		Events{
+			{Name: "advance", Src: []string{"packing"}, Dst: "packed"},
+			{Name: "advance", Src: []string{"packed"}, Dst: "shipped"},
+		},
+		Callbacks{},
+	)
+	fsmUnderTest := NewFSM(
+		"new",
+		Events{
+			{Name: "start", Src: []string{"new"}, Dst: "processing"},
+			{Name: "done", Src: []string{"processing"}, Dst: "complete"},
+			{Name: "abort", Src: []string{"processing"}, Dst: "aborted"},
+		},
+		Callbacks{},
+		WithRegions("processing", ResetSubmachine,
+			Region{FSM: payment, Final: []string{"paid"}},
+			Region{FSM: shipping, Final: []string{"shipped"}},
+		),
+		WithJoin("processing", "done"),
+	)
+	_ = fsmUnderTest.Event(context.Background(), "start")
+
+	got, err := VisualizeForMermaidWithGraphType(fsmUnderTest, FlowChart)
+	if err != nil {
+		t.Errorf("got error for visualizing with type MERMAID: %s", err)
+	}
+	wanted := `
+graph LR
+    id0[aborted]
+    id1[complete]
+    id2[new]
+    id3[processing]
+
+    id2 --> |start| id3
+    id3 --> |abort| id0
+    id3 --> |done| id1
+
+    subgraph id3s [processing]
+        id3_0_id0[paid]
+        id3_0_id1[unpaid]
+        id3_0_id1 --> |advance| id3_0_id0
+        id3_1_id0[packed]
+        id3_1_id1[packing]
+        id3_1_id2[shipped]
+        id3_1_id0 --> |advance| id3_1_id2
+        id3_1_id1 --> |advance| id3_1_id0
+    end
+    id3 -.-> id3_0_id1
+    id3 -.-> id3_1_id1
+    style id3_0_id1 fill:#00AA00
+    style id3_1_id1 fill:#00AA00
+    style id3 fill:#00AA00
+`
+	normalizedGot := strings.ReplaceAll(got, "\n", "")
+	normalizedWanted := strings.ReplaceAll(wanted, "\n", "")
+	if normalizedGot != normalizedWanted {
+		t.Errorf("build mermaid graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func hasFunds(context.Context, GuardContext) bool { return true }
+
+func isBlocked(context.Context, GuardContext) bool { return false }
+
+func TestMermaidOutputWithAnnotations(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"cart",
+		Events{
+			{Name: "pay", Src: []string{"cart"}, Dst: "paid", Guard: hasFunds, Unless: []GuardFunc{isBlocked}},
+			{Name: "refund", Src: []string{"paid"}, Dst: "cart"},
+		},
+		Callbacks{
+			"before_pay":  func(context.Context, *Event) {},
+			"enter_paid":  func(context.Context, *Event) {},
+			"leave_paid":  func(context.Context, *Event) {},
+			"after_event": func(context.Context, *Event) {},
+		},
+		WithStateDescriptions(map[string]string{
+			"cart": "Items are selected",
+			"paid": "The order is paid",
+		}),
+	)
+
+	got := VisualizeForMermaidWithOptions(fsmUnderTest, MermaidOptions{Guards: true, Callbacks: true})
+	wanted := `stateDiagram-v2
+    [*] --> cart
+    cart --> paid: pay [hasFunds, !isBlocked] / before_pay
+    paid --> cart: refund
+    note right of cart: Items are selected
+    note right of paid
+        The order is paid
+        enter_paid, leave_paid
+    end note
+`
+	if got != wanted {
+		t.Errorf("build mermaid graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+
+	plain, _ := VisualizeForMermaidWithGraphType(fsmUnderTest, StateDiagram)
+	if got := VisualizeForMermaidWithOptions(fsmUnderTest, MermaidOptions{}); got != plain {
+		t.Errorf("expected no annotations by default, got \n%s\n", got)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// EventHandler processes an event, like FSM.Event.
+type EventHandler func(ctx context.Context, event string, args ...interface{}) error
+
+// Middleware wraps an EventHandler with cross-cutting behavior, like logging,
+// authorization or retries. It calls next to continue processing the event,
+// and can change its arguments or error, or skip it.
+type Middleware func(next EventHandler) EventHandler
+
+// Use adds middleware around the processing of events by Event, in the same
+// way as HTTP middleware. The first middleware added is the outermost one and
+// sees every event first. The middleware is called as soon as Event is called,
+// before the event is passed to submachines, rejected in a final state or rate
+// limited, and it is called once for all the retries of WithRetry. Events sent
+// from callbacks also pass through the middleware, but the events that a FSM
+// passes to its submachines only pass through its own.
+func (f *FSM) Use(middleware ...Middleware) {
+	if !f.initialized() {
+		return
+	}
+	f.handlerMu.Lock()
+	defer f.handlerMu.Unlock()
+	f.middleware = append(f.middleware, middleware...)
+	var handler EventHandler = f.startEvent
+	for i := len(f.middleware) - 1; i >= 0; i-- {
+		handler = f.middleware[i](handler)
+	}
+	f.handler.Store(handler)
+	f.setHook(hookMiddleware)
+}
+
+// handlerFor returns the middleware chain, or nil without middleware. It is a
+// single load, so that events are not slowed down when there is none.
+func (f *FSM) handlerFor() EventHandler {
+	handler, _ := f.handler.Load().(EventHandler)
+	return handler
+}
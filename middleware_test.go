@@ -0,0 +1,148 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+	)
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next EventHandler) EventHandler {
+			return func(ctx context.Context, event string, args ...interface{}) error {
+				order = append(order, name+" before "+event)
+				err := next(ctx, event, args...)
+				order = append(order, name+" after "+event)
+				return err
+			}
+		}
+	}
+	fsm.Use(trace("first"), trace("second"))
+	fsm.Use(trace("third"))
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{
+		"first before open", "second before open", "third before open",
+		"third after open", "second after open", "first after open",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected order %v, got %v", expected, order)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestMiddlewareReject(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+	)
+
+	denied := errors.New("denied")
+	fsm.Use(func(next EventHandler) EventHandler {
+		return func(ctx context.Context, event string, args ...interface{}) error {
+			if len(args) == 0 || args[0] != "admin" {
+				return denied
+			}
+			return next(ctx, event, args...)
+		}
+	})
+
+	if err := fsm.Event(context.Background(), "open"); err != denied {
+		t.Errorf("expected denied error, got %v", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+	if err := fsm.Event(context.Background(), "open", "admin"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestMiddlewareSeesEveryEvent(t *testing.T) {
+	child := NewFSM(
+		"idle",
+		Events{
+			{Name: "work", Src: []string{"idle"}, Dst: "busy"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "ping", Src: []string{"open"}, Dst: "open", Kind: KindInternal},
+			{Name: "finish", Src: []string{"open"}, Dst: "done"},
+		},
+		Callbacks{},
+		WithSubmachine("open", child, ResetSubmachine),
+		WithFinalStates("done"),
+		WithThrottle("ping", time.Hour),
+	)
+
+	var seen []string
+	fsm.Use(func(next EventHandler) EventHandler {
+		return func(ctx context.Context, event string, args ...interface{}) error {
+			err := next(ctx, event, args...)
+			seen = append(seen, fmt.Sprintf("%s:%T", event, err))
+			return err
+		}
+	})
+
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "open")
+	_ = fsm.Event(ctx, "work")
+	_ = fsm.Event(ctx, "ping")
+	_ = fsm.Event(ctx, "ping")
+	_ = fsm.Event(ctx, "finish")
+	_ = fsm.Event(ctx, "finish")
+	_ = fsm.Event(ctx, "open")
+
+	expected := []string{
+		"open:<nil>",
+		"work:<nil>",
+		"ping:<nil>",
+		"ping:fsm.ThrottledError",
+		"finish:<nil>",
+		"finish:fsm.MachineCompletedError",
+		"open:fsm.MachineCompletedError",
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("expected middleware to see %v, got %v", expected, seen)
+	}
+}
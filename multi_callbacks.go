@@ -0,0 +1,33 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// MultiCallbacks is a shorthand for defining several callbacks per key with
+// WithCallbacks.
+type MultiCallbacks map[string][]Callback
+
+// WithCallbacks binds several callbacks to each key. The keys are parsed in the
+// same way as the callbacks passed to NewFSM. The callbacks of a key are called
+// in the given order, after the callbacks bound to the same key in NewFSM and
+// WithErrCallbacks. WithCallbacks can be given more than once; the callbacks
+// of later options are called after those of earlier ones.
+//
+// A callback can skip the remaining callbacks of its kind with
+// Event.StopPropagation.
+func WithCallbacks(callbacks MultiCallbacks) Option {
+	return func(f *FSM) {
+		f.multiCallbacks = append(f.multiCallbacks, callbacks)
+	}
+}
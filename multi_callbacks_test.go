@@ -0,0 +1,129 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMultiCallbacksOrder(t *testing.T) {
+	var order []string
+	record := func(name string) Callback {
+		return func(_ context.Context, e *Event) {
+			order = append(order, name)
+		}
+	}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"enter_open": record("single"),
+		},
+		WithCallbacks(MultiCallbacks{
+			"enter_open":  {record("first"), record("second")},
+			"enter_state": {record("any")},
+		}),
+		WithCallbacks(MultiCallbacks{
+			"enter_open": {record("third")},
+		}),
+	)
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{"single", "first", "second", "third", "any"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected order %v, got %v", expected, order)
+	}
+}
+
+func TestStopPropagation(t *testing.T) {
+	var order []string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithCallbacks(MultiCallbacks{
+			"enter_open": {
+				func(_ context.Context, e *Event) {
+					order = append(order, "first")
+					e.StopPropagation()
+				},
+				func(_ context.Context, e *Event) {
+					order = append(order, "second")
+				},
+			},
+			"enter_state": {
+				func(_ context.Context, e *Event) {
+					order = append(order, "enter_state")
+				},
+			},
+			"after_open": {
+				func(_ context.Context, e *Event) {
+					order = append(order, "after_open")
+				},
+			},
+		}),
+	)
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{"first", "after_open"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected order %v, got %v", expected, order)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestStopPropagationCancel(t *testing.T) {
+	called := false
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithCallbacks(MultiCallbacks{
+			"before_open": {
+				func(_ context.Context, e *Event) {
+					e.StopPropagation()
+				},
+				func(_ context.Context, e *Event) {
+					called = true
+					e.Cancel()
+				},
+			},
+		}),
+	)
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if called {
+		t.Error("expected second callback to be skipped")
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
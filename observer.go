@@ -0,0 +1,132 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// TransitionInfo describes an attempted transition, as passed to observers.
+type TransitionInfo struct {
+	// ID is the ID of the call to Event, see Event.ID.
+	ID uint64
+
+	// Event is the event name.
+	Event string
+
+	// Src is the state when the event was sent.
+	Src string
+
+	// Dst is the destination state of the transition. It is empty if the
+	// event was rejected before a destination was chosen.
+	Dst string
+
+	// Args are the arguments passed to the event.
+	Args []interface{}
+
+	// Err is the error returned by Event, or nil if the transition succeeded.
+	Err error
+
+	// Duration is the time Event took to perform the transition.
+	Duration time.Duration
+
+	// SrcDuration is the time the FSM had spent in Src when the event was
+	// sent, see FSM.DurationInState.
+	SrcDuration time.Duration
+
+	// Replay is true if the event was replayed, see SetReplay.
+	Replay bool
+
+	// Tags are the tags of the transition, see EventDesc.Tags. If the event
+	// was rejected before a transition was chosen, they are the tags of all
+	// transitions of the event.
+	Tags []string
+
+	// Suppressed is the number of calls of the event that were coalesced
+	// into this one or dropped before it, see WithDebounce and
+	// WithThrottle.
+	Suppressed int
+}
+
+// Observer is notified of every transition attempted with Event, successful or
+// not. It is useful for logging and metrics. Like middleware and extensions,
+// observers only cost something when they are added: without them, Event
+// neither allocates nor locks anything for them.
+type Observer interface {
+	// OnTransition is called when Event returns, with the same context. It is
+	// called after the after callbacks and can trigger new events.
+	OnTransition(ctx context.Context, info TransitionInfo)
+}
+
+// ObserverFunc is an adapter to use an ordinary function as an Observer.
+type ObserverFunc func(ctx context.Context, info TransitionInfo)
+
+// OnTransition calls fn(ctx, info).
+func (fn ObserverFunc) OnTransition(ctx context.Context, info TransitionInfo) {
+	fn(ctx, info)
+}
+
+// AddObserver adds an observer that is notified of every following
+// transition. Observers are notified in the order they were added. An
+// asynchronous transition is reported when Event returns the AsyncError, see
+// AsyncObserver to be notified when it completes.
+func (f *FSM) AddObserver(o Observer) {
+	if !f.initialized() {
+		return
+	}
+	f.observersMu.Lock()
+	defer f.observersMu.Unlock()
+	current := f.observersFor()
+	observers := make([]Observer, len(current), len(current)+1)
+	copy(observers, current)
+	f.observers.Store(append(observers, o))
+	f.setHook(hookObservers)
+}
+
+// observersFor returns the observers to notify of a transition. It is a
+// single load, so that events are not slowed down when there are none.
+func (f *FSM) observersFor() []Observer {
+	observers, _ := f.observers.Load().([]Observer)
+	return observers
+}
+
+// notifyObservers notifies observers of the transition with id for event that
+// started at start. e is nil if the event was rejected before any callbacks were called.
+func (f *FSM) notifyObservers(ctx context.Context, observers []Observer, id uint64, start time.Time, event string, args []interface{}, e *Event, err error) {
+	info := TransitionInfo{
+		ID:         id,
+		Event:      event,
+		Args:       args,
+		Err:        err,
+		Duration:   f.since(start),
+		Suppressed: suppressedEvents(ctx, event),
+	}
+	if e != nil {
+		info.Src = e.Src
+		info.Dst = e.Dst
+		info.Replay = e.Replay
+		info.Tags = e.Tags
+		info.SrcDuration = e.SrcDuration
+	} else {
+		info.Src = f.liveState()
+		info.SrcDuration = f.DurationInState()
+		info.Replay = f.isReplay(ctx)
+		info.Tags = f.eventTags(event)
+	}
+	for _, o := range observers {
+		o.OnTransition(ctx, info)
+	}
+}
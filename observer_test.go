@@ -0,0 +1,120 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestObserver(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+
+	var infos []TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+
+	if err := fsm.Event(context.Background(), "open", "fast"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err := fsm.Event(context.Background(), "open")
+	if _, ok := err.(InvalidEventError); !ok {
+		t.Fatalf("expected InvalidEventError, got %v", err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(infos))
+	}
+	info := infos[0]
+	if info.Event != "open" || info.Src != "closed" || info.Dst != "open" || info.Err != nil {
+		t.Errorf("unexpected info for successful transition: %+v", info)
+	}
+	if len(info.Args) != 1 || info.Args[0] != "fast" {
+		t.Errorf("expected args to be passed, got %v", info.Args)
+	}
+	if info.Duration < 0 {
+		t.Errorf("expected non-negative duration, got %v", info.Duration)
+	}
+	info = infos[1]
+	if info.Event != "open" || info.Src != "open" || info.Dst != "" || info.Err != err {
+		t.Errorf("unexpected info for rejected transition: %+v", info)
+	}
+}
+
+func TestObserverCanceled(t *testing.T) {
+	canceled := errors.New("not now")
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_open": func(_ context.Context, e *Event) {
+				e.Cancel(canceled)
+			},
+		},
+	)
+
+	var order []string
+	var got TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		order = append(order, "first")
+		got = info
+	}))
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		order = append(order, "second")
+	}))
+
+	err := fsm.Event(context.Background(), "open")
+	if cerr, ok := err.(CanceledError); !ok || cerr.Err != canceled {
+		t.Fatalf("expected canceled error, got %v", err)
+	}
+	if got.Src != "closed" || got.Dst != "open" || got.Err != err {
+		t.Errorf("unexpected info for canceled transition: %+v", got)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("expected observers in order, got %v", order)
+	}
+}
+
+func TestObserverRejectedTags(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Tags: []string{"door"}},
+			{Name: "open", Src: []string{"ajar"}, Dst: "open", Tags: []string{"door", "alarm"}},
+		},
+		Callbacks{},
+	)
+	fsm.SetState("open")
+
+	var got TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		got = info
+	}))
+	_ = fsm.Event(context.Background(), "open")
+	if len(got.Tags) != 2 || got.Tags[0] != "alarm" || got.Tags[1] != "door" {
+		t.Errorf("expected tags of all transitions of the event, got %v", got.Tags)
+	}
+}
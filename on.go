@@ -0,0 +1,155 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// callbackEntry is a callback bound to a key in the callbacks map.
+type callbackEntry struct {
+	// id identifies callbacks added with On; it is 0 for other callbacks.
+	id uint64
+
+	fn Callback
+}
+
+// CallbackHandle identifies a callback added with On, so that it can be
+// removed with Off.
+type CallbackHandle struct {
+	key cKey
+	id  uint64
+}
+
+// On adds a callback after the FSM has been constructed. The name is parsed in
+// the same way as the keys of the callbacks passed to NewFSM, and the callback
+// is called after the callbacks that are already bound to the same key.
+//
+// An UnknownCallbackError is returned if the name does not refer to a known
+// event or state. The returned handle can be passed to Off to remove the
+// callback again.
+func (f *FSM) On(name string, fn Callback) (CallbackHandle, error) {
+	if !f.initialized() {
+		return CallbackHandle{}, NotInitializedError{}
+	}
+	f.stateMu.RLock()
+	allEvents, allStates := f.callbackTargets()
+	f.stateMu.RUnlock()
+
+	key, ok := callbackKey(name, allEvents, allStates)
+	if !ok {
+		return CallbackHandle{}, UnknownCallbackError{name}
+	}
+
+	f.callbacksMu.Lock()
+	defer f.callbacksMu.Unlock()
+	f.lastCallbackID++
+	entries := f.callbacks[key]
+	updated := make([]callbackEntry, len(entries), len(entries)+1)
+	copy(updated, entries)
+	f.callbacks[key] = append(updated, callbackEntry{f.lastCallbackID, fn})
+	f.publishCallbacks()
+	return CallbackHandle{key, f.lastCallbackID}, nil
+}
+
+// Off removes a callback that was added with On. It returns false if the
+// callback has already been removed.
+func (f *FSM) Off(handle CallbackHandle) bool {
+	if !f.initialized() {
+		return false
+	}
+	f.callbacksMu.Lock()
+	defer f.callbacksMu.Unlock()
+	entries := f.callbacks[handle.key]
+	for i, entry := range entries {
+		if entry.id != 0 && entry.id == handle.id {
+			updated := make([]callbackEntry, 0, len(entries)-1)
+			updated = append(updated, entries[:i]...)
+			updated = append(updated, entries[i+1:]...)
+			if len(updated) == 0 {
+				delete(f.callbacks, handle.key)
+			} else {
+				f.callbacks[handle.key] = updated
+			}
+			f.publishCallbacks()
+			return true
+		}
+	}
+	return false
+}
+
+// callbackTargets returns the sets of events and states that callbacks can be
+// bound to. Callers must hold stateMu.
+func (f *FSM) callbackTargets() (map[string]bool, map[string]bool) {
+	allEvents := make(map[string]bool)
+	for key := range f.transitions {
+		allEvents[key.event] = true
+	}
+	return allEvents, f.knownStates()
+}
+
+// isCallbackPattern returns true if target is a valid pattern for callbacks,
+// as supported by path.Match.
+func isCallbackPattern(target string) bool {
+	if !strings.ContainsAny(target, `*?[\`) {
+		return false
+	}
+	_, err := path.Match(target, "")
+	return err == nil
+}
+
+// matchCallbackPattern returns true if name matches the pattern.
+func matchCallbackPattern(pattern, name string) bool {
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// callbackSet is a copy of the callbacks of a FSM that is never modified, so
+// that events can read it without locking.
+type callbackSet struct {
+	callbacks map[cKey][]callbackEntry
+
+	// patterns are the sorted keys in callbacks with a pattern as target.
+	patterns []cKey
+}
+
+// publishCallbacks publishes a copy of callbacks to be read by events.
+// Callers must hold callbacksMu or be constructing the FSM.
+func (f *FSM) publishCallbacks() {
+	set := &callbackSet{callbacks: make(map[cKey][]callbackEntry, len(f.callbacks))}
+	for key, entries := range f.callbacks {
+		set.callbacks[key] = entries
+		if isCallbackPattern(key.target) {
+			set.patterns = append(set.patterns, key)
+		}
+	}
+	sort.Slice(set.patterns, func(i, j int) bool {
+		if set.patterns[i].target != set.patterns[j].target {
+			return set.patterns[i].target < set.patterns[j].target
+		}
+		return set.patterns[i].callbackType < set.patterns[j].callbackType
+	})
+	f.published.Store(set)
+	if len(set.callbacks) > 0 {
+		f.setHook(hookTraced)
+	}
+}
+
+// callbackPatternsFor returns the keys of the callbacks with a pattern.
+func (f *FSM) callbackPatternsFor() []cKey {
+	return f.published.Load().(*callbackSet).patterns
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestOnOff(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_closed": func(_ context.Context, e *Event) {
+				calls = append(calls, "static")
+			},
+		},
+	)
+
+	first, err := fsm.On("enter_closed", func(_ context.Context, e *Event) {
+		calls = append(calls, "first")
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err = fsm.On("closed", func(_ context.Context, e *Event) {
+		calls = append(calls, "second")
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_ = fsm.Event(context.Background(), "open")
+	_ = fsm.Event(context.Background(), "close")
+	if fmt.Sprint(calls) != "[static first second]" {
+		t.Errorf("expected callbacks in registration order, got %v", calls)
+	}
+
+	if !fsm.Off(first) {
+		t.Error("expected callback to be removed")
+	}
+	if fsm.Off(first) {
+		t.Error("expected callback to be removed only once")
+	}
+	calls = nil
+	_ = fsm.Event(context.Background(), "open")
+	_ = fsm.Event(context.Background(), "close")
+	if fmt.Sprint(calls) != "[static second]" {
+		t.Errorf("expected removed callback not to be called, got %v", calls)
+	}
+}
+
+func TestOnCancel(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{},
+	)
+	handle, _ := fsm.On("before_run", func(_ context.Context, e *Event) {
+		e.Cancel()
+	})
+	if _, ok := fsm.Event(context.Background(), "run").(CanceledError); !ok {
+		t.Error("expected 'CanceledError'")
+	}
+	fsm.Off(handle)
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Errorf("transition failed %v", err)
+	}
+}
+
+func TestOnUnknown(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{},
+	)
+	_, err := fsm.On("enter_nowhere", func(_ context.Context, e *Event) {})
+	if e, ok := err.(UnknownCallbackError); !ok || e.Name != "enter_nowhere" {
+		t.Errorf("expected 'UnknownCallbackError', got %v", err)
+	}
+}
+
+func TestOnAddedTransition(t *testing.T) {
+	entered := false
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{},
+	)
+	if err := fsm.AddTransition(EventDesc{Name: "skip", Src: []string{"start"}, Dst: "skipped"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := fsm.On("enter_skipped", func(_ context.Context, e *Event) {
+		entered = true
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = fsm.Event(context.Background(), "skip")
+	if !entered {
+		t.Error("expected callback for added state to be called")
+	}
+}
+
+func TestOnFromCallback(t *testing.T) {
+	var fsm *FSM
+	calls := 0
+	fsm = NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+			{Name: "reset", Src: []string{"end"}, Dst: "start"},
+		},
+		Callbacks{
+			"enter_end": func(_ context.Context, e *Event) {
+				var handle CallbackHandle
+				handle, _ = fsm.On("enter_start", func(_ context.Context, e *Event) {
+					calls++
+					fsm.Off(handle)
+				})
+			},
+		},
+	)
+	_ = fsm.Event(context.Background(), "run")
+	_ = fsm.Event(context.Background(), "reset")
+	_ = fsm.Event(context.Background(), "run")
+	if calls != 1 {
+		t.Errorf("expected one-shot callback to be called once, got %d", calls)
+	}
+}
+
+func TestCallbackPatterns(t *testing.T) {
+	var calls []string
+	record := func(name string) Callback {
+		return func(_ context.Context, e *Event) {
+			calls = append(calls, name)
+		}
+	}
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "checkout", Src: []string{"cart"}, Dst: "payment_pending"},
+			{Name: "admin:approve", Src: []string{"payment_pending"}, Dst: "payment_done"},
+		},
+		Callbacks{
+			"enter_payment_*":       record("enter_payment_*"),
+			"enter_payment_?ending": record("enter_payment_?ending"),
+			"enter_payment_pending": record("enter_payment_pending"),
+			"enter_state":           record("enter_state"),
+			"before_admin:*":        record("before_admin:*"),
+			"after_[a-c]*":          record("after_[a-c]*"),
+		},
+	)
+
+	if err := fsm.Event(context.Background(), "checkout"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{"enter_payment_pending", "enter_payment_*", "enter_payment_?ending", "enter_state", "after_[a-c]*"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	calls = nil
+	if err := fsm.Event(context.Background(), "admin:approve"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected = []string{"before_admin:*", "enter_payment_*", "enter_state", "after_[a-c]*"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestOnCallbackPattern(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "end"},
+		},
+		Callbacks{},
+	)
+
+	if _, err := fsm.On("enter_[", func(context.Context, *Event) {}); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+
+	calls := 0
+	handle, err := fsm.On("leave_st*", func(context.Context, *Event) {
+		calls++
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !fsm.Off(handle) {
+		t.Error("expected callback to be removed")
+	}
+	if len(fsm.callbackPatternsFor()) != 0 {
+		t.Errorf("expected no patterns, got %v", fsm.callbackPatternsFor())
+	}
+	if err := fsm.Event(context.Background(), "run"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls != 0 {
+		t.Error("expected removed callback not to be called")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"strings"
+)
+
+// PathSeparator separates the states of a path, see Path.
+const PathSeparator = "/"
+
+// Path returns the current state followed by the current states of the
+// submachines of the composite states it is in, separated by PathSeparator,
+// like "connected/authenticating". For a state with regions it follows the
+// first region. Without submachines it is the same as Current.
+func (f *FSM) Path() string {
+	return strings.Join(f.pathStates(), PathSeparator)
+}
+
+// Leaf returns the innermost current state, which is the last state of Path.
+// Without submachines it is the same as Current.
+func (f *FSM) Leaf() string {
+	states := f.pathStates()
+	if len(states) == 0 {
+		return ""
+	}
+	return states[len(states)-1]
+}
+
+// pathStates returns the states of Path.
+func (f *FSM) pathStates() []string {
+	if !f.initialized() {
+		return nil
+	}
+	state := f.Current()
+	states := []string{state}
+	for child := f.Submachine(state); child != nil; child = child.Submachine(state) {
+		state = child.Current()
+		states = append(states, state)
+	}
+	return states
+}
+
+// isPath returns true if path is the start of Path, with at least one state
+// of a submachine. The path is compared state by state, so that the names of
+// states can contain PathSeparator.
+func (f *FSM) isPath(path string) bool {
+	if !strings.Contains(path, PathSeparator) {
+		return false
+	}
+	states := f.pathStates()
+	for i := 2; i <= len(states); i++ {
+		if strings.Join(states[:i], PathSeparator) == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	session := NewFSM(
+		"idle",
+		Events{
+			{Name: "request", Src: []string{"idle"}, Dst: "busy"},
+		},
+		Callbacks{},
+	)
+	auth := NewFSM(
+		"authenticating",
+		Events{
+			{Name: "authenticated", Src: []string{"authenticating"}, Dst: "session"},
+		},
+		Callbacks{},
+		WithSubmachine("session", session, ResetSubmachine),
+	)
+	fsm := NewFSM(
+		"disconnected",
+		Events{
+			{Name: "connect", Src: []string{"disconnected"}, Dst: "connected"},
+			{Name: "disconnect", Src: []string{"connected"}, Dst: "disconnected"},
+		},
+		Callbacks{},
+		WithSubmachine("connected", auth, ResetSubmachine),
+	)
+	ctx := context.Background()
+
+	if fsm.Path() != "disconnected" || fsm.Leaf() != "disconnected" {
+		t.Errorf("expected path and leaf 'disconnected', got %s and %s", fsm.Path(), fsm.Leaf())
+	}
+	if err := fsm.Event(ctx, "connect"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "connected" || fsm.Path() != "connected/authenticating" || fsm.Leaf() != "authenticating" {
+		t.Errorf("expected to be authenticating, got %s, %s and %s", fsm.Current(), fsm.Path(), fsm.Leaf())
+	}
+	if err := fsm.Event(ctx, "authenticated"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Path() != "connected/session/idle" || fsm.Leaf() != "idle" {
+		t.Errorf("expected path 'connected/session/idle', got %s", fsm.Path())
+	}
+	for _, state := range []string{"connected", "connected/session", "connected/session/idle"} {
+		if !fsm.Is(state) {
+			t.Errorf("expected to be in %s", state)
+		}
+	}
+	for _, state := range []string{"session", "idle", "connected/idle", "connected/authenticating", "connected/session/idle/"} {
+		if fsm.Is(state) {
+			t.Errorf("expected not to be in %s", state)
+		}
+	}
+	if auth.Path() != "session/idle" {
+		t.Errorf("expected the path of the child to start at its own state, got %s", auth.Path())
+	}
+
+	if err := fsm.Event(ctx, "disconnect"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Path() != "disconnected" || fsm.Is("connected/session") {
+		t.Errorf("expected path 'disconnected', got %s", fsm.Path())
+	}
+}
+
+func TestPathSeparatorInState(t *testing.T) {
+	fsm := NewFSM(
+		"a/b",
+		Events{
+			{Name: "next", Src: []string{"a/b"}, Dst: "a"},
+		},
+		Callbacks{},
+	)
+	if !fsm.Is("a/b") || fsm.Is("a") || fsm.Leaf() != "a/b" {
+		t.Errorf("expected flat state 'a/b', got path %s and leaf %s", fsm.Path(), fsm.Leaf())
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// periodicEvent is an event set with WithPeriodicEvent.
+type periodicEvent struct {
+	every time.Duration
+	event string
+}
+
+// WithPeriodicEvent triggers event at an interval of every while the FSM is in
+// state, for example "poll" every 10 seconds in "monitoring". Several periodic
+// events can be set for the same state.
+//
+// The first event is triggered one interval after the state is entered,
+// including when it is the initial state. The events stop when the state is
+// left or the FSM is closed, and restart from the beginning when the state is
+// entered again, also by an external self-transition.
+//
+// The events are triggered from the goroutine of the clock with EventIf, so
+// they have no effect if the state has changed in the meantime. Their errors
+// are not returned anywhere, use an Observer to see them.
+func WithPeriodicEvent(state string, every time.Duration, event string) Option {
+	return func(f *FSM) {
+		if f.periodicEvents == nil {
+			f.periodicEvents = make(map[string][]periodicEvent)
+		}
+		f.periodicEvents[state] = append(f.periodicEvents[state], periodicEvent{every, event})
+	}
+}
+
+// enterPeriodicEvents starts the timers of the periodic events of state, if
+// any, and stops the timers of the previous state.
+func (f *FSM) enterPeriodicEvents(state string) {
+	if len(f.periodicEvents) == 0 {
+		return
+	}
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	f.stopPeriodicTimers()
+	select {
+	case <-f.closed:
+		return
+	default:
+	}
+	for i, p := range f.periodicEvents[state] {
+		f.periodicTimers = append(f.periodicTimers, f.schedulePeriodicEvent(state, i, p, f.periodicGen))
+	}
+}
+
+// schedulePeriodicEvent starts the timer of the periodic event p of state,
+// which is the ith timer of the generation gen. Callers must hold timerMu.
+func (f *FSM) schedulePeriodicEvent(state string, i int, p periodicEvent, gen uint64) Timer {
+	return f.clock.AfterFunc(p.every, func() {
+		f.timerMu.Lock()
+		running := f.periodicGen == gen
+		f.timerMu.Unlock()
+		if !running {
+			return
+		}
+
+		_ = f.EventIf(context.Background(), state, p.event)
+
+		f.timerMu.Lock()
+		defer f.timerMu.Unlock()
+		if f.periodicGen == gen {
+			f.periodicTimers[i] = f.schedulePeriodicEvent(state, i, p, gen)
+		}
+	})
+}
+
+// stopPeriodicEvents stops the timers of the periodic events, if any.
+func (f *FSM) stopPeriodicEvents() {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	f.stopPeriodicTimers()
+}
+
+// stopPeriodicTimers stops the timers of the periodic events and starts a new
+// generation, so that the timers that already fired do not restart. Callers
+// must hold timerMu.
+func (f *FSM) stopPeriodicTimers() {
+	for _, t := range f.periodicTimers {
+		t.Stop()
+	}
+	f.periodicTimers = nil
+	f.periodicGen++
+}
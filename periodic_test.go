@@ -0,0 +1,93 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPeriodicEvent(t *testing.T) {
+	clock := &manualClock{}
+	polls := 0
+	fsm := NewFSM(
+		"monitoring",
+		Events{
+			{Name: "poll", Src: []string{"monitoring"}, Dst: "monitoring", Kind: KindInternal},
+			{Name: "pause", Src: []string{"monitoring"}, Dst: "paused"},
+			{Name: "resume", Src: []string{"paused"}, Dst: "monitoring"},
+		},
+		Callbacks{
+			"poll": func(context.Context, *Event) {
+				polls++
+			},
+		},
+		WithClock(clock),
+		WithPeriodicEvent("monitoring", 10*time.Second, "poll"),
+	)
+
+	clock.Advance(35 * time.Second)
+	if polls != 3 {
+		t.Errorf("expected 3 polls, got %d", polls)
+	}
+
+	if err := fsm.Event(context.Background(), "pause"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(time.Minute)
+	if polls != 3 {
+		t.Errorf("expected no polls while paused, got %d", polls-3)
+	}
+
+	if err := fsm.Event(context.Background(), "resume"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(9 * time.Second)
+	if polls != 3 {
+		t.Errorf("expected the interval to restart, got %d polls", polls)
+	}
+	clock.Advance(time.Second)
+	if polls != 4 {
+		t.Errorf("expected 4 polls, got %d", polls)
+	}
+
+	fsm.Close()
+	clock.Advance(time.Minute)
+	if polls != 4 {
+		t.Errorf("expected no polls after close, got %d", polls-4)
+	}
+}
+
+func TestPeriodicEventLeavesState(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"counting",
+		Events{
+			{Name: "tick", Src: []string{"counting"}, Dst: "done"},
+		},
+		Callbacks{},
+		WithClock(clock),
+		WithPeriodicEvent("counting", time.Second, "tick"),
+	)
+
+	clock.Advance(10 * time.Second)
+	if fsm.Current() != "done" {
+		t.Errorf("expected state to be 'done', got %s", fsm.Current())
+	}
+	if len(clock.timers) != 0 {
+		t.Errorf("expected no timers to be left, got %d", len(clock.timers))
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// VisualizeForPlantUML outputs a visualization of a FSM as a PlantUML state
+// diagram (including highlighting of current state).
+func VisualizeForPlantUML(fsm *FSM) string {
+	fsm = visualized(fsm)
+	var buf bytes.Buffer
+
+	fsm.stateMu.RLock()
+	defer fsm.stateMu.RUnlock()
+
+	sortedEdges := getSortedTransitionEdges(fsm)
+	sortedStates, statesToIDMap := getSortedStates(sortedEdges)
+
+	buf.WriteString("@startuml\n")
+	buf.WriteString(fmt.Sprintf("[*] --> %s\n", fsm.Current()))
+	for _, edge := range sortedEdges {
+		buf.WriteString(fmt.Sprintf("%s --> %s : %s\n", edge.src, edge.dst, edge.event))
+	}
+	writePlantUMLComposites(&buf, fsm, statesToIDMap, "")
+	for _, state := range sortedStates {
+		if description := fsm.stateDescriptions[state]; description != "" {
+			buf.WriteString(fmt.Sprintf("%s : %s\n", state, description))
+		}
+	}
+	buf.WriteString(fmt.Sprintf("state %s %s\n", fsm.Current(), highlightingColor))
+	buf.WriteString("@enduml\n")
+
+	return buf.String()
+}
+
+// writePlantUMLComposites writes the composite states of fsm with the
+// transitions of their children, separating regions with "--".
+func writePlantUMLComposites(buf *bytes.Buffer, fsm *FSM, statesToIDMap map[string]string, indent string) {
+	for _, state := range getSortedCompositeStates(fsm, statesToIDMap) {
+		buf.WriteString(fmt.Sprintf("%sstate %s {\n", indent, state))
+		for i, s := range fsm.submachines[state] {
+			if i > 0 {
+				buf.WriteString(fmt.Sprintf("%s  --\n", indent))
+			}
+			edges, _, childIDs := getRegionGraph(s)
+			buf.WriteString(fmt.Sprintf("%s  [*] --> %s\n", indent, s.initial))
+			for _, edge := range edges {
+				buf.WriteString(fmt.Sprintf("%s  %s --> %s : %s\n", indent, edge.src, edge.dst, edge.event))
+			}
+			writePlantUMLComposites(buf, s.child, childIDs, indent+"  ")
+		}
+		buf.WriteString(fmt.Sprintf("%s}\n", indent))
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"testing"
+)
+
+func TestPlantUMLOutput(t *testing.T) {
+	fsmUnderTest := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+		WithStateDescriptions(map[string]string{
+			"closed": "The door is closed",
+		}),
+	)
+
+	got, err := VisualizeWithType(fsmUnderTest, PLANTUML)
+	if err != nil {
+		t.Errorf("got error for visualizing with type PLANTUML: %s", err)
+	}
+	wanted := `@startuml
+[*] --> closed
+closed --> open : open
+open --> closed : close
+closed : The door is closed
+state closed #00AA00
+@enduml
+`
+	if got != wanted {
+		t.Errorf("build plantuml graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
+
+func TestPlantUMLOutputWithRegions(t *testing.T) {
+	payment := NewFSM(
+		"unpaid",
+		Events{
+			{Name: "advance", Src: []string{"unpaid"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	shipping := NewFSM(
+		"packing",
+		Events{
+			{Name: "advance", Src: []string{"packing"}, Dst: "packed"},
+			{Name: "advance", Src: []string{"packed"}, Dst: "shipped"},
+		},
+		Callbacks{},
+	)
+	fsmUnderTest := NewFSM(
+		"new",
+		Events{
+			{Name: "start", Src: []string{"new"}, Dst: "processing"},
+			{Name: "done", Src: []string{"processing"}, Dst: "complete"},
+			{Name: "abort", Src: []string{"processing"}, Dst: "aborted"},
+		},
+		Callbacks{},
+		WithRegions("processing", ResetSubmachine,
+			Region{FSM: payment, Final: []string{"paid"}},
+			Region{FSM: shipping, Final: []string{"shipped"}},
+		),
+		WithJoin("processing", "done"),
+	)
+
+	got := VisualizeForPlantUML(fsmUnderTest)
+	wanted := `@startuml
+[*] --> new
+new --> processing : start
+processing --> aborted : abort
+processing --> complete : done
+state processing {
+  [*] --> unpaid
+  unpaid --> paid : advance
+  --
+  [*] --> packing
+  packed --> shipped : advance
+  packing --> packed : advance
+}
+state new #00AA00
+@enduml
+`
+	if got != wanted {
+		t.Errorf("build plantuml graph failed. \nwanted \n%s\nand got \n%s\n", wanted, got)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// Progress is the progress of a long-running transition, reported with
+// Event.ReportProgress.
+type Progress struct {
+	// ID is the ID of the event, see Event.ID.
+	ID uint64
+
+	// Event is the event name.
+	Event string
+
+	// Src is the state before the transition.
+	Src string
+
+	// Dst is the state after the transition.
+	Dst string
+
+	// Percent is the completion of the transition, from 0 to 100.
+	Percent float64
+
+	// Step is the label of the current sub-step, if any.
+	Step string
+
+	// At is the time the progress was reported.
+	At time.Time
+}
+
+// ProgressObserver is an Observer that is also notified of the progress of
+// transitions.
+type ProgressObserver interface {
+	Observer
+
+	// OnProgress is called with the context passed to ReportProgress every
+	// time the progress of a transition is reported.
+	OnProgress(ctx context.Context, p Progress)
+}
+
+// WithProgressChannel sends the progress of every transition to ch. Progress
+// is dropped rather than blocking the transition if ch is full, so ch should
+// be buffered.
+func WithProgressChannel(ch chan<- Progress) Option {
+	return func(f *FSM) {
+		f.progress = ch
+	}
+}
+
+// ReportProgress reports the progress of the transition: percent is its
+// completion from 0 to 100, and step is an optional label of the current
+// sub-step, like "copying tables". It is meant for long-running transitions,
+// in particular asynchronous ones, and can be called from any goroutine until
+// the transition has completed.
+//
+// The progress is passed to the ProgressObservers and to the channel set with
+// WithProgressChannel.
+func (e *Event) ReportProgress(ctx context.Context, percent float64, step string) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	p := Progress{
+		ID:      e.ID,
+		Event:   e.Event,
+		Src:     e.Src,
+		Dst:     e.Dst,
+		Percent: percent,
+		Step:    step,
+	}
+	f := e.FSM
+	if f == nil {
+		e.progress.Store(p)
+		return
+	}
+	p.At = f.clock.Now()
+	e.progress.Store(p)
+	for _, o := range f.observersFor() {
+		if po, ok := o.(ProgressObserver); ok {
+			po.OnProgress(ctx, p)
+		}
+	}
+	if f.progress != nil {
+		select {
+		case f.progress <- p:
+		default:
+		}
+	}
+}
+
+// Progress returns the last progress reported with ReportProgress, and false
+// if none has been reported yet.
+func (e *Event) Progress() (Progress, bool) {
+	p, ok := e.progress.Load().(Progress)
+	return p, ok
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type progressRecorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *progressRecorder) OnTransition(context.Context, TransitionInfo) {}
+
+func (r *progressRecorder) OnProgress(_ context.Context, p Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, p.Event+" "+p.Step)
+}
+
+func TestReportProgress(t *testing.T) {
+	var migration *Event
+	ch := make(chan Progress, 10)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "migrate", Src: []string{"idle"}, Dst: "migrated"},
+		},
+		Callbacks{
+			"leave_idle": func(_ context.Context, e *Event) {
+				migration = e
+				e.Async()
+			},
+		},
+		WithProgressChannel(ch),
+	)
+	r := &progressRecorder{}
+	fsm.AddObserver(r)
+
+	if _, ok := fsm.Event(context.Background(), "migrate").(AsyncError); !ok {
+		t.Fatal("expected 'AsyncError'")
+	}
+	if _, ok := migration.Progress(); ok {
+		t.Error("expected no progress before it is reported")
+	}
+	migration.ReportProgress(context.Background(), 40, "copying tables")
+	migration.ReportProgress(context.Background(), 120, "rebuilding indexes")
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !reflect.DeepEqual(r.steps, []string{"migrate copying tables", "migrate rebuilding indexes"}) {
+		t.Errorf("expected progress to be observed, got %v", r.steps)
+	}
+	p, ok := migration.Progress()
+	if !ok || p.Percent != 100 || p.Step != "rebuilding indexes" || p.Src != "idle" || p.Dst != "migrated" {
+		t.Errorf("expected last progress clamped to 100, got %+v", p)
+	}
+	if len(ch) != 2 {
+		t.Fatalf("expected 2 progress notifications on the channel, got %d", len(ch))
+	}
+	if p := <-ch; p.Percent != 40 || p.ID != migration.ID {
+		t.Errorf("unexpected progress on the channel: %+v", p)
+	}
+}
+
+func TestReportProgressFullChannel(t *testing.T) {
+	ch := make(chan Progress)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "migrate", Src: []string{"idle"}, Dst: "migrated"},
+		},
+		Callbacks{
+			"leave_idle": func(ctx context.Context, e *Event) {
+				e.ReportProgress(ctx, 50, "")
+			},
+		},
+		WithProgressChannel(ch),
+	)
+	if err := fsm.Event(context.Background(), "migrate"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
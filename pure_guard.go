@@ -0,0 +1,96 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// WithPureGuards makes the guards, unless conditions and validators read-only:
+// if the metadata or bound data is written while one of them runs, the event
+// is rejected with a GuardMutationError. This keeps Can, CanWith and
+// AvailableTransitions free of side effects.
+//
+// Writes are detected with a version of the metadata, so a write by another
+// goroutine during the evaluation of a guard is reported as well.
+func WithPureGuards() Option {
+	return func(f *FSM) {
+		f.pureGuards = true
+	}
+}
+
+// MetadataView returns a read-only view of the metadata of the FSM, to pass on
+// to helpers that must not write it.
+func (g GuardContext) MetadataView() MetadataView {
+	return readOnlyMetadata{g.fsm}
+}
+
+// readOnlyMetadata is a MetadataView that can not be converted back to the
+// FSM.
+type readOnlyMetadata struct {
+	fsm *FSM
+}
+
+func (m readOnlyMetadata) Metadata(key string) (interface{}, bool) {
+	if m.fsm == nil {
+		return nil, false
+	}
+	return m.fsm.Metadata(key)
+}
+
+// CanWith returns true if event can occur in the current state with args. Unlike
+// Can, the guards and the validator of the transition are evaluated with args,
+// as a dry run of Event that does not call any callback.
+func (f *FSM) CanWith(ctx context.Context, event string, args ...interface{}) bool {
+	if !f.initialized() {
+		return false
+	}
+	current := f.readState().State
+	f.stateMu.RLock()
+	if f.transition != nil || f.finalStates[current] || f.IsPaused() {
+		f.stateMu.RUnlock()
+		return false
+	}
+	_, rule, err := f.resolveTransition(ctx, event, current, args)
+	if err != nil {
+		f.stateMu.RUnlock()
+		return false
+	}
+	dst := f.targetOf(rule, current)
+	f.stateMu.RUnlock()
+	if rule.validator != nil {
+		return f.validate(ctx, event, current, dst, rule, args) == nil
+	}
+	return true
+}
+
+// guardVersion returns the version of the metadata if WithPureGuards is set.
+func (f *FSM) guardVersion() uint64 {
+	if !f.pureGuards {
+		return 0
+	}
+	f.metadataMu.RLock()
+	defer f.metadataMu.RUnlock()
+	return f.metadataVersion
+}
+
+// checkPure returns a GuardMutationError if WithPureGuards is set and the
+// metadata changed since version.
+func (f *FSM) checkPure(event, state string, version uint64) error {
+	if f.pureGuards && f.guardVersion() != version {
+		return GuardMutationError{event, state}
+	}
+	return nil
+}
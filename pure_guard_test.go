@@ -0,0 +1,121 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPureGuards(t *testing.T) {
+	var fsm *FSM
+	fsm = NewFSM(
+		"cart",
+		Events{
+			{Name: "pay", Src: []string{"cart"}, Dst: "paid", Guard: func(_ context.Context, g GuardContext) bool {
+				fsm.SetMetadata("checked", true)
+				return true
+			}},
+			{Name: "ship", Src: []string{"cart"}, Dst: "shipped", Validator: func(_ context.Context, g GuardContext) error {
+				fsm.DeleteMetadata("checked")
+				return nil
+			}},
+		},
+		Callbacks{},
+		WithPureGuards(),
+	)
+
+	if fsm.Can("pay") {
+		t.Error("expected impure guard not to allow the event")
+	}
+	var mutErr GuardMutationError
+	if err := fsm.Event(context.Background(), "pay"); !errors.As(err, &mutErr) || mutErr.Event != "pay" || mutErr.State != "cart" {
+		t.Errorf("expected 'GuardMutationError', got %v", err)
+	}
+	if err := fsm.Event(context.Background(), "ship"); !errors.As(err, &mutErr) || mutErr.Event != "ship" {
+		t.Errorf("expected 'GuardMutationError', got %v", err)
+	}
+	if fsm.Current() != "cart" {
+		t.Errorf("expected state to be 'cart', got %s", fsm.Current())
+	}
+}
+
+func TestPureGuardsReadOnly(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "pay", Src: []string{"cart"}, Dst: "paid", Guard: func(_ context.Context, g GuardContext) bool {
+				paid, _ := g.MetadataView().Metadata("paid")
+				return paid == true
+			}},
+		},
+		Callbacks{},
+		WithPureGuards(),
+	)
+
+	if fsm.Can("pay") {
+		t.Error("expected guard not to allow the event")
+	}
+	fsm.SetMetadata("paid", true)
+	if !fsm.Can("pay") {
+		t.Error("expected guard to allow the event")
+	}
+	if _, ok := (GuardContext{}).MetadataView().(*FSM); ok {
+		t.Error("expected view not to expose the FSM")
+	}
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestCanWith(t *testing.T) {
+	calls := 0
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{Name: "pay", Src: []string{"cart"}, Dst: "paid", Guard: func(_ context.Context, g GuardContext) bool {
+				amount, _ := g.IntArg(0)
+				return amount > 0
+			}, Validator: func(_ context.Context, g GuardContext) error {
+				if amount, _ := g.IntArg(0); amount > 100 {
+					return errors.New("too much")
+				}
+				return nil
+			}},
+		},
+		Callbacks{
+			"enter_paid": func(context.Context, *Event) {
+				calls++
+			},
+		},
+	)
+
+	if fsm.CanWith(context.Background(), "pay") {
+		t.Error("expected guard to reject the event without arguments")
+	}
+	if fsm.CanWith(context.Background(), "pay", 200) {
+		t.Error("expected validator to reject the event")
+	}
+	if !fsm.CanWith(context.Background(), "pay", 50) {
+		t.Error("expected event to be allowed")
+	}
+	if fsm.CanWith(context.Background(), "refund", 50) {
+		t.Error("expected unknown event not to be allowed")
+	}
+	if calls != 0 || fsm.Current() != "cart" {
+		t.Errorf("expected dry run, got %d calls in state %s", calls, fsm.Current())
+	}
+}
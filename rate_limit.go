@@ -0,0 +1,167 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// rateLimiter debounces or throttles an event.
+type rateLimiter struct {
+	// debounce is the wait set by WithDebounce.
+	debounce time.Duration
+	// throttle is the interval set by WithThrottle.
+	throttle time.Duration
+
+	// last is the time the last throttled event was accepted, if any.
+	last     time.Time
+	accepted bool
+	// suppressed is the number of events suppressed since the last one
+	// that was processed.
+	suppressed int
+
+	// pending is set while a debounced event waits for timer.
+	pending bool
+	// ctx and args are the context and arguments of the pending event.
+	ctx  context.Context
+	args []interface{}
+	// timer delivers the pending event.
+	timer Timer
+	// gen is incremented when timer is replaced.
+	gen uint64
+}
+
+// rateLimitKey is the context key of the event that passed its rate limiter.
+type rateLimitKey struct{}
+
+// rateLimited is an event that passed its rate limiter.
+type rateLimited struct {
+	event string
+	// suppressed is the number of events suppressed before it.
+	suppressed int
+}
+
+// WithDebounce coalesces rapid repeated calls of the named event: Event
+// returns a DebouncedError and the event is only processed once no call has
+// been made for wait on the clock of the FSM, with the context values and
+// arguments of the last call. Pending events are dropped when the FSM is
+// closed.
+//
+// The observers of the processed event are told how many calls were
+// coalesced into it with TransitionInfo.Suppressed. An event is either
+// debounced or throttled, the last option wins.
+func WithDebounce(event string, wait time.Duration) Option {
+	return func(f *FSM) {
+		f.setRateLimiter(event, &rateLimiter{debounce: wait})
+	}
+}
+
+// WithThrottle processes the named event at most once every interval on the
+// clock of the FSM. Event returns a ThrottledError for the calls in between,
+// which are dropped.
+//
+// The observers of the next processed event are told how many calls were
+// dropped before it with TransitionInfo.Suppressed. An event is either
+// debounced or throttled, the last option wins.
+func WithThrottle(event string, interval time.Duration) Option {
+	return func(f *FSM) {
+		f.setRateLimiter(event, &rateLimiter{throttle: interval})
+	}
+}
+
+// setRateLimiter sets the rate limiter of event.
+func (f *FSM) setRateLimiter(event string, l *rateLimiter) {
+	if f.rateLimiters == nil {
+		f.rateLimiters = make(map[string]*rateLimiter)
+	}
+	f.rateLimiters[event] = l
+}
+
+// rateLimit applies the rate limiter of event, if any. It returns the context
+// to process the event with, or an error if the event must not be processed
+// now.
+func (f *FSM) rateLimit(ctx context.Context, event string, args []interface{}) (context.Context, error) {
+	l, ok := f.rateLimiters[event]
+	if !ok {
+		return ctx, nil
+	}
+	if r, ok := ctx.Value(rateLimitKey{}).(rateLimited); ok && r.event == event {
+		return ctx, nil
+	}
+
+	f.rateMu.Lock()
+	defer f.rateMu.Unlock()
+	if l.debounce > 0 {
+		if l.pending {
+			l.suppressed++
+			l.timer.Stop()
+		}
+		l.pending = true
+		l.ctx, l.args = &uncancel{ctx}, args
+		l.gen++
+		gen := l.gen
+		l.timer = f.clock.AfterFunc(l.debounce, func() {
+			f.deliverDebounced(event, l, gen)
+		})
+		return nil, DebouncedError{event, l.debounce}
+	}
+
+	now := f.clock.Now()
+	if l.accepted && now.Sub(l.last) < l.throttle {
+		l.suppressed++
+		return nil, ThrottledError{event, l.throttle}
+	}
+	l.last, l.accepted = now, true
+	suppressed := l.suppressed
+	l.suppressed = 0
+	return context.WithValue(ctx, rateLimitKey{}, rateLimited{event, suppressed}), nil
+}
+
+// deliverDebounced processes the pending event of the debouncer l, unless it
+// was replaced since the timer of generation gen was started.
+func (f *FSM) deliverDebounced(event string, l *rateLimiter, gen uint64) {
+	f.rateMu.Lock()
+	if !l.pending || l.gen != gen {
+		f.rateMu.Unlock()
+		return
+	}
+	ctx := context.WithValue(l.ctx, rateLimitKey{}, rateLimited{event, l.suppressed})
+	args := l.args
+	l.pending, l.ctx, l.args, l.suppressed = false, nil, nil, 0
+	f.rateMu.Unlock()
+	_ = f.Event(ctx, event, args...)
+}
+
+// stopDebounced drops the pending debounced events.
+func (f *FSM) stopDebounced() {
+	f.rateMu.Lock()
+	defer f.rateMu.Unlock()
+	for _, l := range f.rateLimiters {
+		if l.pending {
+			l.timer.Stop()
+			l.pending, l.ctx, l.args, l.suppressed = false, nil, nil, 0
+		}
+	}
+}
+
+// suppressedEvents returns the number of events suppressed before the event
+// processed with ctx.
+func suppressedEvents(ctx context.Context, event string) int {
+	if r, ok := ctx.Value(rateLimitKey{}).(rateLimited); ok && r.event == event {
+		return r.suppressed
+	}
+	return 0
+}
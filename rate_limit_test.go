@@ -0,0 +1,142 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	clock := &manualClock{}
+	var updates []interface{}
+	var infos []TransitionInfo
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "update", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"after_update": func(_ context.Context, e *Event) {
+				updates = append(updates, e.Args...)
+			},
+		},
+		WithClock(clock),
+		WithDebounce("update", time.Second),
+	)
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+
+	for i := 1; i <= 3; i++ {
+		err := fsm.Event(context.Background(), "update", i)
+		if derr, ok := err.(DebouncedError); !ok || derr.Event != "update" || derr.Wait != time.Second {
+			t.Fatalf("expected 'DebouncedError', got %v", err)
+		}
+		clock.Advance(500 * time.Millisecond)
+	}
+	if len(updates) != 0 {
+		t.Fatalf("expected no update while events keep coming, got %v", updates)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if !reflect.DeepEqual(updates, []interface{}{3}) {
+		t.Fatalf("expected last update to be processed, got %v", updates)
+	}
+	if len(infos) != 1 || infos[0].Suppressed != 2 {
+		t.Errorf("expected 2 suppressed events to be observed, got %+v", infos)
+	}
+
+	_ = fsm.Event(context.Background(), "update", 4)
+	clock.Advance(time.Second)
+	if !reflect.DeepEqual(updates, []interface{}{3, 4}) {
+		t.Fatalf("expected single update to be processed, got %v", updates)
+	}
+	if infos[1].Suppressed != 0 {
+		t.Errorf("expected no suppressed events, got %d", infos[1].Suppressed)
+	}
+}
+
+func TestDebounceClose(t *testing.T) {
+	clock := &manualClock{}
+	var updates []interface{}
+	var infos []TransitionInfo
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "update", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"after_update": func(_ context.Context, e *Event) {
+				updates = append(updates, e.Args...)
+			},
+		},
+		WithClock(clock),
+		WithDebounce("update", time.Second),
+	)
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+	_ = fsm.Event(context.Background(), "update", 1)
+	fsm.Close()
+	clock.Advance(time.Second)
+	if len(updates) != 0 {
+		t.Errorf("expected pending event to be dropped, got %v", updates)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	clock := &manualClock{}
+	var updates []interface{}
+	var infos []TransitionInfo
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "update", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"after_update": func(_ context.Context, e *Event) {
+				updates = append(updates, e.Args...)
+			},
+		},
+		WithClock(clock),
+		WithThrottle("update", time.Second),
+	)
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+
+	if err := fsm.Event(context.Background(), "update", 1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for i := 2; i <= 4; i++ {
+		clock.Advance(300 * time.Millisecond)
+		err := fsm.Event(context.Background(), "update", i)
+		if terr, ok := err.(ThrottledError); !ok || terr.Interval != time.Second {
+			t.Fatalf("expected 'ThrottledError', got %v", err)
+		}
+	}
+	clock.Advance(100 * time.Millisecond)
+	if err := fsm.Event(context.Background(), "update", 5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(updates, []interface{}{1, 5}) {
+		t.Errorf("expected updates [1 5], got %v", updates)
+	}
+	if len(infos) != 2 || infos[0].Suppressed != 0 || infos[1].Suppressed != 3 {
+		t.Errorf("expected 3 suppressed events to be observed, got %+v", infos)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"sync/atomic"
+)
+
+// canVerdict tells whether the rules of an event in a source state allow the
+// event, without evaluating any guards.
+type canVerdict int
+
+const (
+	// canNever means that there are no rules.
+	canNever canVerdict = iota
+	// canGuarded means that all rules have guards that must be evaluated.
+	canGuarded
+	// canAlways means that at least one rule has no guard.
+	canAlways
+)
+
+// canVerdicts maps events and source states to their canVerdict. It is never
+// modified once stored.
+type canVerdicts map[eKey]canVerdict
+
+// verdict returns whether event can occur in state src, combining the rules
+// for src and for AnyState.
+func (v canVerdicts) verdict(event, src string) canVerdict {
+	verdict := v[eKey{event, src}]
+	if wildcard := v[eKey{event, AnyState}]; wildcard > verdict {
+		verdict = wildcard
+	}
+	return verdict
+}
+
+// storeView publishes whether a transition is pending for Can. Callers must
+// hold stateMu for writing.
+func (f *FSM) storeView() {
+	var inTransition int32
+	if f.transition != nil {
+		inTransition = 1
+	}
+	atomic.StoreInt32(&f.inTransition, inTransition)
+}
+
+// storeVerdicts precomputes the canVerdicts of the transitions for Can.
+// Callers must hold stateMu for writing.
+func (f *FSM) storeVerdicts() {
+	verdicts := make(canVerdicts, len(f.transitions))
+	for key, rules := range f.transitions {
+		for _, rule := range rules {
+			if rule.unconditional() {
+				verdicts[key] = canAlways
+				break
+			}
+			verdicts[key] = canGuarded
+		}
+	}
+	f.verdicts.Store(verdicts)
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCanVerdicts(t *testing.T) {
+	allow := true
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "kick", Src: []string{"closed"}, Dst: "open", Guard: func(context.Context, GuardContext) bool {
+				return allow
+			}},
+			{Name: "reset", Src: []string{AnyState}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+
+	if !fsm.Can("open") || !fsm.Can("reset") || !fsm.Can("kick") {
+		t.Error("expected open, reset and kick to be possible")
+	}
+	allow = false
+	if fsm.Can("kick") {
+		t.Error("expected guard to be evaluated")
+	}
+	if fsm.Can("close") {
+		t.Error("expected unknown event not to be possible")
+	}
+
+	if err := fsm.AddTransition(EventDesc{Name: "close", Src: []string{"closed"}, Dst: "closed"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !fsm.Can("close") {
+		t.Error("expected added transition to be possible")
+	}
+	if err := fsm.RemoveTransition("open", "closed"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Can("open") {
+		t.Error("expected removed transition not to be possible")
+	}
+
+	fsm.SetState("open")
+	if fsm.Can("close") || !fsm.Can("reset") {
+		t.Error("expected only reset to be possible after SetState")
+	}
+}
+
+func BenchmarkCan(b *testing.B) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fsm.Can("open")
+	}
+}
+
+func BenchmarkCurrent(b *testing.B) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = fsm.Current()
+	}
+}
+
+// BenchmarkCanWhileTransitioning measures Can on all CPUs while events
+// are processed in the background, which used to contend on the state lock.
+func BenchmarkCanWhileTransitioning(b *testing.B) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{},
+	)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_ = fsm.Event(context.Background(), "open")
+			_ = fsm.Event(context.Background(), "close")
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			fsm.Can("open")
+			fsm.Is("open")
+		}
+	})
+	b.StopTimer()
+	close(done)
+	<-stopped
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"runtime/debug"
+)
+
+// WithRecoverCallbacks recovers panics in callbacks and turns them into a
+// CallbackPanicError that is returned by Event, instead of unwinding through
+// the FSM.
+//
+// A panic in a before_ or leave_ callback cancels the transition, like calling
+// Event.Cancel with the error: the state is not changed and Event returns a
+// CanceledError wrapping the CallbackPanicError. A panic in an enter_ or after_
+// callback happens after the state has changed: the remaining callbacks are
+// still called and Event returns the CallbackPanicError, like an error stored
+// in Event.Err. In both cases the FSM is ready for the next event.
+func WithRecoverCallbacks() Option {
+	return func(f *FSM) {
+		f.recoverCallbacks = true
+	}
+}
+
+// call calls the callback fn bound to key, with a timeout and recovering panics
+// if enabled.
+func (f *FSM) call(ctx context.Context, e *Event, key cKey, fn Callback) {
+	if timeout := f.callbackTimeouts.forType(key.callbackType); timeout > 0 {
+		if f.deterministic {
+			fn = f.withClockCallbackTimeout(key, fn, timeout)
+		} else {
+			fn = withCallbackTimeout(key, fn, timeout)
+		}
+	}
+	if !f.recoverCallbacks {
+		fn(ctx, e)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			callbackFailed(e, key.callbackType, CallbackPanicError{key.String(), r, debug.Stack()})
+		}
+	}()
+	fn(ctx, e)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRecoverCallbacksBefore(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_event": func(_ context.Context, e *Event) {
+				panic("boom")
+			},
+		},
+		WithRecoverCallbacks(),
+	)
+
+	err := fsm.Event(context.Background(), "open")
+	if _, ok := err.(CanceledError); !ok {
+		t.Fatalf("expected CanceledError, got %v", err)
+	}
+	var panicErr CallbackPanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected CallbackPanicError, got %v", err)
+	}
+	if panicErr.Callback != "before_event" || panicErr.Value != "boom" {
+		t.Errorf("unexpected panic error %+v", panicErr)
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Error("expected stack trace")
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+	// The FSM must not be stuck in a transition.
+	if _, ok := fsm.Event(context.Background(), "open").(CanceledError); !ok {
+		t.Error("expected CanceledError again")
+	}
+}
+
+func TestRecoverCallbacksEnter(t *testing.T) {
+	afterCalled := false
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(_ context.Context, e *Event) {
+				panic(errors.New("boom"))
+			},
+			"after_open": func(_ context.Context, e *Event) {
+				afterCalled = true
+			},
+		},
+		WithRecoverCallbacks(),
+	)
+
+	err := fsm.Event(context.Background(), "open")
+	panicErr, ok := err.(CallbackPanicError)
+	if !ok {
+		t.Fatalf("expected CallbackPanicError, got %v", err)
+	}
+	if panicErr.Callback != "enter_open" {
+		t.Errorf("expected callback to be 'enter_open', got %s", panicErr.Callback)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+	if !afterCalled {
+		t.Error("expected after callback to be called")
+	}
+	if err := fsm.Event(context.Background(), "close"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestWithoutRecoverCallbacks(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"open": func(_ context.Context, e *Event) {
+				panic("boom")
+			},
+		},
+	)
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected panic to propagate, got %v", r)
+		}
+	}()
+	_ = fsm.Event(context.Background(), "open")
+}
+
+func TestCallbackKeyString(t *testing.T) {
+	tests := map[cKey]string{
+		{"open", callbackBeforeEvent}:  "before_open",
+		{"", callbackBeforeEvent}:      "before_event",
+		{"closed", callbackLeaveState}: "leave_closed",
+		{"", callbackLeaveState}:       "leave_state",
+		{"open", callbackEnterState}:   "enter_open",
+		{"", callbackEnterState}:       "enter_state",
+		{"open", callbackAfterEvent}:   "after_open",
+		{"", callbackAfterEvent}:       "after_event",
+	}
+	for key, wanted := range tests {
+		if key.String() != wanted {
+			t.Errorf("expected %s, got %s", wanted, key.String())
+		}
+	}
+}
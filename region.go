@@ -0,0 +1,104 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// Region is an orthogonal region of a composite state, see WithRegions.
+type Region struct {
+	FSM *FSM
+	// Final are the states in which the region is complete, see WithJoin.
+	Final []string
+}
+
+// WithRegions makes state a composite state containing orthogonal regions,
+// which are all active while the FSM is in state, each in its own state.
+//
+// Events are passed to every region, and handled by the FSM only if none of
+// the regions handled them, so a single event can change the state of several
+// regions. Otherwise the regions behave like the child of WithSubmachine, and
+// the initial state of each region is the current state of its FSM.
+func WithRegions(state string, exit SubmachineExit, regions ...Region) Option {
+	return func(f *FSM) {
+		if f.submachines == nil {
+			f.submachines = make(map[string][]*submachine)
+		}
+		for _, r := range regions {
+			f.submachines[state] = append(f.submachines[state], &submachine{
+				child:   r.FSM,
+				initial: r.FSM.Current(),
+				exit:    exit,
+				final:   r.Final,
+			})
+		}
+	}
+}
+
+// WithJoin triggers event on the FSM when an event handled by the regions of
+// the composite state leaves all of them in one of their final states, to
+// model their joint completion. The event usually leaves the composite state.
+// Without WithJoin, the FSM handles DoneEvent if it can, see
+// WithFinalStates.
+func WithJoin(state, event string) Option {
+	return func(f *FSM) {
+		if f.joins == nil {
+			f.joins = make(map[string]string)
+		}
+		f.joins[state] = event
+	}
+}
+
+// Regions returns the FSMs of the regions of a composite state, or of its
+// child for a state set with WithSubmachine.
+func (f *FSM) Regions(state string) []*FSM {
+	if !f.initialized() {
+		return nil
+	}
+	var regions []*FSM
+	for _, s := range f.submachines[state] {
+		regions = append(regions, s.child)
+	}
+	return regions
+}
+
+// complete returns true if the child is in one of the final states of the
+// region or has completed, see WithFinalStates.
+func (s *submachine) complete() bool {
+	current := s.child.liveState()
+	for _, state := range s.final {
+		if state == current {
+			return true
+		}
+	}
+	return s.child.finalStates[current]
+}
+
+// join triggers the join event of state if all its regions are complete. The
+// event is DoneEvent unless set with WithJoin, in which case the FSM does not
+// have to handle it.
+func (f *FSM) join(ctx context.Context, state string) error {
+	event, ok := f.joins[state]
+	if !ok {
+		event = DoneEvent
+	}
+	for _, s := range f.submachines[state] {
+		if !s.complete() {
+			return nil
+		}
+	}
+	return f.exitEvent(ctx, event, ok)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRegions(t *testing.T) {
+	payment := NewFSM(
+		"unpaid",
+		Events{
+			{Name: "advance", Src: []string{"unpaid"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	shipping := NewFSM(
+		"packing",
+		Events{
+			{Name: "advance", Src: []string{"packing"}, Dst: "packed"},
+			{Name: "advance", Src: []string{"packed"}, Dst: "shipped"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"new",
+		Events{
+			{Name: "start", Src: []string{"new"}, Dst: "processing"},
+			{Name: "done", Src: []string{"processing"}, Dst: "complete"},
+			{Name: "abort", Src: []string{"processing"}, Dst: "aborted"},
+		},
+		Callbacks{},
+		WithRegions("processing", ResetSubmachine,
+			Region{FSM: payment, Final: []string{"paid"}},
+			Region{FSM: shipping, Final: []string{"shipped"}},
+		),
+		WithJoin("processing", "done"),
+	)
+	ctx := context.Background()
+
+	if regions := fsm.Regions("processing"); !reflect.DeepEqual(regions, []*FSM{payment, shipping}) {
+		t.Errorf("expected regions in order, got %v", regions)
+	}
+	_ = fsm.Event(ctx, "start")
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"processing", "unpaid", "packing"}) {
+		t.Errorf("expected all regions to be active, got %v", states)
+	}
+
+	// Both regions handle the event.
+	if err := fsm.Event(ctx, "advance"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"processing", "paid", "packed"}) {
+		t.Errorf("expected both regions to change state, got %v", states)
+	}
+
+	// Only shipping handles the event, which completes both regions.
+	if err := fsm.Event(ctx, "advance"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"complete"}) {
+		t.Errorf("expected join to leave the composite state, got %v", states)
+	}
+	if payment.Current() != "unpaid" || shipping.Current() != "packing" {
+		t.Errorf("expected regions to be reset, got %s and %s", payment.Current(), shipping.Current())
+	}
+}
+
+func TestRegionsBubbling(t *testing.T) {
+	payment := NewFSM(
+		"unpaid",
+		Events{
+			{Name: "advance", Src: []string{"unpaid"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	shipping := NewFSM(
+		"packing",
+		Events{
+			{Name: "advance", Src: []string{"packing"}, Dst: "packed"},
+			{Name: "advance", Src: []string{"packed"}, Dst: "shipped"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"new",
+		Events{
+			{Name: "start", Src: []string{"new"}, Dst: "processing"},
+			{Name: "done", Src: []string{"processing"}, Dst: "complete"},
+			{Name: "abort", Src: []string{"processing"}, Dst: "aborted"},
+		},
+		Callbacks{},
+		WithRegions("processing", ResetSubmachine,
+			Region{FSM: payment, Final: []string{"paid"}},
+			Region{FSM: shipping, Final: []string{"shipped"}},
+		),
+		WithJoin("processing", "done"),
+	)
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "start")
+
+	if err := fsm.Event(ctx, "abort"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "aborted" {
+		t.Errorf("expected event unknown to the regions to bubble up, got %s", fsm.Current())
+	}
+	if _, ok := fsm.Event(ctx, "advance").(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError' outside of the composite state")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package render renders the visualizations of a FSM to images, like SVG for
+// dashboards, by running the Graphviz dot command or the Mermaid CLI mmdc.
+package render
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/looplab/fsm"
+)
+
+// Format is the format of a rendered image.
+type Format string
+
+const (
+	// SVG renders a Scalable Vector Graphics image.
+	SVG Format = "svg"
+	// PNG renders a Portable Network Graphics image.
+	PNG Format = "png"
+)
+
+// dotCommand and mermaidCommand are the commands used to render, replaced in
+// tests.
+var (
+	dotCommand     = "dot"
+	mermaidCommand = "mmdc"
+)
+
+// CommandNotFoundError is returned when the command needed to render is not
+// installed.
+type CommandNotFoundError struct {
+	Command string
+}
+
+func (e CommandNotFoundError) Error() string {
+	return "render: command " + e.Command + " not found in PATH"
+}
+
+// CommandError is returned when the command rendering the image fails.
+type CommandError struct {
+	Command string
+	Err     error
+	// Stderr is the error output of the command.
+	Stderr string
+}
+
+func (e CommandError) Error() string {
+	msg := "render: " + e.Command + " failed: " + e.Err.Error()
+	if e.Stderr != "" {
+		msg += ": " + strings.TrimSpace(e.Stderr)
+	}
+	return msg
+}
+
+func (e CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Graphviz renders the Graphviz visualization of f, see fsm.Visualize, with
+// the dot command.
+func Graphviz(ctx context.Context, f *fsm.FSM, format Format) ([]byte, error) {
+	return DOT(ctx, fsm.Visualize(f), format)
+}
+
+// DOT renders a graph in the DOT language, like the output of
+// fsm.VisualizeWithOptions, with the dot command.
+func DOT(ctx context.Context, src string, format Format) ([]byte, error) {
+	path, err := exec.LookPath(dotCommand)
+	if err != nil {
+		return nil, CommandNotFoundError{dotCommand}
+	}
+	cmd := exec.CommandContext(ctx, path, "-T"+string(format))
+	cmd.Stdin = strings.NewReader(src)
+	return run(cmd, dotCommand)
+}
+
+// Mermaid renders the Mermaid visualization of f of type diagram, see
+// fsm.VisualizeForMermaidWithGraphType, with the mmdc command of the Mermaid
+// CLI.
+func Mermaid(ctx context.Context, f *fsm.FSM, diagram fsm.MermaidDiagramType, format Format) ([]byte, error) {
+	src, err := fsm.VisualizeForMermaidWithGraphType(f, diagram)
+	if err != nil {
+		return nil, err
+	}
+	path, err := exec.LookPath(mermaidCommand)
+	if err != nil {
+		return nil, CommandNotFoundError{mermaidCommand}
+	}
+
+	// mmdc reads and writes files, and picks the format from the extension.
+	dir, err := ioutil.TempDir("", "fsm-render")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "diagram.mmd")
+	output := filepath.Join(dir, "diagram."+string(format))
+	if err := ioutil.WriteFile(input, []byte(src), 0o600); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, path, "-i", input, "-o", output)
+	if _, err := run(cmd, mermaidCommand); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(output)
+}
+
+// run runs cmd and returns its output.
+func run(cmd *exec.Cmd, command string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, CommandError{command, err, stderr.String()}
+	}
+	return stdout.Bytes(), nil
+}
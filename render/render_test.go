@@ -0,0 +1,132 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/looplab/fsm"
+)
+
+// fakeCommand replaces *command with a shell script running script for the
+// duration of the test.
+func fakeCommand(t *testing.T, command *string, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "fake")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	previous := *command
+	*command = path
+	t.Cleanup(func() { *command = previous })
+}
+
+func TestGraphviz(t *testing.T) {
+	fakeCommand(t, &dotCommand, `echo "$1"; cat`)
+	f := fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		fsm.Callbacks{},
+	)
+
+	out, err := Graphviz(context.Background(), f, SVG)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if wanted := "-Tsvg\n" + fsm.Visualize(f); string(out) != wanted {
+		t.Errorf("expected dot to render the visualization, got %q", out)
+	}
+}
+
+func TestGraphvizError(t *testing.T) {
+	fakeCommand(t, &dotCommand, `echo "syntax error" >&2; exit 1`)
+
+	_, err := DOT(context.Background(), "digraph {", PNG)
+	var cmdErr CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Stderr != "syntax error\n" {
+		t.Fatalf("expected 'CommandError', got %v", err)
+	}
+	if !strings.HasSuffix(err.Error(), "failed: exit status 1: syntax error") {
+		t.Errorf("unexpected error string %q", err.Error())
+	}
+}
+
+func TestCommandNotFound(t *testing.T) {
+	dotCommand, mermaidCommand = "fsm-render-missing-dot", "fsm-render-missing-mmdc"
+	defer func() { dotCommand, mermaidCommand = "dot", "mmdc" }()
+
+	_, err := Graphviz(context.Background(), fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		fsm.Callbacks{},
+	), SVG)
+	if e, ok := err.(CommandNotFoundError); !ok || e.Command != "fsm-render-missing-dot" {
+		t.Errorf("expected 'CommandNotFoundError', got %v", err)
+	}
+	_, err = Mermaid(context.Background(), fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		fsm.Callbacks{},
+	), fsm.StateDiagram, SVG)
+	if e, ok := err.(CommandNotFoundError); !ok || e.Command != "fsm-render-missing-mmdc" {
+		t.Errorf("expected 'CommandNotFoundError', got %v", err)
+	}
+	if err.Error() != "render: command fsm-render-missing-mmdc not found in PATH" {
+		t.Errorf("unexpected error string %q", err.Error())
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	fakeCommand(t, &mermaidCommand, `cp "$2" "$4"`)
+	f := fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		fsm.Callbacks{},
+	)
+
+	out, err := Mermaid(context.Background(), f, fsm.FlowChart, PNG)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	wanted, _ := fsm.VisualizeForMermaidWithGraphType(f, fsm.FlowChart)
+	if string(out) != wanted {
+		t.Errorf("expected mmdc to render the visualization, got %q", out)
+	}
+
+	if _, err := Mermaid(context.Background(), f, "unknown", PNG); err == nil {
+		t.Error("expected error for unknown diagram type")
+	}
+}
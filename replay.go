@@ -0,0 +1,59 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// replayKey is the context key that marks events as replayed.
+type replayKey struct{}
+
+// ReplayContext returns a copy of ctx that marks the events sent with it as
+// replayed, see SetReplay.
+func ReplayContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replayKey{}, true)
+}
+
+// IsReplay returns true if ctx has been marked with ReplayContext.
+func IsReplay(ctx context.Context) bool {
+	replay, _ := ctx.Value(replayKey{}).(bool)
+	return replay
+}
+
+// SetReplay turns the replay mode of the FSM on or off. In replay mode all
+// events are replayed, as are the events sent with a context from
+// ReplayContext outside of replay mode.
+//
+// Replaying historical events re-derives the state without repeating their
+// side effects: the declared effects of the transitions are not performed,
+// Event.Replay is set for the callbacks to skip their own side effects, and
+// observers see TransitionInfo.Replay.
+func (f *FSM) SetReplay(replay bool) {
+	if !f.initialized() {
+		return
+	}
+	var v int32
+	if replay {
+		v = 1
+	}
+	atomic.StoreInt32(&f.replay, v)
+}
+
+// isReplay returns true if an event sent with ctx is replayed.
+func (f *FSM) isReplay(ctx context.Context) bool {
+	return atomic.LoadInt32(&f.replay) == 1 || IsReplay(ctx)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReplayMode(t *testing.T) {
+	charged := 0
+	var replayed []bool
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card"}},
+			{Name: "refund", Src: []string{"paid"}, Dst: "pending"},
+		},
+		Callbacks{
+			"enter_state": func(_ context.Context, e *Event) {
+				replayed = append(replayed, e.Replay)
+			},
+		},
+		WithEffects(EffectRegistry{
+			"charge_card": func(context.Context, *Event) error {
+				charged++
+				return nil
+			},
+		}),
+	)
+	var infos []TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+
+	fsm.SetReplay(true)
+	for _, event := range []string{"pay", "refund", "pay"} {
+		if err := fsm.Event(context.Background(), event); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	fsm.SetReplay(false)
+
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+	if charged != 0 {
+		t.Errorf("expected no effects during replay, got %d", charged)
+	}
+	for i, r := range replayed {
+		if !r {
+			t.Errorf("expected callback %d to see a replayed event", i)
+		}
+	}
+	for i, info := range infos {
+		if !info.Replay {
+			t.Errorf("expected observer to see replayed transition %d", i)
+		}
+	}
+
+	if err := fsm.Event(context.Background(), "refund"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if charged != 1 {
+		t.Errorf("expected effect after replay, got %d", charged)
+	}
+	if replayed[len(replayed)-1] || infos[len(infos)-1].Replay {
+		t.Error("expected live event not to be replayed")
+	}
+}
+
+func TestReplayContext(t *testing.T) {
+	charged := 0
+	var replayed []bool
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid", Effects: []string{"charge_card"}},
+			{Name: "refund", Src: []string{"paid"}, Dst: "pending"},
+		},
+		Callbacks{
+			"enter_state": func(_ context.Context, e *Event) {
+				replayed = append(replayed, e.Replay)
+			},
+		},
+		WithEffects(EffectRegistry{
+			"charge_card": func(context.Context, *Event) error {
+				charged++
+				return nil
+			},
+		}),
+	)
+
+	ctx := ReplayContext(context.Background())
+	if !IsReplay(ctx) || IsReplay(context.Background()) {
+		t.Error("expected only the replay context to be marked")
+	}
+	if err := fsm.Event(ctx, "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if charged != 0 || len(replayed) != 1 || !replayed[0] {
+		t.Errorf("expected replayed event without effects, got %d effects and %v", charged, replayed)
+	}
+}
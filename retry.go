@@ -0,0 +1,132 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy decides how a failing event is retried, see WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the event is tried,
+	// including the first one.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It is multiplied by
+	// Multiplier before each further retry.
+	Backoff time.Duration
+
+	// Multiplier is the factor the delay grows by for each retry, 2 if
+	// not set.
+	Multiplier float64
+
+	// MaxBackoff is the maximum delay between retries, if set.
+	MaxBackoff time.Duration
+
+	// Retryable decides whether the error that a before_ or leave_
+	// callback canceled the transition with is worth retrying. If not set,
+	// every such error is.
+	Retryable func(error) bool
+
+	// Schedule makes the retries go through EventAfter instead of blocking
+	// the caller of Event, see RetryScheduledError.
+	Schedule bool
+}
+
+// delay returns the delay before the given attempt, starting at 2.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	d := float64(p.Backoff)
+	for i := 2; i < attempt && (p.MaxBackoff <= 0 || d < float64(p.MaxBackoff)); i++ {
+		d *= multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// retryable returns true if an attempt that failed with err can be retried.
+func (p RetryPolicy) retryable(err error) bool {
+	canceled, ok := err.(CanceledError)
+	if !ok || canceled.Err == nil {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(canceled.Err)
+}
+
+// retryAttemptKey is the context key of the attempt of a retried event.
+type retryAttemptKey struct{}
+
+// retryAttempt is the attempt number of a retried event.
+type retryAttempt struct {
+	event   string
+	attempt int
+}
+
+// RetryAttempt returns the attempt number of the event being processed with
+// ctx because of WithRetry, starting at 1, or 0 if the event is not retried.
+func RetryAttempt(ctx context.Context) int {
+	a, _ := ctx.Value(retryAttemptKey{}).(retryAttempt)
+	return a.attempt
+}
+
+// WithRetry retries the named event when a before_ or leave_ callback cancels
+// its transition with a retryable error, see RetryPolicy. Every attempt goes
+// through the callbacks and observers like any other event; use RetryAttempt
+// in them to know the attempt number. The middleware sees the event once.
+//
+// By default Event blocks between attempts, waiting on the clock of the FSM,
+// and returns the error of the last attempt. It stops retrying early if its
+// context is done.
+func WithRetry(event string, policy RetryPolicy) Option {
+	return func(f *FSM) {
+		if f.retryPolicies == nil {
+			f.retryPolicies = make(map[string]RetryPolicy)
+		}
+		f.retryPolicies[event] = policy
+	}
+}
+
+// retryEvent calls handler for the event until it succeeds or policy gives up.
+func (f *FSM) retryEvent(ctx context.Context, handler EventHandler, policy RetryPolicy, event string, args []interface{}) error {
+	attempt := 1
+	if a, ok := ctx.Value(retryAttemptKey{}).(retryAttempt); ok && a.event == event {
+		attempt = a.attempt
+	}
+	for {
+		err := handler(context.WithValue(ctx, retryAttemptKey{}, retryAttempt{event, attempt}), event, args...)
+		if attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return err
+		}
+		attempt++
+		delay := policy.delay(attempt)
+		if policy.Schedule || f.deterministic {
+			retryCtx := context.WithValue(&uncancel{ctx}, retryAttemptKey{}, retryAttempt{event, attempt})
+			return RetryScheduledError{event, attempt, err, f.eventAfter(retryCtx, delay, event, args)}
+		}
+		timer := f.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
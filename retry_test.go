@@ -0,0 +1,207 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var errBusy = errors.New("payment provider busy")
+
+func TestRetry(t *testing.T) {
+	var attempts []int
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+		WithErrCallbacks(CallbacksWithErr{
+			"before_pay": func(ctx context.Context, e *Event) error {
+				attempts = append(attempts, RetryAttempt(ctx))
+				if len(attempts) <= 2 {
+					return errBusy
+				}
+				return nil
+			},
+		}),
+		WithRetry("pay", RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}),
+	)
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("expected attempts [1 2 3], got %v", attempts)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var attempts []int
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+		WithErrCallbacks(CallbacksWithErr{
+			"before_pay": func(ctx context.Context, e *Event) error {
+				attempts = append(attempts, RetryAttempt(ctx))
+				if len(attempts) <= 5 {
+					return errBusy
+				}
+				return nil
+			},
+		}),
+		WithRetry("pay", RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}),
+	)
+	err := fsm.Event(context.Background(), "pay")
+	if cerr, ok := err.(CanceledError); !ok || cerr.Err != errBusy {
+		t.Fatalf("expected 'CanceledError' of last attempt, got %v", err)
+	}
+	if len(attempts) != 3 {
+		t.Errorf("expected 3 attempts, got %v", attempts)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	var attempts []int
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+		WithErrCallbacks(CallbacksWithErr{
+			"before_pay": func(ctx context.Context, e *Event) error {
+				attempts = append(attempts, RetryAttempt(ctx))
+				if len(attempts) <= 5 {
+					return errBusy
+				}
+				return nil
+			},
+		}),
+		WithRetry("pay", RetryPolicy{
+			MaxAttempts: 3,
+			Retryable:   func(err error) bool { return err != errBusy },
+		}),
+	)
+	if _, ok := fsm.Event(context.Background(), "pay").(CanceledError); !ok {
+		t.Fatal("expected 'CanceledError'")
+	}
+	if len(attempts) != 1 {
+		t.Errorf("expected 1 attempt, got %v", attempts)
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+	var attempts []int
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+		WithErrCallbacks(CallbacksWithErr{
+			"before_pay": func(ctx context.Context, e *Event) error {
+				attempts = append(attempts, RetryAttempt(ctx))
+				if len(attempts) <= 5 {
+					return errBusy
+				}
+				return nil
+			},
+		}),
+		WithRetry("pay", RetryPolicy{MaxAttempts: 3, Backoff: time.Minute}),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if cerr, ok := fsm.Event(ctx, "pay").(CanceledError); !ok || cerr.Err != errBusy {
+		t.Fatal("expected 'CanceledError' of last attempt")
+	}
+	if len(attempts) != 1 {
+		t.Errorf("expected 1 attempt, got %v", attempts)
+	}
+}
+
+func TestRetryScheduled(t *testing.T) {
+	clock := &manualClock{}
+	var attempts []int
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+		WithErrCallbacks(CallbacksWithErr{
+			"before_pay": func(ctx context.Context, e *Event) error {
+				attempts = append(attempts, RetryAttempt(ctx))
+				if len(attempts) <= 2 {
+					return errBusy
+				}
+				return nil
+			},
+		}),
+		WithClock(clock),
+		WithRetry("pay", RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Second,
+			Schedule:    true,
+		}),
+	)
+
+	err := fsm.Event(context.Background(), "pay")
+	var rerr RetryScheduledError
+	if !errors.As(err, &rerr) || rerr.Attempt != 2 || !errors.Is(err, errBusy) {
+		t.Fatalf("expected 'RetryScheduledError', got %v", err)
+	}
+	clock.Advance(time.Second)
+	<-rerr.Retry.Done()
+	if !errors.As(rerr.Retry.Err(), &rerr) || rerr.Attempt != 3 {
+		t.Fatalf("expected 'RetryScheduledError', got %v", rerr.Retry.Err())
+	}
+	clock.Advance(time.Second)
+	if fsm.Current() != "pending" {
+		t.Fatal("expected backoff to grow")
+	}
+	clock.Advance(time.Second)
+	<-rerr.Retry.Done()
+	if err := rerr.Retry.Err(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("expected attempts [1 2 3], got %v", attempts)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Second, Multiplier: 3, MaxBackoff: 20 * time.Second}
+	var delays []time.Duration
+	for attempt := 2; attempt <= 6; attempt++ {
+		delays = append(delays, policy.delay(attempt))
+	}
+	expected := []time.Duration{time.Second, 3 * time.Second, 9 * time.Second, 20 * time.Second, 20 * time.Second}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("expected delays %v, got %v", expected, delays)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// Run starts the goroutine owned by the FSM that processes the events sent
+// with Send, and blocks until it exits. Deferred events are retried by the
+// same goroutine after each event that changed the state.
+//
+// When ctx is done the FSM is stopped without processing the events that are
+// still queued, which fail with a StoppedError, and Run returns the error of
+// ctx. Run returns nil when the FSM is stopped with Stop or closed with Close.
+// Run can be called more than once, but all calls share the same goroutine.
+func (f *FSM) Run(ctx context.Context) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	f.startMailbox()
+	select {
+	case <-f.mailboxDone:
+		return nil
+	case <-ctx.Done():
+		f.stop(ctx)
+		<-f.mailboxDone
+		return ctx.Err()
+	}
+}
+
+// Stop gracefully stops the goroutine processing the events sent with Send.
+// New events are rejected with a StoppedError right away, while the events
+// that are already queued are still processed until ctx is done. The events
+// that are left after that fail with a StoppedError.
+//
+// Stop blocks until the goroutine has exited or ctx is done, in which case it
+// returns the error of ctx. Unlike Close it does not shut down the extensions.
+func (f *FSM) Stop(ctx context.Context) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	f.startMailbox()
+	f.stop(ctx)
+	select {
+	case <-f.mailboxDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop stops the FSM once, draining the queued events until ctx is done.
+func (f *FSM) stop(ctx context.Context) {
+	f.stopOnce.Do(func() {
+		f.stopCtx = ctx
+		close(f.stopping)
+	})
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunStop(t *testing.T) {
+	calls := 0
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+			{Name: "block", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"step": func(context.Context, *Event) {
+				calls++
+			},
+			"block": func(context.Context, *Event) {
+				close(entered)
+				<-release
+			},
+		},
+		WithMailbox(10),
+	)
+
+	done := make(chan error)
+	go func() {
+		done <- fsm.Run(context.Background())
+	}()
+
+	blocked := fsm.Send(context.Background(), "block")
+	<-entered
+	var results []<-chan error
+	for i := 0; i < 3; i++ {
+		results = append(results, fsm.Send(context.Background(), "step"))
+	}
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- fsm.Stop(context.Background())
+	}()
+	close(release)
+
+	if err := <-stopped; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := <-blocked; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("expected queued events to be processed, got %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	if _, ok := (<-fsm.Send(context.Background(), "step")).(StoppedError); !ok {
+		t.Error("expected 'StoppedError'")
+	}
+	if err := fsm.Run(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	calls := 0
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+			{Name: "block", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"step": func(context.Context, *Event) {
+				calls++
+			},
+			"block": func(context.Context, *Event) {
+				close(entered)
+				<-release
+			},
+		},
+		WithMailbox(10),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- fsm.Run(ctx)
+	}()
+
+	blocked := fsm.Send(context.Background(), "block")
+	<-entered
+	queued := fsm.Send(context.Background(), "step")
+
+	cancel()
+	<-fsm.stopping
+	close(release)
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if err := <-blocked; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, ok := (<-queued).(StoppedError); !ok {
+		t.Error("expected 'StoppedError'")
+	}
+	if calls != 0 {
+		t.Errorf("expected no calls, got %d", calls)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	calls := 0
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "step", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+			{Name: "block", Src: []string{"idle"}, Dst: "idle", Kind: KindInternal},
+		},
+		Callbacks{
+			"step": func(context.Context, *Event) {
+				calls++
+			},
+			"block": func(context.Context, *Event) {
+				close(entered)
+				<-release
+			},
+		},
+		WithMailbox(10),
+	)
+
+	blocked := fsm.Send(context.Background(), "block")
+	<-entered
+	queued := fsm.Send(context.Background(), "step")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fsm.Stop(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-blocked; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, ok := (<-queued).(StoppedError); !ok {
+		t.Error("expected 'StoppedError'")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"path"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SetStateCall is a call to SetState or SetStateWithReason that was not
+// allowed by the SetStatePolicy.
+type SetStateCall struct {
+	// State is the state that was set.
+	State string
+	// Src is the current state at the time of the call.
+	Src string
+	// Reason is the reason passed to SetStateWithReason, if any.
+	Reason string
+	// Caller is the fully qualified name of the calling function, like
+	// "github.com/acme/app/store.(*Store).Load".
+	Caller string
+	// Rejected is true if the state was left unchanged.
+	Rejected bool
+	// At is the time of the call, as shown by the clock of the FSM.
+	At time.Time
+}
+
+// SetStatePolicy restricts the calls to SetState and SetStateWithReason, which
+// bypass the transitions of the FSM and the invariants they maintain.
+type SetStatePolicy struct {
+	// Reasons are the reasons that SetStateWithReason is allowed to be
+	// called with, like "restore".
+	Reasons []string
+
+	// Callers are the patterns of the functions that are allowed to call
+	// SetState, with the syntax of path.Match, like
+	// "github.com/acme/app/store.*".
+	Callers []string
+
+	// Reject leaves the state unchanged when a call is not allowed.
+	// SetStateWithReason then returns a SetStateRejectedError.
+	Reject bool
+
+	// Report, if set, is called with every call that is not allowed.
+	Report func(SetStateCall)
+}
+
+// allows returns true if the reason or the caller is allowed by p.
+func (p *SetStatePolicy) allows(reason, caller string) bool {
+	if reason != "" {
+		for _, r := range p.Reasons {
+			if r == reason {
+				return true
+			}
+		}
+	}
+	for _, pattern := range p.Callers {
+		if ok, _ := path.Match(pattern, caller); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WithSetStatePolicy restricts the calls to SetState and SetStateWithReason to
+// the reasons and callers allowed by policy, to surface the state changes that
+// bypass the transitions. The calls that are not allowed are reported, and
+// rejected if policy.Reject is set.
+func WithSetStatePolicy(policy SetStatePolicy) Option {
+	return func(f *FSM) {
+		f.setStatePolicy = &policy
+	}
+}
+
+// SetStateWithReason moves to the given state like SetState, giving the
+// reason of the call to the policy set with WithSetStatePolicy. It returns a
+// SetStateRejectedError if the policy rejected the call.
+func (f *FSM) SetStateWithReason(state, reason string) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	return f.setStateWithReason(state, reason)
+}
+
+// checkSetState checks a call to SetState against the policy, and returns an
+// error if it was rejected.
+func (f *FSM) checkSetState(state, reason string) error {
+	caller := externalCaller()
+	p := f.setStatePolicy
+	if p.allows(reason, caller) {
+		return nil
+	}
+	if p.Report != nil {
+		p.Report(SetStateCall{
+			State:    state,
+			Src:      f.Current(),
+			Reason:   reason,
+			Caller:   caller,
+			Rejected: p.Reject,
+			At:       f.clock.Now(),
+		})
+	}
+	if p.Reject {
+		return SetStateRejectedError{State: state, Reason: reason, Caller: caller}
+	}
+	return nil
+}
+
+// packageDir is the directory of the source files of the package.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return path.Dir(file)
+}()
+
+// externalCaller returns the fully qualified name of the first function on
+// the call stack that is not in the package, or in its tests.
+func externalCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if path.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.Function
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"testing"
+)
+
+// restoreState is an allowed caller in TestSetStatePolicyCallers.
+func restoreState(f *FSM, state string) {
+	f.SetState(state)
+}
+
+func TestSetStatePolicyReport(t *testing.T) {
+	var calls []SetStateCall
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithSetStatePolicy(SetStatePolicy{
+			Reasons: []string{"restore"},
+			Report: func(call SetStateCall) {
+				calls = append(calls, call)
+			},
+		}),
+	)
+
+	fsm.SetState("open")
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be changed, got %s", fsm.Current())
+	}
+	if len(calls) != 1 {
+		t.Fatalf("expected one reported call, got %v", calls)
+	}
+	call := calls[0]
+	if call.State != "open" || call.Src != "closed" || call.Rejected {
+		t.Errorf("unexpected reported call %+v", call)
+	}
+	if call.Caller != "github.com/looplab/fsm.TestSetStatePolicyReport" {
+		t.Errorf("expected caller to be the test, got %s", call.Caller)
+	}
+
+	if err := fsm.SetStateWithReason("closed", "restore"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("expected allowed call not to be reported, got %v", calls)
+	}
+}
+
+func TestSetStatePolicyReject(t *testing.T) {
+	reported := 0
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithSetStatePolicy(SetStatePolicy{
+			Reasons: []string{"restore"},
+			Reject:  true,
+			Report: func(call SetStateCall) {
+				if !call.Rejected {
+					t.Error("expected call to be rejected")
+				}
+				reported++
+			},
+		}),
+	)
+
+	fsm.SetState("open")
+	err := fsm.SetStateWithReason("open", "repair")
+	if e, ok := err.(SetStateRejectedError); !ok || e.Reason != "repair" || e.State != "open" || e.Caller != "github.com/looplab/fsm.TestSetStatePolicyReject" {
+		t.Errorf("expected 'SetStateRejectedError', got %v", err)
+	}
+	if fsm.Current() != "closed" || reported != 2 {
+		t.Errorf("expected rejected calls to be reported, got %s and %d", fsm.Current(), reported)
+	}
+}
+
+func TestSetStatePolicyCallers(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithSetStatePolicy(SetStatePolicy{
+			Callers: []string{"github.com/looplab/fsm.restore*"},
+			Reject:  true,
+		}),
+	)
+
+	fsm.SetState("open")
+	if fsm.Current() != "closed" {
+		t.Error("expected call from the test to be rejected")
+	}
+	restoreState(fsm, "open")
+	if fsm.Current() != "open" {
+		t.Error("expected call from allowed caller to change the state")
+	}
+}
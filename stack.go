@@ -0,0 +1,48 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Stack returns the states pushed by KindPush transitions that have not been
+// popped yet by KindPop transitions, from the bottom to the top of the stack.
+func (f *FSM) Stack() []string {
+	if !f.initialized() {
+		return nil
+	}
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	return append([]string(nil), f.stack...)
+}
+
+// targetOf returns the destination state of rule when performed in state src,
+// before any choice. Callers must hold stateMu.
+func (f *FSM) targetOf(rule *transitionRule, src string) string {
+	if rule.kind == KindPop && len(f.stack) > 0 {
+		return f.stack[len(f.stack)-1]
+	}
+	return rule.target(src)
+}
+
+// updateStack pushes or pops the stack after a transition of kind from src.
+// Callers must hold stateMu.
+func (f *FSM) updateStack(kind TransitionKind, src string) {
+	switch kind {
+	case KindPush:
+		f.stack = append(f.stack, src)
+	case KindPop:
+		if len(f.stack) > 0 {
+			f.stack = f.stack[:len(f.stack)-1]
+		}
+	}
+}
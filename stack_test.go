@@ -0,0 +1,133 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStack(t *testing.T) {
+	fsm := NewFSM(
+		"home",
+		Events{
+			{Name: "browse", Src: []string{"home"}, Dst: "catalog"},
+			{Name: "login", Src: []string{"home", "catalog"}, Dst: "login", Kind: KindPush},
+			{Name: "help", Src: []string{AnyState}, Dst: "help", Kind: KindPush},
+			{Name: "back", Src: []string{"login", "help"}, Dst: "home", Kind: KindPop},
+		},
+		Callbacks{},
+	)
+	steps := []struct {
+		event string
+		state string
+		stack []string
+	}{
+		{"browse", "catalog", nil},
+		{"login", "login", []string{"catalog"}},
+		{"help", "help", []string{"catalog", "login"}},
+		{"back", "login", []string{"catalog"}},
+		{"back", "catalog", nil},
+		{"help", "help", []string{"catalog"}},
+		{"back", "catalog", nil},
+	}
+	for _, step := range steps {
+		if err := fsm.Event(context.Background(), step.event); err != nil {
+			t.Fatalf("expected no error for %s, got %v", step.event, err)
+		}
+		if fsm.Current() != step.state {
+			t.Errorf("expected state to be '%s' after %s, got %s", step.state, step.event, fsm.Current())
+		}
+		if stack := fsm.Stack(); len(stack) != len(step.stack) || (len(stack) > 0 && !reflect.DeepEqual(stack, step.stack)) {
+			t.Errorf("expected stack %v after %s, got %v", step.stack, step.event, stack)
+		}
+	}
+}
+
+func TestStackEmpty(t *testing.T) {
+	fsm := NewFSM(
+		"home",
+		Events{
+			{Name: "browse", Src: []string{"home"}, Dst: "catalog"},
+			{Name: "login", Src: []string{"home", "catalog"}, Dst: "login", Kind: KindPush},
+			{Name: "help", Src: []string{AnyState}, Dst: "help", Kind: KindPush},
+			{Name: "back", Src: []string{"login", "help"}, Dst: "home", Kind: KindPop},
+		},
+		Callbacks{},
+	)
+	fsm.SetState("help")
+
+	var dst string
+	_, _ = fsm.On("before_back", func(_ context.Context, e *Event) {
+		dst = e.Dst
+	})
+	if err := fsm.Event(context.Background(), "back"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "home" || dst != "home" {
+		t.Errorf("expected pop of empty stack to go to 'home', got %s", fsm.Current())
+	}
+}
+
+func TestStackCanceled(t *testing.T) {
+	fsm := NewFSM(
+		"home",
+		Events{
+			{Name: "browse", Src: []string{"home"}, Dst: "catalog"},
+			{Name: "login", Src: []string{"home", "catalog"}, Dst: "login", Kind: KindPush},
+			{Name: "help", Src: []string{AnyState}, Dst: "help", Kind: KindPush},
+			{Name: "back", Src: []string{"login", "help"}, Dst: "home", Kind: KindPop},
+		},
+		Callbacks{},
+	)
+	_, _ = fsm.On("before_help", func(_ context.Context, e *Event) {
+		e.Cancel()
+	})
+	if _, ok := fsm.Event(context.Background(), "help").(CanceledError); !ok {
+		t.Error("expected 'CanceledError'")
+	}
+	if len(fsm.Stack()) != 0 {
+		t.Errorf("expected canceled push to leave the stack empty, got %v", fsm.Stack())
+	}
+}
+
+func TestStackRollback(t *testing.T) {
+	fsm := NewFSM(
+		"home",
+		Events{
+			{Name: "browse", Src: []string{"home"}, Dst: "catalog"},
+			{Name: "login", Src: []string{"home", "catalog"}, Dst: "login", Kind: KindPush},
+			{Name: "help", Src: []string{AnyState}, Dst: "help", Kind: KindPush},
+			{Name: "back", Src: []string{"login", "help"}, Dst: "home", Kind: KindPop},
+		},
+		Callbacks{},
+	)
+	_ = fsm.Event(context.Background(), "login")
+
+	err := fsm.WithinTx(context.Background(), &fakeTx{}, func(ctx context.Context) error {
+		_ = fsm.Event(ctx, "help")
+		_ = fsm.Event(ctx, "back")
+		_ = fsm.Event(ctx, "back")
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if fsm.Current() != "login" || !reflect.DeepEqual(fsm.Stack(), []string{"home"}) {
+		t.Errorf("expected state 'login' and stack [home], got %s and %v", fsm.Current(), fsm.Stack())
+	}
+}
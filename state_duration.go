@@ -0,0 +1,59 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"time"
+)
+
+// DurationInState returns how long the FSM has been in the current state on
+// its clock, since the state was entered or, for the initial state, since the
+// FSM was created. The state changes before the enter callbacks are called,
+// so they see a duration close to zero.
+func (f *FSM) DurationInState() time.Duration {
+	if !f.initialized() {
+		return 0
+	}
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	return f.since(f.enteredAt)
+}
+
+// StateDurations returns the cumulative time the FSM has spent in each state,
+// including the time spent so far in the current state. It is useful for SLA
+// reporting.
+func (f *FSM) StateDurations() map[string]time.Duration {
+	if !f.initialized() {
+		return nil
+	}
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	durations := make(map[string]time.Duration, len(f.durations)+1)
+	for state, d := range f.durations {
+		durations[state] = d
+	}
+	durations[f.current] += f.since(f.enteredAt)
+	return durations
+}
+
+// leaveState adds the time spent in the current state until now to its
+// cumulative duration. Callers must hold stateMu for writing.
+func (f *FSM) leaveState(now time.Time) {
+	if f.durations == nil {
+		f.durations = make(map[string]time.Duration)
+	}
+	f.durations[f.current] += now.Sub(f.enteredAt)
+	f.enteredAt = now
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDurationInState(t *testing.T) {
+	clock := &manualClock{}
+	clock.Advance(time.Hour)
+	var inSrc time.Duration
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				inSrc = e.FSM.DurationInState()
+			},
+		},
+		WithClock(clock),
+	)
+	var infos []TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+
+	clock.Advance(10 * time.Minute)
+	if d := fsm.DurationInState(); d != 10*time.Minute {
+		t.Errorf("expected 10m in initial state, got %v", d)
+	}
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if inSrc != 10*time.Minute {
+		t.Errorf("expected callbacks to see 10m in state, got %v", inSrc)
+	}
+	if d := fsm.DurationInState(); d != 0 {
+		t.Errorf("expected 0 in new state, got %v", d)
+	}
+	clock.Advance(5 * time.Minute)
+	if err := fsm.Event(context.Background(), "close"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = fsm.Event(context.Background(), "close")
+	clock.Advance(time.Minute)
+
+	var inSrcs []time.Duration
+	for _, info := range infos {
+		inSrcs = append(inSrcs, info.SrcDuration)
+	}
+	if expected := []time.Duration{10 * time.Minute, 5 * time.Minute, 0}; !reflect.DeepEqual(inSrcs, expected) {
+		t.Errorf("expected observed durations %v, got %v", expected, inSrcs)
+	}
+	expected := map[string]time.Duration{"closed": 11 * time.Minute, "open": 5 * time.Minute}
+	if durations := fsm.StateDurations(); !reflect.DeepEqual(durations, expected) {
+		t.Errorf("expected durations %v, got %v", expected, durations)
+	}
+}
+
+func TestStateDurationsRollback(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{},
+		WithClock(clock),
+	)
+	clock.Advance(time.Minute)
+	err := fsm.EventBatch(context.Background(), []EventRequest{{Event: "open"}, {Event: "jump"}})
+	if _, ok := err.(BatchError); !ok {
+		t.Fatalf("expected 'BatchError', got %v", err)
+	}
+	clock.Advance(time.Minute)
+	expected := map[string]time.Duration{"closed": 2 * time.Minute}
+	if durations := fsm.StateDurations(); !reflect.DeepEqual(durations, expected) {
+		t.Errorf("expected durations %v, got %v", expected, durations)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// StateRecord is a consistent view of the state of a FSM.
+type StateRecord struct {
+	// State is the current state.
+	State string
+
+	// Version is incremented every time the state changes, including
+	// self-transitions that re-enter the state.
+	Version uint64
+
+	// EnteredAt is the time the state was entered. It is the zero time for
+	// the initial state.
+	EnteredAt time.Time
+}
+
+// State returns the current state record of the FSM. The record is replaced
+// atomically once a transition has completed its enter callbacks, so readers
+// never see a state whose enter callbacks are still running; until then they
+// see the previous state. The callbacks are the exception: they see the state
+// as seen by the processing of events, which already is the new state while
+// the enter callbacks are called. State does not block on running transitions.
+func (f *FSM) State() StateRecord {
+	if !f.initialized() {
+		return StateRecord{}
+	}
+	return *f.readState()
+}
+
+// readState returns the record of the current state as seen by the caller,
+// see State. Current, Is, Can, AvailableTransitions and the other readers all
+// take the state from it.
+func (f *FSM) readState() *StateRecord {
+	record := f.record.Load().(*StateRecord)
+	if live := f.live.Load().(*StateRecord); live != record && inCallback() {
+		return live
+	}
+	return record
+}
+
+// liveState returns the current state as seen by the processing of events.
+func (f *FSM) liveState() string {
+	return f.live.Load().(*StateRecord).State
+}
+
+// publishState makes the record of a state change visible to readers, unless
+// a newer state change has already been published. r must not be modified
+// afterwards.
+func (f *FSM) publishState(r *StateRecord) {
+	f.recordMu.Lock()
+	defer f.recordMu.Unlock()
+	if current, ok := f.record.Load().(*StateRecord); ok && current.Version >= r.Version {
+		return
+	}
+	f.record.Store(r)
+}
+
+// changeState sets the current state, fills r with its record and makes it
+// visible to the callbacks. r must be published with publishState once the
+// enter callbacks are called. Callers must hold stateMu for writing.
+func (f *FSM) changeState(r *StateRecord, state string, enteredAt time.Time) {
+	f.leaveState(enteredAt)
+	f.current = state
+	f.stateVersion++
+	*r = StateRecord{state, f.stateVersion, enteredAt}
+	f.live.Store(r)
+}
+
+// callbackFuncs are the functions that callbacks are called from.
+var callbackFuncs = map[string]bool{
+	fullFuncName((*FSM).runCallbacks): true,
+	fullFuncName(callTimed):           true,
+}
+
+// fullFuncName returns the fully qualified name of the function fn.
+func fullFuncName(fn interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+}
+
+// inCallback returns true if it is called from a callback of a FSM.
+func inCallback() bool {
+	var pcs [32]uintptr
+	for skip := 2; ; skip += len(pcs) {
+		n := runtime.Callers(skip, pcs[:])
+		frames := runtime.CallersFrames(pcs[:n])
+		for {
+			frame, more := frames.Next()
+			if callbackFuncs[frame.Function] {
+				return true
+			}
+			if !more {
+				break
+			}
+		}
+		if n < len(pcs) {
+			return false
+		}
+	}
+}
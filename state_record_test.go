@@ -0,0 +1,165 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStateRecord(t *testing.T) {
+	var duringEnter, duringAfter StateRecord
+	var currentDuringEnter string
+	var isOpenDuringEnter, canCloseDuringEnter bool
+	var availableDuringEnter []string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(_ context.Context, e *Event) {
+				duringEnter = e.FSM.State()
+				currentDuringEnter = e.FSM.Current()
+				isOpenDuringEnter = e.FSM.Is("open")
+				availableDuringEnter = e.FSM.AvailableTransitions()
+				canCloseDuringEnter = e.FSM.Can("close")
+			},
+			"after_open": func(_ context.Context, e *Event) {
+				duringAfter = e.FSM.State()
+			},
+		},
+	)
+
+	initial := fsm.State()
+	if initial.State != "closed" || initial.Version != 0 || !initial.EnteredAt.IsZero() {
+		t.Errorf("unexpected initial record %+v", initial)
+	}
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if duringEnter.State != "open" || duringEnter.Version != 1 || duringEnter.EnteredAt.IsZero() {
+		t.Errorf("expected new record during enter callbacks, got %+v", duringEnter)
+	}
+	if currentDuringEnter != "open" || !isOpenDuringEnter {
+		t.Errorf("expected state to be 'open' during enter callbacks, got %s", currentDuringEnter)
+	}
+	if !reflect.DeepEqual(availableDuringEnter, []string{"close"}) || !canCloseDuringEnter {
+		t.Errorf("expected transitions of the new state during enter callbacks, got %v", availableDuringEnter)
+	}
+	if duringAfter != duringEnter {
+		t.Errorf("expected record %+v during after callbacks, got %+v", duringEnter, duringAfter)
+	}
+	if fsm.State() != duringAfter {
+		t.Errorf("expected record %+v, got %+v", duringAfter, fsm.State())
+	}
+
+	fsm.SetState("closed")
+	if r := fsm.State(); r.State != "closed" || r.Version != 2 {
+		t.Errorf("unexpected record after SetState %+v", r)
+	}
+}
+
+func TestStateRecordNestedTransition(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(ctx context.Context, e *Event) {
+				if err := e.FSM.Event(ctx, "close"); err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			},
+		},
+	)
+
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// The outer transition completes last, but must not overwrite the state
+	// of the nested one.
+	if r := fsm.State(); r.State != "closed" || r.Version != 2 {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestStateRecordCallbackTimeout(t *testing.T) {
+	var current string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"enter_open": func(_ context.Context, e *Event) {
+				current = e.FSM.Current()
+			},
+		},
+		WithCallbackTimeouts(CallbackTimeouts{Enter: time.Minute}),
+	)
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if current != "open" {
+		t.Errorf("expected state to be 'open' during enter callbacks with a timeout, got %s", current)
+	}
+}
+
+func TestStateRecordConcurrentReaders(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(context.Context, *Event) {
+				close(entered)
+				<-release
+			},
+		},
+	)
+
+	done := make(chan error)
+	go func() {
+		done <- fsm.Event(context.Background(), "open")
+	}()
+	<-entered
+	if fsm.Current() != "closed" || !fsm.Is("closed") || fsm.State().State != "closed" {
+		t.Errorf("expected state to be 'closed' while entering, got %s", fsm.Current())
+	}
+	if !fsm.Can("open") || fsm.Can("close") {
+		t.Error("expected Can to report on the state 'closed' while entering")
+	}
+	if available := fsm.AvailableTransitions(); !reflect.DeepEqual(available, []string{"open"}) {
+		t.Errorf("expected transitions of the state 'closed' while entering, got %v", available)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
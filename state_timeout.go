@@ -0,0 +1,123 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// stateTimeout is a timeout set with WithStateTimeout.
+type stateTimeout struct {
+	after time.Duration
+	event string
+}
+
+// stateTimer is the running timer of a state timeout.
+type stateTimer struct {
+	timer    Timer
+	state    string
+	deadline time.Time
+}
+
+// WithStateTimeout triggers event when the FSM stays in state for longer than
+// after, for example "expire" after 30 minutes in "awaiting_payment".
+//
+// The timer starts when the state is entered, including when it is the
+// initial state, and is stopped when the state is left or the FSM is closed.
+// An external self-transition restarts it, an internal transition does not.
+// When the state is restored by WithinTx or EventBatch, the timer is restored
+// with the time that was remaining.
+//
+// The event is triggered from the goroutine of the clock with EventIf, so it
+// has no effect if the state has changed in the meantime. Its error is not
+// returned anywhere, use an Observer to see it.
+func WithStateTimeout(state string, after time.Duration, event string) Option {
+	return func(f *FSM) {
+		if f.stateTimeouts == nil {
+			f.stateTimeouts = make(map[string]stateTimeout)
+		}
+		f.stateTimeouts[state] = stateTimeout{after, event}
+	}
+}
+
+// enterStateTimeout starts the timer of the timeout of state, if any, and
+// stops the timer of the previous state.
+func (f *FSM) enterStateTimeout(state string) {
+	if len(f.stateTimeouts) == 0 {
+		return
+	}
+	f.armStateTimeout(state, f.stateTimeouts[state].after)
+}
+
+// armStateTimeout starts the timer of the timeout of state to fire after d,
+// and stops the timer of the previous state.
+func (f *FSM) armStateTimeout(state string, d time.Duration) {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	if f.stateTimer != nil {
+		f.stateTimer.timer.Stop()
+		f.stateTimer = nil
+	}
+	timeout, ok := f.stateTimeouts[state]
+	if !ok {
+		return
+	}
+	select {
+	case <-f.closed:
+		return
+	default:
+	}
+
+	t := &stateTimer{state: state, deadline: f.clock.Now().Add(d)}
+	t.timer = f.clock.AfterFunc(d, func() {
+		f.fireStateTimeout(t, timeout.event)
+	})
+	f.stateTimer = t
+}
+
+// fireStateTimeout triggers event if t is still the running timer.
+func (f *FSM) fireStateTimeout(t *stateTimer, event string) {
+	f.timerMu.Lock()
+	running := f.stateTimer == t
+	if running {
+		f.stateTimer = nil
+	}
+	f.timerMu.Unlock()
+	if running {
+		_ = f.EventIf(context.Background(), t.state, event)
+	}
+}
+
+// remainingStateTimeout returns the time left before the running timer
+// fires, and false if no timer is running.
+func (f *FSM) remainingStateTimeout() (time.Duration, bool) {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	if f.stateTimer == nil {
+		return 0, false
+	}
+	return f.stateTimer.deadline.Sub(f.clock.Now()), true
+}
+
+// stopStateTimeout stops the running timer, if any.
+func (f *FSM) stopStateTimeout() {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	if f.stateTimer != nil {
+		f.stateTimer.timer.Stop()
+		f.stateTimer = nil
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateTimeout(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"awaiting_payment",
+		Events{
+			{Name: "pay", Src: []string{"awaiting_payment"}, Dst: "paid"},
+			{Name: "expire", Src: []string{"awaiting_payment"}, Dst: "expired"},
+			{Name: "retry", Src: []string{"expired", "paid"}, Dst: "awaiting_payment"},
+			{Name: "remind", Src: []string{"awaiting_payment"}, Dst: "awaiting_payment", Kind: KindInternal},
+			{Name: "fail", Src: []string{"awaiting_payment"}, Dst: "paid"},
+		},
+		Callbacks{
+			"before_fail": func(_ context.Context, e *Event) {
+				e.Cancel(errors.New("failed"))
+			},
+		},
+		WithClock(clock),
+		WithStateTimeout("awaiting_payment", 30*time.Minute, "expire"),
+	)
+
+	clock.Advance(20 * time.Minute)
+	if err := fsm.Event(context.Background(), "remind"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+	if fsm.Current() != "expired" {
+		t.Fatalf("expected state to be 'expired', got %s", fsm.Current())
+	}
+
+	if err := fsm.Event(context.Background(), "retry"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(20 * time.Minute)
+	if err := fsm.Event(context.Background(), "pay"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(time.Hour)
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', got %s", fsm.Current())
+	}
+}
+
+func TestStateTimeoutRollback(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"awaiting_payment",
+		Events{
+			{Name: "pay", Src: []string{"awaiting_payment"}, Dst: "paid"},
+			{Name: "expire", Src: []string{"awaiting_payment"}, Dst: "expired"},
+			{Name: "retry", Src: []string{"expired", "paid"}, Dst: "awaiting_payment"},
+			{Name: "remind", Src: []string{"awaiting_payment"}, Dst: "awaiting_payment", Kind: KindInternal},
+			{Name: "fail", Src: []string{"awaiting_payment"}, Dst: "paid"},
+		},
+		Callbacks{
+			"before_fail": func(_ context.Context, e *Event) {
+				e.Cancel(errors.New("failed"))
+			},
+		},
+		WithClock(clock),
+		WithStateTimeout("awaiting_payment", 30*time.Minute, "expire"),
+	)
+
+	clock.Advance(20 * time.Minute)
+	err := fsm.EventBatch(context.Background(), []EventRequest{{Event: "pay"}, {Event: "retry"}, {Event: "fail"}})
+	if err == nil {
+		t.Fatal("expected batch to fail")
+	}
+	if fsm.Current() != "awaiting_payment" {
+		t.Fatalf("expected state to be 'awaiting_payment', got %s", fsm.Current())
+	}
+	clock.Advance(9 * time.Minute)
+	if fsm.Current() != "awaiting_payment" {
+		t.Fatalf("expected state to be 'awaiting_payment', got %s", fsm.Current())
+	}
+	clock.Advance(time.Minute)
+	if fsm.Current() != "expired" {
+		t.Errorf("expected the remaining time to be restored, got state %s", fsm.Current())
+	}
+}
+
+func TestStateTimeoutClose(t *testing.T) {
+	clock := &manualClock{}
+	fsm := NewFSM(
+		"awaiting_payment",
+		Events{
+			{Name: "pay", Src: []string{"awaiting_payment"}, Dst: "paid"},
+			{Name: "expire", Src: []string{"awaiting_payment"}, Dst: "expired"},
+			{Name: "retry", Src: []string{"expired", "paid"}, Dst: "awaiting_payment"},
+			{Name: "remind", Src: []string{"awaiting_payment"}, Dst: "awaiting_payment", Kind: KindInternal},
+			{Name: "fail", Src: []string{"awaiting_payment"}, Dst: "paid"},
+		},
+		Callbacks{
+			"before_fail": func(_ context.Context, e *Event) {
+				e.Cancel(errors.New("failed"))
+			},
+		},
+		WithClock(clock),
+		WithStateTimeout("awaiting_payment", 30*time.Minute, "expire"),
+	)
+	fsm.Close()
+	clock.Advance(time.Hour)
+	if fsm.Current() != "awaiting_payment" {
+		t.Errorf("expected state to be 'awaiting_payment', got %s", fsm.Current())
+	}
+}
+
+func TestStateTimeoutChainedFromCallback(t *testing.T) {
+	clock := &manualClock{}
+	var chained error
+	fsm := NewFSM(
+		"awaiting_payment",
+		Events{
+			{Name: "expire", Src: []string{"awaiting_payment"}, Dst: "expired"},
+			{Name: "archive", Src: []string{"expired"}, Dst: "archived"},
+		},
+		Callbacks{
+			"enter_expired": func(ctx context.Context, e *Event) {
+				chained = e.FSM.Event(ctx, "archive")
+			},
+		},
+		WithClock(clock),
+		WithStateTimeout("awaiting_payment", 30*time.Minute, "expire"),
+	)
+
+	clock.Advance(30 * time.Minute)
+	if chained != nil {
+		t.Errorf("expected chained event to succeed, got %v", chained)
+	}
+	if fsm.Current() != "archived" {
+		t.Errorf("expected state to be 'archived', got %s", fsm.Current())
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Stats are the counts of the events handled by a FSM since it was created,
+// to report the health of a machine without an external metrics stack.
+type Stats struct {
+	// Attempted is the number of events that were handled, including the
+	// retries of WithRetry.
+	Attempted uint64
+
+	// Succeeded is the number of events that completed a transition, including
+	// transitions that did not change the state and those whose callbacks set
+	// an error after the state changed.
+	Succeeded uint64
+
+	// Rejected is the number of events that failed without completing a
+	// transition, by the type of the error as formatted by %T, like
+	// "fsm.GuardFailedError" or "*errors.errorString". Canceled and
+	// asynchronous events are not counted.
+	Rejected map[string]uint64
+
+	// Canceled is the number of events canceled by a callback, including the
+	// asynchronous transitions rolled back by EventBatch or WithinTx.
+	Canceled uint64
+
+	// AsyncStarted is the number of asynchronous transitions that were
+	// started with Event.Async.
+	AsyncStarted uint64
+
+	// AsyncCompleted is the number of asynchronous transitions that were
+	// completed with Transition.
+	AsyncCompleted uint64
+
+	// LastError is the last error returned for an event, if any.
+	LastError error
+
+	// LastErrorAt is the time LastError was returned.
+	LastErrorAt time.Time
+}
+
+// stats holds the Stats of a FSM.
+type stats struct {
+	mu sync.Mutex
+	Stats
+}
+
+// Stats returns the counts of the events handled by the FSM.
+func (f *FSM) Stats() Stats {
+	if !f.initialized() {
+		return Stats{}
+	}
+	f.stats.mu.Lock()
+	defer f.stats.mu.Unlock()
+	s := f.stats.Stats
+	s.Rejected = make(map[string]uint64, len(f.stats.Rejected))
+	for name, n := range f.stats.Rejected {
+		s.Rejected[name] = n
+	}
+	return s
+}
+
+// countEvent records the outcome of an event in the Stats, where e is nil if
+// the event was rejected before any callbacks were called.
+func (f *FSM) countEvent(e *Event, err error) {
+	f.stats.mu.Lock()
+	defer f.stats.mu.Unlock()
+	f.stats.Attempted++
+	if _, ok := err.(AsyncError); ok {
+		f.stats.AsyncStarted++
+		return
+	}
+	if err == nil || e != nil && e.completed {
+		f.stats.Succeeded++
+		if noTransition, ok := err.(NoTransitionError); err == nil || ok && noTransition.Err == nil {
+			return
+		}
+	} else if _, ok := err.(CanceledError); ok {
+		f.stats.Canceled++
+	} else {
+		if f.stats.Rejected == nil {
+			f.stats.Rejected = make(map[string]uint64)
+		}
+		f.stats.Rejected[fmt.Sprintf("%T", err)]++
+	}
+	f.stats.LastError = err
+	f.stats.LastErrorAt = f.clock.Now()
+}
+
+// countAsyncCompleted records the completion of an asynchronous transition
+// in the Stats.
+func (f *FSM) countAsyncCompleted(err error) {
+	f.stats.mu.Lock()
+	defer f.stats.mu.Unlock()
+	if err == nil {
+		f.stats.AsyncCompleted++
+		return
+	}
+	f.stats.LastError = err
+	f.stats.LastErrorAt = f.clock.Now()
+}
+
+// countAsyncRolledBack records that an asynchronous transition was rolled back
+// by EventBatch or WithinTx, so that it is counted as canceled instead.
+func (f *FSM) countAsyncRolledBack() {
+	f.stats.mu.Lock()
+	defer f.stats.mu.Unlock()
+	f.stats.AsyncStarted--
+	f.stats.Canceled++
+}
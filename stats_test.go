@@ -0,0 +1,134 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	cancel := true
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "running"},
+			{Name: "stop", Src: []string{"running"}, Dst: "start"},
+			{Name: "pause", Src: []string{"running"}, Dst: "paused"},
+		},
+		Callbacks{
+			"before_stop": func(_ context.Context, e *Event) {
+				if cancel {
+					e.Cancel(errors.New("busy"))
+				}
+			},
+			"leave_running": func(_ context.Context, e *Event) {
+				if e.Event == "pause" {
+					e.Async()
+				}
+			},
+		},
+	)
+
+	_ = fsm.Event(context.Background(), "run")
+	_ = fsm.Event(context.Background(), "run")
+	_ = fsm.Event(context.Background(), "jump")
+	err := fsm.Event(context.Background(), "stop")
+	cancel = false
+	_ = fsm.Event(context.Background(), "stop")
+	_ = fsm.Event(context.Background(), "run")
+	_ = fsm.Event(context.Background(), "pause")
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	s := fsm.Stats()
+	if s.Attempted != 7 || s.Succeeded != 3 || s.Canceled != 1 || s.AsyncStarted != 1 || s.AsyncCompleted != 1 {
+		t.Errorf("unexpected counts %+v", s)
+	}
+	expected := map[string]uint64{"fsm.InvalidEventError": 1, "fsm.UnknownEventError": 1}
+	if !reflect.DeepEqual(s.Rejected, expected) {
+		t.Errorf("expected rejected %v, got %v", expected, s.Rejected)
+	}
+	if s.LastError != err || s.LastErrorAt.IsZero() {
+		t.Errorf("expected last error %v, got %v at %v", err, s.LastError, s.LastErrorAt)
+	}
+
+	s.Rejected["fsm.InvalidEventError"] = 10
+	if fsm.Stats().Rejected["fsm.InvalidEventError"] != 1 {
+		t.Error("expected stats to be a copy")
+	}
+}
+
+func TestStatsClassification(t *testing.T) {
+	errEnter := errors.New("enter failed")
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "running"},
+			{Name: "stay", Src: []string{"running"}, Dst: "running"},
+			{Name: "fail", Src: []string{"running"}, Dst: "failed"},
+			{Name: "check", Src: []string{"running"}, Dst: "checked"},
+		},
+		Callbacks{
+			"enter_failed": func(_ context.Context, e *Event) {
+				e.Err = errEnter
+			},
+			"before_check": func(_ context.Context, e *Event) {
+				e.Cancel(errors.New("busy"))
+			},
+		},
+	)
+
+	_ = fsm.Event(context.Background(), "run")
+	_ = fsm.Event(context.Background(), "stay")
+	_ = fsm.Event(context.Background(), "check")
+	err := fsm.Event(context.Background(), "fail")
+	if err != errEnter || fsm.Current() != "failed" {
+		t.Fatalf("expected the transition to fail after entering, got %v in %s", err, fsm.Current())
+	}
+
+	s := fsm.Stats()
+	if s.Attempted != 4 || s.Succeeded != 3 || s.Canceled != 1 || len(s.Rejected) != 0 {
+		t.Errorf("unexpected counts %+v", s)
+	}
+	if s.LastError != errEnter {
+		t.Errorf("expected last error %v, got %v", errEnter, s.LastError)
+	}
+}
+
+func TestStatsRejectedByType(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{Name: "run", Src: []string{"start"}, Dst: "running"},
+		},
+		Callbacks{},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fsm.Event(ctx, "run"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	_ = fsm.Event(context.Background(), "fly")
+
+	expected := map[string]uint64{"*errors.errorString": 1, "fsm.UnknownEventError": 1}
+	if s := fsm.Stats(); !reflect.DeepEqual(s.Rejected, expected) {
+		t.Errorf("expected rejected %v, got %v", expected, s.Rejected)
+	}
+}
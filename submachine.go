@@ -0,0 +1,248 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+)
+
+// SubmachineExit is what happens to the child FSM of a composite state when
+// the composite state is left.
+type SubmachineExit int
+
+const (
+	// ResetSubmachine sets the child back to its initial state.
+	ResetSubmachine SubmachineExit = iota
+	// SuspendSubmachine pauses the child in its current state, see Pause,
+	// so that it can still be inspected but does not process events.
+	SuspendSubmachine
+)
+
+// History is what a composite state resumes its child FSM at when it is
+// entered again.
+type History int
+
+const (
+	// NoHistory starts the child at its initial state.
+	NoHistory History = iota
+	// ShallowHistory resumes the child at the state it was in when the
+	// composite state was last left. Its own submachines are entered as
+	// usual.
+	ShallowHistory
+	// DeepHistory resumes the child and all its submachines at the states
+	// they were in when the composite state was last left.
+	DeepHistory
+)
+
+// submachine is the child FSM of a composite state, or one of its regions.
+type submachine struct {
+	child *FSM
+	// initial is the state of child when it was added.
+	initial string
+	exit    SubmachineExit
+	history History
+	// final are the states in which the region is complete, see WithJoin.
+	final []string
+
+	// last is the state of child when the composite state was last left,
+	// guarded by stateMu of the parent.
+	last string
+}
+
+// enteredState is a state entered by a submachine, whose enter callbacks are
+// called once the transition that entered its composite state has called its
+// own.
+type enteredState struct {
+	fsm *FSM
+	src string
+	dst string
+}
+
+// enter starts the child at state, or if state is empty at its initial
+// state or as set by its history. If deep is true the child and its
+// submachines are resumed at their last state as with DeepHistory. It returns
+// the states entered by the child and its submachines, depth first.
+func (s *submachine) enter(state string, deep bool) []enteredState {
+	if state == "" {
+		state = s.initial
+		if (deep || s.history != NoHistory) && s.last != "" {
+			state = s.last
+		}
+		deep = deep || s.history == DeepHistory
+	} else {
+		deep = false
+	}
+	entered := s.child.enterState(state, deep)
+	s.child.Resume()
+	return entered
+}
+
+// leave records the state of the child and resets or suspends it.
+func (s *submachine) leave() {
+	s.last = s.child.liveState()
+	switch s.exit {
+	case ResetSubmachine:
+		s.child.exitState(s.initial)
+	case SuspendSubmachine:
+		s.child.exitState("")
+		s.child.Pause()
+	}
+}
+
+// WithSubmachine makes state a composite state containing the child FSM,
+// whose initial state is its current state.
+//
+// While the FSM is in state, events are passed to the child first, and only
+// handled by the FSM if the child does not know them, they are inappropriate
+// in its current state, or the child refused them because a guard failed or
+// a callback canceled the transition. The error of the refusal is returned if
+// the FSM cannot handle the event either. As the child can have submachines
+// itself, events are handled by the deepest active FSM that can handle them.
+// Entering state from another state starts the child at its initial state,
+// or as set by WithHistory, and leaving it resets or suspends the child as
+// set by exit. When a transition enters state, the enter callbacks of the
+// state the child starts at are called after those of the FSM, and before
+// those of the submachines of the child; SetState calls none of them.
+func WithSubmachine(state string, child *FSM, exit SubmachineExit) Option {
+	return WithRegions(state, exit, Region{FSM: child})
+}
+
+// WithHistory makes the composite state resume its child FSMs as set by
+// history when it is entered again, instead of starting them at their
+// initial state. It must be given after the WithSubmachine or WithRegions of
+// the state.
+func WithHistory(state string, history History) Option {
+	return func(f *FSM) {
+		for _, s := range f.submachines[state] {
+			s.history = history
+		}
+	}
+}
+
+// Submachine returns the child FSM of a composite state, or nil if the state
+// has none. For a state with regions, it returns the first region.
+func (f *FSM) Submachine(state string) *FSM {
+	if !f.initialized() {
+		return nil
+	}
+	if subs := f.submachines[state]; len(subs) > 0 {
+		return subs[0].child
+	}
+	return nil
+}
+
+// ActiveStates returns the current state of the FSM followed by the active
+// states of its submachines, depth first and in the order of the regions.
+func (f *FSM) ActiveStates() []string {
+	if !f.initialized() {
+		return nil
+	}
+	current := f.Current()
+	states := []string{current}
+	for _, s := range f.submachines[current] {
+		states = append(states, s.child.ActiveStates()...)
+	}
+	return states
+}
+
+// submachineEvent passes the event to the children of the current state, and
+// returns false if there are none or if the event has to bubble up to f. A
+// child only handles the event if it has a transition for it that it did not
+// refuse because of a guard or a cancellation; the error of the first refusal
+// is returned with false then. Every region gets the event; the error is the
+// first one of the regions that handled it.
+func (f *FSM) submachineEvent(ctx context.Context, event string, args []interface{}) (bool, error) {
+	current := f.liveState()
+	handled := false
+	var err, refused error
+	for _, s := range f.submachines[current] {
+		switch e := s.child.processEvent(ctx, event, args); e.(type) {
+		case UnknownEventError, InvalidEventError, MachineCompletedError:
+		case GuardFailedError, CanceledError:
+			if refused == nil {
+				refused = e
+			}
+		default:
+			if !handled {
+				handled, err = true, e
+			}
+		}
+	}
+	if !handled {
+		return false, refused
+	}
+	if err == nil {
+		err = f.exit(ctx, current)
+	}
+	return true, err
+}
+
+// switchSubmachines leaves the children of src and enters the children of
+// dst, at the entry point entry if it is not empty. It returns the states
+// entered by the children, see enterSubmachineCallbacks. Callers must hold
+// stateMu for writing.
+func (f *FSM) switchSubmachines(src, dst, entry string) []enteredState {
+	for _, s := range f.submachines[src] {
+		s.leave()
+	}
+	var entered []enteredState
+	states := f.entryPoints[dst][entry]
+	for i, s := range f.submachines[dst] {
+		if i < len(states) {
+			entered = append(entered, s.enter(states[i], false)...)
+		} else {
+			entered = append(entered, s.enter("", false)...)
+		}
+	}
+	return entered
+}
+
+// enterSubmachineCallbacks calls the enter callbacks of the states entered by
+// the submachines when the transition of e entered their composite state.
+// Each submachine is passed its own Event for the event of e.
+func (f *FSM) enterSubmachineCallbacks(ctx context.Context, e *Event, entered []enteredState) {
+	for _, s := range entered {
+		s.fsm.enterStateCallbacks(ctx, &Event{FSM: s.fsm, Event: e.Event, Src: s.src, Dst: s.dst, Args: e.Args, Replay: e.Replay})
+	}
+}
+
+// enterState sets the state of the FSM, which must have been left with
+// exitState, and enters its submachines. It returns the entered states, its
+// own first.
+func (f *FSM) enterState(state string, deep bool) []enteredState {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	entered := []enteredState{{f, f.current, state}}
+	if state != f.current {
+		f.setState(state)
+	}
+	for _, s := range f.submachines[state] {
+		entered = append(entered, s.enter("", deep)...)
+	}
+	return entered
+}
+
+// exitState leaves the submachines of the current state and, unless reset is
+// empty, sets the state to reset without entering it.
+func (f *FSM) exitState(reset string) {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+	for _, s := range f.submachines[f.current] {
+		s.leave()
+	}
+	if reset != "" && reset != f.current {
+		f.setState(reset)
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSubmachine(t *testing.T) {
+	child := NewFSM(
+		"loading",
+		Events{
+			{Name: "loaded", Src: []string{"loading"}, Dst: "ready"},
+			{Name: "fail", Src: []string{"loading"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: "stop", Src: []string{"running"}, Dst: "idle"},
+			{Name: "fail", Src: []string{"running"}, Dst: "broken"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, ResetSubmachine),
+	)
+	ctx := context.Background()
+
+	if _, ok := fsm.Event(ctx, "loaded").(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError' while the composite state is not active")
+	}
+	if err := fsm.Event(ctx, "start"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Submachine("running") != child || fsm.Submachine("idle") != nil {
+		t.Error("expected child only for the composite state")
+	}
+	if err := fsm.Event(ctx, "loaded"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"running", "ready"}) {
+		t.Errorf("expected active states [running ready], got %v", states)
+	}
+
+	if err := fsm.Event(ctx, "stop"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if child.Current() != "loading" {
+		t.Errorf("expected child to be reset, got %s", child.Current())
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"idle"}) {
+		t.Errorf("expected active states [idle], got %v", states)
+	}
+}
+
+func TestSubmachineEnterCallbacks(t *testing.T) {
+	var entered []string
+	grandchild := NewFSM(
+		"a",
+		Events{
+			{Name: "next", Src: []string{"a"}, Dst: "b"},
+		},
+		Callbacks{
+			"enter_state": func(_ context.Context, e *Event) {
+				entered = append(entered, "grandchild "+e.Dst)
+			},
+		},
+	)
+	var child *FSM
+	child = NewFSM(
+		"loading",
+		Events{
+			{Name: "loaded", Src: []string{"loading"}, Dst: "ready"},
+		},
+		Callbacks{
+			"enter_loading": func(_ context.Context, e *Event) {
+				if e.FSM != child || e.Event != "start" {
+					t.Errorf("expected the event of the child for start, got %s", e.Event)
+				}
+				entered = append(entered, "child "+e.Dst)
+			},
+		},
+		WithSubmachine("loading", grandchild, ResetSubmachine),
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: "stop", Src: []string{"running"}, Dst: "idle"},
+		},
+		Callbacks{
+			"enter_running": func(_ context.Context, e *Event) {
+				entered = append(entered, "parent "+e.Dst)
+			},
+		},
+		WithSubmachine("running", child, ResetSubmachine),
+	)
+	ctx := context.Background()
+
+	if err := fsm.Event(ctx, "start"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{"parent running", "child loading", "grandchild a"}
+	if !reflect.DeepEqual(entered, expected) {
+		t.Errorf("expected enter callbacks %v, got %v", expected, entered)
+	}
+
+	_ = fsm.Event(ctx, "stop")
+	entered = nil
+	fsm.SetState("running")
+	if len(entered) != 0 {
+		t.Errorf("expected no enter callbacks for SetState, got %v", entered)
+	}
+}
+
+func TestSubmachineBubbling(t *testing.T) {
+	child := NewFSM(
+		"loading",
+		Events{
+			{Name: "loaded", Src: []string{"loading"}, Dst: "ready"},
+			{Name: "fail", Src: []string{"loading"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: "stop", Src: []string{"running"}, Dst: "idle"},
+			{Name: "fail", Src: []string{"running"}, Dst: "broken"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, ResetSubmachine),
+	)
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "start")
+
+	// The child handles fail first.
+	if err := fsm.Event(ctx, "fail"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "running" || child.Current() != "failed" {
+		t.Errorf("expected child to handle the event, got %v", fsm.ActiveStates())
+	}
+
+	// It is inappropriate in the child now, so it bubbles up.
+	if err := fsm.Event(ctx, "fail"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "broken" || child.Current() != "loading" {
+		t.Errorf("expected parent to handle the event, got %s and %s", fsm.Current(), child.Current())
+	}
+}
+
+func TestSubmachineBubblingRefused(t *testing.T) {
+	child := NewFSM(
+		"loading",
+		Events{
+			{Name: "loaded", Src: []string{"loading"}, Dst: "ready", Guard: func(context.Context, GuardContext) bool {
+				return false
+			}},
+			{Name: "fail", Src: []string{"loading"}, Dst: "failed"},
+			{Name: "retry", Src: []string{"loading"}, Dst: "loading"},
+		},
+		Callbacks{
+			"before_fail": func(_ context.Context, e *Event) {
+				e.Cancel()
+			},
+		},
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: "fail", Src: []string{"running"}, Dst: "broken"},
+			{Name: "retry", Src: []string{"running"}, Dst: "idle"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, ResetSubmachine),
+	)
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "start")
+
+	// The guard of the child refuses loaded, which the parent does not know.
+	if _, ok := fsm.Event(ctx, "loaded").(GuardFailedError); !ok {
+		t.Error("expected 'GuardFailedError' from the child")
+	}
+
+	// The child handles retry without changing its state.
+	if _, ok := fsm.Event(ctx, "retry").(NoTransitionError); !ok {
+		t.Error("expected 'NoTransitionError' from the child")
+	}
+	if fsm.Current() != "running" {
+		t.Errorf("expected the child to handle retry, got %s", fsm.Current())
+	}
+
+	// The child cancels fail, so it bubbles up.
+	if err := fsm.Event(ctx, "fail"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "broken" || child.Current() != "loading" {
+		t.Errorf("expected parent to handle the event, got %s and %s", fsm.Current(), child.Current())
+	}
+}
+
+func TestSubmachineSuspend(t *testing.T) {
+	child := NewFSM(
+		"loading",
+		Events{
+			{Name: "loaded", Src: []string{"loading"}, Dst: "ready"},
+			{Name: "fail", Src: []string{"loading"}, Dst: "failed"},
+		},
+		Callbacks{},
+	)
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "start", Src: []string{"idle"}, Dst: "running"},
+			{Name: "stop", Src: []string{"running"}, Dst: "idle"},
+			{Name: "fail", Src: []string{"running"}, Dst: "broken"},
+		},
+		Callbacks{},
+		WithSubmachine("running", child, SuspendSubmachine),
+	)
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "start")
+	_ = fsm.Event(ctx, "loaded")
+	_ = fsm.Event(ctx, "stop")
+
+	if child.Current() != "ready" || !child.IsPaused() {
+		t.Errorf("expected child to be suspended in ready, got %s", child.Current())
+	}
+	if _, ok := child.Event(ctx, "fail").(UnavailableError); !ok {
+		t.Error("expected 'UnavailableError' from suspended child")
+	}
+
+	_ = fsm.Event(ctx, "start")
+	if child.Current() != "loading" || child.IsPaused() {
+		t.Errorf("expected child to be restarted, got %s", child.Current())
+	}
+}
+
+func TestSubmachineNested(t *testing.T) {
+	grandchild := NewFSM(
+		"a",
+		Events{
+			{Name: "next", Src: []string{"a"}, Dst: "b"},
+		},
+		Callbacks{},
+	)
+	child := NewFSM(
+		"inner",
+		Events{
+			{Name: "next", Src: []string{"inner"}, Dst: "done"},
+		},
+		Callbacks{},
+		WithSubmachine("inner", grandchild, ResetSubmachine),
+	)
+	fsm := NewFSM(
+		"outer",
+		Events{
+			{Name: "next", Src: []string{"outer"}, Dst: "end"},
+		},
+		Callbacks{},
+		WithSubmachine("outer", child, ResetSubmachine),
+	)
+	ctx := context.Background()
+
+	expected := [][]string{
+		{"outer", "inner", "b"},
+		{"outer", "done"},
+		{"end"},
+	}
+	for _, states := range expected {
+		if err := fsm.Event(ctx, "next"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := fsm.ActiveStates(); !reflect.DeepEqual(got, states) {
+			t.Errorf("expected active states %v, got %v", states, got)
+		}
+	}
+	if grandchild.Current() != "a" {
+		t.Errorf("expected grandchild to be reset, got %s", grandchild.Current())
+	}
+}
+
+func TestSubmachineHistory(t *testing.T) {
+	tests := []struct {
+		history  History
+		events   []string
+		expected []string
+	}{
+		{NoHistory, []string{"step", "advance"}, []string{"on", "p1", "a"}},
+		{ShallowHistory, []string{"step", "advance"}, []string{"on", "p2"}},
+		{ShallowHistory, []string{"step"}, []string{"on", "p1", "a"}},
+		{DeepHistory, []string{"step"}, []string{"on", "p1", "b"}},
+	}
+	for _, test := range tests {
+		grandchild := NewFSM(
+			"a",
+			Events{
+				{Name: "step", Src: []string{"a"}, Dst: "b"},
+			},
+			Callbacks{},
+		)
+		child := NewFSM(
+			"p1",
+			Events{
+				{Name: "advance", Src: []string{"p1"}, Dst: "p2"},
+			},
+			Callbacks{},
+			WithSubmachine("p1", grandchild, ResetSubmachine),
+		)
+		fsm := NewFSM(
+			"off",
+			Events{
+				{Name: "on", Src: []string{"off"}, Dst: "on"},
+				{Name: "off", Src: []string{"on"}, Dst: "off"},
+			},
+			Callbacks{},
+			WithSubmachine("on", child, ResetSubmachine),
+			WithHistory("on", test.history),
+		)
+		ctx := context.Background()
+		_ = fsm.Event(ctx, "on")
+		for _, event := range test.events {
+			if err := fsm.Event(ctx, event); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		_ = fsm.Event(ctx, "off")
+		if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"off"}) {
+			t.Errorf("expected active states [off], got %v", states)
+		}
+		_ = fsm.Event(ctx, "on")
+		if states := fsm.ActiveStates(); !reflect.DeepEqual(states, test.expected) {
+			t.Errorf("expected active states %v with history %d after %v, got %v", test.expected, test.history, test.events, states)
+		}
+	}
+}
+
+func TestSubmachineRollback(t *testing.T) {
+	grandchild := NewFSM(
+		"a",
+		Events{
+			{Name: "step", Src: []string{"a"}, Dst: "b"},
+		},
+		Callbacks{},
+	)
+	child := NewFSM(
+		"p1",
+		Events{
+			{Name: "advance", Src: []string{"p1"}, Dst: "p2"},
+		},
+		Callbacks{},
+		WithSubmachine("p1", grandchild, ResetSubmachine),
+	)
+	fsm := NewFSM(
+		"off",
+		Events{
+			{Name: "on", Src: []string{"off"}, Dst: "on"},
+			{Name: "off", Src: []string{"on"}, Dst: "off"},
+		},
+		Callbacks{},
+		WithSubmachine("on", child, ResetSubmachine),
+		WithHistory("on", NoHistory),
+	)
+	ctx := context.Background()
+	_ = fsm.Event(ctx, "on")
+	_ = fsm.Event(ctx, "step")
+
+	err := fsm.WithinTx(ctx, &fakeTx{}, func(ctx context.Context) error {
+		if err := fsm.Event(ctx, "off"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if states := fsm.ActiveStates(); !reflect.DeepEqual(states, []string{"on", "p1", "b"}) {
+		t.Errorf("expected active states to be restored, got %v", states)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sort"
+)
+
+// HasTag returns true if the transition is tagged with tag.
+func (i TransitionInfo) HasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyTag returns true if the transition is tagged with any of tags.
+func (i TransitionInfo) hasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		if i.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ObserveTags returns an observer that only notifies o of the transitions
+// tagged with any of tags. If o is an AsyncObserver, so is the returned
+// observer.
+func ObserveTags(o Observer, tags ...string) Observer {
+	return newTagFilter(o, func(info TransitionInfo) bool {
+		return info.hasAnyTag(tags)
+	})
+}
+
+// IgnoreTags returns an observer that notifies o of all transitions except the
+// ones tagged with any of tags, for example to keep heartbeats out of an
+// expensive audit log. If o is an AsyncObserver, so is the returned observer.
+func IgnoreTags(o Observer, tags ...string) Observer {
+	return newTagFilter(o, func(info TransitionInfo) bool {
+		return !info.hasAnyTag(tags)
+	})
+}
+
+// tagFilter is an Observer that notifies the wrapped observer of the
+// transitions that match.
+type tagFilter struct {
+	o     Observer
+	match func(TransitionInfo) bool
+}
+
+// asyncTagFilter is a tagFilter for an AsyncObserver.
+type asyncTagFilter struct {
+	tagFilter
+	ao AsyncObserver
+}
+
+// newTagFilter wraps o in a tagFilter, or an asyncTagFilter if o is an
+// AsyncObserver.
+func newTagFilter(o Observer, match func(TransitionInfo) bool) Observer {
+	filter := tagFilter{o, match}
+	if ao, ok := o.(AsyncObserver); ok {
+		return asyncTagFilter{filter, ao}
+	}
+	return filter
+}
+
+func (t tagFilter) OnTransition(ctx context.Context, info TransitionInfo) {
+	if t.match(info) {
+		t.o.OnTransition(ctx, info)
+	}
+}
+
+func (t asyncTagFilter) OnAsyncStarted(ctx context.Context, info TransitionInfo) {
+	if t.match(info) {
+		t.ao.OnAsyncStarted(ctx, info)
+	}
+}
+
+func (t asyncTagFilter) OnAsyncCompleted(ctx context.Context, info TransitionInfo) {
+	if t.match(info) {
+		t.ao.OnAsyncCompleted(ctx, info)
+	}
+}
+
+func (t asyncTagFilter) OnAsyncCanceled(ctx context.Context, info TransitionInfo) {
+	if t.match(info) {
+		t.ao.OnAsyncCanceled(ctx, info)
+	}
+}
+
+// eventTags returns the sorted tags of all transitions of event, without
+// duplicates.
+func (f *FSM) eventTags(event string) []string {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	var tags []string
+	seen := make(map[string]bool)
+	for key, rules := range f.transitions {
+		if key.event != event {
+			continue
+		}
+		for _, rule := range rules {
+			for _, tag := range rule.tags {
+				if !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	var tags []string
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{Name: "charge", Src: []string{"idle"}, Dst: "charged", Tags: []string{"billing", "compliance"}},
+			{Name: "ping", Src: []string{"idle", "charged"}, Dst: "idle", Kind: KindInternal, Tags: []string{"heartbeat"}},
+		},
+		Callbacks{
+			"enter_charged": func(_ context.Context, e *Event) {
+				tags = e.Tags
+			},
+		},
+	)
+
+	var billing, audit []string
+	fsm.AddObserver(ObserveTags(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		billing = append(billing, info.Event)
+	}), "billing"))
+	fsm.AddObserver(IgnoreTags(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		audit = append(audit, info.Event)
+	}), "heartbeat"))
+
+	_ = fsm.Event(context.Background(), "ping")
+	_ = fsm.Event(context.Background(), "charge")
+	_ = fsm.Event(context.Background(), "ping")
+	_ = fsm.Event(context.Background(), "charge")
+
+	if !reflect.DeepEqual(tags, []string{"billing", "compliance"}) {
+		t.Errorf("expected event to carry the tags, got %v", tags)
+	}
+	if !reflect.DeepEqual(billing, []string{"charge", "charge"}) {
+		t.Errorf("expected billing observer to see both charges, got %v", billing)
+	}
+	if !reflect.DeepEqual(audit, []string{"charge", "charge"}) {
+		t.Errorf("expected audit observer to ignore heartbeats, got %v", audit)
+	}
+}
+
+func TestTagsAsyncObserver(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open", Tags: []string{"door"}},
+		},
+		Callbacks{
+			"leave_closed": func(_ context.Context, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	r := &asyncRecorder{}
+	o := ObserveTags(r, "door")
+	if _, ok := o.(AsyncObserver); !ok {
+		t.Fatal("expected filter of an AsyncObserver to be an AsyncObserver")
+	}
+	fsm.AddObserver(o)
+	fsm.AddObserver(IgnoreTags(r, "door"))
+
+	_ = fsm.Event(context.Background(), "open")
+	if err := fsm.Transition(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{
+		"started open closed>open",
+		"transition open closed>open",
+		"completed open closed>open",
+	}
+	if !reflect.DeepEqual(r.phases, expected) {
+		t.Errorf("expected %v, got %v", expected, r.phases)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+)
+
+// Chain generates the events of a linear pipeline of states named by format
+// with the numbers from first to last, like "step_%d": event moves from each
+// state to the next one. The result can be combined with other events with
+// Compose or append.
+//
+//	fsm.Chain("step_%d", 1, 3, "next")
+//
+// is the same as
+//
+//	fsm.Events{
+//		{Name: "next", Src: []string{"step_1"}, Dst: "step_2"},
+//		{Name: "next", Src: []string{"step_2"}, Dst: "step_3"},
+//	}
+func Chain(format string, first, last int, event string) Events {
+	var events Events
+	for i := first; i < last; i++ {
+		events = append(events, EventDesc{
+			Name: event,
+			Src:  []string{fmt.Sprintf(format, i)},
+			Dst:  fmt.Sprintf(format, i+1),
+		})
+	}
+	return events
+}
+
+// Star generates the events that make event move from each of the states to
+// dst, like a common error or abort transition.
+//
+//	fsm.Star("error", []string{"step_1", "step_2"}, "failed")
+//
+// is the same as
+//
+//	fsm.Events{
+//		{Name: "error", Src: []string{"step_1", "step_2"}, Dst: "failed"},
+//	}
+func Star(event string, states []string, dst string) Events {
+	if len(states) == 0 {
+		return nil
+	}
+	return Events{{Name: event, Src: append([]string(nil), states...), Dst: dst}}
+}
+
+// ChainStates returns the names of the states generated by Chain with the same
+// format, first and last, to pass them to Star.
+func ChainStates(format string, first, last int) []string {
+	var states []string
+	for i := first; i <= last; i++ {
+		states = append(states, fmt.Sprintf(format, i))
+	}
+	return states
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	events := Chain("step_%d", 1, 3, "next")
+	expected := Events{
+		{Name: "next", Src: []string{"step_1"}, Dst: "step_2"},
+		{Name: "next", Src: []string{"step_2"}, Dst: "step_3"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+	if events := Chain("step_%d", 3, 3, "next"); len(events) != 0 {
+		t.Errorf("expected no events for a single state, got %v", events)
+	}
+}
+
+func TestStar(t *testing.T) {
+	states := []string{"step_1", "step_2"}
+	events := Star("error", states, "failed")
+	expected := Events{
+		{Name: "error", Src: []string{"step_1", "step_2"}, Dst: "failed"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+	states[0] = "changed"
+	if events[0].Src[0] != "step_1" {
+		t.Error("expected states to be copied")
+	}
+	if events := Star("error", nil, "failed"); events != nil {
+		t.Errorf("expected no events without states, got %v", events)
+	}
+}
+
+func TestChainPipeline(t *testing.T) {
+	events, err := Compose(
+		Chain("step_%d", 1, 10, "next"),
+		Star("error", ChainStates("step_%d", 1, 10), "failed"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fsm := NewFSM("step_1", events, Callbacks{})
+	for i := 0; i < 4; i++ {
+		if err := fsm.Event(context.Background(), "next"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if fsm.Current() != "step_5" {
+		t.Errorf("expected state to be 'step_5', got %s", fsm.Current())
+	}
+	if err := fsm.Event(context.Background(), "error"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "failed" {
+		t.Errorf("expected state to be 'failed', got %s", fsm.Current())
+	}
+}
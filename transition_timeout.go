@@ -0,0 +1,57 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// WithTransitionTimeout limits the duration of a transition, from the
+// before_ callbacks until the state changes.
+//
+// The context passed to the callbacks and effects of the transition has a
+// deadline of timeout after the event was received. If it is exceeded before
+// the state changed, the transition fails with a TransitionTimeoutError and
+// the state is left unchanged. The callbacks are not interrupted, they must
+// stop when their context is done. The enter_ and after_ callbacks run with
+// the same context but can no longer fail the transition.
+//
+// Asynchronous transitions are not limited once Event has returned. Like
+// WithCallbackTimeouts, the deadline uses the real time and not the Clock set
+// with WithClock, unless the FSM is deterministic, see WithDeterministic.
+func WithTransitionTimeout(timeout time.Duration) Option {
+	return func(f *FSM) {
+		f.transitionTimeout = timeout
+	}
+}
+
+// transitionContext returns the context of the callbacks of a transition,
+// derived from ctx.
+func (f *FSM) transitionContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.transitionTimeout > 0 {
+		if f.deterministic {
+			return f.withClockTimeout(ctx, f.transitionTimeout)
+		}
+		return context.WithTimeout(ctx, f.transitionTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// transitionTimedOut returns true if the context ctx of a transition, derived
+// from parent, is done because of WithTransitionTimeout.
+func (f *FSM) transitionTimedOut(parent, ctx context.Context, async bool) bool {
+	return f.transitionTimeout > 0 && !async && parent.Err() == nil && ctx.Err() == context.DeadlineExceeded
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransitionTimeout(t *testing.T) {
+	for _, callback := range []string{"before_open", "leave_closed"} {
+		fsm := NewFSM(
+			"closed",
+			Events{
+				{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			},
+			Callbacks{
+				callback: func(ctx context.Context, e *Event) {
+					select {
+					case <-time.After(time.Minute):
+					case <-ctx.Done():
+					}
+				},
+			},
+			WithTransitionTimeout(10*time.Millisecond),
+		)
+		err := fsm.Event(context.Background(), "open")
+		var terr TransitionTimeoutError
+		if !errors.As(err, &terr) || terr.Event != "open" || terr.Timeout != 10*time.Millisecond {
+			t.Fatalf("expected 'TransitionTimeoutError' for %s, got %v", callback, err)
+		}
+		if fsm.Current() != "closed" {
+			t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+		}
+		if err := fsm.Event(context.Background(), "open"); !errors.As(err, &terr) {
+			t.Errorf("expected FSM not to be left in transition, got %v", err)
+		}
+	}
+}
+
+func TestTransitionTimeoutNotExceeded(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(ctx context.Context, e *Event) {
+				select {
+				case <-time.After(time.Millisecond):
+				case <-ctx.Done():
+				}
+			},
+		},
+		WithTransitionTimeout(time.Minute),
+	)
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+}
+
+func TestTransitionTimeoutCallerDeadline(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"leave_closed": func(ctx context.Context, e *Event) {
+				select {
+				case <-time.After(time.Minute):
+				case <-ctx.Done():
+				}
+			},
+		},
+		WithTransitionTimeout(time.Minute),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := fsm.Event(ctx, "open"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline of caller to be exceeded, got %v", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+}
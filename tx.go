@@ -0,0 +1,197 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Tx is a unit of work that the changes of a FSM can participate in, for
+// example a *sql.Tx from database/sql.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// WithinTx scopes the state changes and metadata writes done by fn to the
+// transaction tx, so that they are committed together with the writes that fn
+// does through tx.
+//
+// If fn returns an error or panics, tx is rolled back and the state and
+// metadata of the FSM are restored to what they were before fn was called,
+// and asynchronous transitions started by fn are canceled. The same happens if
+// committing tx fails. The error of fn or Commit is returned.
+//
+// The struct bound with BindData is restored from a shallow copy, including
+// its unexported fields. The maps, slices and pointers it refers to are not
+// copied, so changes made to them in place are not rolled back.
+//
+// Callbacks are called as usual when fn triggers events, so side effects done
+// outside of tx are not rolled back. WithinTx should not be used concurrently
+// with other events on the same FSM, as their changes may be rolled back too.
+func (f *FSM) WithinTx(ctx context.Context, tx Tx, fn func(ctx context.Context) error) error {
+	if !f.initialized() {
+		return NotInitializedError{}
+	}
+	snapshot := f.takeSnapshot()
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		_ = tx.Rollback()
+		f.restoreSnapshot(snapshot)
+	}()
+
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// snapshot is a copy of the mutable data of a FSM.
+type snapshot struct {
+	current    string
+	enteredAt  time.Time
+	transition func()
+	asyncEvent *Event
+	since      time.Time
+	durations  map[string]time.Duration
+	entries    map[string]int
+	stack      []string
+	metadata   map[string]interface{}
+	data       interface{}
+	dataCopy   reflect.Value
+	timeout    time.Duration
+	timeoutSet bool
+
+	// submachines are the snapshots of the child FSMs of composite states.
+	submachines map[string][]submachineSnapshot
+}
+
+// submachineSnapshot is a copy of the mutable data of a child FSM.
+type submachineSnapshot struct {
+	snapshot
+	paused bool
+	last   string
+}
+
+// takeSnapshot copies the state and metadata of the FSM.
+func (f *FSM) takeSnapshot() snapshot {
+	f.stateMu.RLock()
+	s := snapshot{
+		current:    f.current,
+		enteredAt:  f.State().EnteredAt,
+		transition: f.transition,
+		asyncEvent: f.asyncEvent,
+		since:      f.enteredAt,
+		durations:  make(map[string]time.Duration, len(f.durations)),
+		entries:    make(map[string]int, len(f.entries)),
+		stack:      append([]string(nil), f.stack...),
+	}
+	for state, d := range f.durations {
+		s.durations[state] = d
+	}
+	for state, n := range f.entries {
+		s.entries[state] = n
+	}
+	s.timeout, s.timeoutSet = f.remainingStateTimeout()
+	if f.submachines != nil {
+		s.submachines = make(map[string][]submachineSnapshot, len(f.submachines))
+		for state, subs := range f.submachines {
+			for _, sub := range subs {
+				s.submachines[state] = append(s.submachines[state], submachineSnapshot{
+					snapshot: sub.child.takeSnapshot(),
+					paused:   sub.child.IsPaused(),
+					last:     sub.last,
+				})
+			}
+		}
+	}
+	f.stateMu.RUnlock()
+
+	f.metadataMu.RLock()
+	s.metadata = make(map[string]interface{}, len(f.metadata))
+	for key, value := range f.metadata {
+		s.metadata[key] = value
+	}
+	if f.data != nil {
+		s.data = f.data
+		s.dataCopy = reflect.New(reflect.TypeOf(f.data).Elem()).Elem()
+		s.dataCopy.Set(reflect.ValueOf(f.data).Elem())
+	}
+	f.metadataMu.RUnlock()
+	return s
+}
+
+// restoreSnapshot restores the state and metadata of the FSM from s.
+func (f *FSM) restoreSnapshot(s snapshot) {
+	f.stateMu.Lock()
+	started := f.asyncEvent
+	if started == s.asyncEvent {
+		started = nil
+	}
+	var record StateRecord
+	f.changeState(&record, s.current, s.enteredAt)
+	f.publishState(&record)
+	f.transition = s.transition
+	f.asyncEvent = s.asyncEvent
+	f.enteredAt, f.durations = s.since, s.durations
+	f.storeView()
+	f.entries = s.entries
+	f.stack = s.stack
+	if s.timeoutSet {
+		f.armStateTimeout(s.current, s.timeout)
+	} else {
+		f.stopStateTimeout()
+	}
+	f.enterPeriodicEvents(s.current)
+	f.enterWatchdog(s.current, s.enteredAt)
+	for state, subs := range s.submachines {
+		for i, sub := range subs {
+			child := f.submachines[state][i]
+			child.last = sub.last
+			child.child.restoreSnapshot(sub.snapshot)
+			if sub.paused {
+				child.child.Pause()
+			} else {
+				child.child.Resume()
+			}
+		}
+	}
+	f.stateMu.Unlock()
+
+	// an asynchronous transition started since the snapshot is rolled back,
+	// so that it is no longer pending
+	if started != nil {
+		started.cancelFunc()
+		f.countAsyncRolledBack()
+	}
+
+	f.metadataMu.Lock()
+	f.metadata = s.metadata
+	f.metadataVersion++
+	f.data = s.data
+	if s.data != nil {
+		reflect.ValueOf(s.data).Elem().Set(s.dataCopy)
+	}
+	f.metadataMu.Unlock()
+}
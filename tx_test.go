@@ -0,0 +1,194 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeTx struct {
+	commitErr  error
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Commit() error {
+	if tx.commitErr != nil {
+		return tx.commitErr
+	}
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.rolledBack = true
+	return nil
+}
+
+func TestWithinTxCommit(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	tx := &fakeTx{}
+	err := fsm.WithinTx(context.Background(), tx, func(ctx context.Context) error {
+		fsm.SetMetadata("receipt", 42)
+		return fsm.Event(ctx, "pay")
+	})
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if !tx.committed || tx.rolledBack {
+		t.Error("expected transaction to be committed")
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state to be 'paid', was '%s'", fsm.Current())
+	}
+	if v, ok := fsm.Metadata("receipt"); !ok || v != 42 {
+		t.Error("expected metadata to be kept")
+	}
+}
+
+func TestWithinTxError(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	fsm.SetMetadata("attempts", 1)
+	tx := &fakeTx{}
+	fnErr := errors.New("insert failed")
+	err := fsm.WithinTx(context.Background(), tx, func(ctx context.Context) error {
+		fsm.SetMetadata("attempts", 2)
+		fsm.SetMetadata("receipt", 42)
+		if err := fsm.Event(ctx, "pay"); err != nil {
+			return err
+		}
+		return fnErr
+	})
+	if err != fnErr {
+		t.Errorf("expected error of fn, got %v", err)
+	}
+	if tx.committed || !tx.rolledBack {
+		t.Error("expected transaction to be rolled back")
+	}
+	if fsm.Current() != "pending" {
+		t.Errorf("expected state to be 'pending', was '%s'", fsm.Current())
+	}
+	if v, _ := fsm.Metadata("attempts"); v != 1 {
+		t.Errorf("expected metadata to be restored, got %v", v)
+	}
+	if _, ok := fsm.Metadata("receipt"); ok {
+		t.Error("expected new metadata to be removed")
+	}
+	if fsm.EntryCount("paid") != 0 {
+		t.Error("expected entry counts to be restored")
+	}
+}
+
+func TestWithinTxCommitError(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	commitErr := errors.New("commit failed")
+	tx := &fakeTx{commitErr: commitErr}
+	err := fsm.WithinTx(context.Background(), tx, func(ctx context.Context) error {
+		return fsm.Event(ctx, "pay")
+	})
+	if err != commitErr {
+		t.Errorf("expected commit error, got %v", err)
+	}
+	if !tx.rolledBack {
+		t.Error("expected transaction to be rolled back")
+	}
+	if fsm.Current() != "pending" {
+		t.Errorf("expected state to be 'pending', was '%s'", fsm.Current())
+	}
+}
+
+func TestWithinTxPanic(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	tx := &fakeTx{}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected panic to be propagated")
+			}
+		}()
+		_ = fsm.WithinTx(context.Background(), tx, func(ctx context.Context) error {
+			_ = fsm.Event(ctx, "pay")
+			panic("boom")
+		})
+	}()
+	if !tx.rolledBack {
+		t.Error("expected transaction to be rolled back")
+	}
+	if fsm.Current() != "pending" {
+		t.Errorf("expected state to be 'pending', was '%s'", fsm.Current())
+	}
+}
+
+type paymentData struct {
+	Amount int
+	Token  string `json:"-"`
+	tries  int
+}
+
+func TestWithinTxRestoresData(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{Name: "pay", Src: []string{"pending"}, Dst: "paid"},
+		},
+		Callbacks{},
+	)
+	payment := &paymentData{Amount: 10, Token: "secret", tries: 1}
+	if err := fsm.BindData(payment); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err := fsm.WithinTx(context.Background(), &fakeTx{}, func(ctx context.Context) error {
+		payment.Amount, payment.Token, payment.tries = 20, "other", 2
+		if err := fsm.BindData(&orderData{}); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if *payment != (paymentData{Amount: 10, Token: "secret", tries: 1}) {
+		t.Errorf("expected data to be restored, got %+v", *payment)
+	}
+	if fsm.Data() != payment {
+		t.Error("expected the bound data to be restored")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Unavailability is a condition in which a FSM can not process events.
+type Unavailability int
+
+const (
+	// UnavailablePaused is the condition of a FSM paused with Pause.
+	UnavailablePaused Unavailability = iota + 1
+	// UnavailableClosed is the condition of a FSM closed with Close.
+	UnavailableClosed
+	// UnavailableTerminal is the condition of a FSM in a state without
+	// any transitions out of it.
+	UnavailableTerminal
+)
+
+func (u Unavailability) String() string {
+	switch u {
+	case UnavailablePaused:
+		return "paused"
+	case UnavailableClosed:
+		return "closed"
+	case UnavailableTerminal:
+		return "terminal"
+	}
+	return "available"
+}
+
+// UnavailableStrategy is how a FSM handles the events it receives while it is
+// unavailable.
+type UnavailableStrategy int
+
+const (
+	// RejectUnavailable makes Event return an UnavailableError.
+	RejectUnavailable UnavailableStrategy = iota
+	// DropUnavailable drops the event: Event returns nil, but the
+	// observers are notified with an UnavailableError.
+	DropUnavailable
+	// DeadLetterUnavailable passes the event to the sink set with
+	// WithDeadLetters to be processed later: Event returns nil, but the
+	// observers are notified with an UnavailableError.
+	DeadLetterUnavailable
+)
+
+// WithUnavailableStrategies sets how events are handled while the FSM is
+// unavailable because of each condition.
+//
+// By default a paused FSM rejects events, while a closed FSM and a FSM in a
+// terminal state process them as usual, which for a terminal state means
+// failing with an InvalidEventError.
+func WithUnavailableStrategies(strategies map[Unavailability]UnavailableStrategy) Option {
+	return func(f *FSM) {
+		f.unavailableStrategies = strategies
+		f.setHook(hookUnavailable)
+	}
+}
+
+// Pause makes the FSM unavailable until Resume is called. Events received in
+// the meantime are handled as set by WithUnavailableStrategies, and rejected
+// with an UnavailableError by default, and Can reports them as impossible.
+// Events that are already being processed are not affected.
+func (f *FSM) Pause() {
+	if !f.initialized() {
+		return
+	}
+	f.setHook(hookUnavailable)
+	atomic.StoreInt32(&f.paused, 1)
+}
+
+// Resume makes a FSM paused with Pause available again.
+func (f *FSM) Resume() {
+	if !f.initialized() {
+		return
+	}
+	atomic.StoreInt32(&f.paused, 0)
+}
+
+// IsPaused returns true if the FSM has been paused with Pause.
+func (f *FSM) IsPaused() bool {
+	if !f.initialized() {
+		return false
+	}
+	return atomic.LoadInt32(&f.paused) == 1
+}
+
+// unavailability returns the condition that makes the FSM unavailable and
+// how to handle events in it, and false if the FSM is available.
+func (f *FSM) unavailability() (Unavailability, UnavailableStrategy, bool) {
+	if f.IsPaused() {
+		return UnavailablePaused, f.unavailableStrategies[UnavailablePaused], true
+	}
+	if strategy, ok := f.unavailableStrategies[UnavailableClosed]; ok {
+		select {
+		case <-f.closed:
+			return UnavailableClosed, strategy, true
+		default:
+		}
+	}
+	if strategy, ok := f.unavailableStrategies[UnavailableTerminal]; ok && f.inTerminalState() {
+		return UnavailableTerminal, strategy, true
+	}
+	return 0, 0, false
+}
+
+// inTerminalState returns true if there are no transitions out of the
+// current state.
+func (f *FSM) inTerminalState() bool {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	for key := range f.transitions {
+		if key.src == f.current || key.src == AnyState {
+			return false
+		}
+	}
+	return true
+}
+
+// handleUnavailable handles event received while the FSM is unavailable
+// because of reason, and returns the error to notify the observers of and the
+// error to return from Event.
+func (f *FSM) handleUnavailable(ctx context.Context, event string, args []interface{}, reason Unavailability, strategy UnavailableStrategy) (error, error) {
+	state := f.liveState()
+	err := UnavailableError{event, state, reason}
+	switch strategy {
+	case DropUnavailable:
+		return err, nil
+	case DeadLetterUnavailable:
+		if ctx.Value(redeliveryKey{}) != nil {
+			return err, err
+		}
+		f.putDeadLetter(ctx, event, args, state, err)
+		return err, nil
+	}
+	return err, err
+}
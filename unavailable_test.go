@@ -0,0 +1,188 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPause(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "break", Src: []string{"closed", "open"}, Dst: "broken"},
+		},
+		Callbacks{},
+	)
+	fsm.Pause()
+	if !fsm.IsPaused() {
+		t.Error("expected FSM to be paused")
+	}
+	if fsm.Can("open") || fsm.CanWith(context.Background(), "open") || len(fsm.AvailableTransitions()) != 0 {
+		t.Error("expected no possible events while paused")
+	}
+	err := fsm.Event(context.Background(), "open")
+	if e, ok := err.(UnavailableError); !ok || e.Reason != UnavailablePaused || e.Event != "open" || e.State != "closed" {
+		t.Fatalf("expected UnavailableError, got %v", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+
+	fsm.Resume()
+	if fsm.IsPaused() {
+		t.Error("expected FSM not to be paused")
+	}
+	if !fsm.Can("open") || !reflect.DeepEqual(fsm.AvailableTransitions(), []string{"break", "open"}) {
+		t.Errorf("expected break and open to be possible, got %v", fsm.AvailableTransitions())
+	}
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestUnavailableDrop(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "break", Src: []string{"closed", "open"}, Dst: "broken"},
+		},
+		Callbacks{},
+		WithUnavailableStrategies(map[Unavailability]UnavailableStrategy{
+			UnavailablePaused: DropUnavailable,
+		}),
+	)
+	var infos []TransitionInfo
+	fsm.AddObserver(ObserverFunc(func(_ context.Context, info TransitionInfo) {
+		infos = append(infos, info)
+	}))
+
+	fsm.Pause()
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %s", fsm.Current())
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(infos))
+	}
+	if e, ok := infos[0].Err.(UnavailableError); !ok || e.Reason != UnavailablePaused {
+		t.Errorf("expected UnavailableError to be observed, got %v", infos[0].Err)
+	}
+}
+
+func TestUnavailableClosed(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "break", Src: []string{"closed", "open"}, Dst: "broken"},
+		},
+		Callbacks{},
+	)
+	fsm.Close()
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected closed FSM to process events by default, got %v", err)
+	}
+
+	var letters []DeadLetter
+	fsm = NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "break", Src: []string{"closed", "open"}, Dst: "broken"},
+		},
+		Callbacks{},
+		WithUnavailableStrategies(map[Unavailability]UnavailableStrategy{
+			UnavailableClosed: DeadLetterUnavailable,
+		}), WithDeadLetters(DeadLetterFunc(func(_ context.Context, letter DeadLetter) {
+			letters = append(letters, letter)
+		})),
+	)
+	if err := fsm.Event(context.Background(), "open"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fsm.Close()
+	if err := fsm.Event(context.Background(), "close", "now"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "open" {
+		t.Errorf("expected state to be 'open', got %s", fsm.Current())
+	}
+	if len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(letters))
+	}
+	letter := letters[0]
+	if letter.Event != "close" || letter.State != "open" || len(letter.Args) != 1 || letter.Args[0] != "now" {
+		t.Errorf("unexpected dead letter: %+v", letter)
+	}
+	if e, ok := letter.Err.(UnavailableError); !ok || e.Reason != UnavailableClosed {
+		t.Errorf("expected UnavailableError, got %v", letter.Err)
+	}
+	if letter.At.IsZero() {
+		t.Error("expected time of dead letter to be set")
+	}
+}
+
+func TestUnavailableTerminal(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+			{Name: "break", Src: []string{"closed", "open"}, Dst: "broken"},
+		},
+		Callbacks{},
+		WithUnavailableStrategies(map[Unavailability]UnavailableStrategy{
+			UnavailableTerminal: RejectUnavailable,
+		}),
+	)
+	if err := fsm.Event(context.Background(), "break"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err := fsm.Event(context.Background(), "open")
+	if e, ok := err.(UnavailableError); !ok || e.Reason != UnavailableTerminal || e.State != "broken" {
+		t.Fatalf("expected UnavailableError, got %v", err)
+	}
+
+	if err := fsm.AddTransition(EventDesc{Name: "repair", Src: []string{"broken"}, Dst: "closed"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fsm.Event(context.Background(), "repair"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestUnavailabilityString(t *testing.T) {
+	for u, expected := range map[Unavailability]string{
+		UnavailablePaused:   "paused",
+		UnavailableClosed:   "closed",
+		UnavailableTerminal: "terminal",
+		0:                   "available",
+	} {
+		if u.String() != expected {
+			t.Errorf("expected %s, got %s", expected, u.String())
+		}
+	}
+}
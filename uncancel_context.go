@@ -16,6 +16,8 @@ func (*uncancel) Err() error                              { return nil }
 // uncancelContext returns a context which ignores the cancellation of the parent and only keeps the values.
 // Also returns a new cancel function.
 // This is useful to keep a background task running while the initial request is finished.
+// It is used for asynchronous transitions, for the transitions detached by WithDetachOnDeadline and for the
+// chains of events continued by WithChainPolicy.
 func uncancelContext(ctx context.Context) (context.Context, context.CancelFunc) {
 	return context.WithCancel(&uncancel{ctx})
 }
@@ -2,7 +2,10 @@ package fsm
 
 import (
 	"fmt"
+	"reflect"
+	"runtime"
 	"sort"
+	"strings"
 )
 
 // VisualizeType the type of the visualization
@@ -17,6 +20,8 @@ const (
 	MermaidStateDiagram VisualizeType = "mermaid-state-diagram"
 	// MermaidFlowChart the type for mermaid output (https://mermaid-js.github.io/mermaid/#/flowchart) in the flow chart form
 	MermaidFlowChart VisualizeType = "mermaid-flow-chart"
+	// PLANTUML the type for PlantUML output (https://plantuml.com/state-diagram)
+	PLANTUML VisualizeType = "plantuml"
 )
 
 // VisualizeWithType outputs a visualization of a FSM in the desired format.
@@ -31,36 +36,102 @@ func VisualizeWithType(fsm *FSM, visualizeType VisualizeType) (string, error) {
 		return VisualizeForMermaidWithGraphType(fsm, StateDiagram)
 	case MermaidFlowChart:
 		return VisualizeForMermaidWithGraphType(fsm, FlowChart)
+	case PLANTUML:
+		return VisualizeForPlantUML(fsm), nil
 	default:
 		return "", fmt.Errorf("unknown VisualizeType: %s", visualizeType)
 	}
 }
 
-func getSortedTransitionKeys(transitions map[eKey]string) []eKey {
-	// we sort the key alphabetically to have a reproducible graph output
-	sortedTransitionKeys := make([]eKey, 0)
+// transitionEdge is a transition between two states in a visualization.
+type transitionEdge struct {
+	src   string
+	event string
+	dst   string
 
-	for transition := range transitions {
-		sortedTransitionKeys = append(sortedTransitionKeys, transition)
+	// description is the description of the transition, or of its event.
+	description string
+
+	// guards are the names of the guard and unless conditions of the
+	// transition, see guardNames.
+	guards string
+}
+
+// visualized returns fsm, or a FSM without states if fsm is nil, so that a nil
+// FSM can be visualized.
+func visualized(fsm *FSM) *FSM {
+	if fsm == nil {
+		return &FSM{}
 	}
-	sort.Slice(sortedTransitionKeys, func(i, j int) bool {
-		if sortedTransitionKeys[i].src == sortedTransitionKeys[j].src {
-			return sortedTransitionKeys[i].event < sortedTransitionKeys[j].event
+	return fsm
+}
+
+// getSortedTransitionEdges returns the transitions of the FSM that can be
+// performed as edges between states. Transitions from AnyState are expanded to
+// every known state and transitions that are shadowed by a transition without
+// conditions that is tried before them are left out.
+func getSortedTransitionEdges(fsm *FSM) []transitionEdge {
+	states := make(map[string]bool)
+	events := make(map[string]bool)
+	for transition, rules := range fsm.transitions {
+		if transition.src != AnyState {
+			states[transition.src] = true
+		}
+		for _, rule := range rules {
+			if rule.kind != KindInternal {
+				states[rule.dst] = true
+			}
 		}
-		return sortedTransitionKeys[i].src < sortedTransitionKeys[j].src
+		events[transition.event] = true
+	}
+
+	seen := make(map[transitionEdge]bool)
+	edges := make([]transitionEdge, 0)
+	for event := range events {
+		for state := range states {
+			fsm.forEachRule(event, state, func(_ eKey, rule *transitionRule) bool {
+				edge := transitionEdge{src: state, event: event, dst: rule.target(state)}
+				if !seen[edge] {
+					seen[edge] = true
+					edge.description = rule.description
+					if edge.description == "" {
+						edge.description = fsm.EventDescription(event)
+					}
+					edge.guards = guardNames(rule)
+					edges = append(edges, edge)
+				}
+				return !rule.unconditional()
+			})
+		}
+	}
+
+	// we sort the edges alphabetically to have a reproducible graph output
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].src != edges[j].src {
+			return edges[i].src < edges[j].src
+		}
+		if edges[i].event != edges[j].event {
+			return edges[i].event < edges[j].event
+		}
+		return edges[i].dst < edges[j].dst
 	})
 
-	return sortedTransitionKeys
+	return edges
 }
 
-func getSortedStates(transitions map[eKey]string) ([]string, map[string]string) {
+// getSortedStates returns the states of edges and extra, sorted alphabetically,
+// and maps them to the IDs used by the visualizations.
+func getSortedStates(edges []transitionEdge, extra ...string) ([]string, map[string]string) {
 	statesToIDMap := make(map[string]string)
-	for transition, target := range transitions {
-		if _, ok := statesToIDMap[transition.src]; !ok {
-			statesToIDMap[transition.src] = ""
+	for _, state := range extra {
+		statesToIDMap[state] = ""
+	}
+	for _, edge := range edges {
+		if _, ok := statesToIDMap[edge.src]; !ok {
+			statesToIDMap[edge.src] = ""
 		}
-		if _, ok := statesToIDMap[target]; !ok {
-			statesToIDMap[target] = ""
+		if _, ok := statesToIDMap[edge.dst]; !ok {
+			statesToIDMap[edge.dst] = ""
 		}
 	}
 
@@ -75,3 +146,57 @@ func getSortedStates(transitions map[eKey]string) ([]string, map[string]string)
 	}
 	return sortedStates, statesToIDMap
 }
+
+// getSortedCompositeStates returns the composite states of fsm that are among
+// the states of statesToIDMap, sorted alphabetically, see WithSubmachine and
+// WithRegions.
+func getSortedCompositeStates(fsm *FSM, statesToIDMap map[string]string) []string {
+	var states []string
+	for state := range fsm.submachines {
+		if _, ok := statesToIDMap[state]; ok {
+			states = append(states, state)
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+// getRegionGraph returns the sorted edges and states of the child FSM of a
+// composite state or region, including its initial state.
+func getRegionGraph(s *submachine) ([]transitionEdge, []string, map[string]string) {
+	s.child.stateMu.RLock()
+	defer s.child.stateMu.RUnlock()
+	edges := getSortedTransitionEdges(s.child)
+	states, statesToIDMap := getSortedStates(edges, s.initial)
+	return edges, states, statesToIDMap
+}
+
+// guardNames returns the function names of the guard and unless conditions of
+// rule, with the unless conditions negated, like "hasFunds, !isBlocked".
+func guardNames(rule *transitionRule) string {
+	var names []string
+	if rule.guard != nil {
+		names = append(names, funcName(rule.guard))
+	}
+	for _, unless := range rule.unless {
+		if unless != nil {
+			names = append(names, "!"+funcName(unless))
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// funcName returns the name of the function fn without its package, like
+// "hasFunds" or "newFSM.func1" for a closure.
+func funcName(fn interface{}) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return "guard"
+	}
+	name := f.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// Watchdog decides what happens when the FSM stays in a state for longer than
+// expected, see WithWatchdog.
+type Watchdog struct {
+	// Event is triggered when the state is exceeded, if set, for example
+	// "stuck" or "escalate".
+	Event string
+
+	// Escalate is called when the state is exceeded, if set, for example to
+	// alert an operator.
+	Escalate func(StuckInfo)
+}
+
+// StuckInfo describes a state that the FSM stayed in for longer than expected,
+// as passed to Watchdog.Escalate.
+type StuckInfo struct {
+	// State is the exceeded state.
+	State string
+
+	// EnteredAt is the time the state was entered.
+	EnteredAt time.Time
+
+	// Expected is the expected maximum time in the state.
+	Expected time.Duration
+}
+
+// watchdog is a watchdog set with WithWatchdog.
+type watchdog struct {
+	expected time.Duration
+	Watchdog
+}
+
+// WithWatchdog declares the expected maximum time the FSM stays in state, to
+// monitor stalled workflows. When the FSM is still in the state expected
+// after entering it, the watchdog w triggers its event and calls its
+// escalation function, once per entry in the state. AnyState sets the
+// watchdog of the states that have none of their own.
+//
+// Unlike WithStateTimeout, the watchdog does not need to move the FSM out of
+// the state: its event can be an internal transition, or it can only
+// escalate. The time is measured from State().EnteredAt on the clock of the
+// FSM, so a state restored by WithinTx or EventBatch keeps its deadline.
+//
+// The watchdog fires from the goroutine of the clock. Its event is triggered
+// with EventIf, so it has no effect if the state has changed in the meantime,
+// and its error is not returned anywhere, use an Observer to see it.
+func WithWatchdog(state string, expected time.Duration, w Watchdog) Option {
+	return func(f *FSM) {
+		if f.watchdogs == nil {
+			f.watchdogs = make(map[string]watchdog)
+		}
+		f.watchdogs[state] = watchdog{expected, w}
+	}
+}
+
+// enterWatchdog starts the timer of the watchdog of state, entered at
+// enteredAt, if any, and stops the timer of the previous state.
+func (f *FSM) enterWatchdog(state string, enteredAt time.Time) {
+	if len(f.watchdogs) == 0 {
+		return
+	}
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	if f.watchdogTimer != nil {
+		f.watchdogTimer.timer.Stop()
+		f.watchdogTimer = nil
+	}
+	w, ok := f.watchdogs[state]
+	if !ok {
+		if w, ok = f.watchdogs[AnyState]; !ok {
+			return
+		}
+	}
+	select {
+	case <-f.closed:
+		return
+	default:
+	}
+
+	if enteredAt.IsZero() {
+		enteredAt = f.clock.Now()
+	}
+	t := &stateTimer{state: state, deadline: enteredAt.Add(w.expected)}
+	t.timer = f.clock.AfterFunc(t.deadline.Sub(f.clock.Now()), func() {
+		f.fireWatchdog(t, enteredAt, w)
+	})
+	f.watchdogTimer = t
+}
+
+// fireWatchdog escalates and triggers the event of w if t is still the
+// running timer.
+func (f *FSM) fireWatchdog(t *stateTimer, enteredAt time.Time, w watchdog) {
+	f.timerMu.Lock()
+	running := f.watchdogTimer == t
+	if running {
+		f.watchdogTimer = nil
+	}
+	f.timerMu.Unlock()
+	if !running {
+		return
+	}
+	if w.Escalate != nil {
+		w.Escalate(StuckInfo{t.state, enteredAt, w.expected})
+	}
+	if w.Event != "" {
+		_ = f.EventIf(context.Background(), t.state, w.Event)
+	}
+}
+
+// stopWatchdog stops the running timer, if any.
+func (f *FSM) stopWatchdog() {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	if f.watchdogTimer != nil {
+		f.watchdogTimer.timer.Stop()
+		f.watchdogTimer = nil
+	}
+}
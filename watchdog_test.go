@@ -0,0 +1,172 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	clock := &manualClock{}
+	var stuck []StuckInfo
+	fsm := NewFSM(
+		"queued",
+		Events{
+			{Name: "start", Src: []string{"queued"}, Dst: "running"},
+			{Name: "finish", Src: []string{"running"}, Dst: "done"},
+			{Name: "stuck", Src: []string{"running"}, Dst: "stalled"},
+		},
+		Callbacks{},
+		WithClock(clock),
+		WithWatchdog("running", time.Hour, Watchdog{
+			Event: "stuck",
+			Escalate: func(info StuckInfo) {
+				stuck = append(stuck, info)
+			},
+		}),
+	)
+
+	clock.Advance(time.Minute)
+	if err := fsm.Event(context.Background(), "start"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(59 * time.Minute)
+	if len(stuck) != 0 {
+		t.Fatal("expected watchdog not to fire early")
+	}
+	clock.Advance(time.Minute)
+	if fsm.Current() != "stalled" {
+		t.Errorf("expected state to be 'stalled', got %s", fsm.Current())
+	}
+	expected := []StuckInfo{{"running", time.Time{}.Add(time.Minute), time.Hour}}
+	if !reflect.DeepEqual(stuck, expected) {
+		t.Errorf("expected %v, got %v", expected, stuck)
+	}
+}
+
+func TestWatchdogStateLeft(t *testing.T) {
+	clock := &manualClock{}
+	fired := false
+	fsm := NewFSM(
+		"queued",
+		Events{
+			{Name: "start", Src: []string{"queued"}, Dst: "running"},
+			{Name: "finish", Src: []string{"running"}, Dst: "done"},
+			{Name: "stuck", Src: []string{"running"}, Dst: "stalled"},
+		},
+		Callbacks{},
+		WithClock(clock),
+		WithWatchdog("running", time.Hour, Watchdog{
+			Escalate: func(StuckInfo) {
+				fired = true
+			},
+		}),
+	)
+	_ = fsm.Event(context.Background(), "start")
+	_ = fsm.Event(context.Background(), "finish")
+	clock.Advance(2 * time.Hour)
+	if fired {
+		t.Error("expected watchdog to be stopped when the state is left")
+	}
+}
+
+func TestWatchdogAnyState(t *testing.T) {
+	clock := &manualClock{}
+	var states []string
+	escalate := func(info StuckInfo) {
+		states = append(states, info.State)
+	}
+	fsm := NewFSM(
+		"queued",
+		Events{
+			{Name: "start", Src: []string{"queued"}, Dst: "running"},
+			{Name: "finish", Src: []string{"running"}, Dst: "done"},
+			{Name: "stuck", Src: []string{"running"}, Dst: "stalled"},
+		},
+		Callbacks{},
+		WithClock(clock),
+		WithWatchdog(AnyState, time.Hour, Watchdog{Escalate: escalate}),
+		WithWatchdog("running", 2*time.Hour, Watchdog{Escalate: escalate}),
+	)
+	clock.Advance(time.Hour)
+	_ = fsm.Event(context.Background(), "start")
+	clock.Advance(time.Hour)
+	if len(states) != 1 {
+		t.Fatalf("expected running to have its own watchdog, got %v", states)
+	}
+	clock.Advance(time.Hour)
+	if !reflect.DeepEqual(states, []string{"queued", "running"}) {
+		t.Errorf("expected watchdogs of [queued running], got %v", states)
+	}
+}
+
+func TestWatchdogRollback(t *testing.T) {
+	clock := &manualClock{}
+	fired := 0
+	fsm := NewFSM(
+		"queued",
+		Events{
+			{Name: "start", Src: []string{"queued"}, Dst: "running"},
+			{Name: "finish", Src: []string{"running"}, Dst: "done"},
+			{Name: "stuck", Src: []string{"running"}, Dst: "stalled"},
+		},
+		Callbacks{},
+		WithClock(clock),
+		WithWatchdog("running", time.Hour, Watchdog{
+			Escalate: func(StuckInfo) {
+				fired++
+			},
+		}),
+	)
+	clock.Advance(time.Minute)
+	_ = fsm.Event(context.Background(), "start")
+	clock.Advance(30 * time.Minute)
+	err := fsm.EventBatch(context.Background(), []EventRequest{{Event: "finish"}, {Event: "start"}})
+	if _, ok := err.(BatchError); !ok {
+		t.Fatalf("expected 'BatchError', got %v", err)
+	}
+	clock.Advance(30 * time.Minute)
+	if fired != 1 {
+		t.Errorf("expected restored state to keep its deadline, got %d", fired)
+	}
+}
+
+func TestWatchdogClose(t *testing.T) {
+	clock := &manualClock{}
+	fired := false
+	fsm := NewFSM(
+		"queued",
+		Events{
+			{Name: "start", Src: []string{"queued"}, Dst: "running"},
+			{Name: "finish", Src: []string{"running"}, Dst: "done"},
+			{Name: "stuck", Src: []string{"running"}, Dst: "stalled"},
+		},
+		Callbacks{},
+		WithClock(clock),
+		WithWatchdog("queued", time.Hour, Watchdog{
+			Escalate: func(StuckInfo) {
+				fired = true
+			},
+		}),
+	)
+	fsm.Close()
+	clock.Advance(time.Hour)
+	if fired {
+		t.Error("expected watchdog to be stopped when the FSM is closed")
+	}
+}